@@ -3,19 +3,33 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/waveywaves/agentrun-controller/pkg/agent"
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/approval"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	"github.com/waveywaves/agentrun-controller/pkg/pod"
 	"github.com/waveywaves/agentrun-controller/pkg/providers/claude"
+	"github.com/waveywaves/agentrun-controller/pkg/targets"
+	"github.com/waveywaves/agentrun-controller/pkg/tools/agents"
 	"github.com/waveywaves/agentrun-controller/pkg/tools/k8s"
 	"github.com/waveywaves/agentrun-controller/pkg/tools/tekton"
 	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -23,11 +37,26 @@ import (
 var (
 	goal          string
 	maxIterations int
+	maxParallel   int
 	timeout       time.Duration
 	provider      string
 	configPath    string
 	dataPath      string
 	secretsPath   string
+
+	tektonResultsDir string
+	requireApproval  []string
+	mode             string
+	dryRun           bool
+
+	previousTranscript  string
+	transcriptConfigMap string
+
+	// resultFields are the structured results declared by the AgentConfig
+	resultFields []agent.ResultField
+
+	// defaultToolLimits apply to tools the AgentConfig does not configure
+	defaultToolLimits agent.ToolLimits
 )
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -37,26 +66,76 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// envInt returns the integer value of the environment variable, or defaultValue if it is unset or invalid
+func envInt(key string, defaultValue int) int {
+	if val, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return val
+	}
+	return defaultValue
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func main() {
 	flag.StringVar(&goal, "goal", os.Getenv("AGENTRUN_GOAL"), "Goal for the agent to achieve")
-	flag.IntVar(&maxIterations, "max-iterations", 3, "Maximum iterations for plan-act-reflect loop")
+	flag.IntVar(&maxIterations, "max-iterations", envInt("AGENT_MAX_ITERATIONS", 6), "Maximum model turns of the agent loop")
+	flag.IntVar(&maxParallel, "max-parallel-tool-calls", envInt("AGENT_MAX_PARALLEL_TOOL_CALLS", 4), "Maximum calls of read-only tools run concurrently within a turn; 1 runs every call in turn")
+	flag.DurationVar(&defaultToolLimits.Timeout, "tool-timeout", 0, "Timeout of a single tool call, unless the AgentConfig sets one for the tool; 0 leaves only the run's timeout")
+	flag.IntVar(&defaultToolLimits.MaxOutputBytes, "max-tool-output-bytes", envInt("AGENT_MAX_TOOL_OUTPUT_BYTES", 32768), "Truncate longer tool output sent to the model, unless the AgentConfig sets a limit for the tool; 0 means unlimited")
 	flag.DurationVar(&timeout, "timeout", 8*time.Minute, "Timeout for agent execution")
 	flag.StringVar(&provider, "provider", getEnvOrDefault("LLM_PROVIDER", "claude"), "LLM provider (claude or gemini)")
 	flag.StringVar(&configPath, "config-path", "/workspace/config", "Path to config volume")
 	flag.StringVar(&dataPath, "data-path", "/workspace/data", "Path to data volume")
 	flag.StringVar(&secretsPath, "secrets-path", "/workspace/secrets", "Path to secrets volume")
+	flag.StringVar(&tektonResultsDir, "tekton-results-dir", "", "Write results to this directory when running as a Tekton step (e.g. "+pod.TektonResultsDir+")")
+	flag.StringVar(&mode, "mode", os.Getenv("AGENTRUN_MODE"), "Set to plan to propose mutating tool calls instead of executing them, or execute to perform the plan in AGENT_PLAN")
+	flag.StringVar(&previousTranscript, "previous-transcript", os.Getenv("AGENT_PREVIOUS_TRANSCRIPT"), "Path to the transcript of a previous run to continue; the goal is sent as a follow-up instruction")
+	flag.StringVar(&transcriptConfigMap, "transcript-configmap", os.Getenv("AGENT_TRANSCRIPT_CONFIGMAP"), "ConfigMap to save the transcript to so a later run can continue it")
+	flag.BoolVar(&dryRun, "dry-run", os.Getenv("AGENT_DRY_RUN") == "true", "Run mutating tools with server-side dry run so nothing is changed")
+	flag.Func("require-approval", "Comma-separated tools whose calls must be approved (defaults to AGENT_REQUIRE_APPROVAL env var)", func(value string) error {
+		requireApproval = splitList(value)
+		return nil
+	})
 	flag.Parse()
 
+	if requireApproval == nil {
+		requireApproval = splitList(os.Getenv("AGENT_REQUIRE_APPROVAL"))
+	}
+
 	if goal == "" {
 		log.Fatal("Goal is required (--goal or AGENTRUN_GOAL env var)")
 	}
 
+	var err error
+	if resultFields, err = loadResultFields(os.Getenv("AGENT_RESULTS")); err != nil {
+		log.Fatalf("Failed to load declared results: %v", err)
+	}
+
 	log.Printf("Agent starting with goal: %s", goal)
 	log.Printf("Max iterations: %d, Timeout: %v, Provider: %s", maxIterations, timeout, provider)
+	if dryRun {
+		log.Println("Dry run: mutating tools will not change anything")
+	}
+	if len(requireApproval) > 0 {
+		log.Printf("Tools requiring approval: %s", strings.Join(requireApproval, ", "))
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	// Stop the loop on SIGTERM (sent when the AgentRun is cancelled) so a partial result is flushed
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
 	// Load system prompt
 	systemPrompt, err := loadSystemPrompt(configPath)
 	if err != nil {
@@ -64,6 +143,16 @@ func main() {
 	}
 	log.Println("System prompt loaded")
 
+	// Load the planner and reflector prompt templates
+	planner, err := loadPromptTemplate(configPath, "planner")
+	if err != nil {
+		log.Fatalf("Failed to load planner prompt: %v", err)
+	}
+	reflector, err := loadPromptTemplate(configPath, "reflector")
+	if err != nil {
+		log.Fatalf("Failed to load reflector prompt: %v", err)
+	}
+
 	// Load OPA policy
 	policyContent, err := loadOPAPolicy(configPath)
 	if err != nil {
@@ -96,6 +185,11 @@ func main() {
 		log.Fatalf("Failed to create Tekton client: %v", err)
 	}
 
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		log.Fatalf("Failed to create dynamic client: %v", err)
+	}
+
 	// Set up tools
 	tools := map[string]agent.Tool{
 		"k8s_get_resources": &k8s.GetResources{
@@ -109,67 +203,514 @@ func main() {
 			TektonClient: tektonClient,
 			AgentRunName: os.Getenv("AGENTRUN_NAME"),
 			AgentRunUID:  types.UID(os.Getenv("AGENTRUN_UID")),
+			DryRun:       dryRun,
 		},
 	}
+
+	// Delegation to child AgentRuns is only available when the AgentConfig allows it
+	if allowedConfigs := splitList(os.Getenv("AGENT_DELEGATE_CONFIGS")); len(allowedConfigs) > 0 {
+		tools["agent_delegate"] = &agents.Delegate{
+			AgentRuns:      &client.AgentRuns{Dynamic: dynamicClient},
+			Namespace:      os.Getenv("AGENTRUN_NAMESPACE"),
+			AgentRunName:   os.Getenv("AGENTRUN_NAME"),
+			AgentRunUID:    types.UID(os.Getenv("AGENTRUN_UID")),
+			PodUID:         types.UID(os.Getenv("AGENT_POD_UID")),
+			AllowedConfigs: allowedConfigs,
+			Depth:          envInt("AGENT_DELEGATION_DEPTH", 0),
+			MaxDepth:       envInt("AGENT_DELEGATE_MAX_DEPTH", int(v1alpha1.DefaultDelegationMaxDepth)),
+			MaxChildren:    envInt("AGENT_DELEGATE_MAX_CHILDREN", int(v1alpha1.DefaultDelegationMaxChildren)),
+			DryRun:         dryRun,
+		}
+		log.Printf("Delegation allowed to AgentConfigs: %s", strings.Join(allowedConfigs, ", "))
+	}
 	log.Printf("Tools registered: %d", len(tools))
 
-	// Set up LLM provider
+	toolLimits, err := loadToolLimits(os.Getenv("AGENT_TOOLS"))
+	if err != nil {
+		log.Fatalf("Failed to load tool limits: %v", err)
+	}
+	compaction, err := loadCompaction(os.Getenv("AGENT_COMPACTION"))
+	if err != nil {
+		log.Fatalf("Failed to load compaction: %v", err)
+	}
+
+	// The hints and targets of the AgentRun are described in the first message
+	agentContext, err := loadAgentContext(os.Getenv("AGENTRUN_CONTEXT"))
+	if err != nil {
+		log.Fatalf("Failed to load AgentRun context: %v", err)
+	}
+	fetcher := &targets.Fetcher{KubeClient: kubeClient, TektonClient: tektonClient, Policy: policy}
+	runContext := fetcher.Context(ctx, agentContext)
+	if len(agentContext.Targets) > 0 {
+		log.Printf("Targets: %d", len(agentContext.Targets))
+	}
+
+	// Execute mode performs the reviewed plan without consulting the LLM
+	var plan []agent.ToolCall
 	var llmProvider agent.Provider
-	switch provider {
-	case "claude":
-		apiKey, err := loadSecret(secretsPath, "CLAUDE_API_KEY")
+	var budget agent.Budget
+	if mode == string(v1alpha1.AgentRunModeExecute) {
+		plan, err = loadPlan(os.Getenv("AGENT_PLAN"))
 		if err != nil {
-			log.Fatalf("Failed to load Claude API key: %v", err)
+			log.Fatalf("Failed to load plan: %v", err)
+		}
+		log.Printf("Executing plan with %d actions", len(plan))
+	} else {
+		// Set up LLM provider
+		switch provider {
+		case "claude":
+			apiKey, err := loadSecret(secretsPath, "CLAUDE_API_KEY")
+			if err != nil {
+				log.Fatalf("Failed to load Claude API key: %v", err)
+			}
+			claudeClient := claude.NewClient(apiKey)
+			claudeClient.Tools = append(registeredClaudeTools(tools), finishClaudeTool())
+			if len(resultFields) > 0 {
+				claudeClient.Tools = append(claudeClient.Tools, submitResultClaudeTool(resultFields))
+			}
+			llmProvider = claudeClient
+			log.Println("Claude provider initialized")
+
+			budget, err = loadBudget(os.Getenv("AGENT_BUDGET"), claudeClient.Model, claude.Prices)
+			if err != nil {
+				log.Fatalf("Failed to load budget: %v", err)
+			}
+		default:
+			log.Fatalf("Unsupported provider: %s", provider)
 		}
-		claudeClient := claude.NewClient(apiKey)
-		claudeClient.Tools = buildClaudeTools()
-		llmProvider = claudeClient
-		log.Println("Claude provider initialized")
-	default:
-		log.Fatalf("Unsupported provider: %s", provider)
 	}
 
 	// Create agent loop
 	loop := &agent.Loop{
-		Provider:      llmProvider,
-		Tools:         tools,
-		Policy:        policy,
-		SystemPrompt:  systemPrompt,
-		Goal:          goal,
-		MaxIterations: maxIterations,
+		Provider:             llmProvider,
+		Tools:                tools,
+		Policy:               policy,
+		SystemPrompt:         systemPrompt,
+		Planner:              planner,
+		Reflector:            reflector,
+		Goal:                 goal,
+		Context:              runContext,
+		MaxIterations:        maxIterations,
+		MaxParallelToolCalls: maxParallel,
+		RequireApproval:      requireApproval,
+		PlanOnly:             mode == string(v1alpha1.AgentRunModePlan),
+		DryRun:               dryRun,
+		Results:              resultFields,
+		ToolLimits:           toolLimits,
+		DefaultToolLimits:    defaultToolLimits,
+		Budget:               budget,
+		Compaction:           compaction,
+	}
+
+	// Save the run's progress so that a restarted pod resumes it instead of starting over
+	if transcriptConfigMap != "" {
+		checkpoints := &checkpointer{
+			kubeClient: kubeClient,
+			namespace:  os.Getenv("AGENTRUN_NAMESPACE"),
+			name:       transcriptConfigMap,
+		}
+		checkpoint, err := checkpoints.load(ctx)
+		if err != nil {
+			log.Fatalf("Failed to load checkpoint: %v", err)
+		}
+		if checkpoint != nil {
+			loop.Resume = checkpoint
+			log.Printf("Resuming from checkpoint after %d iterations and %d tool calls", checkpoint.Iterations, len(checkpoint.ToolCalls))
+		}
+		loop.Checkpointer = checkpoints
+	}
+
+	// A continuation resumes the previous run's conversation
+	if previousTranscript != "" {
+		history, err := loadTranscript(previousTranscript)
+		if err != nil {
+			log.Fatalf("Failed to load previous transcript: %v", err)
+		}
+		loop.History = history
+		log.Printf("Continuing previous transcript of %d messages", len(history))
+	}
+
+	// Tool calls requiring approval are recorded as AgentApprovals of the AgentRun.
+	// Without an AgentRun (e.g. as a Tekton step) nobody can approve, so they are rejected.
+	if agentRunName := os.Getenv("AGENTRUN_NAME"); agentRunName != "" {
+		loop.Approver = &approval.Approver{
+			AgentApprovals: &client.AgentApprovals{Dynamic: dynamicClient},
+			Namespace:      os.Getenv("AGENTRUN_NAMESPACE"),
+			AgentRunName:   agentRunName,
+			AgentRunUID:    types.UID(os.Getenv("AGENTRUN_UID")),
+		}
 	}
 
 	// Run agent
 	log.Println("Starting agent execution...")
-	result, err := loop.Run(ctx)
+	var result *agent.Result
+	if mode == string(v1alpha1.AgentRunModeExecute) {
+		result, err = loop.ExecutePlan(ctx, plan)
+	} else {
+		result, err = loop.Run(ctx)
+	}
+
+	// A plan that cannot be reported in full must not be executed in part
+	if err == nil && loop.PlanOnly {
+		if err = pod.CheckPlan(proposedActions(result.Plan)); err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+		}
+	}
+
+	// Declared results are never truncated, so results that cannot be reported in full fail the run
+	if err == nil && result.Status == "succeeded" {
+		if err = checkResults(result); err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+		}
+	}
+
 	if err != nil {
-		log.Printf("Agent execution failed: %v", err)
-		saveResult(dataPath, result, err)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			log.Printf("Agent execution cancelled: %v", err)
+			result.Status = "cancelled"
+		} else {
+			log.Printf("Agent execution failed: %v", err)
+		}
+		if err := saveResult(dataPath, result, err); err != nil {
+			log.Printf("Warning: Failed to save result: %v", err)
+		}
+		// A pod stopped by a signal, e.g. on eviction or a node drain, keeps its
+		// checkpoint so that the replacement pod resumes the run
+		interrupted := errors.Is(ctx.Err(), context.Canceled)
+		if err := saveTranscript(kubeClient, result.Messages, interrupted); err != nil {
+			log.Printf("Warning: Failed to save transcript: %v", err)
+		}
+		report(ctx, result, err)
 		os.Exit(1)
 	}
 
 	log.Printf("Agent execution completed: status=%s, iterations=%d", result.Status, result.Iterations)
-	log.Printf("Tool calls: %d, Tokens: in=%d out=%d", len(result.ToolCalls), result.TotalTokensIn, result.TotalTokensOut)
+	log.Printf("Tool calls: %d, Tokens: in=%d out=%d, Cost: $%.4f", len(result.ToolCalls), result.TotalTokensIn, result.TotalTokensOut, result.Cost)
+	if result.Compactions > 0 {
+		log.Printf("Conversation compacted %d times", result.Compactions)
+	}
+	if loop.PlanOnly {
+		log.Printf("Proposed actions: %d", len(result.Plan))
+	}
 
 	// Save result
 	if err := saveResult(dataPath, result, nil); err != nil {
 		log.Printf("Warning: Failed to save result: %v", err)
 	}
+	if err := saveTranscript(kubeClient, result.Messages, false); err != nil {
+		log.Printf("Warning: Failed to save transcript: %v", err)
+	}
 
+	report(ctx, result, nil)
 	if result.Status != "succeeded" {
 		os.Exit(1)
 	}
 }
 
+// report records the outcome of the run: as Tekton results when running as a
+// Tekton step, otherwise in the termination log for the controller
+func report(ctx context.Context, result *agent.Result, execError error) {
+	if tektonResultsDir != "" {
+		if err := pod.WriteTektonResults(tektonResultsDir, agentResults(result)); err != nil {
+			log.Printf("Warning: Failed to write Tekton results: %v", err)
+		}
+		return
+	}
+
+	if execError == nil && result.Status == "succeeded" {
+		reportSuccess(result)
+		return
+	}
+	reportFailure(ctx, result, execError)
+}
+
+// agentResults returns the results of a run. Only the response is truncated when
+// the results exceed the size limit.
+func agentResults(result *agent.Result) []v1alpha1.AgentResult {
+	results := []v1alpha1.AgentResult{
+		{Name: "status", Value: result.Status},
+		{Name: "iterations", Value: strconv.Itoa(result.Iterations)},
+		{Name: "tokens-in", Value: strconv.Itoa(result.TotalTokensIn)},
+		{Name: "tokens-out", Value: strconv.Itoa(result.TotalTokensOut)},
+	}
+	if simulated := simulatedActions(result); simulated != "" {
+		results = append(results, v1alpha1.AgentResult{Name: "simulated-actions", Value: simulated})
+	}
+	for _, field := range resultFields {
+		if value, ok := result.Results[field.Name]; ok {
+			results = append(results, v1alpha1.AgentResult{Name: field.Name, Value: value})
+		}
+	}
+	return append(results, v1alpha1.AgentResult{Name: "response", Value: result.FinalResponse})
+}
+
+// checkResults returns an error if the results of the run cannot be reported in full
+func checkResults(result *agent.Result) error {
+	if tektonResultsDir != "" {
+		return pod.CheckTektonResults(agentResults(result))
+	}
+	return pod.CheckResults(agentResults(result), proposedActions(result.Plan))
+}
+
+// simulatedActions lists the tool calls that ran with dry run, so a rehearsal
+// is never mistaken for real changes
+func simulatedActions(result *agent.Result) string {
+	var names []string
+	for _, call := range result.ToolCalls {
+		if call.Simulated {
+			names = append(names, call.Name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// reportSuccess writes the agent's results to the termination log so the
+// controller can record them in the AgentRun status
+func reportSuccess(result *agent.Result) {
+	msg := pod.TerminationMessage{
+		Reason:     v1alpha1.AgentRunReasonSucceeded,
+		Iterations: result.Iterations,
+		Results:    agentResults(result),
+		Plan:       proposedActions(result.Plan),
+	}
+
+	if err := pod.WriteTerminationMessage(pod.TerminationMessagePath, msg); err != nil {
+		log.Printf("Warning: Failed to write termination message: %v", err)
+	}
+}
+
+// reportFailure writes the reason for a failed run to the termination log so
+// the controller can decide whether to retry
+func reportFailure(ctx context.Context, result *agent.Result, execError error) {
+	msg := pod.TerminationMessage{
+		Reason:     v1alpha1.AgentRunReasonFailed,
+		Message:    result.Error,
+		Iterations: result.Iterations,
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		msg.Reason = v1alpha1.AgentRunReasonCancelled
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		msg.Reason = v1alpha1.AgentRunReasonTimeout
+	case errors.Is(execError, agent.ErrProviderCall):
+		msg.Reason = v1alpha1.AgentRunReasonProviderError
+	case errors.Is(execError, agent.ErrBudgetExceeded):
+		msg.Reason = v1alpha1.AgentRunReasonBudgetExceeded
+	case errors.Is(execError, pod.ErrPlanTooLarge):
+		msg.Reason = v1alpha1.AgentRunReasonPlanTooLarge
+	case errors.Is(execError, pod.ErrResultsTooLarge):
+		msg.Reason = v1alpha1.AgentRunReasonResultsTooLarge
+	case result.Status == "max_iterations":
+		msg.Reason = v1alpha1.AgentRunReasonMaxIterations
+		msg.Message = fmt.Sprintf("Goal not achieved within %d iterations", result.Iterations)
+	}
+
+	if err := pod.WriteTerminationMessage(pod.TerminationMessagePath, msg); err != nil {
+		log.Printf("Warning: Failed to write termination message: %v", err)
+	}
+}
+
+// proposedActions converts the tool calls proposed in plan mode for the AgentRun status
+func proposedActions(plan []agent.ToolCall) []v1alpha1.ProposedAction {
+	if len(plan) == 0 {
+		return nil
+	}
+
+	actions := make([]v1alpha1.ProposedAction, 0, len(plan))
+	for _, toolCall := range plan {
+		input, err := json.Marshal(toolCall.Input)
+		if err != nil {
+			input = []byte("{}")
+		}
+		actions = append(actions, v1alpha1.ProposedAction{
+			ID:    toolCall.ID,
+			Tool:  toolCall.Name,
+			Input: string(input),
+		})
+	}
+	return actions
+}
+
+// loadTranscript reads the messages saved by a previous run
+func loadTranscript(path string) ([]agent.Message, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+
+	var messages []agent.Message
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, fmt.Errorf("failed to parse transcript: %w", err)
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("transcript is empty")
+	}
+	return messages, nil
+}
+
+// saveTranscript writes the run's messages to its transcript ConfigMap, dropping
+// the oldest ones if needed to fit, and removes the run's checkpoint unless
+// keepCheckpoint is set. The run's context may already be done, so the update gets
+// its own deadline.
+func saveTranscript(kubeClient kubernetes.Interface, messages []agent.Message, keepCheckpoint bool) error {
+	if transcriptConfigMap == "" {
+		return nil
+	}
+
+	// An executed plan has no messages, but its checkpoint is still removed
+	var data []byte
+	if len(messages) > 0 {
+		messages, err := agent.TrimTranscript(messages, pod.MaxTranscriptLength)
+		if err != nil {
+			return err
+		}
+		data, err = json.Marshal(messages)
+		if err != nil {
+			return fmt.Errorf("failed to marshal transcript: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	namespace := os.Getenv("AGENTRUN_NAMESPACE")
+	cm, err := kubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, transcriptConfigMap, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get transcript ConfigMap: %w", err)
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	if data != nil {
+		cm.Data[pod.TranscriptKey] = string(data)
+	}
+	// A finished run has nothing left to resume
+	if !keepCheckpoint {
+		delete(cm.Data, pod.CheckpointKey)
+	}
+	if _, err := kubeClient.CoreV1().ConfigMaps(namespace).Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update transcript ConfigMap: %w", err)
+	}
+	return nil
+}
+
+// checkpointer saves the checkpoints of the run to its transcript ConfigMap
+type checkpointer struct {
+	kubeClient kubernetes.Interface
+	namespace  string
+	name       string
+}
+
+// load returns the checkpoint left by a previous pod of the run, or nil if there is none
+func (c *checkpointer) load(ctx context.Context) (*agent.Checkpoint, error) {
+	cm, err := c.kubeClient.CoreV1().ConfigMaps(c.namespace).Get(ctx, c.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transcript ConfigMap: %w", err)
+	}
+	data := cm.Data[pod.CheckpointKey]
+	if data == "" {
+		return nil, nil
+	}
+
+	var checkpoint agent.Checkpoint
+	if err := json.Unmarshal([]byte(data), &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	return &checkpoint, nil
+}
+
+// Save writes the checkpoint to the ConfigMap. Failures are logged: the run goes on,
+// but a restart would resume it from an older checkpoint.
+func (c *checkpointer) Save(ctx context.Context, checkpoint *agent.Checkpoint) {
+	if err := c.save(ctx, checkpoint); err != nil {
+		log.Printf("Warning: Failed to save checkpoint: %v", err)
+	}
+}
+
+func (c *checkpointer) save(ctx context.Context, checkpoint *agent.Checkpoint) error {
+	data, err := agent.MarshalCheckpoint(checkpoint, pod.MaxCheckpointLength)
+	if err != nil {
+		return err
+	}
+
+	cm, err := c.kubeClient.CoreV1().ConfigMaps(c.namespace).Get(ctx, c.name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get transcript ConfigMap: %w", err)
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[pod.CheckpointKey] = string(data)
+	if _, err := c.kubeClient.CoreV1().ConfigMaps(c.namespace).Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update transcript ConfigMap: %w", err)
+	}
+	return nil
+}
+
+// loadPlan parses the proposed actions passed to an execute-mode agent
+func loadPlan(data string) ([]agent.ToolCall, error) {
+	if data == "" {
+		return nil, fmt.Errorf("no plan provided")
+	}
+
+	var actions []v1alpha1.ProposedAction
+	if err := json.Unmarshal([]byte(data), &actions); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %w", err)
+	}
+
+	plan := make([]agent.ToolCall, 0, len(actions))
+	for i, action := range actions {
+		input := map[string]interface{}{}
+		if action.Input != "" {
+			if err := json.Unmarshal([]byte(action.Input), &input); err != nil {
+				return nil, fmt.Errorf("failed to parse input of action %d: %w", i, err)
+			}
+		}
+		plan = append(plan, agent.ToolCall{
+			ID:    action.ID,
+			Name:  action.Tool,
+			Input: input,
+		})
+	}
+	return plan, nil
+}
+
 func loadSystemPrompt(configPath string) (string, error) {
 	path := filepath.Join(configPath, "prompts", "system.txt")
 	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Tekton steps may run without a config workspace
+		log.Printf("No system prompt found at %s, using default system prompt", path)
+		return defaultSystemPrompt, nil
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to read system prompt: %w", err)
 	}
 	return string(data), nil
 }
 
+// loadPromptTemplate parses prompts/<name>.txt as a Go template rendered with agent.PromptData.
+// It returns nil if the file does not exist, so the loop's built-in behaviour is used.
+func loadPromptTemplate(configPath, name string) (*template.Template, error) {
+	path := filepath.Join(configPath, "prompts", name+".txt")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("No %s prompt found at %s, using the default", name, path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s prompt: %w", name, err)
+	}
+	return agent.ParsePromptTemplate(name, string(data))
+}
+
+const defaultSystemPrompt = `You are an intelligent Kubernetes agent that helps users operate their cluster and Tekton Pipelines.
+Use the available tools to gather information before acting, and only take the actions needed to achieve the goal.
+Be concise. When the goal is achieved, call the finish tool with a short summary of what you found or did.`
+
 func loadOPAPolicy(configPath string) (string, error) {
 	// Try to load policy from guardrails directory
 	path := filepath.Join(configPath, "guardrails", "policy.rego")
@@ -194,6 +735,167 @@ func loadSecret(secretsPath, key string) (string, error) {
 	return string(data), nil
 }
 
+// loadResultFields parses the results declared by the AgentConfig, if any
+func loadResultFields(data string) ([]agent.ResultField, error) {
+	if data == "" {
+		return nil, nil
+	}
+
+	var fields []agent.ResultField
+	if err := json.Unmarshal([]byte(data), &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse results: %w", err)
+	}
+	return fields, nil
+}
+
+// loadToolLimits parses the tool limits of the AgentConfig from AGENT_TOOLS
+func loadToolLimits(data string) (map[string]agent.ToolLimits, error) {
+	if data == "" {
+		return nil, nil
+	}
+
+	var specs []v1alpha1.ToolSpec
+	if err := json.Unmarshal([]byte(data), &specs); err != nil {
+		return nil, fmt.Errorf("failed to parse tools: %w", err)
+	}
+	limits := make(map[string]agent.ToolLimits, len(specs))
+	for _, spec := range specs {
+		l := agent.ToolLimits{
+			Retries:        int(spec.Retries),
+			MaxOutputBytes: int(spec.MaxOutputBytes),
+		}
+		if spec.Timeout != nil {
+			l.Timeout = spec.Timeout.Duration
+		}
+		limits[spec.Name] = l
+	}
+	return limits, nil
+}
+
+// loadBudget parses the budget of the AgentConfig from AGENT_BUDGET. The price of the
+// model comes from the budget's prices or the provider's list prices, so the cost of
+// a run is tracked even without a budget.
+func loadBudget(data, model string, listPrices map[string]agent.ModelPrice) (agent.Budget, error) {
+	var budget agent.Budget
+	if price, ok := listPrices[model]; ok {
+		budget.Price = &price
+	}
+	if data == "" {
+		return budget, nil
+	}
+
+	var spec v1alpha1.BudgetSpec
+	if err := json.Unmarshal([]byte(data), &spec); err != nil {
+		return budget, fmt.Errorf("failed to parse budget: %w", err)
+	}
+	budget.MaxInputTokens = int(spec.MaxInputTokens)
+	budget.MaxOutputTokens = int(spec.MaxOutputTokens)
+
+	for _, price := range spec.Prices {
+		if price.Model != model {
+			continue
+		}
+		in, err := strconv.ParseFloat(price.InputPerMillion, 64)
+		if err != nil {
+			return budget, fmt.Errorf("invalid input price of model %s: %w", model, err)
+		}
+		out, err := strconv.ParseFloat(price.OutputPerMillion, 64)
+		if err != nil {
+			return budget, fmt.Errorf("invalid output price of model %s: %w", model, err)
+		}
+		budget.Price = &agent.ModelPrice{InputPerMillion: in, OutputPerMillion: out}
+	}
+
+	if spec.MaxCost != "" {
+		maxCost, err := strconv.ParseFloat(spec.MaxCost, 64)
+		if err != nil {
+			return budget, fmt.Errorf("invalid maxCost: %w", err)
+		}
+		// Fail closed rather than run without the cost ceiling
+		if budget.Price == nil {
+			return budget, fmt.Errorf("maxCost is set but the price of model %s is unknown; add it to budget.prices", model)
+		}
+		budget.MaxCost = maxCost
+	}
+	return budget, nil
+}
+
+// loadCompaction parses the compaction of the AgentConfig from AGENT_COMPACTION.
+// Long conversations are compacted by default, since the provider rejects
+// conversations that exceed the model's context window.
+func loadCompaction(data string) (agent.Compaction, error) {
+	compaction := agent.Compaction{
+		MaxTokens: v1alpha1.DefaultMaxContextTokens,
+		KeepTurns: v1alpha1.DefaultKeepTurns,
+	}
+	if data == "" {
+		return compaction, nil
+	}
+
+	var spec v1alpha1.CompactionSpec
+	if err := json.Unmarshal([]byte(data), &spec); err != nil {
+		return compaction, fmt.Errorf("failed to parse compaction: %w", err)
+	}
+	if spec.MaxContextTokens > 0 {
+		compaction.MaxTokens = int(spec.MaxContextTokens)
+	}
+	if spec.KeepTurns > 0 {
+		compaction.KeepTurns = int(spec.KeepTurns)
+	}
+	compaction.Summarize = spec.Summarize
+	return compaction, nil
+}
+
+// loadAgentContext parses the hints and targets of the AgentRun from AGENTRUN_CONTEXT
+func loadAgentContext(data string) (v1alpha1.AgentContext, error) {
+	var agentContext v1alpha1.AgentContext
+	if data == "" {
+		return agentContext, nil
+	}
+	if err := json.Unmarshal([]byte(data), &agentContext); err != nil {
+		return agentContext, fmt.Errorf("failed to parse context: %w", err)
+	}
+	return agentContext, nil
+}
+
+// finishClaudeTool returns the Claude definition of the finish tool, which ends the run
+func finishClaudeTool() claude.Tool {
+	return claude.Tool{
+		Name:        agent.FinishTool,
+		Description: "Finish the run once the goal is achieved or cannot be achieved. Other tool calls in the same turn still run first.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"summary": map[string]interface{}{
+					"type":        "string",
+					"description": "Short summary of what you found or did; it becomes the final response",
+				},
+			},
+			"required": []string{"summary"},
+		},
+	}
+}
+
+// submitResultClaudeTool returns the Claude definition of the submit_result tool for the declared results
+func submitResultClaudeTool(fields []agent.ResultField) claude.Tool {
+	return claude.Tool{
+		Name:        agent.SubmitResultTool,
+		Description: "Submit the structured results of the goal with a value for every result. A valid submission finishes the run; fix and resubmit a rejected one.",
+		InputSchema: agent.SubmitResultSchema(fields),
+	}
+}
+
+// registeredClaudeTools returns the Claude definitions of the registered tools
+func registeredClaudeTools(tools map[string]agent.Tool) []claude.Tool {
+	var defs []claude.Tool
+	for _, def := range buildClaudeTools() {
+		if _, ok := tools[def.Name]; ok {
+			defs = append(defs, def)
+		}
+	}
+	return defs
+}
+
 func buildClaudeTools() []claude.Tool {
 	return []claude.Tool{
 		{
@@ -299,10 +1001,37 @@ func buildClaudeTools() []claude.Tool {
 				"required": []string{"namespace", "name", "pipelineName"},
 			},
 		},
+		{
+			Name:        "agent_delegate",
+			Description: "Delegate sub-goals to child agents and wait for their final responses. Use goals to split independent investigations, e.g. one per namespace: the children run at the same time.",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"goal": map[string]interface{}{
+						"type":        "string",
+						"description": "Self-contained goal for a child agent; it does not see this conversation",
+					},
+					"goals": map[string]interface{}{
+						"type":        "array",
+						"description": "Self-contained goals, one child agent each, used instead of goal",
+						"items":       map[string]interface{}{"type": "string"},
+					},
+					"config": map[string]interface{}{
+						"type":        "string",
+						"description": "AgentConfig for the child agents (optional, defaults to the first allowed one)",
+					},
+				},
+			},
+		},
 	}
 }
 
 func saveResult(dataPath string, result *agent.Result, execError error) error {
+	// Tekton steps without an output workspace have nowhere to save the full result
+	if dataPath == "" {
+		return nil
+	}
+
 	output := map[string]interface{}{
 		"status":      result.Status,
 		"iterations":  result.Iterations,
@@ -311,6 +1040,18 @@ func saveResult(dataPath string, result *agent.Result, execError error) error {
 		"tokensOut":   result.TotalTokensOut,
 		"response":    result.FinalResponse,
 	}
+	if len(result.Plan) > 0 {
+		output["plan"] = result.Plan
+	}
+	if len(result.Results) > 0 {
+		output["results"] = result.Results
+	}
+	if result.Cost > 0 {
+		output["cost"] = result.Cost
+	}
+	if dryRun {
+		output["dryRun"] = true
+	}
 	if execError != nil {
 		output["error"] = execError.Error()
 	}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/waveywaves/agentrun-controller/pkg/agent"
+	"github.com/waveywaves/agentrun-controller/pkg/pod"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSaveTranscript_Checkpoint(t *testing.T) {
+	tests := []struct {
+		name           string
+		keepCheckpoint bool
+	}{
+		{name: "finished run", keepCheckpoint: false},
+		{name: "interrupted by SIGTERM", keepCheckpoint: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transcriptConfigMap = "triage-transcript"
+			t.Cleanup(func() { transcriptConfigMap = "" })
+			t.Setenv("AGENTRUN_NAMESPACE", "default")
+
+			kubeClient := fake.NewSimpleClientset(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "triage-transcript", Namespace: "default"},
+				Data:       map[string]string{pod.CheckpointKey: `{"iterations":2}`},
+			})
+			messages := []agent.Message{{Role: "user", Content: "Find why the build failed"}}
+			if err := saveTranscript(kubeClient, messages, tt.keepCheckpoint); err != nil {
+				t.Fatalf("saveTranscript() error = %v", err)
+			}
+
+			cm, err := kubeClient.CoreV1().ConfigMaps("default").Get(context.Background(), "triage-transcript", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get transcript ConfigMap: %v", err)
+			}
+			if cm.Data[pod.TranscriptKey] == "" {
+				t.Error("transcript was not saved")
+			}
+			if _, ok := cm.Data[pod.CheckpointKey]; ok != tt.keepCheckpoint {
+				t.Errorf("checkpoint kept = %v, want %v", ok, tt.keepCheckpoint)
+			}
+		})
+	}
+}
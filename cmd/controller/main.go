@@ -8,13 +8,23 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // AgentSchedule time zones must resolve in distroless images
 
+	tektonv1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
 	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	"github.com/waveywaves/agentrun-controller/pkg/pod"
+	"github.com/waveywaves/agentrun-controller/pkg/reconciler/agentapproval"
 	"github.com/waveywaves/agentrun-controller/pkg/reconciler/agentrun"
+	"github.com/waveywaves/agentrun-controller/pkg/reconciler/agentschedule"
+	"github.com/waveywaves/agentrun-controller/pkg/reconciler/agenttrigger"
+	"github.com/waveywaves/agentrun-controller/pkg/reconciler/agentworkflow"
+	"github.com/waveywaves/agentrun-controller/pkg/reconciler/customrun"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
@@ -25,15 +35,17 @@ import (
 )
 
 var (
-	masterURL  string
-	kubeconfig string
-	image      string
+	masterURL                     string
+	kubeconfig                    string
+	image                         string
+	maxConcurrentRunsPerNamespace int
 )
 
 func main() {
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to kubeconfig file (optional, defaults to in-cluster config)")
 	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server (optional)")
 	flag.StringVar(&image, "agent-image", "ko://github.com/waveywaves/agentrun-controller/cmd/agent", "Agent runtime image")
+	flag.IntVar(&maxConcurrentRunsPerNamespace, "namespace-max-concurrent-runs", 0, "Default maximum number of AgentRuns running at once per namespace (0 means unlimited); the agent.tekton.dev/max-concurrent-runs namespace annotation overrides it")
 	flag.Parse()
 
 	// Set up signal handling
@@ -60,6 +72,12 @@ func main() {
 		log.Fatalf("Error building kubernetes client: %v", err)
 	}
 
+	// Create Tekton client for managing PipelineRuns created by agents
+	tektonClient, err := tektonclient.NewForConfig(cfg)
+	if err != nil {
+		log.Fatalf("Error building tekton client: %v", err)
+	}
+
 	// Create dynamic client for AgentRun CRDs
 	dynamicClient, err := dynamic.NewForConfig(cfg)
 	if err != nil {
@@ -71,26 +89,40 @@ func main() {
 		log.Fatalf("Error adding types to scheme: %v", err)
 	}
 
-	// GVR for AgentRun
-	agentRunGVR := schema.GroupVersionResource{
-		Group:    "agent.tekton.dev",
-		Version:  "v1alpha1",
-		Resource: "agentruns",
+	// Create reconciler
+	reconciler := &agentrun.Reconciler{
+		KubeClient:                    kubeClient,
+		TektonClient:                  tektonClient,
+		Image:                         image,
+		MaxConcurrentRunsPerNamespace: int32(maxConcurrentRunsPerNamespace),
 	}
+	log.Printf("Reconciler initialized with image: %s", reconciler.Image)
 
-	// GVR for AgentConfig
-	agentConfigGVR := schema.GroupVersionResource{
-		Group:    "agent.tekton.dev",
-		Version:  "v1alpha1",
-		Resource: "agentconfigs",
+	// Create AgentApproval reconciler
+	approvalReconciler := &agentapproval.Reconciler{
+		AgentRuns: &client.AgentRuns{Dynamic: dynamicClient},
 	}
 
-	// Create reconciler
-	reconciler := &agentrun.Reconciler{
-		KubeClient: kubeClient,
-		Image:      image,
+	// Create AgentSchedule reconciler
+	scheduleReconciler := &agentschedule.Reconciler{
+		AgentRuns: &client.AgentRuns{Dynamic: dynamicClient},
+	}
+
+	// Create AgentTrigger reconciler
+	triggerReconciler := &agenttrigger.Reconciler{
+		AgentRuns:    &client.AgentRuns{Dynamic: dynamicClient},
+		TektonClient: tektonClient,
+	}
+
+	// Create AgentWorkflow reconciler
+	workflowReconciler := &agentworkflow.Reconciler{
+		AgentRuns: &client.AgentRuns{Dynamic: dynamicClient},
+	}
+
+	// Create CustomRun reconciler for Pipeline tasks that reference kind AgentRun
+	customRunReconciler := &customrun.Reconciler{
+		AgentRuns: &client.AgentRuns{Dynamic: dynamicClient},
 	}
-	log.Printf("Reconciler initialized with image: %s", reconciler.Image)
 
 	// Create informer factory
 	informerFactory := informers.NewSharedInformerFactory(kubeClient, 30*time.Second)
@@ -118,6 +150,9 @@ func main() {
 	log.Printf("AgentRun Controller started (agent image: %s)", image)
 	log.Println("Watching for AgentRun resources...")
 
+	// Garbage collect finished AgentRuns past their TTL
+	go runGarbageCollector(ctx, dynamicClient)
+
 	// Run reconciliation loop
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
@@ -128,24 +163,104 @@ func main() {
 			log.Println("Context cancelled, shutting down")
 			return
 		case <-ticker.C:
+			// Each resource type is reconciled even when another cannot be listed,
+			// e.g. because its CRD is not installed or RBAC does not allow it
+
+			// Reconcile AgentApprovals first so AgentRuns see their latest decisions.
+			// Without them, the approval gates of AgentRuns stay pending.
+			approvals := []*v1alpha1.AgentApproval{}
+			agentApprovals, err := dynamicClient.Resource(client.AgentApprovalGVR).Namespace("").List(ctx, metav1.ListOptions{})
+			if err != nil {
+				log.Printf("Error listing AgentApprovals: %v", err)
+			} else {
+				for _, item := range agentApprovals.Items {
+					approval, err := reconcileAgentApproval(ctx, approvalReconciler, dynamicClient, &item)
+					if err != nil {
+						log.Printf("Error reconciling AgentApproval %s/%s: %v", item.GetNamespace(), item.GetName(), err)
+					}
+					if approval != nil {
+						approvals = append(approvals, approval)
+					}
+				}
+			}
+			reconciler.AgentApprovals = approvals
+
 			// List all AgentRuns
-			agentRuns, err := dynamicClient.Resource(agentRunGVR).Namespace("").List(ctx, metav1.ListOptions{})
+			agentRuns, err := dynamicClient.Resource(client.AgentRunGVR).Namespace("").List(ctx, metav1.ListOptions{})
 			if err != nil {
 				log.Printf("Error listing AgentRuns: %v", err)
-				continue
+			} else {
+				// Snapshot all AgentRuns so queued runs are admitted in creation order
+				snapshot := make([]*v1alpha1.AgentRun, 0, len(agentRuns.Items))
+				for _, item := range agentRuns.Items {
+					var ar v1alpha1.AgentRun
+					if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &ar); err != nil {
+						continue
+					}
+					snapshot = append(snapshot, &ar)
+				}
+				reconciler.AgentRuns = snapshot
+
+				// Reconcile each AgentRun
+				for _, item := range agentRuns.Items {
+					if err := reconcileAgentRun(ctx, reconciler, dynamicClient, &item); err != nil {
+						log.Printf("Error reconciling AgentRun %s/%s: %v", item.GetNamespace(), item.GetName(), err)
+					}
+				}
 			}
 
-			// Reconcile each AgentRun
-			for _, item := range agentRuns.Items {
-				if err := reconcileAgentRun(ctx, reconciler, dynamicClient, agentRunGVR, agentConfigGVR, &item); err != nil {
-					log.Printf("Error reconciling AgentRun %s/%s: %v", item.GetNamespace(), item.GetName(), err)
+			// Start the AgentRuns of workflow steps whose dependencies have succeeded
+			agentWorkflows, err := dynamicClient.Resource(client.AgentWorkflowGVR).Namespace("").List(ctx, metav1.ListOptions{})
+			if err != nil {
+				log.Printf("Error listing AgentWorkflows: %v", err)
+			} else {
+				for _, item := range agentWorkflows.Items {
+					if err := reconcileAgentWorkflow(ctx, workflowReconciler, dynamicClient, &item); err != nil {
+						log.Printf("Error reconciling AgentWorkflow %s/%s: %v", item.GetNamespace(), item.GetName(), err)
+					}
+				}
+			}
+
+			// Create AgentRuns for due AgentSchedules
+			agentSchedules, err := dynamicClient.Resource(client.AgentScheduleGVR).Namespace("").List(ctx, metav1.ListOptions{})
+			if err != nil {
+				log.Printf("Error listing AgentSchedules: %v", err)
+			} else {
+				for _, item := range agentSchedules.Items {
+					if err := reconcileAgentSchedule(ctx, scheduleReconciler, dynamicClient, &item); err != nil {
+						log.Printf("Error reconciling AgentSchedule %s/%s: %v", item.GetNamespace(), item.GetName(), err)
+					}
+				}
+			}
+
+			// Create AgentRuns for failed PipelineRuns and TaskRuns
+			agentTriggers, err := dynamicClient.Resource(client.AgentTriggerGVR).Namespace("").List(ctx, metav1.ListOptions{})
+			if err != nil {
+				log.Printf("Error listing AgentTriggers: %v", err)
+			} else {
+				for _, item := range agentTriggers.Items {
+					if err := reconcileAgentTrigger(ctx, triggerReconciler, dynamicClient, &item); err != nil {
+						log.Printf("Error reconciling AgentTrigger %s/%s: %v", item.GetNamespace(), item.GetName(), err)
+					}
+				}
+			}
+
+			// Run AgentRuns for CustomRuns created by Pipelines
+			customRuns, err := tektonClient.TektonV1beta1().CustomRuns("").List(ctx, metav1.ListOptions{})
+			if err != nil {
+				log.Printf("Error listing CustomRuns: %v", err)
+			} else {
+				for i := range customRuns.Items {
+					if err := reconcileCustomRun(ctx, customRunReconciler, tektonClient, &customRuns.Items[i]); err != nil {
+						log.Printf("Error reconciling CustomRun %s/%s: %v", customRuns.Items[i].Namespace, customRuns.Items[i].Name, err)
+					}
 				}
 			}
 		}
 	}
 }
 
-func reconcileAgentRun(ctx context.Context, reconciler *agentrun.Reconciler, dynamicClient dynamic.Interface, agentRunGVR, agentConfigGVR schema.GroupVersionResource, unstr *unstructured.Unstructured) error {
+func reconcileAgentRun(ctx context.Context, reconciler *agentrun.Reconciler, dynamicClient dynamic.Interface, unstr *unstructured.Unstructured) error {
 	// Convert unstructured to AgentRun
 	var ar v1alpha1.AgentRun
 	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstr.Object, &ar); err != nil {
@@ -163,22 +278,33 @@ func reconcileAgentRun(ctx context.Context, reconciler *agentrun.Reconciler, dyn
 	}
 
 	// Get AgentConfig
-	agentConfigUnstr, err := dynamicClient.Resource(agentConfigGVR).Namespace(ar.Namespace).Get(ctx, ar.Spec.ConfigRef.Name, metav1.GetOptions{})
+	agentConfig, err := getAgentConfig(ctx, dynamicClient, ar.Namespace, ar.Spec.ConfigRef.Name)
 	if err != nil {
 		log.Printf("Failed to get AgentConfig %s/%s: %v", ar.Namespace, ar.Spec.ConfigRef.Name, err)
 		return err
 	}
 
-	var agentConfig v1alpha1.AgentConfig
-	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(agentConfigUnstr.Object, &agentConfig); err != nil {
-		return err
-	}
-
 	// Store in reconciler's map (temporary solution)
 	if reconciler.AgentConfigs == nil {
 		reconciler.AgentConfigs = make(map[string]*v1alpha1.AgentConfig)
 	}
-	reconciler.AgentConfigs[agentConfig.Name] = &agentConfig
+	reconciler.AgentConfigs[agentConfig.Name] = agentConfig
+
+	// Child AgentRuns are checked against the delegation limits of their parent's AgentConfig
+	if parentName := pod.ParentAgentRunName(&ar); parentName != "" && !ar.HasStarted() {
+		for _, parent := range reconciler.AgentRuns {
+			if parent.Namespace != ar.Namespace || parent.Name != parentName {
+				continue
+			}
+			parentConfig, err := getAgentConfig(ctx, dynamicClient, parent.Namespace, parent.Spec.ConfigRef.Name)
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			if parentConfig != nil {
+				reconciler.AgentConfigs[parentConfig.Name] = parentConfig
+			}
+		}
+	}
 
 	// Reconcile
 	if err := reconciler.Reconcile(ctx, &ar); err != nil {
@@ -194,7 +320,7 @@ func reconcileAgentRun(ctx context.Context, reconciler *agentrun.Reconciler, dyn
 
 	// Update status subresource
 	unstr.Object["status"] = arUnstr["status"]
-	_, err = dynamicClient.Resource(agentRunGVR).Namespace(ar.Namespace).UpdateStatus(ctx, unstr, metav1.UpdateOptions{})
+	_, err = dynamicClient.Resource(client.AgentRunGVR).Namespace(ar.Namespace).UpdateStatus(ctx, unstr, metav1.UpdateOptions{})
 	if err != nil {
 		log.Printf("Failed to update status for %s/%s: %v", ar.Namespace, ar.Name, err)
 		return err
@@ -204,6 +330,209 @@ func reconcileAgentRun(ctx context.Context, reconciler *agentrun.Reconciler, dyn
 	return nil
 }
 
+// getAgentConfig returns the named AgentConfig
+func getAgentConfig(ctx context.Context, dynamicClient dynamic.Interface, namespace, name string) (*v1alpha1.AgentConfig, error) {
+	unstr, err := dynamicClient.Resource(client.AgentConfigGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var agentConfig v1alpha1.AgentConfig
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstr.Object, &agentConfig); err != nil {
+		return nil, err
+	}
+	return &agentConfig, nil
+}
+
+func reconcileAgentApproval(ctx context.Context, reconciler *agentapproval.Reconciler, dynamicClient dynamic.Interface, unstr *unstructured.Unstructured) (*v1alpha1.AgentApproval, error) {
+	var approval v1alpha1.AgentApproval
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstr.Object, &approval); err != nil {
+		return nil, err
+	}
+
+	// Decided approvals only need their decision time recorded once
+	if approval.IsDecided() && approval.Status.DecisionTime != nil {
+		return &approval, nil
+	}
+
+	if err := reconciler.Reconcile(ctx, &approval); err != nil {
+		return &approval, err
+	}
+
+	approvalUnstr, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&approval)
+	if err != nil {
+		return &approval, err
+	}
+
+	// Update status subresource
+	unstr.Object["status"] = approvalUnstr["status"]
+	_, err = dynamicClient.Resource(client.AgentApprovalGVR).Namespace(approval.Namespace).UpdateStatus(ctx, unstr, metav1.UpdateOptions{})
+	return &approval, err
+}
+
+func reconcileAgentSchedule(ctx context.Context, reconciler *agentschedule.Reconciler, dynamicClient dynamic.Interface, unstr *unstructured.Unstructured) error {
+	var as v1alpha1.AgentSchedule
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstr.Object, &as); err != nil {
+		return err
+	}
+
+	if err := reconciler.Reconcile(ctx, &as); err != nil {
+		return err
+	}
+
+	asUnstr, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&as)
+	if err != nil {
+		return err
+	}
+
+	// Update status subresource
+	unstr.Object["status"] = asUnstr["status"]
+	_, err = dynamicClient.Resource(client.AgentScheduleGVR).Namespace(as.Namespace).UpdateStatus(ctx, unstr, metav1.UpdateOptions{})
+	return err
+}
+
+func reconcileAgentTrigger(ctx context.Context, reconciler *agenttrigger.Reconciler, dynamicClient dynamic.Interface, unstr *unstructured.Unstructured) error {
+	var at v1alpha1.AgentTrigger
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstr.Object, &at); err != nil {
+		return err
+	}
+
+	if err := reconciler.Reconcile(ctx, &at); err != nil {
+		return err
+	}
+
+	atUnstr, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&at)
+	if err != nil {
+		return err
+	}
+
+	// Update status subresource
+	unstr.Object["status"] = atUnstr["status"]
+	_, err = dynamicClient.Resource(client.AgentTriggerGVR).Namespace(at.Namespace).UpdateStatus(ctx, unstr, metav1.UpdateOptions{})
+	return err
+}
+
+func reconcileAgentWorkflow(ctx context.Context, reconciler *agentworkflow.Reconciler, dynamicClient dynamic.Interface, unstr *unstructured.Unstructured) error {
+	var aw v1alpha1.AgentWorkflow
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstr.Object, &aw); err != nil {
+		return err
+	}
+
+	// Finished workflows need no status update
+	if aw.IsDone() {
+		return nil
+	}
+
+	if err := reconciler.Reconcile(ctx, &aw); err != nil {
+		return err
+	}
+
+	awUnstr, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&aw)
+	if err != nil {
+		return err
+	}
+
+	// Update status subresource
+	unstr.Object["status"] = awUnstr["status"]
+	_, err = dynamicClient.Resource(client.AgentWorkflowGVR).Namespace(aw.Namespace).UpdateStatus(ctx, unstr, metav1.UpdateOptions{})
+	return err
+}
+
+func reconcileCustomRun(ctx context.Context, reconciler *customrun.Reconciler, tektonClient tektonclient.Interface, cr *tektonv1beta1.CustomRun) error {
+	// Skip other custom tasks and finished runs
+	if !customrun.IsAgentRunCustomRun(cr) || cr.IsDone() {
+		return nil
+	}
+
+	if err := reconciler.Reconcile(ctx, cr); err != nil {
+		return err
+	}
+
+	// Update status subresource
+	_, err := tektonClient.TektonV1beta1().CustomRuns(cr.Namespace).UpdateStatus(ctx, cr, metav1.UpdateOptions{})
+	return err
+}
+
+func runGarbageCollector(ctx context.Context, dynamicClient dynamic.Interface) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			agentRuns, err := dynamicClient.Resource(client.AgentRunGVR).Namespace("").List(ctx, metav1.ListOptions{})
+			if err != nil {
+				log.Printf("Error listing AgentRuns for garbage collection: %v", err)
+				continue
+			}
+
+			for _, item := range agentRuns.Items {
+				if err := collectAgentRun(ctx, dynamicClient, &item); err != nil {
+					log.Printf("Error garbage collecting AgentRun %s/%s: %v", item.GetNamespace(), item.GetName(), err)
+				}
+			}
+		}
+	}
+}
+
+func collectAgentRun(ctx context.Context, dynamicClient dynamic.Interface, unstr *unstructured.Unstructured) error {
+	var ar v1alpha1.AgentRun
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstr.Object, &ar); err != nil {
+		return err
+	}
+
+	if !ar.IsDone() {
+		return nil
+	}
+
+	// Steps of an unfinished AgentWorkflow are kept until the workflow is done
+	if owner := metav1.GetControllerOf(&ar); owner != nil && owner.Kind == "AgentWorkflow" {
+		workflowUnstr, err := dynamicClient.Resource(client.AgentWorkflowGVR).Namespace(ar.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err == nil {
+			var aw v1alpha1.AgentWorkflow
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(workflowUnstr.Object, &aw); err != nil {
+				return err
+			}
+			if aw.UID == owner.UID && !aw.IsDone() {
+				return nil
+			}
+		} else if !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	// The AgentConfig may have been deleted; fall back to the AgentRun's own TTL
+	var agentConfig *v1alpha1.AgentConfig
+	agentConfigUnstr, err := dynamicClient.Resource(client.AgentConfigGVR).Namespace(ar.Namespace).Get(ctx, ar.Spec.ConfigRef.Name, metav1.GetOptions{})
+	if err == nil {
+		agentConfig = &v1alpha1.AgentConfig{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(agentConfigUnstr.Object, agentConfig); err != nil {
+			return err
+		}
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	if !agentrun.IsExpired(&ar, agentConfig, time.Now()) {
+		return nil
+	}
+
+	// Owner references on the pod, Role and RoleBinding cascade the deletion
+	propagation := metav1.DeletePropagationBackground
+	err = dynamicClient.Resource(client.AgentRunGVR).Namespace(ar.Namespace).Delete(ctx, ar.Name, metav1.DeleteOptions{
+		Preconditions:     &metav1.Preconditions{UID: &ar.UID},
+		PropagationPolicy: &propagation,
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	log.Printf("Deleted AgentRun %s/%s after TTL expired", ar.Namespace, ar.Name)
+	return nil
+}
+
 func buildConfig(kubeconfig, masterURL string) (*rest.Config, error) {
 	if kubeconfig != "" {
 		return clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
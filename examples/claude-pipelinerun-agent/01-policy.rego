@@ -34,3 +34,17 @@ deny[msg] {
     not input.pipelineName
     msg := "pipelineName is required"
 }
+
+# Require a human to approve PipelineRuns that deploy to production
+require_approval {
+    input.tool == "tekton_create_pipelinerun"
+    some i
+    input.params[i].name == "namespace"
+    input.params[i].value == "production"
+}
+
+# Allow delegating investigations to the investigator config only
+allow {
+    input.tool == "agent_delegate"
+    input.config == "investigator-agent-config"
+}
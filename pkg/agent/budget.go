@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrBudgetExceeded is returned by Loop.Run when a run uses more tokens or costs more than its budget
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+}
+
+// Cost returns the cost of the tokens in USD
+func (p ModelPrice) Cost(tokensIn, tokensOut int) float64 {
+	return (float64(tokensIn)*p.InputPerMillion + float64(tokensOut)*p.OutputPerMillion) / 1e6
+}
+
+// Budget caps the tokens and cost of a run. Zero limits are unlimited.
+type Budget struct {
+	MaxInputTokens  int
+	MaxOutputTokens int
+	// MaxCost caps the cost in USD computed with Price
+	MaxCost float64
+	// Price of the model; the cost of a run is not tracked when it is nil
+	Price *ModelPrice
+}
+
+// checkBudget records the cost of the run so far and ends the run if it exceeds its budget
+func (l *Loop) checkBudget(result *Result) error {
+	b := l.Budget
+	if b.Price != nil {
+		result.Cost = b.Price.Cost(result.TotalTokensIn, result.TotalTokensOut)
+	}
+
+	var exceeded string
+	switch {
+	case b.MaxInputTokens > 0 && result.TotalTokensIn > b.MaxInputTokens:
+		exceeded = fmt.Sprintf("used %d input tokens, budget is %d", result.TotalTokensIn, b.MaxInputTokens)
+	case b.MaxOutputTokens > 0 && result.TotalTokensOut > b.MaxOutputTokens:
+		exceeded = fmt.Sprintf("used %d output tokens, budget is %d", result.TotalTokensOut, b.MaxOutputTokens)
+	case b.MaxCost > 0 && b.Price != nil && result.Cost > b.MaxCost:
+		exceeded = fmt.Sprintf("cost $%.4f, budget is $%.4f", result.Cost, b.MaxCost)
+	default:
+		return nil
+	}
+
+	result.Status = "failed"
+	result.Error = fmt.Sprintf("Budget exceeded after %d iterations: %s", result.Iterations, exceeded)
+	return fmt.Errorf("%w: %s", ErrBudgetExceeded, exceeded)
+}
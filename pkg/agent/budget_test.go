@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestModelPrice_Cost(t *testing.T) {
+	price := ModelPrice{InputPerMillion: 3, OutputPerMillion: 15}
+	if got := price.Cost(100000, 10000); math.Abs(got-0.45) > 1e-9 {
+		t.Errorf("Cost() = %v, want 0.45", got)
+	}
+}
+
+func TestLoop_Budget(t *testing.T) {
+	price := &ModelPrice{InputPerMillion: 3, OutputPerMillion: 15}
+
+	tests := []struct {
+		name           string
+		budget         Budget
+		wantIterations int
+		wantErr        string
+	}{
+		{
+			name:           "within budget",
+			budget:         Budget{MaxInputTokens: 50000, MaxOutputTokens: 5000, MaxCost: 1, Price: price},
+			wantIterations: 2,
+		},
+		{
+			name:           "input tokens",
+			budget:         Budget{MaxInputTokens: 15000},
+			wantIterations: 2,
+			wantErr:        "used 30000 input tokens, budget is 15000",
+		},
+		{
+			name:           "output tokens",
+			budget:         Budget{MaxOutputTokens: 1000},
+			wantIterations: 1,
+			wantErr:        "used 2000 output tokens, budget is 1000",
+		},
+		{
+			name:           "cost",
+			budget:         Budget{MaxCost: 0.1, Price: price},
+			wantIterations: 2,
+			wantErr:        "cost $0.1350, budget is $0.1000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &mockProvider{
+				responses: []*Response{
+					{Content: "Checking", ToolCalls: []ToolCall{{ID: "1", Name: "k8s_get_logs"}}, StopReason: "tool_use", TokensIn: 10000, TokensOut: 2000},
+					{Content: "The disk is full", StopReason: "end_turn", TokensIn: 20000, TokensOut: 1000},
+				},
+			}
+			tool := &mockTool{name: "k8s_get_logs", result: "no space left on device"}
+			loop := &Loop{
+				Provider:      provider,
+				Tools:         map[string]Tool{"k8s_get_logs": tool},
+				Policy:        &mockPolicy{allowAll: true},
+				Goal:          "Find why the build failed",
+				MaxIterations: 3,
+				Budget:        tt.budget,
+			}
+
+			result, err := loop.Run(context.Background())
+			if result.Iterations != tt.wantIterations {
+				t.Errorf("Iterations = %d, want %d", result.Iterations, tt.wantIterations)
+			}
+			if tt.wantErr == "" {
+				if err != nil || result.Status != "succeeded" {
+					t.Fatalf("Loop.Run() error = %v, Status = %v, want success", err, result.Status)
+				}
+				if math.Abs(result.Cost-0.135) > 1e-9 {
+					t.Errorf("Cost = %v, want 0.135", result.Cost)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrBudgetExceeded) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Loop.Run() error = %v, want a budget error containing %q", err, tt.wantErr)
+			}
+			if result.Status != "failed" || !strings.Contains(result.Error, "Budget exceeded") {
+				t.Errorf("Status = %v, Error = %q", result.Status, result.Error)
+			}
+			// The turn that went over the budget is not acted on
+			if tt.wantIterations == 1 && tool.calls != 0 {
+				t.Errorf("tool calls = %d, want none after the budget is exceeded", tool.calls)
+			}
+		})
+	}
+}
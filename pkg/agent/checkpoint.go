@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// interruptedOutput is the result of a mutating tool call that was running when the agent restarted
+const interruptedOutput = "the agent restarted while this call was running, so it may or may not have taken effect; check the current state before calling it again"
+
+// Checkpoint is the state of a run between two steps. The loop saves one through
+// its Checkpointer before every model turn and after every tool call, so that an
+// agent restarted mid-run resumes it with Loop.Resume instead of starting over.
+type Checkpoint struct {
+	Iterations     int               `json:"iterations"`
+	Messages       []Message         `json:"messages,omitempty"`
+	ToolCalls      []ToolCallRecord  `json:"tool_calls,omitempty"`
+	FinalResponse  string            `json:"final_response,omitempty"`
+	TotalTokensIn  int               `json:"total_tokens_in,omitempty"`
+	TotalTokensOut int               `json:"total_tokens_out,omitempty"`
+	Cost           float64           `json:"cost,omitempty"`
+	Compactions    int               `json:"compactions,omitempty"`
+	Plan           []ToolCall        `json:"plan,omitempty"`
+	Results        map[string]string `json:"results,omitempty"`
+	// Turn holds the tool calls of the current turn while they are executed
+	Turn *Turn `json:"turn,omitempty"`
+}
+
+// Turn tracks the execution of the tool calls of a model turn
+type Turn struct {
+	ToolCalls []ToolCall `json:"tool_calls"`
+	// ToolResults holds the results of the calls executed so far, in order
+	ToolResults []ToolResult `json:"tool_results,omitempty"`
+	// Running is the ID of the mutating call that was about to run when the checkpoint was saved
+	Running string `json:"running,omitempty"`
+}
+
+// Checkpointer saves the checkpoints of a run to durable storage. Saving is best
+// effort: the run goes on when a checkpoint cannot be saved, so implementations
+// report their own failures.
+type Checkpointer interface {
+	// Save stores the checkpoint, replacing the previous one. The checkpoint is only
+	// valid during the call.
+	Save(ctx context.Context, checkpoint *Checkpoint)
+}
+
+// checkpoint saves the state of the run if the loop has a Checkpointer
+func (l *Loop) checkpoint(ctx context.Context, result *Result, messages []Message, turn *Turn) {
+	if l.Checkpointer == nil {
+		return
+	}
+	l.Checkpointer.Save(ctx, &Checkpoint{
+		Iterations:     result.Iterations,
+		Messages:       messages,
+		ToolCalls:      result.ToolCalls,
+		FinalResponse:  result.FinalResponse,
+		TotalTokensIn:  result.TotalTokensIn,
+		TotalTokensOut: result.TotalTokensOut,
+		Cost:           result.Cost,
+		Compactions:    result.Compactions,
+		Plan:           result.Plan,
+		Results:        result.Results,
+		Turn:           turn,
+	})
+}
+
+// restore copies the state saved in Resume to result. It returns the conversation
+// and the turn whose tool calls were being executed, if any.
+func (l *Loop) restore(result *Result) ([]Message, *Turn) {
+	c := l.Resume
+	result.Iterations = c.Iterations
+	result.ToolCalls = append(result.ToolCalls, c.ToolCalls...)
+	result.FinalResponse = c.FinalResponse
+	result.TotalTokensIn = c.TotalTokensIn
+	result.TotalTokensOut = c.TotalTokensOut
+	result.Cost = c.Cost
+	result.Compactions = c.Compactions
+	result.Plan = append(result.Plan, c.Plan...)
+	result.Results = c.Results
+
+	messages := append([]Message{}, c.Messages...)
+	if c.Turn == nil {
+		return messages, nil
+	}
+	turn := &Turn{
+		ToolCalls:   c.Turn.ToolCalls,
+		ToolResults: append([]ToolResult{}, c.Turn.ToolResults...),
+		Running:     c.Turn.Running,
+	}
+	return messages, turn
+}
+
+// interrupted records a mutating tool call that was running when the agent restarted.
+// It is not run again since it may already have taken effect.
+func interrupted(result *Result, toolCall ToolCall) ToolResult {
+	result.ToolCalls = append(result.ToolCalls, ToolCallRecord{
+		ID:          toolCall.ID,
+		Name:        toolCall.Name,
+		Input:       toolCall.Input,
+		Error:       interruptedOutput,
+		Interrupted: true,
+	})
+	return ToolResult{
+		ToolCallID: toolCall.ID,
+		Content:    interruptedOutput,
+		IsError:    true,
+	}
+}
+
+// MarshalCheckpoint marshals a checkpoint to at most maxBytes of JSON. If it is too
+// large, the outputs of the recorded tool calls are elided, then the oldest messages
+// are dropped as in TrimTranscript.
+func MarshalCheckpoint(checkpoint *Checkpoint, maxBytes int) ([]byte, error) {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	if len(data) <= maxBytes {
+		return data, nil
+	}
+
+	trimmed := *checkpoint
+	trimmed.ToolCalls = make([]ToolCallRecord, len(checkpoint.ToolCalls))
+	for i, record := range checkpoint.ToolCalls {
+		record.Output, _ = truncateOutput(record.Output, elidedMessageBytes)
+		trimmed.ToolCalls[i] = record
+	}
+
+	// Leave the messages whatever room the rest of the checkpoint does not use
+	trimmed.Messages = nil
+	rest, err := json.Marshal(trimmed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	trimmed.Messages, err = TrimTranscript(checkpoint.Messages, maxBytes-len(rest)-len(`,"messages":`))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = json.Marshal(trimmed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	if len(data) > maxBytes {
+		return nil, fmt.Errorf("checkpoint is %d bytes, more than the limit of %d", len(data), maxBytes)
+	}
+	return data, nil
+}
@@ -0,0 +1,232 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// mockCheckpointer keeps every checkpoint saved, marshaled as it would be stored
+type mockCheckpointer struct {
+	saved [][]byte
+}
+
+func (m *mockCheckpointer) Save(ctx context.Context, checkpoint *Checkpoint) {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		panic(err)
+	}
+	m.saved = append(m.saved, data)
+}
+
+func (m *mockCheckpointer) load(t *testing.T, i int) *Checkpoint {
+	t.Helper()
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(m.saved[i], &checkpoint); err != nil {
+		t.Fatalf("failed to unmarshal checkpoint %d: %v", i, err)
+	}
+	return &checkpoint
+}
+
+func TestLoop_Resume(t *testing.T) {
+	firstTurn := &Response{
+		Content: "Rerunning the pipeline",
+		ToolCalls: []ToolCall{
+			{ID: "1", Name: "tekton_create_pipelinerun"},
+			{ID: "2", Name: "k8s_get_logs"},
+		},
+		StopReason: "tool_use",
+		TokensIn:   100,
+	}
+	finalTurn := &Response{Content: "The rerun passed", StopReason: "end_turn", TokensIn: 200}
+
+	// Record the checkpoints of an uninterrupted run
+	checkpointer := &mockCheckpointer{}
+	loop := &Loop{
+		Provider: &mockProvider{responses: []*Response{firstTurn, finalTurn}},
+		Tools: map[string]Tool{
+			"tekton_create_pipelinerun": &mockMutatingTool{mockTool{name: "tekton_create_pipelinerun", result: "created"}},
+			"k8s_get_logs":              &mockTool{name: "k8s_get_logs", result: "passed"},
+		},
+		Policy:        &mockPolicy{allowAll: true},
+		Goal:          "Rerun the failed pipeline",
+		MaxIterations: 3,
+		Checkpointer:  checkpointer,
+	}
+	if _, err := loop.Run(context.Background()); err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+	// Before the first turn, after its response, before the mutating call, after each
+	// of the two calls, and before the second turn
+	if len(checkpointer.saved) != 6 {
+		t.Fatalf("saved %d checkpoints, want 6", len(checkpointer.saved))
+	}
+
+	tests := []struct {
+		name            string
+		checkpoint      int
+		wantCreateCalls int
+		wantLogsCalls   int
+		wantInterrupted bool
+	}{
+		{
+			name:            "after the model turn",
+			checkpoint:      1,
+			wantCreateCalls: 1,
+			wantLogsCalls:   1,
+		},
+		{
+			name:            "while a mutating call runs",
+			checkpoint:      2,
+			wantCreateCalls: 0,
+			wantLogsCalls:   1,
+			wantInterrupted: true,
+		},
+		{
+			name:            "between tool calls",
+			checkpoint:      3,
+			wantCreateCalls: 0,
+			wantLogsCalls:   1,
+		},
+		{
+			name:            "before the next turn",
+			checkpoint:      5,
+			wantCreateCalls: 0,
+			wantLogsCalls:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			create := &mockMutatingTool{mockTool{name: "tekton_create_pipelinerun", result: "created"}}
+			logs := &mockTool{name: "k8s_get_logs", result: "passed"}
+			provider := &mockProvider{responses: []*Response{finalTurn}}
+			loop := &Loop{
+				Provider: provider,
+				Tools: map[string]Tool{
+					"tekton_create_pipelinerun": create,
+					"k8s_get_logs":              logs,
+				},
+				Policy:        &mockPolicy{allowAll: true},
+				Goal:          "Rerun the failed pipeline",
+				MaxIterations: 3,
+				Resume:        checkpointer.load(t, tt.checkpoint),
+			}
+
+			result, err := loop.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Loop.Run() error = %v", err)
+			}
+			if result.Status != "succeeded" || result.Iterations != 2 || provider.callCount != 1 {
+				t.Errorf("Status = %v, Iterations = %d after %d model turns, want success after 2 iterations and 1 turn", result.Status, result.Iterations, provider.callCount)
+			}
+			if create.calls != tt.wantCreateCalls || logs.calls != tt.wantLogsCalls {
+				t.Errorf("calls = %d create, %d logs, want %d and %d", create.calls, logs.calls, tt.wantCreateCalls, tt.wantLogsCalls)
+			}
+			if result.TotalTokensIn != 300 {
+				t.Errorf("TotalTokensIn = %d, want the tokens of both turns", result.TotalTokensIn)
+			}
+
+			if len(result.ToolCalls) != 2 {
+				t.Fatalf("ToolCalls = %+v, want both calls recorded once", result.ToolCalls)
+			}
+			if got := result.ToolCalls[0]; got.Interrupted != tt.wantInterrupted || (tt.wantInterrupted && got.Error != interruptedOutput) {
+				t.Errorf("create record = %+v, want Interrupted = %v", got, tt.wantInterrupted)
+			}
+			if len(result.Messages) != 4 || !strings.Contains(result.Messages[2].Content, "Tool call 2 result: passed") {
+				t.Errorf("Messages = %+v, want the resumed conversation", result.Messages)
+			}
+		})
+	}
+}
+
+func TestExecutePlan_Resume(t *testing.T) {
+	plan := []ToolCall{
+		{ID: "1", Name: "tekton_create_pipelinerun"},
+		{ID: "2", Name: "tekton_create_pipelinerun"},
+	}
+
+	checkpointer := &mockCheckpointer{}
+	loop := &Loop{
+		Tools:        map[string]Tool{"tekton_create_pipelinerun": &mockMutatingTool{mockTool{name: "tekton_create_pipelinerun", result: "created"}}},
+		Policy:       &mockPolicy{allowAll: true},
+		Checkpointer: checkpointer,
+	}
+	if _, err := loop.ExecutePlan(context.Background(), plan); err != nil {
+		t.Fatalf("ExecutePlan() error = %v", err)
+	}
+	if len(checkpointer.saved) != 4 {
+		t.Fatalf("saved %d checkpoints, want one before and one after each action", len(checkpointer.saved))
+	}
+
+	tests := []struct {
+		name       string
+		checkpoint int
+		wantCalls  int
+		wantStatus string
+	}{
+		{name: "between actions", checkpoint: 1, wantCalls: 1, wantStatus: "succeeded"},
+		{name: "while an action runs", checkpoint: 2, wantCalls: 0, wantStatus: "failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := &mockMutatingTool{mockTool{name: "tekton_create_pipelinerun", result: "created"}}
+			loop := &Loop{
+				Tools:  map[string]Tool{"tekton_create_pipelinerun": tool},
+				Policy: &mockPolicy{allowAll: true},
+				Resume: checkpointer.load(t, tt.checkpoint),
+			}
+
+			result, err := loop.ExecutePlan(context.Background(), plan)
+			if err != nil {
+				t.Fatalf("ExecutePlan() error = %v", err)
+			}
+			if tool.calls != tt.wantCalls || result.Status != tt.wantStatus || len(result.ToolCalls) != 2 {
+				t.Errorf("calls = %d, Status = %v, records = %d, want %d calls, %v and 2 records", tool.calls, result.Status, len(result.ToolCalls), tt.wantCalls, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestMarshalCheckpoint(t *testing.T) {
+	checkpoint := &Checkpoint{
+		Iterations: 3,
+		Messages: []Message{
+			{Role: "user", Content: "Find why the build failed"},
+			{Role: "assistant", Content: "Fetching logs"},
+			{Role: "user", Content: strings.Repeat("x", 5000)},
+			{Role: "assistant", Content: "The disk is full"},
+		},
+		ToolCalls: []ToolCallRecord{{ID: "1", Name: "k8s_get_logs", Output: strings.Repeat("x", 5000)}},
+	}
+
+	data, err := MarshalCheckpoint(checkpoint, 100000)
+	if err != nil || !strings.Contains(string(data), strings.Repeat("x", 5000)) {
+		t.Fatalf("MarshalCheckpoint() = %d bytes, %v, want the checkpoint unchanged", len(data), err)
+	}
+
+	data, err = MarshalCheckpoint(checkpoint, 2000)
+	if err != nil {
+		t.Fatalf("MarshalCheckpoint() error = %v", err)
+	}
+	if len(data) > 2000 {
+		t.Errorf("MarshalCheckpoint() = %d bytes, want at most 2000", len(data))
+	}
+
+	var got Checkpoint
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("failed to unmarshal checkpoint: %v", err)
+	}
+	if got.Iterations != 3 || !strings.Contains(got.ToolCalls[0].Output, "bytes truncated") {
+		t.Errorf("ToolCalls = %+v, want the output elided", got.ToolCalls)
+	}
+	if got.Messages[0].Content != "Find why the build failed" || got.Messages[len(got.Messages)-1].Content != "The disk is full" {
+		t.Errorf("Messages = %+v, want the goal and the latest messages kept", got.Messages)
+	}
+
+	if _, err := MarshalCheckpoint(checkpoint, 100); err == nil {
+		t.Error("MarshalCheckpoint() error = nil, want an error when the checkpoint cannot fit")
+	}
+}
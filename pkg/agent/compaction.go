@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// defaultKeepTurns is the number of recent turns kept verbatim when Compaction.KeepTurns is unset
+	defaultKeepTurns = 2
+	// elidedMessageBytes is what is left of an older message when its output is elided
+	elidedMessageBytes = 512
+	// bytesPerToken is a rough estimate of the bytes of English text and JSON per token
+	bytesPerToken = 4
+	// messageOverheadTokens estimates the tokens of the framing of a message
+	messageOverheadTokens = 4
+)
+
+// summarizePrompt asks the provider to summarize the turns that are compacted
+const summarizePrompt = `The conversation below is the earlier part of an agent run working towards a goal. Summarize it for the agent so it can continue without the full conversation. Keep the tool calls made and their key findings (names, errors, exit codes, resource states), the conclusions drawn, and what was still left to do. Answer with the summary only.
+
+Goal: %s
+
+Conversation:
+%s`
+
+// Compaction keeps the conversation of a run within the model's context window.
+// Before each model turn whose conversation is estimated to exceed MaxTokens, the
+// turns before the most recent KeepTurns are compacted: first their tool outputs
+// are elided, then they are summarized (if Summarize is set) or dropped. The tokens
+// of the summaries count against the Budget of the run.
+type Compaction struct {
+	// MaxTokens is the estimated conversation size that triggers compaction; zero disables it
+	MaxTokens int
+	// KeepTurns is the number of most recent turns kept verbatim; defaults to 2
+	KeepTurns int
+	// Summarize asks the provider to summarize the older turns instead of dropping them
+	Summarize bool
+}
+
+// elisionMarker matches the marker truncateOutput leaves between the head and tail of an output
+var elisionMarker = regexp.MustCompile(`\n\n\[\.\.\. \d+ bytes truncated \.\.\.\]\n\n`)
+
+// isElided returns true if content was already cut down to elidedMessageBytes, e.g. by
+// an earlier compaction. Eliding it again would shrink it further and miscount the marker.
+func isElided(content string) bool {
+	marker := elisionMarker.FindString(content)
+	return marker != "" && len(content)-len(marker) <= elidedMessageBytes
+}
+
+// estimateTokens roughly estimates the tokens of the messages
+func estimateTokens(messages []Message) int {
+	tokens := 0
+	for _, msg := range messages {
+		tokens += len(msg.Content)/bytesPerToken + messageOverheadTokens
+	}
+	return tokens
+}
+
+// compact returns the messages compacted to fit Compaction.MaxTokens if possible.
+// The system prompt, the goal and the most recent turns are always kept, so the
+// result may still exceed the limit. It returns ErrBudgetExceeded if summarizing
+// takes the run over its budget.
+func (l *Loop) compact(ctx context.Context, result *Result, messages []Message) ([]Message, error) {
+	c := l.Compaction
+	if c.MaxTokens <= 0 || estimateTokens(messages) <= c.MaxTokens {
+		return messages, nil
+	}
+
+	// Keep the system prompt and the goal
+	head := 0
+	for head < len(messages) && messages[head].Role == "system" {
+		head++
+	}
+	if head < len(messages) {
+		head++
+	}
+
+	// Keep the most recent turns, each starting with an assistant message
+	keepTurns := c.KeepTurns
+	if keepTurns <= 0 {
+		keepTurns = defaultKeepTurns
+	}
+	tail := len(messages)
+	for turns := 0; turns < keepTurns && tail > head; {
+		tail--
+		if messages[tail].Role == "assistant" {
+			turns++
+		}
+	}
+	if tail <= head {
+		return messages, nil
+	}
+
+	compacted := append([]Message{}, messages...)
+
+	// Elide the outputs of older turns first: they are the bulk of the conversation.
+	// Outputs elided by an earlier compaction are left as they are.
+	elided := false
+	for i := head; i < tail; i++ {
+		if compacted[i].Role == "user" && !isElided(compacted[i].Content) {
+			var truncated bool
+			compacted[i].Content, truncated = truncateOutput(compacted[i].Content, elidedMessageBytes)
+			elided = elided || truncated
+		}
+	}
+	if estimateTokens(compacted) <= c.MaxTokens {
+		if elided {
+			result.Compactions++
+		}
+		return compacted, nil
+	}
+	result.Compactions++
+
+	// Replace the older turns by a note on the goal message, which keeps the roles alternating
+	note := fmt.Sprintf("[%d earlier messages were omitted to fit the context window]", tail-head)
+	if c.Summarize {
+		summary := l.summarize(ctx, result, compacted[head:tail])
+		if err := l.checkBudget(result); err != nil {
+			return nil, err
+		}
+		if summary != "" {
+			note = fmt.Sprintf("Summary of %d earlier messages, omitted to fit the context window:\n%s", tail-head, summary)
+		}
+	}
+	goal := compacted[head-1]
+	goal.Content += "\n\n" + note
+
+	out := append([]Message{}, compacted[:head-1]...)
+	out = append(out, goal)
+	return append(out, compacted[tail:]...), nil
+}
+
+// summarize asks the provider to summarize the messages. It returns an empty summary
+// if the provider fails, in which case the messages are dropped without one.
+func (l *Loop) summarize(ctx context.Context, result *Result, messages []Message) string {
+	var conversation strings.Builder
+	for _, msg := range messages {
+		fmt.Fprintf(&conversation, "[%s]\n%s\n\n", msg.Role, msg.Content)
+	}
+
+	response, err := l.Provider.Call(ctx, []Message{{
+		Role:    "user",
+		Content: fmt.Sprintf(summarizePrompt, l.Goal, conversation.String()),
+	}})
+	if err != nil {
+		return ""
+	}
+	result.TotalTokensIn += response.TokensIn
+	result.TotalTokensOut += response.TokensOut
+	return strings.TrimSpace(response.Content)
+}
@@ -0,0 +1,207 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// compactionProvider calls a tool in its first turns, answers summarization requests
+// with a fixed summary and records the conversation of every turn
+type compactionProvider struct {
+	toolTurns int
+	summary   string
+	turns     [][]Message
+}
+
+func (p *compactionProvider) Call(ctx context.Context, messages []Message) (*Response, error) {
+	if strings.HasPrefix(messages[0].Content, "The conversation below") {
+		if p.summary == "" {
+			return nil, errors.New("overloaded")
+		}
+		return &Response{Content: p.summary, StopReason: "end_turn", TokensIn: 100, TokensOut: 10}, nil
+	}
+
+	p.turns = append(p.turns, append([]Message{}, messages...))
+	if len(p.turns) <= p.toolTurns {
+		id := fmt.Sprint(len(p.turns))
+		return &Response{Content: "Fetching logs " + id, ToolCalls: []ToolCall{{ID: id, Name: "k8s_get_logs"}}, StopReason: "tool_use"}, nil
+	}
+	return &Response{Content: "The disk is full", StopReason: "end_turn"}, nil
+}
+
+func TestEstimateTokens(t *testing.T) {
+	messages := []Message{{Role: "user", Content: strings.Repeat("x", 400)}, {Role: "assistant", Content: "ok"}}
+	if got := estimateTokens(messages); got != 108 {
+		t.Errorf("estimateTokens() = %d, want 108", got)
+	}
+}
+
+func TestLoop_Compaction(t *testing.T) {
+	tests := []struct {
+		name       string
+		compaction Compaction
+		summary    string
+		// wantCompactions counts only the compactions that changed the conversation
+		wantCompactions int
+		// check inspects the conversation of the last turn
+		check func(t *testing.T, messages []Message)
+	}{
+		{
+			name:       "disabled",
+			compaction: Compaction{},
+			check: func(t *testing.T, messages []Message) {
+				if len(messages) != 7 || strings.Contains(messages[2].Content, "truncated") {
+					t.Errorf("conversation = %d messages, want all 7 untouched", len(messages))
+				}
+			},
+		},
+		{
+			name:            "elide older outputs",
+			compaction:      Compaction{MaxTokens: 2500, KeepTurns: 1},
+			wantCompactions: 1,
+			check: func(t *testing.T, messages []Message) {
+				if len(messages) != 7 {
+					t.Fatalf("conversation = %d messages, want 7", len(messages))
+				}
+				for _, i := range []int{2, 4} {
+					if !strings.Contains(messages[i].Content, "bytes truncated") {
+						t.Errorf("message %d = %d bytes, want its output elided", i, len(messages[i].Content))
+					}
+				}
+				if strings.Contains(messages[6].Content, "bytes truncated") {
+					t.Error("the most recent turn should be kept verbatim")
+				}
+			},
+		},
+		{
+			name:            "drop older turns",
+			compaction:      Compaction{MaxTokens: 1100, KeepTurns: 1},
+			wantCompactions: 2,
+			check: func(t *testing.T, messages []Message) {
+				if len(messages) != 3 {
+					t.Fatalf("conversation = %d messages, want the goal and the last turn", len(messages))
+				}
+				// The conversation was compacted before the third and the fourth turn
+				if strings.Count(messages[0].Content, "[2 earlier messages were omitted to fit the context window]") != 2 {
+					t.Errorf("goal message = %q, want a note about each compaction", messages[0].Content)
+				}
+				if messages[1].Role != "assistant" || messages[1].Content != "Fetching logs 3" {
+					t.Errorf("message 1 = %+v, want the last turn", messages[1])
+				}
+			},
+		},
+		{
+			name:            "summarize older turns",
+			compaction:      Compaction{MaxTokens: 1100, KeepTurns: 1, Summarize: true},
+			summary:         "Pods a and b ran out of disk",
+			wantCompactions: 2,
+			check: func(t *testing.T, messages []Message) {
+				if len(messages) != 3 || !strings.HasSuffix(messages[0].Content, "omitted to fit the context window:\nPods a and b ran out of disk") {
+					t.Errorf("conversation = %+v, want the goal with the summary and the last turn", messages)
+				}
+			},
+		},
+		{
+			name:            "summary fails",
+			compaction:      Compaction{MaxTokens: 1100, KeepTurns: 1, Summarize: true},
+			wantCompactions: 2,
+			check: func(t *testing.T, messages []Message) {
+				if len(messages) != 3 || !strings.HasSuffix(messages[0].Content, "[2 earlier messages were omitted to fit the context window]") {
+					t.Errorf("conversation = %+v, want the older turns dropped", messages)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &compactionProvider{toolTurns: 3, summary: tt.summary}
+			loop := &Loop{
+				Provider:      provider,
+				Tools:         map[string]Tool{"k8s_get_logs": &mockTool{name: "k8s_get_logs", result: strings.Repeat("no space left on device\n", 170)}},
+				Policy:        &mockPolicy{allowAll: true},
+				Goal:          "Find why the build failed",
+				MaxIterations: 5,
+				Compaction:    tt.compaction,
+			}
+
+			result, err := loop.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Loop.Run() error = %v", err)
+			}
+			if result.Status != "succeeded" || len(provider.turns) != 4 {
+				t.Fatalf("Status = %v after %d turns, want success after 4", result.Status, len(provider.turns))
+			}
+			tt.check(t, provider.turns[3])
+
+			if result.Compactions != tt.wantCompactions {
+				t.Errorf("Compactions = %d, want %d", result.Compactions, tt.wantCompactions)
+			}
+			if tt.summary != "" && result.TotalTokensIn != 200 {
+				t.Errorf("TotalTokensIn = %d, want the summary's tokens counted", result.TotalTokensIn)
+			}
+		})
+	}
+}
+
+func TestLoop_CompactTwice(t *testing.T) {
+	output := strings.Repeat("no space left on device\n", 170)
+	loop := &Loop{Compaction: Compaction{MaxTokens: 1500, KeepTurns: 1}}
+	result := &Result{}
+
+	messages := []Message{
+		{Role: "user", Content: "Find why the build failed"},
+		{Role: "assistant", Content: "Fetching logs 1"},
+		{Role: "user", Content: output},
+		{Role: "assistant", Content: "Fetching logs 2"},
+		{Role: "user", Content: output},
+	}
+	first, err := loop.compact(context.Background(), result, messages)
+	if err != nil {
+		t.Fatalf("compact() error = %v", err)
+	}
+	if len(first) != 5 || !strings.Contains(first[2].Content, "bytes truncated") {
+		t.Fatalf("conversation = %+v, want the first output elided", first)
+	}
+
+	// The next compaction elides the newly older output and leaves the elided one as it is
+	messages = append(first, Message{Role: "assistant", Content: "Fetching logs 3"}, Message{Role: "user", Content: output})
+	second, err := loop.compact(context.Background(), result, messages)
+	if err != nil {
+		t.Fatalf("compact() error = %v", err)
+	}
+	if len(second) != 7 || !strings.Contains(second[4].Content, "bytes truncated") {
+		t.Fatalf("conversation = %+v, want the second output elided", second)
+	}
+	if second[2].Content != first[2].Content {
+		t.Errorf("elided output changed from %d to %d bytes", len(first[2].Content), len(second[2].Content))
+	}
+	if result.Compactions != 2 {
+		t.Errorf("Compactions = %d, want 2", result.Compactions)
+	}
+}
+
+func TestLoop_CompactionBudget(t *testing.T) {
+	provider := &compactionProvider{toolTurns: 3, summary: "Pods a and b ran out of disk"}
+	loop := &Loop{
+		Provider:      provider,
+		Tools:         map[string]Tool{"k8s_get_logs": &mockTool{name: "k8s_get_logs", result: strings.Repeat("no space left on device\n", 170)}},
+		Policy:        &mockPolicy{allowAll: true},
+		Goal:          "Find why the build failed",
+		MaxIterations: 5,
+		Compaction:    Compaction{MaxTokens: 1100, KeepTurns: 1, Summarize: true},
+		Budget:        Budget{MaxInputTokens: 150},
+	}
+
+	// Each summary takes 100 input tokens; the second one goes over the budget
+	result, err := loop.Run(context.Background())
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("Loop.Run() error = %v, want ErrBudgetExceeded", err)
+	}
+	if result.Status != "failed" || result.TotalTokensIn != 200 || len(provider.turns) != 3 {
+		t.Errorf("Status = %v, TotalTokensIn = %d after %d turns, want the run stopped before the fourth turn", result.Status, result.TotalTokensIn, len(provider.turns))
+	}
+}
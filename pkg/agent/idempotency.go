@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// repeatedCallOutput is returned to the LLM for a mutating call identical to an earlier successful one
+const repeatedCallOutput = "This call repeats tool call %s, which completed without an error, so it was not run again. Its result was:\n%s"
+
+type toolCallIDKey struct{}
+
+// WithToolCallID returns a context carrying the ID of the tool call being executed
+func WithToolCallID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, toolCallIDKey{}, id)
+}
+
+// ToolCallID returns the ID of the tool call being executed, or "" outside of a
+// tool call. Mutating tools use it to recognize the objects an earlier attempt of
+// the same call created.
+func ToolCallID(ctx context.Context) string {
+	id, _ := ctx.Value(toolCallIDKey{}).(string)
+	return id
+}
+
+// repeatedCall returns the earlier successful call of the run with the same tool and
+// input as toolCall, or nil if there is none
+func repeatedCall(result *Result, toolCall ToolCall) *ToolCallRecord {
+	for i := range result.ToolCalls {
+		record := &result.ToolCalls[i]
+		if record.Name == toolCall.Name && record.Error == "" && !record.Cached && reflect.DeepEqual(record.Input, toolCall.Input) {
+			return record
+		}
+	}
+	return nil
+}
+
+// cachedCall records a mutating call that repeats an earlier successful one. The
+// earlier result is returned instead of running the tool again.
+func cachedCall(result *Result, toolCall ToolCall, earlier *ToolCallRecord) ToolResult {
+	output := fmt.Sprintf(repeatedCallOutput, earlier.ID, earlier.Output)
+	result.ToolCalls = append(result.ToolCalls, ToolCallRecord{
+		ID:     toolCall.ID,
+		Name:   toolCall.Name,
+		Input:  toolCall.Input,
+		Output: output,
+		Cached: true,
+	})
+	return ToolResult{
+		ToolCallID: toolCall.ID,
+		Content:    output,
+		IsError:    false,
+	}
+}
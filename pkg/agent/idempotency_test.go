@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// idTool is a mutating tool that records the tool call ID of each execution
+type idTool struct {
+	ids []string
+}
+
+func (m *idTool) Name() string {
+	return "tekton_create_pipelinerun"
+}
+
+func (m *idTool) Mutating() bool {
+	return true
+}
+
+func (m *idTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	m.ids = append(m.ids, ToolCallID(ctx))
+	return "PipelineRun default/" + input["name"].(string) + " created successfully", nil
+}
+
+func TestLoop_RepeatedMutatingCall(t *testing.T) {
+	create := func(id, name string) *Response {
+		return &Response{
+			Content:    "Creating " + name,
+			ToolCalls:  []ToolCall{{ID: id, Name: "tekton_create_pipelinerun", Input: map[string]interface{}{"name": name}}},
+			StopReason: "tool_use",
+		}
+	}
+	provider := &mockProvider{
+		responses: []*Response{
+			create("1", "build-1"),
+			create("2", "build-1"),
+			create("3", "build-2"),
+			{Content: "Done", StopReason: "end_turn"},
+		},
+	}
+	tool := &idTool{}
+	loop := &Loop{
+		Provider:      provider,
+		Tools:         map[string]Tool{"tekton_create_pipelinerun": tool},
+		Policy:        &mockPolicy{allowAll: true},
+		Goal:          "Rerun the build",
+		MaxIterations: 5,
+	}
+
+	result, err := loop.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+
+	// The repeated call is not run, and each run sees its own tool call ID
+	if want := []string{"1", "3"}; !reflect.DeepEqual(tool.ids, want) {
+		t.Errorf("executed tool call IDs = %v, want %v", tool.ids, want)
+	}
+	if len(result.ToolCalls) != 3 {
+		t.Fatalf("ToolCalls = %+v, want 3 records", result.ToolCalls)
+	}
+	repeated := result.ToolCalls[1]
+	if !repeated.Cached || !strings.Contains(repeated.Output, "repeats tool call 1") || !strings.Contains(repeated.Output, "PipelineRun default/build-1 created successfully") {
+		t.Errorf("repeated call = %+v, want the cached result of call 1", repeated)
+	}
+	if result.ToolCalls[2].Cached {
+		t.Error("a call with a different input should run")
+	}
+}
+
+func TestToolCallID(t *testing.T) {
+	if got := ToolCallID(context.Background()); got != "" {
+		t.Errorf("ToolCallID() outside of a tool call = %q, want empty", got)
+	}
+	if got := ToolCallID(WithToolCallID(context.Background(), "toolu_01")); got != "toolu_01" {
+		t.Errorf("ToolCallID() = %q, want toolu_01", got)
+	}
+}
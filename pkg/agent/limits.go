@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+	"unicode/utf8"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// retryDelay is the wait before the first retry of a tool call; it doubles with every retry
+var retryDelay = time.Second
+
+// ToolLimits limits the calls of a tool
+type ToolLimits struct {
+	// Timeout of a single attempt; zero leaves only the deadline of the run
+	Timeout time.Duration
+	// Retries is how many times an attempt that fails with a transient API error is retried
+	Retries int
+	// MaxOutputBytes truncates longer output to its head and tail; zero means unlimited
+	MaxOutputBytes int
+}
+
+// toolLimits returns the limits of a tool, falling back to DefaultToolLimits for unset fields
+func (l *Loop) toolLimits(name string) ToolLimits {
+	limits := l.DefaultToolLimits
+	configured, ok := l.ToolLimits[name]
+	if !ok {
+		return limits
+	}
+	if configured.Timeout > 0 {
+		limits.Timeout = configured.Timeout
+	}
+	if configured.Retries > 0 {
+		limits.Retries = configured.Retries
+	}
+	if configured.MaxOutputBytes > 0 {
+		limits.MaxOutputBytes = configured.MaxOutputBytes
+	}
+	return limits
+}
+
+// executeWithLimits executes a tool call, giving each attempt its own timeout and
+// retrying transient errors. It returns the number of retries taken.
+func executeWithLimits(ctx context.Context, tool Tool, input map[string]interface{}, limits ToolLimits) (string, int, error) {
+	delay := retryDelay
+	for retries := 0; ; retries++ {
+		output, err := executeAttempt(ctx, tool, input, limits.Timeout)
+		if err == nil || retries >= limits.Retries || ctx.Err() != nil || !isTransient(err) {
+			return output, retries, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return output, retries, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// executeAttempt executes a tool call once, within timeout if it is set
+func executeAttempt(ctx context.Context, tool Tool, input map[string]interface{}, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return tool.Execute(ctx, input)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	output, err := tool.Execute(attemptCtx, input)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		return output, fmt.Errorf("timed out after %s: %w", timeout, err)
+	}
+	return output, err
+}
+
+// isTransient returns true if the error is likely to go away when the call is retried
+func isTransient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsInternalError(err) ||
+		utilnet.IsConnectionReset(err) ||
+		utilnet.IsConnectionRefused(err)
+}
+
+// truncateOutput keeps the head and tail of output longer than maxBytes around a
+// marker telling the model how much was left out. It returns true if it truncated.
+func truncateOutput(output string, maxBytes int) (string, bool) {
+	if maxBytes <= 0 || len(output) <= maxBytes {
+		return output, false
+	}
+
+	head := maxBytes / 2
+	tail := len(output) - (maxBytes - head)
+	// Cut at rune boundaries so the output stays valid UTF-8
+	for head > 0 && !utf8.RuneStart(output[head]) {
+		head--
+	}
+	for tail < len(output) && !utf8.RuneStart(output[tail]) {
+		tail++
+	}
+
+	marker := fmt.Sprintf("\n\n[... %d bytes truncated ...]\n\n", tail-head)
+	return output[:head] + marker + output[tail:], true
+}
@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// flakyTool fails its first calls with err, or hangs until its context is done if err is nil
+type flakyTool struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakyTool) Name() string {
+	return "k8s_get_logs"
+}
+
+func (f *flakyTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	f.calls++
+	if f.calls > f.failures {
+		return "logs", nil
+	}
+	if f.err != nil {
+		return "", f.err
+	}
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestTruncateOutput(t *testing.T) {
+	output := strings.Repeat("a", 50) + strings.Repeat("b", 50)
+
+	got, truncated := truncateOutput(output, 20)
+	if !truncated || !strings.HasPrefix(got, strings.Repeat("a", 10)+"\n\n[... 80 bytes truncated ...]\n\n") || !strings.HasSuffix(got, strings.Repeat("b", 10)) {
+		t.Errorf("truncateOutput() = %q, want the head and tail around a marker", got)
+	}
+
+	if got, truncated := truncateOutput(output, 0); truncated || got != output {
+		t.Errorf("truncateOutput() without a limit = %q, want the output unchanged", got)
+	}
+	if got, truncated := truncateOutput(output, 100); truncated || got != output {
+		t.Errorf("truncateOutput() within the limit = %q, want the output unchanged", got)
+	}
+
+	if got, _ := truncateOutput(strings.Repeat("é", 20), 9); !utf8.ValidString(got) {
+		t.Errorf("truncateOutput() = %q, want valid UTF-8", got)
+	}
+}
+
+func TestLoop_ToolLimits(t *testing.T) {
+	retryDelay = time.Millisecond
+	defer func() { retryDelay = time.Second }()
+
+	tests := []struct {
+		name        string
+		tool        *flakyTool
+		limits      ToolLimits
+		wantCalls   int
+		wantRetries int
+		wantErr     string
+	}{
+		{
+			name:        "timeout retried",
+			tool:        &flakyTool{failures: 1},
+			limits:      ToolLimits{Timeout: 10 * time.Millisecond, Retries: 2},
+			wantCalls:   2,
+			wantRetries: 1,
+		},
+		{
+			name:      "timeout without retries",
+			tool:      &flakyTool{failures: 1},
+			limits:    ToolLimits{Timeout: 10 * time.Millisecond},
+			wantCalls: 1,
+			wantErr:   "timed out after 10ms",
+		},
+		{
+			name:        "throttled",
+			tool:        &flakyTool{failures: 2, err: apierrors.NewTooManyRequests("slow down", 1)},
+			limits:      ToolLimits{Retries: 2},
+			wantCalls:   3,
+			wantRetries: 2,
+		},
+		{
+			name:        "retries exhausted",
+			tool:        &flakyTool{failures: 3, err: apierrors.NewServiceUnavailable("unavailable")},
+			limits:      ToolLimits{Retries: 2},
+			wantCalls:   3,
+			wantRetries: 2,
+			wantErr:     "unavailable",
+		},
+		{
+			name:      "permanent error",
+			tool:      &flakyTool{failures: 1, err: errors.New("pod is required")},
+			limits:    ToolLimits{Retries: 2},
+			wantCalls: 1,
+			wantErr:   "pod is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &mockProvider{
+				responses: []*Response{
+					{Content: "Fetching logs", ToolCalls: []ToolCall{{ID: "1", Name: "k8s_get_logs"}}, StopReason: "tool_use"},
+					{Content: "Done", StopReason: "end_turn"},
+				},
+			}
+			loop := &Loop{
+				Provider:      provider,
+				Tools:         map[string]Tool{"k8s_get_logs": tt.tool},
+				Policy:        &mockPolicy{allowAll: true},
+				Goal:          "Find why the build failed",
+				MaxIterations: 3,
+				ToolLimits:    map[string]ToolLimits{"k8s_get_logs": tt.limits},
+			}
+
+			result, err := loop.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Loop.Run() error = %v", err)
+			}
+			if tt.tool.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", tt.tool.calls, tt.wantCalls)
+			}
+			record := result.ToolCalls[0]
+			if record.Retries != tt.wantRetries {
+				t.Errorf("Retries = %d, want %d", record.Retries, tt.wantRetries)
+			}
+			if tt.wantErr == "" && (record.Error != "" || record.Output != "logs") {
+				t.Errorf("record = %+v, want the logs", record)
+			}
+			if tt.wantErr != "" && !strings.Contains(record.Error, tt.wantErr) {
+				t.Errorf("Error = %q, want it to contain %q", record.Error, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoop_ToolOutputLimit(t *testing.T) {
+	provider := &mockProvider{
+		responses: []*Response{
+			{Content: "Fetching logs", ToolCalls: []ToolCall{{ID: "1", Name: "k8s_get_logs"}, {ID: "2", Name: "k8s_get_resources"}}, StopReason: "tool_use"},
+			{Content: "Done", StopReason: "end_turn"},
+		},
+	}
+	loop := &Loop{
+		Provider: provider,
+		Tools: map[string]Tool{
+			"k8s_get_logs":      &mockTool{name: "k8s_get_logs", result: strings.Repeat("x", 1000)},
+			"k8s_get_resources": &mockTool{name: "k8s_get_resources", result: strings.Repeat("y", 1000)},
+		},
+		Policy:            &mockPolicy{allowAll: true},
+		Goal:              "Find why the build failed",
+		MaxIterations:     3,
+		ToolLimits:        map[string]ToolLimits{"k8s_get_logs": {MaxOutputBytes: 100}},
+		DefaultToolLimits: ToolLimits{MaxOutputBytes: 500},
+	}
+
+	result, err := loop.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+
+	logs, resources := result.ToolCalls[0], result.ToolCalls[1]
+	if !logs.Truncated || !strings.Contains(logs.Output, "[... 900 bytes truncated ...]") {
+		t.Errorf("logs output = %q, want it cut to the tool's limit", logs.Output)
+	}
+	if !resources.Truncated || !strings.Contains(resources.Output, "[... 500 bytes truncated ...]") {
+		t.Errorf("resources output = %q, want it cut to the default limit", resources.Output)
+	}
+	if strings.Contains(result.Messages[2].Content, strings.Repeat("x", 101)) {
+		t.Error("the model should only see the truncated output")
+	}
+}
@@ -2,9 +2,21 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"text/template"
 )
 
+// ErrProviderCall is returned by Loop.Run when a call to the LLM provider fails
+var ErrProviderCall = errors.New("provider call failed")
+
+// FinishTool is the name of the tool the LLM calls to end the run
+const FinishTool = "finish"
+
+// continuePrompt asks the LLM to go on after a turn that did not end with a final answer
+const continuePrompt = "Please continue. Use the available tools if you need more information, and call the finish tool once the goal is achieved."
+
 // Tool is the interface for agent tools
 type Tool interface {
 	// Name returns the tool name
@@ -13,13 +25,45 @@ type Tool interface {
 	Execute(ctx context.Context, input map[string]interface{}) (string, error)
 }
 
+// MutatingTool is implemented by tools that change cluster state
+type MutatingTool interface {
+	// Mutating returns true if the tool changes cluster state
+	Mutating() bool
+}
+
+// ParallelTool is implemented by tools whose calls may run concurrently with other
+// calls of the same turn, typically because they only read cluster state
+type ParallelTool interface {
+	// Parallel returns true if calls of the tool may run concurrently
+	Parallel() bool
+}
+
 // Policy is the interface for policy enforcement
 type Policy interface {
 	// Allow checks if a tool call is allowed
 	Allow(ctx context.Context, toolCall ToolCall) error
 }
 
-// Loop implements the plan-act-reflect loop
+// ApprovalPolicy is implemented by policies that can require a human to approve a tool call
+type ApprovalPolicy interface {
+	// RequiresApproval checks if a tool call must be approved before it runs
+	RequiresApproval(ctx context.Context, toolCall ToolCall) (bool, error)
+}
+
+// Approver asks a human to approve a tool call
+type Approver interface {
+	// RequestApproval blocks until the tool call is approved or rejected
+	RequestApproval(ctx context.Context, toolCall ToolCall, reason string) (ApprovalDecision, error)
+}
+
+// ApprovalDecision is a human decision on a tool call
+type ApprovalDecision struct {
+	Approved bool
+	Message  string
+}
+
+// Loop runs an agent: the LLM is called in turns and the tools it calls are
+// executed until it finishes or MaxIterations turns have been taken
 type Loop struct {
 	Provider      Provider
 	Tools         map[string]Tool
@@ -27,17 +71,76 @@ type Loop struct {
 	Goal          string
 	SystemPrompt  string
 	MaxIterations int
+
+	// Context is additional information about the goal, available to the prompt templates
+	Context string
+	// Planner renders the first message of a run from PromptData; a built-in prompt is used when nil
+	Planner *template.Template
+	// Reflector renders a prompt from PromptData that is sent with the results of each
+	// turn's tool calls, and when a turn is cut short. Nothing is added when nil.
+	Reflector *template.Template
+
+	// RequireApproval lists the tools whose calls must be approved through Approver
+	RequireApproval []string
+	// Approver is asked to approve tool calls; without one, calls requiring approval are rejected
+	Approver Approver
+
+	// PlanOnly records calls of mutating tools in Result.Plan instead of executing them
+	PlanOnly bool
+
+	// DryRun marks calls of mutating tools as simulated; the tools themselves must be
+	// configured for server-side dry run. Simulated calls do not require approval.
+	DryRun bool
+
+	// History holds the messages of a previous run to continue; Goal is then sent
+	// as a follow-up instruction
+	History []Message
+
+	// Results declares the structured results the agent must submit through the
+	// submit_result tool before the run can succeed
+	Results []ResultField
+
+	// MaxParallelToolCalls bounds how many calls of parallel tools run at once within
+	// a turn. Calls run one at a time when it is 0 or 1.
+	MaxParallelToolCalls int
+
+	// ToolLimits limits the calls of individual tools by name. Unset fields fall back
+	// to DefaultToolLimits, which applies to every tool.
+	ToolLimits        map[string]ToolLimits
+	DefaultToolLimits ToolLimits
+
+	// Budget caps the tokens and cost of the run; it is checked after every model turn
+	Budget Budget
+
+	// Compaction keeps the conversation within the model's context window
+	Compaction Compaction
+
+	// Checkpointer saves the state of the run before every model turn and after every tool call
+	Checkpointer Checkpointer
+	// Resume is the checkpoint of an interrupted run to resume instead of starting
+	// over. Mutating calls that were running when it was saved are not run again.
+	Resume *Checkpoint
 }
 
 // Result represents the result of running the loop
 type Result struct {
-	Status        string            `json:"status"` // "succeeded", "failed", "max_iterations"
+	Status        string            `json:"status"` // "succeeded", "failed", "max_iterations", "cancelled"
 	Iterations    int               `json:"iterations"`
 	ToolCalls     []ToolCallRecord  `json:"tool_calls"`
 	FinalResponse string            `json:"final_response"`
 	TotalTokensIn int               `json:"total_tokens_in"`
 	TotalTokensOut int              `json:"total_tokens_out"`
 	Error         string            `json:"error,omitempty"`
+	// Plan lists the mutating tool calls proposed in plan-only mode
+	Plan []ToolCall `json:"plan,omitempty"`
+	// Messages is the transcript of the run, which a later run may continue
+	Messages []Message `json:"messages,omitempty"`
+	// Results holds the values submitted through the submit_result tool
+	Results map[string]string `json:"results,omitempty"`
+	// Cost of the run in USD, tracked when the price of the model is known
+	Cost float64 `json:"cost,omitempty"`
+	// Compactions is the number of times the conversation was compacted
+	Compactions int `json:"compactions,omitempty"`
 }
 
 // ToolCallRecord records a tool call execution
@@ -47,9 +150,26 @@ type ToolCallRecord struct {
 	Input  map[string]interface{} `json:"input"`
 	Output string                 `json:"output"`
 	Error  string                 `json:"error,omitempty"`
+	// Approval is "approved" or "rejected" for tool calls that required approval
+	Approval string `json:"approval,omitempty"`
+	// Proposed is set for mutating tool calls recorded in plan-only mode instead of being executed
+	Proposed bool `json:"proposed,omitempty"`
+	// Simulated is set for mutating tool calls that ran with server-side dry run and changed nothing
+	Simulated bool `json:"simulated,omitempty"`
+	// Retries is the number of times the call was retried after a transient error
+	Retries int `json:"retries,omitempty"`
+	// Truncated is set when the output sent to the model was cut to the tool's size limit
+	Truncated bool `json:"truncated,omitempty"`
+	// Interrupted is set for mutating tool calls that were running when the agent restarted
+	Interrupted bool `json:"interrupted,omitempty"`
+	// Cached is set for mutating tool calls that repeated an earlier successful call and were not run
+	Cached bool `json:"cached,omitempty"`
 }
 
-// Run executes the plan-act-reflect loop
+// Run executes the agent loop. Each iteration is one model turn: the tool calls of
+// the response are executed and their results sent back in the next turn. The run
+// succeeds when the LLM calls the finish tool, submits valid results, or ends its
+// turn without calling a tool.
 func (l *Loop) Run(ctx context.Context) (*Result, error) {
 	result := &Result{
 		Status:     "succeeded",
@@ -58,95 +178,130 @@ func (l *Loop) Run(ctx context.Context) (*Result, error) {
 
 	messages := []Message{}
 
-	// Add system prompt if provided
-	if l.SystemPrompt != "" {
-		messages = append(messages, Message{
-			Role:    "system",
-			Content: l.SystemPrompt,
-		})
-	}
+	// Record the transcript however the run ends
+	defer func() {
+		result.Messages = messages
+	}()
 
-	// Add initial goal
-	messages = append(messages, Message{
-		Role:    "user",
-		Content: fmt.Sprintf("Goal: %s\n\nPlease analyze this goal and take the necessary actions to achieve it.", l.Goal),
-	})
+	// The turn whose tool calls are being executed
+	var turn *Turn
+	start := 0
 
-	for iteration := 0; iteration < l.MaxIterations; iteration++ {
-		result.Iterations = iteration + 1
+	if l.Resume != nil {
+		// Pick up an interrupted run where its last checkpoint left it
+		messages, turn = l.restore(result)
+		start = result.Iterations
+		if turn != nil {
+			start--
+		}
+	} else if len(l.History) > 0 {
+		// Resume the previous transcript, which already starts with the system prompt
+		messages = append(messages, l.History...)
+		messages = append(messages, Message{
+			Role:    "user",
+			Content: fmt.Sprintf("Follow-up: %s\n\nContinue from the conversation above and take the necessary actions.", l.Goal),
+		})
+	} else {
+		// Add system prompt if provided
+		if l.SystemPrompt != "" {
+			messages = append(messages, Message{
+				Role:    "system",
+				Content: l.SystemPrompt,
+			})
+		}
 
-		// Call LLM
-		response, err := l.Provider.Call(ctx, messages)
+		// Add initial goal
+		planner := l.Planner
+		if planner == nil {
+			planner = defaultPlanner
+		}
+		prompt, err := l.renderPrompt(planner, result)
 		if err != nil {
 			result.Status = "failed"
-			result.Error = fmt.Sprintf("LLM call failed: %v", err)
+			result.Error = err.Error()
 			return result, err
 		}
-
-		result.TotalTokensIn += response.TokensIn
-		result.TotalTokensOut += response.TokensOut
-
-		// Add assistant response to messages
 		messages = append(messages, Message{
-			Role:    "assistant",
-			Content: response.Content,
+			Role:    "user",
+			Content: prompt,
 		})
+	}
 
-		// If no tool calls, continue to next iteration
-		if len(response.ToolCalls) == 0 {
-			result.FinalResponse = response.Content
-			// Add a prompt asking for more analysis or tool usage
-			messages = append(messages, Message{
-				Role:    "user",
-				Content: "Please continue analyzing the goal. If you need more information, use the available tools. If you're confident the goal is achieved, provide your final answer.",
-			})
-			continue
-		}
+	for iteration := start; iteration < l.MaxIterations; iteration++ {
+		// A resumed turn already has its response; its remaining tool calls are executed
+		if turn == nil {
+			l.checkpoint(ctx, result, messages, nil)
+			result.Iterations = iteration + 1
 
-		// Process tool calls
-		toolResults := []ToolResult{}
-		for _, toolCall := range response.ToolCalls {
-			// Check policy
-			if err := l.Policy.Allow(ctx, toolCall); err != nil {
-				result.Status = "failed"
-				result.Error = fmt.Sprintf("Policy violation for tool %s: %v", toolCall.Name, err)
-				return result, fmt.Errorf("policy violation: %w", err)
+			// Keep the conversation within the context window
+			compacted, err := l.compact(ctx, result, messages)
+			if err != nil {
+				return result, err
 			}
+			messages = compacted
 
-			// Find tool
-			tool, ok := l.Tools[toolCall.Name]
-			if !ok {
+			// Call LLM
+			response, err := l.Provider.Call(ctx, messages)
+			if err != nil {
 				result.Status = "failed"
-				result.Error = fmt.Sprintf("Tool not found: %s", toolCall.Name)
-				return result, fmt.Errorf("tool not found: %s", toolCall.Name)
+				result.Error = fmt.Sprintf("LLM call failed: %v", err)
+				return result, fmt.Errorf("%w: %w", ErrProviderCall, err)
 			}
 
-			// Execute tool
-			output, err := tool.Execute(ctx, toolCall.Input)
+			result.TotalTokensIn += response.TokensIn
+			result.TotalTokensOut += response.TokensOut
 
-			record := ToolCallRecord{
-				ID:    toolCall.ID,
-				Name:  toolCall.Name,
-				Input: toolCall.Input,
+			// Add assistant response to messages
+			messages = append(messages, Message{
+				Role:    "assistant",
+				Content: response.Content,
+			})
+			result.FinalResponse = response.Content
+
+			// Stop before acting on a turn that went over the budget
+			if err := l.checkBudget(result); err != nil {
+				return result, err
 			}
 
-			if err != nil {
-				record.Error = err.Error()
-				toolResults = append(toolResults, ToolResult{
-					ToolCallID: toolCall.ID,
-					Content:    err.Error(),
-					IsError:    true,
-				})
-			} else {
-				record.Output = output
-				toolResults = append(toolResults, ToolResult{
-					ToolCallID: toolCall.ID,
-					Content:    output,
-					IsError:    false,
-				})
+			if len(response.ToolCalls) == 0 {
+				// A response cut short, e.g. by max_tokens, is not a final answer
+				if response.StopReason != "end_turn" {
+					prompt, err := l.reflect(result)
+					if err != nil {
+						return result, err
+					}
+					if prompt == "" {
+						prompt = continuePrompt
+					}
+					messages = append(messages, Message{
+						Role:    "user",
+						Content: prompt,
+					})
+					continue
+				}
+
+				// The run cannot succeed before the declared results are submitted
+				if l.resultsMissing(result) {
+					messages = append(messages, Message{
+						Role:    "user",
+						Content: submitResultReminder,
+					})
+					continue
+				}
+
+				result.Status = "succeeded"
+				return result, nil
 			}
 
-			result.ToolCalls = append(result.ToolCalls, record)
+			turn = &Turn{ToolCalls: response.ToolCalls}
+			l.checkpoint(ctx, result, messages, turn)
+		}
+
+		// Process tool calls
+		toolResults, finished, err := l.executeToolCalls(ctx, result, messages, turn)
+		turn = nil
+		if err != nil {
+			return result, err
 		}
 
 		// Add tool results to messages as user message
@@ -160,38 +315,225 @@ func (l *Loop) Run(ctx context.Context) (*Result, error) {
 			}
 		}
 
+		if finished {
+			messages = append(messages, Message{
+				Role:    "user",
+				Content: toolResultsContent,
+			})
+			result.Status = "succeeded"
+			return result, nil
+		}
+
+		// Ask the LLM to reflect on the results before its next turn
+		prompt, err := l.reflect(result)
+		if err != nil {
+			return result, err
+		}
+		if prompt != "" {
+			toolResultsContent += "\n" + prompt
+		}
+
 		messages = append(messages, Message{
 			Role:    "user",
 			Content: toolResultsContent,
 		})
+	}
 
-		// Get reflection from LLM
-		reflectResponse, err := l.Provider.Call(ctx, messages)
-		if err != nil {
-			result.Status = "failed"
-			result.Error = fmt.Sprintf("Reflection call failed: %v", err)
-			return result, err
+	// Max iterations reached
+	result.Status = "max_iterations"
+	return result, nil
+}
+
+// executeToolCall runs a single tool call of the LLM and records it in result. It
+// returns true if the call ends the run. Errors end the run as failed. running is
+// called right before a mutating call takes effect.
+func (l *Loop) executeToolCall(ctx context.Context, result *Result, toolCall ToolCall, running func()) (ToolResult, bool, error) {
+	// The built-in tools only record the agent's answer, so the loop handles them itself
+	switch {
+	case toolCall.Name == FinishTool:
+		return l.finish(result, toolCall)
+	case len(l.Results) > 0 && toolCall.Name == SubmitResultTool:
+		return l.submitResult(result, toolCall)
+	}
+
+	tool, err := l.authorize(ctx, result, toolCall)
+	if err != nil {
+		return ToolResult{}, false, err
+	}
+
+	// Repeating a change that already succeeded would make it twice
+	if isMutating(tool) {
+		if earlier := repeatedCall(result, toolCall); earlier != nil {
+			return cachedCall(result, toolCall, earlier), false, nil
 		}
+	}
+
+	record := ToolCallRecord{
+		ID:    toolCall.ID,
+		Name:  toolCall.Name,
+		Input: toolCall.Input,
+	}
 
-		result.TotalTokensIn += reflectResponse.TokensIn
-		result.TotalTokensOut += reflectResponse.TokensOut
+	// In plan-only mode, mutating calls are proposed rather than executed
+	if l.PlanOnly && isMutating(tool) {
+		result.Plan = append(result.Plan, toolCall)
+		record.Proposed = true
+		record.Output = proposedOutput
+		result.ToolCalls = append(result.ToolCalls, record)
+		return ToolResult{
+			ToolCallID: toolCall.ID,
+			Content:    proposedOutput,
+			IsError:    false,
+		}, false, nil
+	}
 
-		// Add reflection to messages
-		messages = append(messages, Message{
-			Role:    "assistant",
-			Content: reflectResponse.Content,
-		})
+	// Wait for a human decision if the call requires approval
+	approved, err := l.requestApproval(ctx, result, tool, toolCall, &record)
+	if err != nil {
+		return ToolResult{}, false, err
+	}
+	if !approved {
+		result.ToolCalls = append(result.ToolCalls, record)
+		return ToolResult{
+			ToolCallID: toolCall.ID,
+			Content:    record.Error,
+			IsError:    true,
+		}, false, nil
+	}
+
+	// Execute tool
+	if isMutating(tool) && !l.DryRun {
+		running()
+	}
+	toolResult := l.runTool(ctx, tool, toolCall, &record)
+	result.ToolCalls = append(result.ToolCalls, record)
+	return toolResult, false, nil
+}
 
-		result.FinalResponse = reflectResponse.Content
+// authorize checks a tool call against the policy and looks up its tool. Errors end
+// the run as failed.
+func (l *Loop) authorize(ctx context.Context, result *Result, toolCall ToolCall) (Tool, error) {
+	// Check policy
+	if err := l.Policy.Allow(ctx, toolCall); err != nil {
+		result.Status = "failed"
+		result.Error = fmt.Sprintf("Policy violation for tool %s: %v", toolCall.Name, err)
+		return nil, fmt.Errorf("policy violation: %w", err)
+	}
 
-		// If reflection has no more tool calls and stop reason is end_turn, we're done
-		if len(reflectResponse.ToolCalls) == 0 && reflectResponse.StopReason == "end_turn" {
-			result.Status = "succeeded"
-			return result, nil
+	// Find tool
+	tool, ok := l.Tools[toolCall.Name]
+	if !ok {
+		result.Status = "failed"
+		result.Error = fmt.Sprintf("Tool not found: %s", toolCall.Name)
+		return nil, fmt.Errorf("tool not found: %s", toolCall.Name)
+	}
+	return tool, nil
+}
+
+// requestApproval records the decision on a tool call that requires approval in record.
+// It returns false if the call was rejected. Errors end the run as failed.
+func (l *Loop) requestApproval(ctx context.Context, result *Result, tool Tool, toolCall ToolCall, record *ToolCallRecord) (bool, error) {
+	decision, err := l.approve(ctx, tool, toolCall)
+	if err != nil {
+		result.Status = "failed"
+		result.Error = fmt.Sprintf("Approval for tool %s failed: %v", toolCall.Name, err)
+		return false, fmt.Errorf("approval failed: %w", err)
+	}
+	if decision == nil {
+		return true, nil
+	}
+	if !decision.Approved {
+		record.Approval = "rejected"
+		record.Error = fmt.Sprintf("tool call rejected: %s", decision.Message)
+		return false, nil
+	}
+	record.Approval = "approved"
+	return true, nil
+}
+
+// runTool executes a tool call within the limits of its tool and records its output in record
+func (l *Loop) runTool(ctx context.Context, tool Tool, toolCall ToolCall, record *ToolCallRecord) ToolResult {
+	limits := l.toolLimits(toolCall.Name)
+	record.Simulated = l.DryRun && isMutating(tool)
+	output, retries, err := executeWithLimits(WithToolCallID(ctx, toolCall.ID), tool, toolCall.Input, limits)
+	record.Retries = retries
+	if err != nil {
+		record.Error = err.Error()
+		return ToolResult{
+			ToolCallID: toolCall.ID,
+			Content:    err.Error(),
+			IsError:    true,
 		}
 	}
+	record.Output, record.Truncated = truncateOutput(output, limits.MaxOutputBytes)
+	return ToolResult{
+		ToolCallID: toolCall.ID,
+		Content:    record.Output,
+		IsError:    false,
+	}
+}
 
-	// Max iterations reached
-	result.Status = "max_iterations"
-	return result, nil
+// finish ends the run with the summary of the finish call as the final response.
+// It is refused while declared results are missing.
+func (l *Loop) finish(result *Result, toolCall ToolCall) (ToolResult, bool, error) {
+	record := ToolCallRecord{
+		ID:    toolCall.ID,
+		Name:  toolCall.Name,
+		Input: toolCall.Input,
+	}
+	defer func() {
+		result.ToolCalls = append(result.ToolCalls, record)
+	}()
+
+	if l.resultsMissing(result) {
+		record.Error = "cannot finish before the results are submitted with the submit_result tool"
+		return ToolResult{ToolCallID: toolCall.ID, Content: record.Error, IsError: true}, false, nil
+	}
+
+	if summary, _ := toolCall.Input["summary"].(string); summary != "" {
+		result.FinalResponse = summary
+	}
+	record.Output = "Finished."
+	return ToolResult{ToolCallID: toolCall.ID, Content: record.Output}, true, nil
+}
+
+// resultsMissing returns true if results are declared but have not been submitted
+func (l *Loop) resultsMissing(result *Result) bool {
+	return len(l.Results) > 0 && result.Results == nil
+}
+
+// approve asks for approval of the tool call if the config or the policy requires it.
+// It returns nil if no approval is required.
+func (l *Loop) approve(ctx context.Context, tool Tool, toolCall ToolCall) (*ApprovalDecision, error) {
+	// A dry run changes nothing, so there is nothing to approve
+	if l.DryRun && isMutating(tool) {
+		return nil, nil
+	}
+
+	reason := ""
+	if slices.Contains(l.RequireApproval, toolCall.Name) {
+		reason = fmt.Sprintf("Tool %s requires approval", toolCall.Name)
+	} else if policy, ok := l.Policy.(ApprovalPolicy); ok {
+		required, err := policy.RequiresApproval(ctx, toolCall)
+		if err != nil {
+			return nil, err
+		}
+		if required {
+			reason = fmt.Sprintf("Policy requires approval for tool %s", toolCall.Name)
+		}
+	}
+	if reason == "" {
+		return nil, nil
+	}
+
+	// Fail closed when nobody can approve the call
+	if l.Approver == nil {
+		return &ApprovalDecision{Message: "no approver is configured"}, nil
+	}
+
+	decision, err := l.Approver.RequestApproval(ctx, toolCall, reason)
+	if err != nil {
+		return nil, err
+	}
+	return &decision, nil
 }
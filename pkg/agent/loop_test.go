@@ -26,6 +26,7 @@ type mockTool struct {
 	name   string
 	result string
 	err    error
+	calls  int
 }
 
 func (m *mockTool) Name() string {
@@ -33,6 +34,7 @@ func (m *mockTool) Name() string {
 }
 
 func (m *mockTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	m.calls++
 	if m.err != nil {
 		return "", m.err
 	}
@@ -51,6 +53,18 @@ func (m *mockPolicy) Allow(ctx context.Context, toolCall ToolCall) error {
 	return errors.New("policy violation")
 }
 
+// mockApprover records approval requests and returns a fixed decision
+type mockApprover struct {
+	decision ApprovalDecision
+	err      error
+	requests []ToolCall
+}
+
+func (m *mockApprover) RequestApproval(ctx context.Context, toolCall ToolCall, reason string) (ApprovalDecision, error) {
+	m.requests = append(m.requests, toolCall)
+	return m.decision, m.err
+}
+
 func TestLoop_SuccessfulCompletion(t *testing.T) {
 	// Setup mock provider that returns confident response on first iteration
 	provider := &mockProvider{
@@ -97,8 +111,9 @@ func TestLoop_SuccessfulCompletion(t *testing.T) {
 		t.Errorf("Result.Status = %v, want succeeded", result.Status)
 	}
 
-	if result.Iterations != 1 {
-		t.Errorf("Result.Iterations = %d, want 1", result.Iterations)
+	// One turn calls the tool, the next ends the run
+	if result.Iterations != 2 {
+		t.Errorf("Result.Iterations = %d, want 2", result.Iterations)
 	}
 
 	if len(result.ToolCalls) != 1 {
@@ -111,12 +126,13 @@ func TestLoop_SuccessfulCompletion(t *testing.T) {
 }
 
 func TestLoop_MaxIterationsReached(t *testing.T) {
-	// Setup mock provider that never returns confident response
+	// Setup mock provider that keeps calling tools and never finishes
+	toolCalls := []ToolCall{{ID: "1", Name: "k8s_get_resources"}}
 	provider := &mockProvider{
 		responses: []*Response{
-			{Content: "Iteration 1", StopReason: "end_turn", TokensIn: 100, TokensOut: 50},
-			{Content: "Iteration 2", StopReason: "end_turn", TokensIn: 100, TokensOut: 50},
-			{Content: "Iteration 3", StopReason: "end_turn", TokensIn: 100, TokensOut: 50},
+			{Content: "Iteration 1", ToolCalls: toolCalls, StopReason: "tool_use", TokensIn: 100, TokensOut: 50},
+			{Content: "Iteration 2", ToolCalls: toolCalls, StopReason: "tool_use", TokensIn: 100, TokensOut: 50},
+			{Content: "Iteration 3", ToolCalls: toolCalls, StopReason: "tool_use", TokensIn: 100, TokensOut: 50},
 		},
 	}
 
@@ -124,7 +140,7 @@ func TestLoop_MaxIterationsReached(t *testing.T) {
 
 	loop := &Loop{
 		Provider:      provider,
-		Tools:         map[string]Tool{},
+		Tools:         map[string]Tool{"k8s_get_resources": &mockTool{name: "k8s_get_resources", result: "pods"}},
 		Policy:        policy,
 		Goal:          "Test goal",
 		MaxIterations: 3,
@@ -224,3 +240,304 @@ func TestLoop_ToolNotFound(t *testing.T) {
 		t.Errorf("Result.Status = %v, want failed", result.Status)
 	}
 }
+
+func TestLoop_Approval(t *testing.T) {
+	tests := []struct {
+		name         string
+		approver     *mockApprover
+		wantCalls    int
+		wantApproval string
+		wantError    string
+	}{
+		{
+			name:         "approved call runs",
+			approver:     &mockApprover{decision: ApprovalDecision{Approved: true}},
+			wantCalls:    1,
+			wantApproval: "approved",
+		},
+		{
+			name:         "rejected call is reported to the agent",
+			approver:     &mockApprover{decision: ApprovalDecision{Message: "not during the freeze"}},
+			wantCalls:    0,
+			wantApproval: "rejected",
+			wantError:    "tool call rejected: not during the freeze",
+		},
+		{
+			name:         "no approver rejects the call",
+			wantCalls:    0,
+			wantApproval: "rejected",
+			wantError:    "tool call rejected: no approver is configured",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &mockProvider{
+				responses: []*Response{
+					{
+						Content:    "Deploying",
+						ToolCalls:  []ToolCall{{ID: "1", Name: "tekton_create_pipelinerun", Input: map[string]interface{}{"namespace": "prod"}}},
+						StopReason: "tool_use",
+					},
+					{
+						Content:    "Done",
+						StopReason: "end_turn",
+					},
+				},
+			}
+			tool := &mockTool{name: "tekton_create_pipelinerun", result: "created"}
+
+			loop := &Loop{
+				Provider:        provider,
+				Tools:           map[string]Tool{"tekton_create_pipelinerun": tool},
+				Policy:          &mockPolicy{allowAll: true},
+				Goal:            "Deploy",
+				MaxIterations:   3,
+				RequireApproval: []string{"tekton_create_pipelinerun"},
+			}
+			if tt.approver != nil {
+				loop.Approver = tt.approver
+			}
+
+			result, err := loop.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Loop.Run() error = %v", err)
+			}
+			if result.Status != "succeeded" {
+				t.Errorf("Result.Status = %v, want succeeded", result.Status)
+			}
+			if tool.calls != tt.wantCalls {
+				t.Errorf("tool calls = %d, want %d", tool.calls, tt.wantCalls)
+			}
+			if tt.approver != nil && len(tt.approver.requests) != 1 {
+				t.Errorf("approval requests = %d, want 1", len(tt.approver.requests))
+			}
+			if len(result.ToolCalls) != 1 {
+				t.Fatalf("Result.ToolCalls length = %d, want 1", len(result.ToolCalls))
+			}
+			if got := result.ToolCalls[0].Approval; got != tt.wantApproval {
+				t.Errorf("ToolCallRecord.Approval = %q, want %q", got, tt.wantApproval)
+			}
+			if got := result.ToolCalls[0].Error; got != tt.wantError {
+				t.Errorf("ToolCallRecord.Error = %q, want %q", got, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestLoop_ApprovalNotRequired(t *testing.T) {
+	provider := &mockProvider{
+		responses: []*Response{
+			{
+				Content:    "Let me check the pods",
+				ToolCalls:  []ToolCall{{ID: "1", Name: "k8s_get_resources", Input: map[string]interface{}{}}},
+				StopReason: "tool_use",
+			},
+			{
+				Content:    "Done",
+				StopReason: "end_turn",
+			},
+		},
+	}
+	approver := &mockApprover{}
+
+	loop := &Loop{
+		Provider:        provider,
+		Tools:           map[string]Tool{"k8s_get_resources": &mockTool{name: "k8s_get_resources", result: "pods"}},
+		Policy:          &mockPolicy{allowAll: true},
+		Goal:            "Check pods",
+		MaxIterations:   3,
+		RequireApproval: []string{"tekton_create_pipelinerun"},
+		Approver:        approver,
+	}
+
+	if _, err := loop.Run(context.Background()); err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+	if len(approver.requests) != 0 {
+		t.Errorf("approval requests = %d, want 0", len(approver.requests))
+	}
+}
+
+func TestLoop_ApprovalError(t *testing.T) {
+	provider := &mockProvider{
+		responses: []*Response{
+			{
+				Content:    "Deploying",
+				ToolCalls:  []ToolCall{{ID: "1", Name: "tekton_create_pipelinerun", Input: map[string]interface{}{}}},
+				StopReason: "tool_use",
+			},
+		},
+	}
+	tool := &mockTool{name: "tekton_create_pipelinerun", result: "created"}
+
+	loop := &Loop{
+		Provider:        provider,
+		Tools:           map[string]Tool{"tekton_create_pipelinerun": tool},
+		Policy:          &mockPolicy{allowAll: true},
+		Goal:            "Deploy",
+		MaxIterations:   3,
+		RequireApproval: []string{"tekton_create_pipelinerun"},
+		Approver:        &mockApprover{err: context.Canceled},
+	}
+
+	result, err := loop.Run(context.Background())
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Loop.Run() error = %v, want context.Canceled", err)
+	}
+	if result.Status != "failed" {
+		t.Errorf("Result.Status = %v, want failed", result.Status)
+	}
+	if tool.calls != 0 {
+		t.Errorf("tool calls = %d, want 0", tool.calls)
+	}
+}
+
+func TestLoop_DryRun(t *testing.T) {
+	provider := &mockProvider{
+		responses: []*Response{
+			{
+				Content: "Checking pods, then deploying",
+				ToolCalls: []ToolCall{
+					{ID: "1", Name: "k8s_get_resources", Input: map[string]interface{}{"namespace": "prod"}},
+					{ID: "2", Name: "tekton_create_pipelinerun", Input: map[string]interface{}{"namespace": "prod", "name": "deploy-1"}},
+				},
+				StopReason: "tool_use",
+			},
+			{
+				Content:    "Deployment rehearsed",
+				StopReason: "end_turn",
+			},
+		},
+	}
+	reader := &mockTool{name: "k8s_get_resources", result: "pods"}
+	creator := &mockMutatingTool{mockTool{name: "tekton_create_pipelinerun", result: "DRY RUN: would create"}}
+	approver := &mockApprover{decision: ApprovalDecision{Approved: false, Message: "no"}}
+
+	loop := &Loop{
+		Provider:        provider,
+		Tools:           map[string]Tool{"k8s_get_resources": reader, "tekton_create_pipelinerun": creator},
+		Policy:          &mockPolicy{allowAll: true},
+		Goal:            "Deploy",
+		MaxIterations:   3,
+		DryRun:          true,
+		RequireApproval: []string{"tekton_create_pipelinerun"},
+		Approver:        approver,
+	}
+
+	result, err := loop.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+	if creator.calls != 1 {
+		t.Errorf("mutating tool calls = %d, want 1", creator.calls)
+	}
+	if len(approver.requests) != 0 {
+		t.Errorf("approval requests = %d, want 0 for simulated calls", len(approver.requests))
+	}
+	if result.ToolCalls[0].Simulated || !result.ToolCalls[1].Simulated {
+		t.Errorf("only the mutating call should be marked simulated: %+v", result.ToolCalls)
+	}
+	if result.ToolCalls[1].Error != "" {
+		t.Errorf("simulated call error = %q, want none", result.ToolCalls[1].Error)
+	}
+}
+
+func TestLoop_Finish(t *testing.T) {
+	provider := &mockProvider{
+		responses: []*Response{
+			{
+				Content: "Checking pods, then I'm done",
+				ToolCalls: []ToolCall{
+					{ID: "1", Name: "k8s_get_resources", Input: map[string]interface{}{"namespace": "default"}},
+					{ID: "2", Name: FinishTool, Input: map[string]interface{}{"summary": "All pods are running"}},
+				},
+				StopReason: "tool_use",
+			},
+		},
+	}
+	tool := &mockTool{name: "k8s_get_resources", result: "pods"}
+
+	loop := &Loop{
+		Provider:      provider,
+		Tools:         map[string]Tool{"k8s_get_resources": tool},
+		Policy:        &mockPolicy{allowAll: true},
+		Goal:          "Check pods",
+		MaxIterations: 3,
+	}
+
+	result, err := loop.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+	if result.Status != "succeeded" || result.Iterations != 1 {
+		t.Errorf("Status = %v, Iterations = %d, want succeeded after 1 iteration", result.Status, result.Iterations)
+	}
+	if tool.calls != 1 {
+		t.Errorf("tool calls = %d, want the call before finish to run", tool.calls)
+	}
+	if result.FinalResponse != "All pods are running" {
+		t.Errorf("FinalResponse = %q, want the finish summary", result.FinalResponse)
+	}
+}
+
+func TestLoop_FinishRequiresResults(t *testing.T) {
+	provider := &mockProvider{
+		responses: []*Response{
+			{Content: "Done", ToolCalls: []ToolCall{{ID: "1", Name: FinishTool}}, StopReason: "tool_use"},
+			{
+				Content:    "Submitting",
+				ToolCalls:  []ToolCall{{ID: "2", Name: SubmitResultTool, Input: map[string]interface{}{"root-cause": "disk full"}}},
+				StopReason: "tool_use",
+			},
+		},
+	}
+
+	loop := &Loop{
+		Provider:      provider,
+		Tools:         map[string]Tool{},
+		Policy:        &mockPolicy{allowAll: true},
+		Goal:          "Find why the build failed",
+		MaxIterations: 3,
+		Results:       []ResultField{{Name: "root-cause"}},
+	}
+
+	result, err := loop.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+	if result.Status != "succeeded" || result.Iterations != 2 {
+		t.Errorf("Status = %v, Iterations = %d, want succeeded after 2 iterations", result.Status, result.Iterations)
+	}
+	if result.ToolCalls[0].Error == "" {
+		t.Error("finish should be refused before the results are submitted")
+	}
+}
+
+func TestLoop_TruncatedResponse(t *testing.T) {
+	provider := &mockProvider{
+		responses: []*Response{
+			{Content: "The pods are", StopReason: "max_tokens"},
+			{Content: "The pods are all running", StopReason: "end_turn"},
+		},
+	}
+
+	loop := &Loop{
+		Provider:      provider,
+		Tools:         map[string]Tool{},
+		Policy:        &mockPolicy{allowAll: true},
+		Goal:          "Check pods",
+		MaxIterations: 3,
+	}
+
+	result, err := loop.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+	if result.Status != "succeeded" || result.Iterations != 2 {
+		t.Errorf("Status = %v, Iterations = %d, want succeeded after 2 iterations", result.Status, result.Iterations)
+	}
+	if result.FinalResponse != "The pods are all running" {
+		t.Errorf("FinalResponse = %q", result.FinalResponse)
+	}
+}
@@ -13,13 +13,31 @@ type OPAPolicy struct {
 	PolicyContent string
 	Data          map[string]interface{}
 	query         rego.PreparedEvalQuery
+	approvalQuery rego.PreparedEvalQuery
 }
 
 // Initialize compiles the OPA policy
 func (o *OPAPolicy) Initialize() error {
+	query, err := o.prepare("data.agent.tools.allow")
+	if err != nil {
+		return err
+	}
+
+	approvalQuery, err := o.prepare("data.agent.tools.require_approval")
+	if err != nil {
+		return err
+	}
+
+	o.query = query
+	o.approvalQuery = approvalQuery
+	return nil
+}
+
+// prepare compiles the policy for the given query
+func (o *OPAPolicy) prepare(queryString string) (rego.PreparedEvalQuery, error) {
 	// Build the query options
 	opts := []func(*rego.Rego){
-		rego.Query("data.agent.tools.allow"),
+		rego.Query(queryString),
 		rego.Module("agent.rego", o.PolicyContent),
 	}
 
@@ -35,27 +53,15 @@ func (o *OPAPolicy) Initialize() error {
 	// Prepare the query
 	query, err := r.PrepareForEval(context.Background())
 	if err != nil {
-		return fmt.Errorf("failed to compile policy: %w", err)
+		return rego.PreparedEvalQuery{}, fmt.Errorf("failed to compile policy: %w", err)
 	}
-
-	o.query = query
-	return nil
+	return query, nil
 }
 
 // Allow checks if a tool call is allowed by the policy
 func (o *OPAPolicy) Allow(ctx context.Context, toolCall ToolCall) error {
-	// Build input for policy evaluation
-	input := map[string]interface{}{
-		"tool": toolCall.Name,
-	}
-
-	// Add all input parameters
-	for k, v := range toolCall.Input {
-		input[k] = v
-	}
-
 	// Evaluate the policy
-	results, err := o.query.Eval(ctx, rego.EvalInput(input))
+	results, err := o.query.Eval(ctx, rego.EvalInput(policyInput(toolCall)))
 	if err != nil {
 		// Fail closed on evaluation error
 		return fmt.Errorf("policy evaluation failed: %w", err)
@@ -78,3 +84,34 @@ func (o *OPAPolicy) Allow(ctx context.Context, toolCall ToolCall) error {
 
 	return nil
 }
+
+// RequiresApproval checks if the policy's require_approval rule holds for a tool call.
+// Policies without a require_approval rule never require approval.
+func (o *OPAPolicy) RequiresApproval(ctx context.Context, toolCall ToolCall) (bool, error) {
+	results, err := o.approvalQuery.Eval(ctx, rego.EvalInput(policyInput(toolCall)))
+	if err != nil {
+		return false, fmt.Errorf("policy evaluation failed: %w", err)
+	}
+
+	// An undefined rule yields no results
+	if len(results) == 0 {
+		return false, nil
+	}
+
+	required, ok := results[0].Expressions[0].Value.(bool)
+	if !ok {
+		return false, fmt.Errorf("require_approval rule returned invalid result type")
+	}
+	return required, nil
+}
+
+// policyInput builds the input for policy evaluation from the tool name and its input parameters
+func policyInput(toolCall ToolCall) map[string]interface{} {
+	input := map[string]interface{}{
+		"tool": toolCall.Name,
+	}
+	for k, v := range toolCall.Input {
+		input[k] = v
+	}
+	return input
+}
@@ -211,3 +211,85 @@ deny[msg] {
 		})
 	}
 }
+
+func TestOPAPolicy_RequiresApproval(t *testing.T) {
+	policy := &OPAPolicy{
+		PolicyContent: `
+package agent.tools
+
+default allow = true
+
+require_approval {
+    input.tool == "tekton_create_pipelinerun"
+    input.namespace == "production"
+}
+`,
+	}
+	if err := policy.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		toolCall ToolCall
+		want     bool
+	}{
+		{
+			name: "pipelinerun in production",
+			toolCall: ToolCall{
+				Name:  "tekton_create_pipelinerun",
+				Input: map[string]interface{}{"namespace": "production"},
+			},
+			want: true,
+		},
+		{
+			name: "pipelinerun in staging",
+			toolCall: ToolCall{
+				Name:  "tekton_create_pipelinerun",
+				Input: map[string]interface{}{"namespace": "staging"},
+			},
+			want: false,
+		},
+		{
+			name: "read-only tool",
+			toolCall: ToolCall{
+				Name:  "k8s_get_resources",
+				Input: map[string]interface{}{"namespace": "production"},
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.RequiresApproval(context.Background(), tt.toolCall)
+			if err != nil {
+				t.Fatalf("RequiresApproval() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RequiresApproval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOPAPolicy_RequiresApprovalUndefined(t *testing.T) {
+	policy := &OPAPolicy{
+		PolicyContent: `
+package agent.tools
+
+default allow = true
+`,
+	}
+	if err := policy.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	got, err := policy.RequiresApproval(context.Background(), ToolCall{Name: "tekton_create_pipelinerun"})
+	if err != nil {
+		t.Fatalf("RequiresApproval() error = %v", err)
+	}
+	if got {
+		t.Error("RequiresApproval() = true, want false for a policy without require_approval")
+	}
+}
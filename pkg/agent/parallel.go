@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"context"
+	"sync"
+)
+
+// isParallel returns true if calls of the tool may run concurrently. Mutating tools
+// never do, whatever they claim.
+func isParallel(tool Tool) bool {
+	p, ok := tool.(ParallelTool)
+	return ok && p.Parallel() && !isMutating(tool)
+}
+
+// executeToolCalls runs the tool calls of a turn that have not run yet and returns
+// the results of all its calls in the order of the calls. Consecutive calls of
+// parallel tools run concurrently; all other calls run one at a time. The run is
+// checkpointed after each call, and before each mutating call takes effect. It
+// returns true if a call ends the run.
+func (l *Loop) executeToolCalls(ctx context.Context, result *Result, messages []Message, turn *Turn) ([]ToolResult, bool, error) {
+	toolCalls := turn.ToolCalls
+	finished := false
+	for i := len(turn.ToolResults); i < len(toolCalls); {
+		// A mutating call cut short by a restart may have taken effect, so it is not run again
+		if turn.Running != "" && turn.Running == toolCalls[i].ID {
+			turn.ToolResults = append(turn.ToolResults, interrupted(result, toolCalls[i]))
+			turn.Running = ""
+			l.checkpoint(ctx, result, messages, turn)
+			i++
+			continue
+		}
+
+		end := i
+		for end < len(toolCalls) && l.parallelCall(toolCalls[end]) {
+			end++
+		}
+		if end-i > 1 {
+			batch, err := l.executeParallel(ctx, result, toolCalls[i:end])
+			turn.ToolResults = append(turn.ToolResults, batch...)
+			if err != nil {
+				return turn.ToolResults, false, err
+			}
+			l.checkpoint(ctx, result, messages, turn)
+			i = end
+			continue
+		}
+
+		toolCall := toolCalls[i]
+		toolResult, done, err := l.executeToolCall(ctx, result, toolCall, func() {
+			turn.Running = toolCall.ID
+			l.checkpoint(ctx, result, messages, turn)
+		})
+		turn.Running = ""
+		if err != nil {
+			return turn.ToolResults, false, err
+		}
+		turn.ToolResults = append(turn.ToolResults, toolResult)
+		l.checkpoint(ctx, result, messages, turn)
+		finished = finished || done
+		i++
+	}
+	return turn.ToolResults, finished, nil
+}
+
+// parallelCall returns true if the call may run concurrently with its neighbours
+func (l *Loop) parallelCall(toolCall ToolCall) bool {
+	if l.MaxParallelToolCalls <= 1 || toolCall.Name == FinishTool || toolCall.Name == SubmitResultTool {
+		return false
+	}
+	tool, ok := l.Tools[toolCall.Name]
+	return ok && isParallel(tool)
+}
+
+// executeParallel runs calls of parallel tools. Each call is checked against the
+// policy and approval requirements in order before any of them runs; the approved
+// calls then run at most MaxParallelToolCalls at a time. The calls are recorded in
+// order. A policy or approval error ends the run after the calls before it have run.
+func (l *Loop) executeParallel(ctx context.Context, result *Result, toolCalls []ToolCall) ([]ToolResult, error) {
+	records := make([]ToolCallRecord, 0, len(toolCalls))
+	toolResults := make([]ToolResult, 0, len(toolCalls))
+	tools := make([]Tool, 0, len(toolCalls))
+
+	var checkErr error
+	for _, toolCall := range toolCalls {
+		tool, err := l.authorize(ctx, result, toolCall)
+		if err != nil {
+			checkErr = err
+			break
+		}
+
+		record := ToolCallRecord{
+			ID:    toolCall.ID,
+			Name:  toolCall.Name,
+			Input: toolCall.Input,
+		}
+		approved, err := l.requestApproval(ctx, result, tool, toolCall, &record)
+		if err != nil {
+			checkErr = err
+			break
+		}
+		if !approved {
+			// A rejected call is not run
+			tool = nil
+		}
+
+		records = append(records, record)
+		toolResults = append(toolResults, ToolResult{
+			ToolCallID: toolCall.ID,
+			Content:    record.Error,
+			IsError:    true,
+		})
+		tools = append(tools, tool)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, l.MaxParallelToolCalls)
+	for i, tool := range tools {
+		if tool == nil {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			toolResults[i] = l.runTool(ctx, tool, toolCalls[i], &records[i])
+		}()
+	}
+	wg.Wait()
+
+	result.ToolCalls = append(result.ToolCalls, records...)
+	return toolResults, checkErr
+}
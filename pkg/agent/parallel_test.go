@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockParallelTool is a read-only tool that records how many of its calls run at once.
+// Each call waits until wait calls are running, or until a short timeout.
+type mockParallelTool struct {
+	name string
+	wait int
+
+	mu      sync.Mutex
+	running int
+	peak    int
+	calls   int
+	all     chan struct{}
+}
+
+func (m *mockParallelTool) Name() string {
+	return m.name
+}
+
+func (m *mockParallelTool) Parallel() bool {
+	return true
+}
+
+func (m *mockParallelTool) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	m.mu.Lock()
+	m.running++
+	m.calls++
+	m.peak = max(m.peak, m.running)
+	if m.calls == m.wait {
+		close(m.all)
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-m.all:
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	m.mu.Lock()
+	m.running--
+	m.mu.Unlock()
+	return fmt.Sprintf("logs of %v", input["pod"]), nil
+}
+
+func newMockParallelTool(wait int) *mockParallelTool {
+	return &mockParallelTool{name: "k8s_get_logs", wait: wait, all: make(chan struct{})}
+}
+
+func logCalls(pods ...string) []ToolCall {
+	calls := make([]ToolCall, 0, len(pods))
+	for i, pod := range pods {
+		calls = append(calls, ToolCall{ID: fmt.Sprint(i + 1), Name: "k8s_get_logs", Input: map[string]interface{}{"pod": pod}})
+	}
+	return calls
+}
+
+func TestLoop_ParallelToolCalls(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxParallel int
+		wantPeak    int
+	}{
+		{name: "concurrent", maxParallel: 4, wantPeak: 4},
+		{name: "bounded", maxParallel: 2, wantPeak: 2},
+		{name: "serial", maxParallel: 0, wantPeak: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := newMockParallelTool(4)
+			provider := &mockProvider{
+				responses: []*Response{
+					{Content: "Fetching logs", ToolCalls: logCalls("a", "b", "c", "d"), StopReason: "tool_use"},
+					{Content: "Done", StopReason: "end_turn"},
+				},
+			}
+			loop := &Loop{
+				Provider:             provider,
+				Tools:                map[string]Tool{"k8s_get_logs": tool},
+				Policy:               &mockPolicy{allowAll: true},
+				Goal:                 "Find why the build failed",
+				MaxIterations:        3,
+				MaxParallelToolCalls: tt.maxParallel,
+			}
+
+			result, err := loop.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Loop.Run() error = %v", err)
+			}
+			if tool.peak != tt.wantPeak {
+				t.Errorf("peak concurrent calls = %d, want %d", tool.peak, tt.wantPeak)
+			}
+
+			// Records and results keep the order of the calls
+			if len(result.ToolCalls) != 4 {
+				t.Fatalf("ToolCalls = %+v, want 4 records", result.ToolCalls)
+			}
+			for i, pod := range []string{"a", "b", "c", "d"} {
+				if record := result.ToolCalls[i]; record.ID != fmt.Sprint(i+1) || record.Output != "logs of "+pod {
+					t.Errorf("ToolCalls[%d] = %+v, want the logs of %s", i, record, pod)
+				}
+			}
+			toolResults := result.Messages[2].Content
+			if strings.Index(toolResults, "logs of a") > strings.Index(toolResults, "logs of d") {
+				t.Errorf("tool results = %q, want them in the order of the calls", toolResults)
+			}
+		})
+	}
+}
+
+func TestLoop_ParallelToolCallsApproval(t *testing.T) {
+	tool := newMockParallelTool(2)
+	creator := &mockMutatingTool{mockTool{name: "tekton_create_pipelinerun", result: "created"}}
+	approver := &mockApprover{decision: ApprovalDecision{Approved: false, Message: "not now"}}
+	calls := append(logCalls("a", "b"), ToolCall{ID: "3", Name: "tekton_create_pipelinerun"}, ToolCall{ID: "4", Name: "k8s_get_logs", Input: map[string]interface{}{"pod": "c"}})
+
+	provider := &mockProvider{
+		responses: []*Response{
+			{Content: "Fetching logs", ToolCalls: calls, StopReason: "tool_use"},
+			{Content: "Done", StopReason: "end_turn"},
+		},
+	}
+	loop := &Loop{
+		Provider:             provider,
+		Tools:                map[string]Tool{"k8s_get_logs": tool, "tekton_create_pipelinerun": creator},
+		Policy:               &mockPolicy{allowAll: true},
+		Goal:                 "Find why the build failed",
+		MaxIterations:        3,
+		MaxParallelToolCalls: 4,
+		RequireApproval:      []string{"tekton_create_pipelinerun"},
+		Approver:             approver,
+	}
+
+	result, err := loop.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+
+	// The mutating call splits the turn: a and b run together, c runs on its own
+	if tool.calls != 3 || creator.calls != 0 {
+		t.Errorf("calls = %d reads, %d creates, want 3 reads and the rejected create not executed", tool.calls, creator.calls)
+	}
+	if len(result.ToolCalls) != 4 || result.ToolCalls[2].Approval != "rejected" || result.ToolCalls[3].Output != "logs of c" {
+		t.Errorf("ToolCalls = %+v, want every call recorded in order", result.ToolCalls)
+	}
+}
+
+func TestLoop_ParallelToolCallsPolicy(t *testing.T) {
+	tool := newMockParallelTool(2)
+	provider := &mockProvider{
+		responses: []*Response{
+			{Content: "Fetching logs", ToolCalls: logCalls("a", "b"), StopReason: "tool_use"},
+		},
+	}
+	loop := &Loop{
+		Provider:             provider,
+		Tools:                map[string]Tool{"k8s_get_logs": tool},
+		Policy:               &mockPolicy{allowAll: false},
+		Goal:                 "Find why the build failed",
+		MaxIterations:        3,
+		MaxParallelToolCalls: 4,
+	}
+
+	result, err := loop.Run(context.Background())
+	if err == nil || result.Status != "failed" {
+		t.Fatalf("Loop.Run() error = %v, Status = %v, want a policy violation", err, result.Status)
+	}
+	if tool.calls != 0 {
+		t.Errorf("calls = %d, want no call to run before the policy allows it", tool.calls)
+	}
+}
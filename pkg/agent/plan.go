@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+)
+
+// proposedOutput is returned to the LLM for mutating tool calls in plan-only mode
+const proposedOutput = "Recorded as a proposed action. It has not been executed; it will run once the plan is reviewed and executed."
+
+// isMutating returns true if the tool changes cluster state
+func isMutating(tool Tool) bool {
+	m, ok := tool.(MutatingTool)
+	return ok && m.Mutating()
+}
+
+// ExecutePlan performs exactly the tool calls of a reviewed plan, in order, without
+// consulting the LLM. Each call is still checked against the policy and approval
+// requirements. Execution stops at the first call that fails or is rejected. When
+// resuming, the calls already recorded in Resume are skipped, and a call that was
+// running when it was saved fails the run since it may have taken effect.
+func (l *Loop) ExecutePlan(ctx context.Context, plan []ToolCall) (*Result, error) {
+	result := &Result{
+		Status:    "succeeded",
+		ToolCalls: []ToolCallRecord{},
+	}
+
+	turn := &Turn{ToolCalls: plan}
+	done := 0
+	if l.Resume != nil {
+		l.restore(result)
+		done = len(result.ToolCalls)
+		if r := l.Resume.Turn; r != nil && done < len(plan) && r.Running == plan[done].ID {
+			interrupted(result, plan[done])
+			result.Status = "failed"
+			result.Error = fmt.Sprintf("Planned action %d (%s) was interrupted by a restart and may have taken effect", done+1, plan[done].Name)
+			return result, nil
+		}
+	}
+
+	for i, toolCall := range plan {
+		if i < done {
+			continue
+		}
+
+		// Check policy
+		if err := l.Policy.Allow(ctx, toolCall); err != nil {
+			result.Status = "failed"
+			result.Error = fmt.Sprintf("Policy violation for tool %s: %v", toolCall.Name, err)
+			return result, fmt.Errorf("policy violation: %w", err)
+		}
+
+		// Find tool
+		tool, ok := l.Tools[toolCall.Name]
+		if !ok {
+			result.Status = "failed"
+			result.Error = fmt.Sprintf("Tool not found: %s", toolCall.Name)
+			return result, fmt.Errorf("tool not found: %s", toolCall.Name)
+		}
+
+		record := ToolCallRecord{
+			ID:    toolCall.ID,
+			Name:  toolCall.Name,
+			Input: toolCall.Input,
+		}
+
+		// Wait for a human decision if the call requires approval
+		decision, err := l.approve(ctx, tool, toolCall)
+		if err != nil {
+			result.Status = "failed"
+			result.Error = fmt.Sprintf("Approval for tool %s failed: %v", toolCall.Name, err)
+			return result, fmt.Errorf("approval failed: %w", err)
+		}
+		if decision != nil {
+			if !decision.Approved {
+				record.Approval = "rejected"
+				record.Error = fmt.Sprintf("tool call rejected: %s", decision.Message)
+				result.ToolCalls = append(result.ToolCalls, record)
+				result.Status = "failed"
+				result.Error = fmt.Sprintf("Planned action %d (%s) was rejected: %s", i+1, toolCall.Name, decision.Message)
+				return result, nil
+			}
+			record.Approval = "approved"
+		}
+
+		if isMutating(tool) && !l.DryRun {
+			turn.Running = toolCall.ID
+			l.checkpoint(ctx, result, nil, turn)
+		}
+		l.runTool(ctx, tool, toolCall, &record)
+		result.ToolCalls = append(result.ToolCalls, record)
+		turn.Running = ""
+		l.checkpoint(ctx, result, nil, turn)
+		if record.Error != "" {
+			result.Status = "failed"
+			result.Error = fmt.Sprintf("Planned action %d (%s) failed: %s", i+1, toolCall.Name, record.Error)
+			return result, nil
+		}
+	}
+
+	if l.DryRun {
+		result.FinalResponse = fmt.Sprintf("Simulated %d planned actions with dry run", len(plan))
+	} else {
+		result.FinalResponse = fmt.Sprintf("Executed %d planned actions", len(plan))
+	}
+	return result, nil
+}
@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// mockMutatingTool is a mockTool that changes cluster state
+type mockMutatingTool struct {
+	mockTool
+}
+
+func (m *mockMutatingTool) Mutating() bool {
+	return true
+}
+
+func TestLoop_PlanOnly(t *testing.T) {
+	provider := &mockProvider{
+		responses: []*Response{
+			{
+				Content: "Checking pods, then deploying",
+				ToolCalls: []ToolCall{
+					{ID: "1", Name: "k8s_get_resources", Input: map[string]interface{}{"namespace": "prod"}},
+					{ID: "2", Name: "tekton_create_pipelinerun", Input: map[string]interface{}{"namespace": "prod", "name": "deploy-1"}},
+				},
+				StopReason: "tool_use",
+			},
+			{
+				Content:    "Plan ready",
+				StopReason: "end_turn",
+			},
+		},
+	}
+	reader := &mockTool{name: "k8s_get_resources", result: "pods"}
+	creator := &mockMutatingTool{mockTool{name: "tekton_create_pipelinerun", result: "created"}}
+	approver := &mockApprover{decision: ApprovalDecision{Approved: true}}
+
+	loop := &Loop{
+		Provider:        provider,
+		Tools:           map[string]Tool{"k8s_get_resources": reader, "tekton_create_pipelinerun": creator},
+		Policy:          &mockPolicy{allowAll: true},
+		Goal:            "Deploy",
+		MaxIterations:   3,
+		PlanOnly:        true,
+		RequireApproval: []string{"tekton_create_pipelinerun"},
+		Approver:        approver,
+	}
+
+	result, err := loop.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+	if reader.calls != 1 {
+		t.Errorf("read-only tool calls = %d, want 1", reader.calls)
+	}
+	if creator.calls != 0 {
+		t.Errorf("mutating tool calls = %d, want 0", creator.calls)
+	}
+	if len(approver.requests) != 0 {
+		t.Errorf("approval requests = %d, want 0 (approval happens when the plan is executed)", len(approver.requests))
+	}
+	if len(result.Plan) != 1 || result.Plan[0].ID != "2" {
+		t.Fatalf("Result.Plan = %+v, want the tekton_create_pipelinerun call", result.Plan)
+	}
+	if !result.ToolCalls[1].Proposed || result.ToolCalls[0].Proposed {
+		t.Errorf("only the mutating call should be marked proposed: %+v", result.ToolCalls)
+	}
+}
+
+func TestLoop_ExecutePlan(t *testing.T) {
+	plan := []ToolCall{
+		{ID: "1", Name: "tekton_create_pipelinerun", Input: map[string]interface{}{"name": "deploy-1"}},
+		{ID: "2", Name: "tekton_create_pipelinerun", Input: map[string]interface{}{"name": "deploy-2"}},
+	}
+
+	tests := []struct {
+		name       string
+		tool       *mockMutatingTool
+		policy     Policy
+		approver   *mockApprover
+		wantStatus string
+		wantCalls  int
+		wantErr    bool
+	}{
+		{
+			name:       "all actions executed",
+			tool:       &mockMutatingTool{mockTool{name: "tekton_create_pipelinerun", result: "created"}},
+			policy:     &mockPolicy{allowAll: true},
+			approver:   &mockApprover{decision: ApprovalDecision{Approved: true}},
+			wantStatus: "succeeded",
+			wantCalls:  2,
+		},
+		{
+			name:       "tool failure stops execution",
+			tool:       &mockMutatingTool{mockTool{name: "tekton_create_pipelinerun", err: errors.New("already exists")}},
+			policy:     &mockPolicy{allowAll: true},
+			approver:   &mockApprover{decision: ApprovalDecision{Approved: true}},
+			wantStatus: "failed",
+			wantCalls:  1,
+		},
+		{
+			name:       "rejection stops execution",
+			tool:       &mockMutatingTool{mockTool{name: "tekton_create_pipelinerun", result: "created"}},
+			policy:     &mockPolicy{allowAll: true},
+			approver:   &mockApprover{decision: ApprovalDecision{Message: "no"}},
+			wantStatus: "failed",
+			wantCalls:  0,
+		},
+		{
+			name:       "policy still applies",
+			tool:       &mockMutatingTool{mockTool{name: "tekton_create_pipelinerun", result: "created"}},
+			policy:     &mockPolicy{allowAll: false},
+			approver:   &mockApprover{decision: ApprovalDecision{Approved: true}},
+			wantStatus: "failed",
+			wantCalls:  0,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loop := &Loop{
+				Tools:           map[string]Tool{"tekton_create_pipelinerun": tt.tool},
+				Policy:          tt.policy,
+				RequireApproval: []string{"tekton_create_pipelinerun"},
+				Approver:        tt.approver,
+			}
+
+			result, err := loop.ExecutePlan(context.Background(), plan)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExecutePlan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result.Status != tt.wantStatus {
+				t.Errorf("Result.Status = %v, want %v (error: %s)", result.Status, tt.wantStatus, result.Error)
+			}
+			if tt.tool.calls != tt.wantCalls {
+				t.Errorf("tool calls = %d, want %d", tt.tool.calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// ErrPromptTemplate is returned by Loop.Run when a prompt template fails to render
+var ErrPromptTemplate = errors.New("prompt template failed")
+
+// defaultPlannerPrompt is the planning prompt used when no planner template is configured
+const defaultPlannerPrompt = `Goal: {{.Goal}}
+{{- if .Context}}
+
+Context:
+{{.Context}}
+{{- end}}
+
+Please analyze this goal and take the necessary actions to achieve it.`
+
+// PromptData is the data the planner and reflector templates are rendered with.
+// The planner is rendered once for the first message of a run, the reflector
+// after every turn whose tool calls were executed.
+type PromptData struct {
+	// Goal is the goal of the run
+	Goal string
+	// Context is additional information about the goal, empty if there is none
+	Context string
+	// ToolCalls are the tool calls of the run so far, oldest first. It prints as
+	// one line per call; use {{range .ToolCalls}} to access Name, Input, Output and Error.
+	ToolCalls ToolCallHistory
+	// Iteration is the number of model turns taken so far
+	Iteration int
+	// MaxIterations is the maximum number of model turns of the run
+	MaxIterations int
+}
+
+// ToolCallHistory is the list of tool calls passed to the prompt templates
+type ToolCallHistory []ToolCallRecord
+
+// String summarizes the tool calls, one per line
+func (h ToolCallHistory) String() string {
+	if len(h) == 0 {
+		return "none"
+	}
+
+	lines := make([]string, 0, len(h))
+	for _, call := range h {
+		input, err := json.Marshal(call.Input)
+		if err != nil {
+			input = []byte("{}")
+		}
+
+		outcome := "succeeded"
+		switch {
+		case call.Proposed:
+			outcome = "proposed, not executed"
+		case call.Approval == "rejected":
+			outcome = "rejected"
+		case call.Error != "":
+			outcome = "failed: " + call.Error
+		case call.Simulated:
+			outcome = "simulated with dry run"
+		}
+		lines = append(lines, fmt.Sprintf("- %s %s: %s", call.Name, input, outcome))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParsePromptTemplate parses a planner or reflector template. It is rendered once
+// with empty data, so references to fields that PromptData lacks fail here rather
+// than in the middle of a run.
+func ParsePromptTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s template: %w", name, err)
+	}
+	if err := tmpl.Execute(io.Discard, PromptData{}); err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// renderPrompt renders a prompt template for the current state of the run
+func (l *Loop) renderPrompt(tmpl *template.Template, result *Result) (string, error) {
+	var out strings.Builder
+	err := tmpl.Execute(&out, PromptData{
+		Goal:          l.Goal,
+		Context:       l.Context,
+		ToolCalls:     ToolCallHistory(result.ToolCalls),
+		Iteration:     result.Iterations,
+		MaxIterations: l.MaxIterations,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %w", ErrPromptTemplate, tmpl.Name(), err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// reflect renders the reflector template, or returns an empty prompt if there is none.
+// A template error fails the run.
+func (l *Loop) reflect(result *Result) (string, error) {
+	if l.Reflector == nil {
+		return "", nil
+	}
+	prompt, err := l.renderPrompt(l.Reflector, result)
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		return "", err
+	}
+	return prompt, nil
+}
+
+var defaultPlanner = template.Must(ParsePromptTemplate("planner", defaultPlannerPrompt))
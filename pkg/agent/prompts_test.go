@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParsePromptTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{
+			name: "documented fields",
+			text: "Goal: {{.Goal}} {{.Context}} {{.ToolCalls}} {{.Iteration}}/{{.MaxIterations}}{{range .ToolCalls}}{{.Name}}{{end}}",
+		},
+		{
+			name:    "syntax error",
+			text:    "Goal: {{.Goal}",
+			wantErr: "failed to parse planner template",
+		},
+		{
+			name:    "unknown field",
+			text:    "Goal: {{.Objective}}",
+			wantErr: "invalid planner template",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePromptTemplate("planner", tt.text)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParsePromptTemplate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParsePromptTemplate() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestToolCallHistory_String(t *testing.T) {
+	history := ToolCallHistory{
+		{Name: "k8s_get_logs", Input: map[string]interface{}{"pod": "build"}, Output: "logs"},
+		{Name: "tekton_create_pipelinerun", Input: map[string]interface{}{}, Error: "already exists"},
+	}
+	want := "- k8s_get_logs {\"pod\":\"build\"}: succeeded\n- tekton_create_pipelinerun {}: failed: already exists"
+	if got := history.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := (ToolCallHistory{}).String(); got != "none" {
+		t.Errorf("String() of no calls = %q, want none", got)
+	}
+}
+
+func TestLoop_PromptTemplates(t *testing.T) {
+	planner, err := ParsePromptTemplate("planner", "Plan for {{.Goal}} ({{.Context}})")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reflector, err := ParsePromptTemplate("reflector", "Turn {{.Iteration}} of {{.MaxIterations}}. Done so far:\n{{.ToolCalls}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &mockProvider{
+		responses: []*Response{
+			{Content: "Checking", ToolCalls: []ToolCall{{ID: "1", Name: "k8s_get_logs", Input: map[string]interface{}{"pod": "build"}}}, StopReason: "tool_use"},
+			{Content: "The disk is full", StopReason: "end_turn"},
+		},
+	}
+	loop := &Loop{
+		Provider:      provider,
+		Tools:         map[string]Tool{"k8s_get_logs": &mockTool{name: "k8s_get_logs", result: "no space left on device"}},
+		Policy:        &mockPolicy{allowAll: true},
+		Goal:          "Find why the build failed",
+		Context:       "The build runs nightly",
+		MaxIterations: 3,
+		Planner:       planner,
+		Reflector:     reflector,
+	}
+
+	result, err := loop.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+
+	if got, want := result.Messages[0].Content, "Plan for Find why the build failed (The build runs nightly)"; got != want {
+		t.Errorf("first message = %q, want %q", got, want)
+	}
+	toolResults := result.Messages[2].Content
+	if !strings.Contains(toolResults, "no space left on device") || !strings.HasSuffix(toolResults, "Turn 1 of 3. Done so far:\n- k8s_get_logs {\"pod\":\"build\"}: succeeded") {
+		t.Errorf("tool results message = %q, want the results followed by the reflection", toolResults)
+	}
+}
+
+func TestLoop_DefaultPlanner(t *testing.T) {
+	provider := &mockProvider{responses: []*Response{{Content: "Done", StopReason: "end_turn"}}}
+	loop := &Loop{
+		Provider:      provider,
+		Tools:         map[string]Tool{},
+		Policy:        &mockPolicy{allowAll: true},
+		Goal:          "Check pods",
+		MaxIterations: 3,
+	}
+
+	result, err := loop.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+	if got, want := result.Messages[0].Content, "Goal: Check pods\n\nPlease analyze this goal and take the necessary actions to achieve it."; got != want {
+		t.Errorf("first message = %q, want %q", got, want)
+	}
+}
+
+func TestLoop_PromptTemplateError(t *testing.T) {
+	// A template that only fails once there are tool calls to range over
+	reflector, err := ParsePromptTemplate("reflector", "{{range .ToolCalls}}{{index $.ToolCalls 5}}{{end}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &mockProvider{
+		responses: []*Response{
+			{Content: "Checking", ToolCalls: []ToolCall{{ID: "1", Name: "k8s_get_logs"}}, StopReason: "tool_use"},
+		},
+	}
+	loop := &Loop{
+		Provider:      provider,
+		Tools:         map[string]Tool{"k8s_get_logs": &mockTool{name: "k8s_get_logs", result: "logs"}},
+		Policy:        &mockPolicy{allowAll: true},
+		Goal:          "Find why the build failed",
+		MaxIterations: 3,
+		Reflector:     reflector,
+	}
+
+	result, err := loop.Run(context.Background())
+	if !errors.Is(err, ErrPromptTemplate) {
+		t.Fatalf("Loop.Run() error = %v, want ErrPromptTemplate", err)
+	}
+	if result.Status != "failed" || !strings.Contains(result.Error, "reflector") {
+		t.Errorf("Status = %v, Error = %q, want a failure naming the template", result.Status, result.Error)
+	}
+}
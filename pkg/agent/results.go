@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SubmitResultTool is the name of the tool the agent submits its structured results with
+const SubmitResultTool = "submit_result"
+
+// submitResultReminder asks the LLM for its results when it finishes without submitting them
+const submitResultReminder = "You have not submitted your results yet. Call the submit_result tool with all of the declared results before finishing."
+
+// ResultField declares a structured result the agent must submit
+type ResultField struct {
+	Name string `json:"name"`
+	// Type is "string", "integer" or "boolean"; empty means string
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// SubmitResultSchema returns the JSON schema of the submit_result input for the declared results
+func SubmitResultSchema(fields []ResultField) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := make([]string, 0, len(fields))
+	for _, field := range fields {
+		property := map[string]interface{}{
+			"type": jsonSchemaType(field.Type),
+		}
+		if field.Description != "" {
+			property["description"] = field.Description
+		}
+		properties[field.Name] = property
+		required = append(required, field.Name)
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func jsonSchemaType(resultType string) string {
+	switch resultType {
+	case "integer", "boolean":
+		return resultType
+	default:
+		return "string"
+	}
+}
+
+// submitResult records the results of a submit_result call, which ends the run.
+// Invalid input is returned to the LLM as an error so that it can correct and resubmit it.
+func (l *Loop) submitResult(result *Result, toolCall ToolCall) (ToolResult, bool, error) {
+	record := ToolCallRecord{
+		ID:    toolCall.ID,
+		Name:  toolCall.Name,
+		Input: toolCall.Input,
+	}
+	defer func() {
+		result.ToolCalls = append(result.ToolCalls, record)
+	}()
+
+	values, err := validateResults(l.Results, toolCall.Input)
+	if err != nil {
+		record.Error = err.Error()
+		return ToolResult{ToolCallID: toolCall.ID, Content: record.Error, IsError: true}, false, nil
+	}
+
+	result.Results = values
+	record.Output = "Results submitted."
+	return ToolResult{ToolCallID: toolCall.ID, Content: record.Output}, true, nil
+}
+
+// validateResults checks the input of a submit_result call against the declared
+// results and returns the submitted values as strings
+func validateResults(fields []ResultField, input map[string]interface{}) (map[string]string, error) {
+	var problems []string
+
+	declared := make(map[string]bool, len(fields))
+	values := make(map[string]string, len(fields))
+	for _, field := range fields {
+		declared[field.Name] = true
+
+		raw, ok := input[field.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("result %q is missing", field.Name))
+			continue
+		}
+		value, err := resultValue(field.Type, raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("result %q: %v", field.Name, err))
+			continue
+		}
+		values[field.Name] = value
+	}
+
+	var unknown []string
+	for name := range input {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, fmt.Sprintf("result %q is not declared", name))
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid results: %s", strings.Join(problems, "; "))
+	}
+	return values, nil
+}
+
+// resultValue returns the string form of a submitted value of the given type
+func resultValue(resultType string, raw interface{}) (string, error) {
+	switch resultType {
+	case "integer":
+		switch v := raw.(type) {
+		case float64:
+			if v != math.Trunc(v) || math.IsInf(v, 0) {
+				return "", fmt.Errorf("%v is not an integer", v)
+			}
+			return strconv.FormatInt(int64(v), 10), nil
+		case int:
+			return strconv.Itoa(v), nil
+		case json.Number:
+			if _, err := v.Int64(); err != nil {
+				return "", fmt.Errorf("%s is not an integer", v)
+			}
+			return v.String(), nil
+		}
+		return "", fmt.Errorf("expected an integer, got %T", raw)
+	case "boolean":
+		v, ok := raw.(bool)
+		if !ok {
+			return "", fmt.Errorf("expected a boolean, got %T", raw)
+		}
+		return strconv.FormatBool(v), nil
+	default:
+		v, ok := raw.(string)
+		if !ok {
+			return "", fmt.Errorf("expected a string, got %T", raw)
+		}
+		return v, nil
+	}
+}
@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+var testResultFields = []ResultField{
+	{Name: "root-cause", Description: "Why the build failed"},
+	{Name: "failed-steps", Type: "integer"},
+	{Name: "fixed", Type: "boolean"},
+}
+
+func TestValidateResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   map[string]interface{}
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			input: map[string]interface{}{"root-cause": "disk full", "failed-steps": float64(2), "fixed": true},
+			want:  map[string]string{"root-cause": "disk full", "failed-steps": "2", "fixed": "true"},
+		},
+		{
+			name:    "missing result",
+			input:   map[string]interface{}{"root-cause": "disk full", "fixed": true},
+			wantErr: `result "failed-steps" is missing`,
+		},
+		{
+			name:    "undeclared result",
+			input:   map[string]interface{}{"root-cause": "disk full", "failed-steps": float64(2), "fixed": true, "severity": "high"},
+			wantErr: `result "severity" is not declared`,
+		},
+		{
+			name:    "fractional integer",
+			input:   map[string]interface{}{"root-cause": "disk full", "failed-steps": 2.5, "fixed": true},
+			wantErr: "2.5 is not an integer",
+		},
+		{
+			name:    "boolean as string",
+			input:   map[string]interface{}{"root-cause": "disk full", "failed-steps": float64(2), "fixed": "yes"},
+			wantErr: `result "fixed": expected a boolean`,
+		},
+		{
+			name:    "string as number",
+			input:   map[string]interface{}{"root-cause": float64(1), "failed-steps": float64(2), "fixed": true},
+			wantErr: `result "root-cause": expected a string`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateResults(testResultFields, tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("validateResults() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateResults() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("validateResults() = %v, want %v", got, tt.want)
+			}
+			for name, value := range tt.want {
+				if got[name] != value {
+					t.Errorf("result %q = %q, want %q", name, got[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestSubmitResultSchema(t *testing.T) {
+	schema := SubmitResultSchema(testResultFields)
+
+	required, _ := schema["required"].([]string)
+	if len(required) != 3 {
+		t.Errorf("required = %v, want all declared results", required)
+	}
+	properties := schema["properties"].(map[string]interface{})
+	if got := properties["failed-steps"].(map[string]interface{})["type"]; got != "integer" {
+		t.Errorf("failed-steps type = %v, want integer", got)
+	}
+	if got := properties["root-cause"].(map[string]interface{})["description"]; got != "Why the build failed" {
+		t.Errorf("root-cause description = %v", got)
+	}
+}
+
+func TestLoop_SubmitResult(t *testing.T) {
+	provider := &mockProvider{
+		responses: []*Response{
+			{
+				Content:    "Submitting my findings",
+				ToolCalls:  []ToolCall{{ID: "1", Name: SubmitResultTool, Input: map[string]interface{}{"root-cause": "disk full"}}},
+				StopReason: "tool_use",
+			},
+			{Content: "Let me fix the results", StopReason: "max_tokens"},
+			{
+				Content:    "Submitting all results",
+				ToolCalls:  []ToolCall{{ID: "2", Name: SubmitResultTool, Input: map[string]interface{}{"root-cause": "disk full", "failed-steps": float64(1), "fixed": false}}},
+				StopReason: "tool_use",
+			},
+		},
+	}
+
+	loop := &Loop{
+		Provider:      provider,
+		Tools:         map[string]Tool{},
+		Policy:        &mockPolicy{allowAll: false},
+		Goal:          "Find why the build failed",
+		MaxIterations: 3,
+		Results:       testResultFields,
+	}
+
+	result, err := loop.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+	if result.Status != "succeeded" {
+		t.Fatalf("Result.Status = %v, want succeeded", result.Status)
+	}
+	if len(result.ToolCalls) != 2 || result.ToolCalls[0].Error == "" || result.ToolCalls[1].Error != "" {
+		t.Errorf("ToolCalls = %+v, want a rejected and an accepted submission", result.ToolCalls)
+	}
+	want := map[string]string{"root-cause": "disk full", "failed-steps": "1", "fixed": "false"}
+	for name, value := range want {
+		if result.Results[name] != value {
+			t.Errorf("Results[%q] = %q, want %q", name, result.Results[name], value)
+		}
+	}
+}
+
+func TestLoop_ResultsRequired(t *testing.T) {
+	provider := &mockProvider{
+		responses: []*Response{
+			{Content: "Checking", ToolCalls: []ToolCall{{ID: "1", Name: "k8s_get_logs"}}, StopReason: "tool_use"},
+			{Content: "The disk is full", StopReason: "end_turn"},
+			{
+				Content:    "Submitting",
+				ToolCalls:  []ToolCall{{ID: "2", Name: SubmitResultTool, Input: map[string]interface{}{"root-cause": "disk full", "failed-steps": float64(1), "fixed": false}}},
+				StopReason: "tool_use",
+			},
+		},
+	}
+
+	loop := &Loop{
+		Provider:      provider,
+		Tools:         map[string]Tool{"k8s_get_logs": &mockTool{name: "k8s_get_logs", result: "no space left on device"}},
+		Policy:        &mockPolicy{allowAll: true},
+		Goal:          "Find why the build failed",
+		MaxIterations: 3,
+		Results:       testResultFields,
+	}
+
+	result, err := loop.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+	if result.Status != "succeeded" || result.Iterations != 3 {
+		t.Errorf("Status = %v, Iterations = %d, want succeeded after 3 iterations", result.Status, result.Iterations)
+	}
+	if result.Results["root-cause"] != "disk full" {
+		t.Errorf("Results = %v", result.Results)
+	}
+
+	reminded := false
+	for _, message := range result.Messages {
+		if message.Content == submitResultReminder {
+			reminded = true
+		}
+	}
+	if !reminded {
+		t.Error("the agent should be reminded to submit its results")
+	}
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// omittedMessage replaces the messages dropped from a trimmed transcript
+const omittedMessage = "[%d earlier messages were omitted to fit the transcript size limit]"
+
+// TrimTranscript drops the oldest messages after the system prompt and the goal
+// until the transcript marshals to at most maxBytes of JSON. The goal is kept so
+// a continuation still knows what the conversation was about.
+func TrimTranscript(messages []Message, maxBytes int) ([]Message, error) {
+	sizes := make([]int, len(messages))
+	total := 2 // brackets
+	for i, msg := range messages {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal message: %w", err)
+		}
+		sizes[i] = len(data) + 1 // comma
+		total += sizes[i]
+	}
+	if total <= maxBytes {
+		return messages, nil
+	}
+
+	// Keep the system prompt and the goal
+	head := 0
+	for head < len(messages) && messages[head].Role == "system" {
+		head++
+	}
+	if head < len(messages) {
+		head++
+	}
+
+	// Reserve room for the note about omitted messages
+	total += len(fmt.Sprintf(omittedMessage, len(messages))) + 64
+
+	dropped := head
+	for dropped < len(messages) && total > maxBytes {
+		total -= sizes[dropped]
+		dropped++
+	}
+	if total > maxBytes {
+		return nil, fmt.Errorf("transcript does not fit in %d bytes", maxBytes)
+	}
+
+	trimmed := append([]Message{}, messages[:head]...)
+	trimmed = append(trimmed, Message{
+		Role:    "user",
+		Content: fmt.Sprintf(omittedMessage, dropped-head),
+	})
+	return append(trimmed, messages[dropped:]...), nil
+}
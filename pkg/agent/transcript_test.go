@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTrimTranscript(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "You are an agent"},
+		{Role: "user", Content: "Goal: deploy"},
+	}
+	for i := 0; i < 20; i++ {
+		messages = append(messages, Message{Role: "assistant", Content: strings.Repeat("x", 100)})
+	}
+
+	t.Run("fits", func(t *testing.T) {
+		got, err := TrimTranscript(messages, 1<<20)
+		if err != nil {
+			t.Fatalf("TrimTranscript() error = %v", err)
+		}
+		if len(got) != len(messages) {
+			t.Errorf("len = %d, want %d", len(got), len(messages))
+		}
+	})
+
+	t.Run("trimmed", func(t *testing.T) {
+		got, err := TrimTranscript(messages, 1000)
+		if err != nil {
+			t.Fatalf("TrimTranscript() error = %v", err)
+		}
+		data, _ := json.Marshal(got)
+		if len(data) > 1000 {
+			t.Errorf("trimmed transcript is %d bytes, want at most 1000", len(data))
+		}
+		if got[0].Role != "system" || got[1].Content != "Goal: deploy" {
+			t.Errorf("system prompt and goal should be kept: %+v", got[:2])
+		}
+		if !strings.Contains(got[2].Content, "earlier messages were omitted") {
+			t.Errorf("expected a note about omitted messages, got %q", got[2].Content)
+		}
+		if last := got[len(got)-1]; last != messages[len(messages)-1] {
+			t.Errorf("the latest message should be kept, got %+v", last)
+		}
+	})
+
+	t.Run("too small", func(t *testing.T) {
+		if _, err := TrimTranscript(messages, 10); err == nil {
+			t.Error("expected an error when even the goal does not fit")
+		}
+	})
+}
+
+func TestLoop_ContinueFromHistory(t *testing.T) {
+	history := []Message{
+		{Role: "system", Content: "You are an agent"},
+		{Role: "user", Content: "Goal: deploy myapp"},
+		{Role: "assistant", Content: "Deployed myapp"},
+	}
+	provider := &mockProvider{
+		responses: []*Response{
+			{Content: "Rerunning with debug", StopReason: "end_turn"},
+		},
+	}
+
+	loop := &Loop{
+		Provider:      provider,
+		Tools:         map[string]Tool{},
+		Policy:        &mockPolicy{allowAll: true},
+		SystemPrompt:  "A new system prompt",
+		Goal:          "now also rerun it with debug=true",
+		MaxIterations: 1,
+		History:       history,
+	}
+
+	result, err := loop.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Loop.Run() error = %v", err)
+	}
+
+	if len(result.Messages) < len(history)+2 {
+		t.Fatalf("transcript has %d messages, want at least %d: %+v", len(result.Messages), len(history)+2, result.Messages)
+	}
+	for i, msg := range history {
+		if result.Messages[i] != msg {
+			t.Errorf("message %d = %+v, want %+v", i, result.Messages[i], msg)
+		}
+	}
+	if followUp := result.Messages[len(history)]; followUp.Role != "user" || !strings.Contains(followUp.Content, "debug=true") {
+		t.Errorf("follow-up message = %+v", followUp)
+	}
+	if reply := result.Messages[len(history)+1]; reply.Content != "Rerunning with debug" {
+		t.Errorf("reply = %+v, want the new response", reply)
+	}
+}
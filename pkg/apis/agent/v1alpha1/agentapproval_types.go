@@ -0,0 +1,107 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Namespaced
+// +kubebuilder:printcolumn:name="AgentRun",type=string,JSONPath=`.spec.agentRun`
+// +kubebuilder:printcolumn:name="Tool",type=string,JSONPath=`.spec.toolName`
+// +kubebuilder:printcolumn:name="Decision",type=string,JSONPath=`.status.decision`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// AgentApproval records a tool call that is waiting for a human decision.
+// It is created by the agent; the decision is recorded in its status subresource,
+// so approving requires permission on agentapprovals/status.
+type AgentApproval struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +optional
+	Spec AgentApprovalSpec `json:"spec,omitempty"`
+
+	// +optional
+	Status AgentApprovalStatus `json:"status,omitempty"`
+}
+
+// AgentApprovalSpec describes the tool call awaiting approval
+type AgentApprovalSpec struct {
+	// AgentRun is the name of the AgentRun that made the tool call
+	// +kubebuilder:validation:MinLength=1
+	AgentRun string `json:"agentRun"`
+
+	// ToolCallID is the ID the LLM assigned to the tool call
+	// +optional
+	ToolCallID string `json:"toolCallID,omitempty"`
+
+	// ToolName is the name of the tool to be called
+	// +kubebuilder:validation:MinLength=1
+	ToolName string `json:"toolName"`
+
+	// Input is the exact tool input, as JSON
+	// +optional
+	Input string `json:"input,omitempty"`
+
+	// Reason explains why the tool call requires approval
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// AgentApprovalStatus defines the observed state of AgentApproval
+type AgentApprovalStatus struct {
+	// Decision is Pending until the tool call is Approved or Rejected
+	// +optional
+	// +kubebuilder:validation:Enum=Pending;Approved;Rejected
+	Decision ApprovalDecision `json:"decision,omitempty"`
+
+	// Message is returned to the agent with the decision
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// DecisionTime is when the decision was observed
+	// +optional
+	DecisionTime *metav1.Time `json:"decisionTime,omitempty"`
+}
+
+// ApprovalDecision is the decision on an AgentApproval
+type ApprovalDecision string
+
+const (
+	// ApprovalPending means no decision has been made yet
+	ApprovalPending ApprovalDecision = "Pending"
+	// ApprovalApproved lets the tool call run
+	ApprovalApproved ApprovalDecision = "Approved"
+	// ApprovalRejected returns an error to the agent instead of running the tool call
+	ApprovalRejected ApprovalDecision = "Rejected"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AgentApprovalList contains a list of AgentApproval
+type AgentApprovalList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AgentApproval `json:"items"`
+}
+
+// IsDecided returns true once the AgentApproval has been approved or rejected
+func (a *AgentApproval) IsDecided() bool {
+	return a.Status.Decision == ApprovalApproved || a.Status.Decision == ApprovalRejected
+}
+
+// IsPendingFor returns true if the AgentApproval is waiting for a decision on a tool call of the AgentRun
+func (a *AgentApproval) IsPendingFor(agentRun *AgentRun) bool {
+	if a.Namespace != agentRun.Namespace || a.Spec.AgentRun != agentRun.Name || a.IsDecided() {
+		return false
+	}
+	for _, ref := range a.OwnerReferences {
+		if ref.UID == agentRun.UID {
+			return true
+		}
+	}
+	return false
+}
@@ -8,12 +8,18 @@ import (
 )
 
 const (
-	DefaultMaxIterations  = 3
+	DefaultMaxIterations  = 6
 	DefaultTimeout        = 8 * time.Minute
 	DefaultProvider       = "claude"
 	DefaultNetworkPolicy  = "strict"
 	DefaultOPAPolicy      = "strict"
 	DefaultServiceAccount = "default"
+
+	DefaultDelegationMaxDepth    = 1
+	DefaultDelegationMaxChildren = 5
+
+	DefaultMaxContextTokens = 150000
+	DefaultKeepTurns        = 2
 )
 
 // SetDefaults sets default values for AgentConfig
@@ -46,4 +52,25 @@ func (acs *AgentConfigSpec) SetDefaults(ctx context.Context) {
 	if acs.Policy.OPA == "" {
 		acs.Policy.OPA = DefaultOPAPolicy
 	}
+
+	if acs.Delegation != nil {
+		if acs.Delegation.MaxDepth == 0 {
+			acs.Delegation.MaxDepth = DefaultDelegationMaxDepth
+		}
+		if acs.Delegation.MaxChildren == 0 {
+			acs.Delegation.MaxChildren = DefaultDelegationMaxChildren
+		}
+	}
+
+	for i := range acs.Params {
+		if acs.Params[i].Type == "" {
+			acs.Params[i].Type = ParamTypeString
+		}
+	}
+
+	for i := range acs.Results {
+		if acs.Results[i].Type == "" {
+			acs.Results[i].Type = ParamTypeString
+		}
+	}
 }
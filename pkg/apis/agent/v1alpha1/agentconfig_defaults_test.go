@@ -102,3 +102,25 @@ func TestAgentConfigSpec_SetDefaults(t *testing.T) {
 		})
 	}
 }
+
+func TestAgentConfigSpec_SetDefaults_Delegation(t *testing.T) {
+	spec := &AgentConfigSpec{
+		ConfigPVC:  "test-pvc",
+		Delegation: &DelegationSpec{AllowedConfigs: []string{"investigator"}},
+	}
+	spec.SetDefaults(context.Background())
+
+	if spec.Delegation.MaxDepth != DefaultDelegationMaxDepth {
+		t.Errorf("Delegation.MaxDepth = %v, want %v", spec.Delegation.MaxDepth, DefaultDelegationMaxDepth)
+	}
+	if spec.Delegation.MaxChildren != DefaultDelegationMaxChildren {
+		t.Errorf("Delegation.MaxChildren = %v, want %v", spec.Delegation.MaxChildren, DefaultDelegationMaxChildren)
+	}
+
+	// Delegation stays disabled unless configured
+	spec = &AgentConfigSpec{ConfigPVC: "test-pvc"}
+	spec.SetDefaults(context.Background())
+	if spec.Delegation != nil {
+		t.Errorf("Delegation = %+v, want nil", spec.Delegation)
+	}
+}
@@ -36,10 +36,10 @@ type AgentConfigSpec struct {
 	// +kubebuilder:validation:MinLength=1
 	ConfigPVC string `json:"configPVC"`
 
-	// MaxIterations is the maximum number of plan-act-reflect iterations
+	// MaxIterations is the maximum number of model turns the agent may take
 	// +optional
 	// +kubebuilder:validation:Minimum=1
-	// +kubebuilder:validation:Maximum=10
+	// +kubebuilder:validation:Maximum=20
 	MaxIterations int32 `json:"maxIterations,omitempty"`
 
 	// Timeout is the maximum duration for agent execution
@@ -69,6 +69,233 @@ type AgentConfigSpec struct {
 	// +optional
 	// +kubebuilder:validation:Enum=claude;gemini
 	Provider string `json:"provider,omitempty"`
+
+	// MaxConcurrentRuns limits how many AgentRuns using this config may run at once.
+	// Excess runs are queued and admitted in creation order. Zero means unlimited.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxConcurrentRuns int32 `json:"maxConcurrentRuns,omitempty"`
+
+	// TTLSecondsAfterFinished is the default lifetime of finished AgentRuns using this config
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+
+	// RequireApproval lists the tools whose calls pause the agent until a human approves them
+	// through an AgentApproval. The OPA policy can also require approval with a require_approval rule.
+	// +optional
+	// +listType=set
+	RequireApproval []string `json:"requireApproval,omitempty"`
+
+	// DryRun makes mutating tools use server-side dry run for AgentRuns using this config
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Delegation lets AgentRuns using this config delegate sub-goals to child AgentRuns
+	// through the agent_delegate tool. Delegation is disabled when unset.
+	// +optional
+	Delegation *DelegationSpec `json:"delegation,omitempty"`
+
+	// Params declares the params AgentRuns using this config may set.
+	// They are substituted into the goal with $(params.<name>).
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Params []ParamSpec `json:"params,omitempty"`
+
+	// GoalTemplate is the goal of AgentRuns using this config that do not set one.
+	// It may reference the declared params with $(params.<name>).
+	// +optional
+	GoalTemplate string `json:"goalTemplate,omitempty"`
+
+	// Results declares the structured results agents using this config must submit
+	// through the submit_result tool. They are recorded in the AgentRun's status.results.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Results []ResultSpec `json:"results,omitempty"`
+
+	// Tools configures how the agent runs the calls of individual tools
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Tools []ToolSpec `json:"tools,omitempty"`
+
+	// Budget caps the tokens and cost of each AgentRun using this config. A run
+	// exceeding it fails with the BudgetExceeded reason.
+	// +optional
+	Budget *BudgetSpec `json:"budget,omitempty"`
+
+	// Compaction keeps the conversation of long runs within the model's context window
+	// +optional
+	Compaction *CompactionSpec `json:"compaction,omitempty"`
+}
+
+// ParamSpec declares a param of the AgentRuns using an AgentConfig
+type ParamSpec struct {
+	// Name of the param
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Type of the param value. Defaults to string.
+	// +optional
+	// +kubebuilder:validation:Enum=string;integer;boolean
+	Type ParamType `json:"type,omitempty"`
+
+	// Description tells users of the AgentConfig what the param is for
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// Default is used when an AgentRun does not set the param. Params without a default are required.
+	// +optional
+	Default *string `json:"default,omitempty"`
+}
+
+// ResultSpec declares a structured result of the agents using an AgentConfig
+type ResultSpec struct {
+	// Name of the result
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Type of the result value. Defaults to string.
+	// +optional
+	// +kubebuilder:validation:Enum=string;integer;boolean
+	Type ParamType `json:"type,omitempty"`
+
+	// Description tells the agent what to submit for the result
+	// +optional
+	Description string `json:"description,omitempty"`
+}
+
+// ToolSpec limits the calls of a tool. Unset fields keep the agent's defaults.
+type ToolSpec struct {
+	// Name of the tool, e.g. k8s_get_logs
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Timeout of a single call of the tool
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// Retries is how many times a call that fails with a transient API error,
+	// such as a timeout or throttling, is retried
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=5
+	Retries int32 `json:"retries,omitempty"`
+
+	// MaxOutputBytes limits the output of a call sent to the model. Longer output
+	// keeps its head and tail around a truncation marker.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxOutputBytes int32 `json:"maxOutputBytes,omitempty"`
+}
+
+// BudgetSpec caps the tokens and cost of an AgentRun. It is checked after every
+// model turn; unset limits are unlimited.
+type BudgetSpec struct {
+	// MaxInputTokens caps the input tokens of all model turns of a run
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxInputTokens int64 `json:"maxInputTokens,omitempty"`
+
+	// MaxOutputTokens caps the output tokens of all model turns of a run
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxOutputTokens int64 `json:"maxOutputTokens,omitempty"`
+
+	// MaxCost caps the cost of a run in USD, e.g. "0.50". The price of the model
+	// must be known, either built in or from Prices.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+	MaxCost string `json:"maxCost,omitempty"`
+
+	// Prices of models in USD per million tokens. They override the built-in prices.
+	// +optional
+	// +listType=map
+	// +listMapKey=model
+	Prices []ModelPrice `json:"prices,omitempty"`
+}
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	// Model is the name of the model, e.g. claude-3-5-sonnet-20241022
+	// +kubebuilder:validation:MinLength=1
+	Model string `json:"model"`
+
+	// InputPerMillion is the price of a million input tokens, e.g. "3"
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+	InputPerMillion string `json:"inputPerMillion"`
+
+	// OutputPerMillion is the price of a million output tokens, e.g. "15"
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+	OutputPerMillion string `json:"outputPerMillion"`
+}
+
+// CompactionSpec configures how the conversation of a run is compacted once it grows
+// too large: the tool outputs of older turns are elided first, then the older turns
+// are summarized or dropped. The goal and the most recent turns are always kept.
+type CompactionSpec struct {
+	// MaxContextTokens is the estimated conversation size that triggers compaction.
+	// Defaults to 150000.
+	// +optional
+	// +kubebuilder:validation:Minimum=1000
+	MaxContextTokens int32 `json:"maxContextTokens,omitempty"`
+
+	// KeepTurns is the number of most recent model turns kept verbatim. Defaults to 2.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	KeepTurns int32 `json:"keepTurns,omitempty"`
+
+	// Summarize asks the model to summarize the older turns instead of dropping them
+	// +optional
+	Summarize bool `json:"summarize,omitempty"`
+}
+
+// ParamType is the type of a param or result value
+type ParamType string
+
+const (
+	// ParamTypeString accepts any value
+	ParamTypeString ParamType = "string"
+	// ParamTypeInteger accepts base-10 integers
+	ParamTypeInteger ParamType = "integer"
+	// ParamTypeBoolean accepts true or false
+	ParamTypeBoolean ParamType = "boolean"
+)
+
+// DelegationSpec limits the child AgentRuns an agent may create
+type DelegationSpec struct {
+	// AllowedConfigs are the AgentConfigs child AgentRuns may use
+	// +listType=set
+	// +kubebuilder:validation:MinItems=1
+	AllowedConfigs []string `json:"allowedConfigs"`
+
+	// MaxDepth limits how deeply delegation may nest. Children of a top-level AgentRun have depth 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxDepth int32 `json:"maxDepth,omitempty"`
+
+	// MaxChildren limits the number of child AgentRuns each AgentRun may create
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxChildren int32 `json:"maxChildren,omitempty"`
+}
+
+// GetMaxDepth returns MaxDepth, or its default when unset
+func (d *DelegationSpec) GetMaxDepth() int32 {
+	if d.MaxDepth == 0 {
+		return DefaultDelegationMaxDepth
+	}
+	return d.MaxDepth
+}
+
+// GetMaxChildren returns MaxChildren, or its default when unset
+func (d *DelegationSpec) GetMaxChildren() int32 {
+	if d.MaxChildren == 0 {
+		return DefaultDelegationMaxChildren
+	}
+	return d.MaxChildren
 }
 
 // PolicySpec defines OPA policy configuration
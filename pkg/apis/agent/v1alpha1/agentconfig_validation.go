@@ -3,6 +3,8 @@ package v1alpha1
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"slices"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -21,9 +23,9 @@ func (acs *AgentConfigSpec) Validate(ctx context.Context) error {
 		return fmt.Errorf("configPVC is required")
 	}
 
-	// MaxIterations is optional, but if set must be in range 1-10
-	if acs.MaxIterations < 0 || acs.MaxIterations > 10 {
-		return fmt.Errorf("maxIterations must be between 0 and 10")
+	// MaxIterations is optional, but if set must be in range 1-20
+	if acs.MaxIterations < 0 || acs.MaxIterations > 20 {
+		return fmt.Errorf("maxIterations must be between 0 and 20")
 	}
 
 	if acs.Provider != "" && acs.Provider != "claude" && acs.Provider != "gemini" {
@@ -38,6 +40,151 @@ func (acs *AgentConfigSpec) Validate(ctx context.Context) error {
 		return fmt.Errorf("policy.opa must be either 'strict' or 'permissive'")
 	}
 
+	if acs.MaxConcurrentRuns < 0 {
+		return fmt.Errorf("maxConcurrentRuns must not be negative")
+	}
+
+	if acs.TTLSecondsAfterFinished != nil && *acs.TTLSecondsAfterFinished < 0 {
+		return fmt.Errorf("ttlSecondsAfterFinished must not be negative")
+	}
+
+	for i, tool := range acs.RequireApproval {
+		if tool == "" {
+			return fmt.Errorf("requireApproval[%d] must not be empty", i)
+		}
+	}
+
+	if d := acs.Delegation; d != nil {
+		if len(d.AllowedConfigs) == 0 {
+			return fmt.Errorf("delegation.allowedConfigs must not be empty")
+		}
+		for i, name := range d.AllowedConfigs {
+			if name == "" {
+				return fmt.Errorf("delegation.allowedConfigs[%d] must not be empty", i)
+			}
+		}
+		if d.MaxDepth < 0 {
+			return fmt.Errorf("delegation.maxDepth must not be negative")
+		}
+		if d.MaxChildren < 0 {
+			return fmt.Errorf("delegation.maxChildren must not be negative")
+		}
+	}
+
+	if err := validateParamSpecs(acs.Params, acs.GoalTemplate); err != nil {
+		return err
+	}
+
+	if err := validateResultSpecs(acs.Results); err != nil {
+		return err
+	}
+
+	if err := validateToolSpecs(acs.Tools); err != nil {
+		return err
+	}
+
+	if acs.Budget != nil {
+		if err := acs.Budget.Validate(); err != nil {
+			return fmt.Errorf("budget: %w", err)
+		}
+	}
+
+	if c := acs.Compaction; c != nil {
+		if c.MaxContextTokens != 0 && c.MaxContextTokens < 1000 {
+			return fmt.Errorf("compaction.maxContextTokens must be at least 1000")
+		}
+		if c.KeepTurns < 0 {
+			return fmt.Errorf("compaction.keepTurns must not be negative")
+		}
+	}
+
+	return nil
+}
+
+// reservedResultNames are the results every agent reports; declared results must not shadow them
+var reservedResultNames = []string{"status", "iterations", "tokens-in", "tokens-out", "simulated-actions", "response"}
+
+// validateResultSpecs validates the result declarations of an AgentConfig
+func validateResultSpecs(specs []ResultSpec) error {
+	declared := make(map[string]bool, len(specs))
+	for i, spec := range specs {
+		if !paramNamePattern.MatchString(spec.Name) {
+			return fmt.Errorf("results[%d].name %q must match %s", i, spec.Name, paramNamePattern)
+		}
+		if slices.Contains(reservedResultNames, spec.Name) {
+			return fmt.Errorf("results[%d].name %q is reserved for a result every agent reports", i, spec.Name)
+		}
+		if declared[spec.Name] {
+			return fmt.Errorf("results[%d].name: duplicate result %q", i, spec.Name)
+		}
+		declared[spec.Name] = true
+
+		switch spec.Type {
+		case "", ParamTypeString, ParamTypeInteger, ParamTypeBoolean:
+		default:
+			return fmt.Errorf("results[%d].type must be one of 'string', 'integer' or 'boolean'", i)
+		}
+	}
+	return nil
+}
+
+// validateToolSpecs validates the tool limits of an AgentConfig
+func validateToolSpecs(specs []ToolSpec) error {
+	configured := make(map[string]bool, len(specs))
+	for i, spec := range specs {
+		if spec.Name == "" {
+			return fmt.Errorf("tools[%d].name is required", i)
+		}
+		if configured[spec.Name] {
+			return fmt.Errorf("tools[%d].name: duplicate tool %q", i, spec.Name)
+		}
+		configured[spec.Name] = true
+
+		if spec.Timeout != nil && spec.Timeout.Duration <= 0 {
+			return fmt.Errorf("tools[%d].timeout must be positive", i)
+		}
+		if spec.Retries < 0 || spec.Retries > 5 {
+			return fmt.Errorf("tools[%d].retries must be between 0 and 5", i)
+		}
+		if spec.MaxOutputBytes < 0 {
+			return fmt.Errorf("tools[%d].maxOutputBytes must not be negative", i)
+		}
+	}
+	return nil
+}
+
+// decimalPattern matches the non-negative decimals of budgets and prices
+var decimalPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// Validate validates the BudgetSpec
+func (b *BudgetSpec) Validate() error {
+	if b.MaxInputTokens < 0 {
+		return fmt.Errorf("maxInputTokens must not be negative")
+	}
+	if b.MaxOutputTokens < 0 {
+		return fmt.Errorf("maxOutputTokens must not be negative")
+	}
+	if b.MaxCost != "" && !decimalPattern.MatchString(b.MaxCost) {
+		return fmt.Errorf("maxCost %q must be a decimal number such as 0.50", b.MaxCost)
+	}
+
+	priced := make(map[string]bool, len(b.Prices))
+	for i, price := range b.Prices {
+		if price.Model == "" {
+			return fmt.Errorf("prices[%d].model is required", i)
+		}
+		if priced[price.Model] {
+			return fmt.Errorf("prices[%d].model: duplicate model %q", i, price.Model)
+		}
+		priced[price.Model] = true
+
+		if !decimalPattern.MatchString(price.InputPerMillion) {
+			return fmt.Errorf("prices[%d].inputPerMillion %q must be a decimal number", i, price.InputPerMillion)
+		}
+		if !decimalPattern.MatchString(price.OutputPerMillion) {
+			return fmt.Errorf("prices[%d].outputPerMillion %q must be a decimal number", i, price.OutputPerMillion)
+		}
+	}
 	return nil
 }
 
@@ -3,11 +3,14 @@ package v1alpha1
 import (
 	"context"
 	"testing"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestAgentConfigSpec_Validate(t *testing.T) {
+	one, yes := "1", "yes"
+
 	tests := []struct {
 		name    string
 		spec    *AgentConfigSpec
@@ -40,7 +43,7 @@ func TestAgentConfigSpec_Validate(t *testing.T) {
 			name: "maxIterations too high",
 			spec: &AgentConfigSpec{
 				ConfigPVC:     "agent-config",
-				MaxIterations: 11,
+				MaxIterations: 21,
 			},
 			wantErr: true,
 		},
@@ -76,6 +79,248 @@ func TestAgentConfigSpec_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "negative maxConcurrentRuns",
+			spec: &AgentConfigSpec{
+				ConfigPVC:         "agent-config",
+				MaxConcurrentRuns: -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative ttlSecondsAfterFinished",
+			spec: &AgentConfigSpec{
+				ConfigPVC:               "agent-config",
+				TTLSecondsAfterFinished: func() *int32 { v := int32(-1); return &v }(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid requireApproval",
+			spec: &AgentConfigSpec{
+				ConfigPVC:       "agent-config",
+				RequireApproval: []string{"tekton_create_pipelinerun"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "empty requireApproval tool",
+			spec: &AgentConfigSpec{
+				ConfigPVC:       "agent-config",
+				RequireApproval: []string{""},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid params and goal template",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Params: []ParamSpec{
+					{Name: "pipeline"},
+					{Name: "replicas", Type: ParamTypeInteger, Default: &one},
+				},
+				GoalTemplate: "Run $(params.pipeline) with $(params.replicas) replicas",
+			},
+			wantErr: false,
+		},
+		{
+			name: "duplicate param",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Params:    []ParamSpec{{Name: "pipeline"}, {Name: "pipeline"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid param name",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Params:    []ParamSpec{{Name: "pipeline name"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid param type",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Params:    []ParamSpec{{Name: "pipeline", Type: "array"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "param default of the wrong type",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Params:    []ParamSpec{{Name: "verbose", Type: ParamTypeBoolean, Default: &yes}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "goal template references undeclared param",
+			spec: &AgentConfigSpec{
+				ConfigPVC:    "agent-config",
+				GoalTemplate: "Run $(params.pipeline)",
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid results",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Results: []ResultSpec{
+					{Name: "root-cause", Description: "Why the build failed"},
+					{Name: "fixed", Type: ParamTypeBoolean},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "duplicate result",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Results:   []ResultSpec{{Name: "root-cause"}, {Name: "root-cause"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "reserved result name",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Results:   []ResultSpec{{Name: "response"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid result type",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Results:   []ResultSpec{{Name: "root-cause", Type: "object"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid tools",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Tools: []ToolSpec{
+					{Name: "k8s_get_logs", Timeout: &metav1.Duration{Duration: 30 * time.Second}, Retries: 2, MaxOutputBytes: 16384},
+					{Name: "k8s_get_resources", MaxOutputBytes: 8192},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "duplicate tool",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Tools:     []ToolSpec{{Name: "k8s_get_logs"}, {Name: "k8s_get_logs", Retries: 1}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero tool timeout",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Tools:     []ToolSpec{{Name: "k8s_get_logs", Timeout: &metav1.Duration{}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "too many tool retries",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Tools:     []ToolSpec{{Name: "k8s_get_logs", Retries: 6}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid budget",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Budget: &BudgetSpec{
+					MaxInputTokens:  200000,
+					MaxOutputTokens: 20000,
+					MaxCost:         "0.50",
+					Prices:          []ModelPrice{{Model: "claude-3-5-haiku-20241022", InputPerMillion: "0.8", OutputPerMillion: "4"}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid budget cost",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Budget:    &BudgetSpec{MaxCost: "$1"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative budget tokens",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Budget:    &BudgetSpec{MaxInputTokens: -1},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid compaction",
+			spec: &AgentConfigSpec{
+				ConfigPVC:  "agent-config",
+				Compaction: &CompactionSpec{MaxContextTokens: 100000, KeepTurns: 3, Summarize: true},
+			},
+			wantErr: false,
+		},
+		{
+			name: "compaction threshold too small",
+			spec: &AgentConfigSpec{
+				ConfigPVC:  "agent-config",
+				Compaction: &CompactionSpec{MaxContextTokens: 10},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate model price",
+			spec: &AgentConfigSpec{
+				ConfigPVC: "agent-config",
+				Budget: &BudgetSpec{Prices: []ModelPrice{
+					{Model: "claude-3-5-haiku-20241022", InputPerMillion: "0.8", OutputPerMillion: "4"},
+					{Model: "claude-3-5-haiku-20241022", InputPerMillion: "1", OutputPerMillion: "5"},
+				}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid delegation",
+			spec: &AgentConfigSpec{
+				ConfigPVC:  "agent-config",
+				Delegation: &DelegationSpec{AllowedConfigs: []string{"investigator"}, MaxDepth: 2, MaxChildren: 10},
+			},
+			wantErr: false,
+		},
+		{
+			name: "delegation without allowed configs",
+			spec: &AgentConfigSpec{
+				ConfigPVC:  "agent-config",
+				Delegation: &DelegationSpec{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "delegation with empty allowed config",
+			spec: &AgentConfigSpec{
+				ConfigPVC:  "agent-config",
+				Delegation: &DelegationSpec{AllowedConfigs: []string{""}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative delegation maxChildren",
+			spec: &AgentConfigSpec{
+				ConfigPVC:  "agent-config",
+				Delegation: &DelegationSpec{AllowedConfigs: []string{"investigator"}, MaxChildren: -1},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,132 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// paramRefPattern matches $(params.<name>) references
+var paramRefPattern = regexp.MustCompile(`\$\(params\.([^()]+)\)`)
+
+// paramNamePattern restricts param names to what can be referenced unambiguously
+var paramNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+
+// ResolveGoal returns the goal of the AgentRun with its params substituted. The goal is
+// the AgentRun's Goal or, when that is empty, the AgentConfig's GoalTemplate. The params
+// must be declared by the AgentConfig; declared params that are not set take their default.
+func (ar *AgentRun) ResolveGoal(agentConfig *AgentConfig) (string, error) {
+	goal := ar.Spec.Goal
+	if goal == "" {
+		goal = agentConfig.Spec.GoalTemplate
+	}
+	if goal == "" {
+		return "", fmt.Errorf("goal is required because AgentConfig %s has no goalTemplate", agentConfig.Name)
+	}
+
+	values, err := resolveParams(agentConfig.Spec.Params, ar.Spec.Params)
+	if err != nil {
+		return "", err
+	}
+
+	var undeclared []string
+	resolved := paramRefPattern.ReplaceAllStringFunc(goal, func(ref string) string {
+		name := paramRefPattern.FindStringSubmatch(ref)[1]
+		value, ok := values[name]
+		if !ok {
+			undeclared = append(undeclared, name)
+			return ref
+		}
+		return value
+	})
+	if len(undeclared) > 0 {
+		return "", fmt.Errorf("goal references undeclared param %q", undeclared[0])
+	}
+	return resolved, nil
+}
+
+// resolveParams checks the params of an AgentRun against their declarations and
+// returns the value of every declared param
+func resolveParams(specs []ParamSpec, params map[string]string) (map[string]string, error) {
+	declared := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		declared[spec.Name] = true
+	}
+
+	var unknown []string
+	for name := range params {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("params %v are not declared by the AgentConfig", unknown)
+	}
+
+	values := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		value, ok := params[spec.Name]
+		if !ok {
+			if spec.Default == nil {
+				return nil, fmt.Errorf("param %q is required", spec.Name)
+			}
+			value = *spec.Default
+		}
+		if err := checkParamType(spec.Type, value); err != nil {
+			return nil, fmt.Errorf("param %q: %w", spec.Name, err)
+		}
+		values[spec.Name] = value
+	}
+	return values, nil
+}
+
+// checkParamType returns an error if value is not of the param type
+func checkParamType(paramType ParamType, value string) error {
+	switch paramType {
+	case ParamTypeInteger:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+	case ParamTypeBoolean:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("%q is not a boolean (true or false)", value)
+		}
+	}
+	return nil
+}
+
+// validateParamSpecs validates the param declarations of an AgentConfig and the
+// references to them in its goal template
+func validateParamSpecs(specs []ParamSpec, goalTemplate string) error {
+	declared := make(map[string]bool, len(specs))
+	for i, spec := range specs {
+		if !paramNamePattern.MatchString(spec.Name) {
+			return fmt.Errorf("params[%d].name %q must match %s", i, spec.Name, paramNamePattern)
+		}
+		if declared[spec.Name] {
+			return fmt.Errorf("params[%d].name: duplicate param %q", i, spec.Name)
+		}
+		declared[spec.Name] = true
+
+		switch spec.Type {
+		case "", ParamTypeString, ParamTypeInteger, ParamTypeBoolean:
+		default:
+			return fmt.Errorf("params[%d].type must be one of 'string', 'integer' or 'boolean'", i)
+		}
+
+		if spec.Default != nil {
+			if err := checkParamType(spec.Type, *spec.Default); err != nil {
+				return fmt.Errorf("params[%d].default: %w", i, err)
+			}
+		}
+	}
+
+	for _, match := range paramRefPattern.FindAllStringSubmatch(goalTemplate, -1) {
+		if !declared[match[1]] {
+			return fmt.Errorf("goalTemplate references undeclared param %q", match[1])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAgentRun_ResolveGoal(t *testing.T) {
+	defaultImage, one, no := "docker.io/myorg/app:latest", "1", "false"
+	config := &AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "build-agent"},
+		Spec: AgentConfigSpec{
+			Params: []ParamSpec{
+				{Name: "pipeline", Type: ParamTypeString},
+				{Name: "image", Type: ParamTypeString, Default: &defaultImage},
+				{Name: "replicas", Type: ParamTypeInteger, Default: &one},
+				{Name: "verbose", Type: ParamTypeBoolean, Default: &no},
+			},
+			GoalTemplate: "Run the $(params.pipeline) Pipeline to build $(params.image)",
+		},
+	}
+
+	tests := []struct {
+		name    string
+		goal    string
+		params  map[string]string
+		config  *AgentConfig
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "goal template with params and defaults",
+			params: map[string]string{"pipeline": "build"},
+			config: config,
+			want:   "Run the build Pipeline to build docker.io/myorg/app:latest",
+		},
+		{
+			name:   "goal of the AgentRun overrides the template",
+			goal:   "Scale to $(params.replicas) replicas, verbose: $(params.verbose)",
+			params: map[string]string{"pipeline": "build", "replicas": "3"},
+			config: config,
+			want:   "Scale to 3 replicas, verbose: false",
+		},
+		{
+			name:   "free-form goal without declared params",
+			goal:   "List the Pipelines",
+			config: &AgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "plain"}},
+			want:   "List the Pipelines",
+		},
+		{
+			name:    "missing required param",
+			params:  map[string]string{"image": "app:v2"},
+			config:  config,
+			wantErr: true,
+		},
+		{
+			name:    "undeclared param",
+			params:  map[string]string{"pipeline": "build", "pipelne": "build"},
+			config:  config,
+			wantErr: true,
+		},
+		{
+			name:    "integer param with a non-integer value",
+			params:  map[string]string{"pipeline": "build", "replicas": "two"},
+			config:  config,
+			wantErr: true,
+		},
+		{
+			name:    "boolean param with a non-boolean value",
+			params:  map[string]string{"pipeline": "build", "verbose": "yes"},
+			config:  config,
+			wantErr: true,
+		},
+		{
+			name:    "goal references undeclared param",
+			goal:    "Deploy to $(params.namespace)",
+			params:  map[string]string{"pipeline": "build"},
+			config:  config,
+			wantErr: true,
+		},
+		{
+			name:    "no goal and no goal template",
+			params:  map[string]string{},
+			config:  &AgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "plain"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar := &AgentRun{Spec: AgentRunSpec{Goal: tt.goal, Params: tt.params}}
+			got, err := ar.ResolveGoal(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveGoal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveGoal() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
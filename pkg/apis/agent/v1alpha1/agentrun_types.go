@@ -1,6 +1,9 @@
 package v1alpha1
 
 import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -31,15 +34,112 @@ type AgentRunSpec struct {
 	// ConfigRef references the AgentConfig to use
 	ConfigRef ConfigRef `json:"configRef"`
 
-	// Goal is the objective for the agent to achieve
+	// Goal is the objective for the agent to achieve. It may be left empty when
+	// params are set and the AgentConfig has a GoalTemplate.
+	// +optional
 	// +kubebuilder:validation:MinLength=1
-	Goal string `json:"goal"`
+	Goal string `json:"goal,omitempty"`
+
+	// Params are substituted into the goal, or into the AgentConfig's GoalTemplate when
+	// Goal is empty, with $(params.<name>). They must be declared by the AgentConfig.
+	// +optional
+	Params map[string]string `json:"params,omitempty"`
 
 	// Context provides additional information for the agent
 	// +optional
 	Context AgentContext `json:"context,omitempty"`
+
+	// Status is used to request a state change of the AgentRun, e.g. cancellation
+	// +optional
+	// +kubebuilder:validation:Enum="";Cancelled
+	Status AgentRunSpecStatus `json:"status,omitempty"`
+
+	// CancelPipelineRuns also cancels PipelineRuns created by the agent when the AgentRun is cancelled
+	// +optional
+	CancelPipelineRuns bool `json:"cancelPipelineRuns,omitempty"`
+
+	// Retries is the number of times a failed attempt is retried for retryable reasons
+	// such as provider errors or timeouts
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Retries int32 `json:"retries,omitempty"`
+
+	// TTLSecondsAfterFinished limits the lifetime of an AgentRun that has finished.
+	// Once the TTL has passed the AgentRun and the resources it owns are deleted.
+	// Overrides the AgentConfig's TTLSecondsAfterFinished when set.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+
+	// Mode controls how the agent acts. In plan mode mutating tool calls are recorded in
+	// status.plan instead of being executed; in execute mode the calls of the plan
+	// referenced by PlanRef are performed exactly, without consulting the LLM.
+	// By default the agent executes tool calls as it makes them.
+	// +optional
+	// +kubebuilder:validation:Enum="";plan;execute
+	Mode AgentRunMode `json:"mode,omitempty"`
+
+	// PlanRef references the succeeded plan-mode AgentRun whose plan is executed. Required in execute mode.
+	// +optional
+	PlanRef *PlanRef `json:"planRef,omitempty"`
+
+	// DryRun makes mutating tools use server-side dry run, so nothing is changed and the
+	// agent sees the objects that would have been created. Overrides the AgentConfig's DryRun when set.
+	// +optional
+	DryRun *bool `json:"dryRun,omitempty"`
+
+	// ContinueFrom references a finished AgentRun whose transcript the agent resumes.
+	// The Goal is then sent as a follow-up instruction rather than a new goal.
+	// +optional
+	ContinueFrom *ContinueFromRef `json:"continueFrom,omitempty"`
+}
+
+// AgentRunMode defines how an AgentRun acts on its tool calls
+type AgentRunMode string
+
+const (
+	// AgentRunModePlan records mutating tool calls as proposed actions instead of executing them
+	AgentRunModePlan AgentRunMode = "plan"
+	// AgentRunModeExecute performs the proposed actions of a plan
+	AgentRunModeExecute AgentRunMode = "execute"
+)
+
+// ContinueFromRef references the AgentRun whose transcript is continued
+type ContinueFromRef struct {
+	// Name of the AgentRun in the same namespace
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
 }
 
+// PlanRef references a plan-mode AgentRun
+type PlanRef struct {
+	// Name of the AgentRun in the same namespace
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// ProposedAction is a mutating tool call recorded by a plan-mode AgentRun
+type ProposedAction struct {
+	// ID is the ID the LLM assigned to the tool call
+	// +optional
+	ID string `json:"id,omitempty"`
+
+	// Tool is the name of the tool
+	Tool string `json:"tool"`
+
+	// Input is the exact tool input, as JSON
+	// +optional
+	Input string `json:"input,omitempty"`
+}
+
+// AgentRunSpecStatus defines the requested state of an AgentRun
+type AgentRunSpecStatus string
+
+const (
+	// AgentRunSpecStatusCancelled indicates that the user wants to cancel the AgentRun
+	AgentRunSpecStatusCancelled AgentRunSpecStatus = "Cancelled"
+)
+
 // ConfigRef references an AgentConfig
 type ConfigRef struct {
 	// Name of the AgentConfig
@@ -53,8 +153,38 @@ type AgentContext struct {
 	// +optional
 	// +listType=atomic
 	Hints []string `json:"hints,omitempty"`
+
+	// Targets reference the resources the goal is about. The agent fetches them
+	// before its first turn and describes them in its first message.
+	// +optional
+	// +listType=atomic
+	Targets []TargetRef `json:"targets,omitempty"`
+}
+
+// TargetRef references a resource an AgentRun is about
+type TargetRef struct {
+	// Kind of the resource
+	// +kubebuilder:validation:Enum=PipelineRun;TaskRun;Pod
+	Kind TargetKind `json:"kind"`
+
+	// Name of the resource
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Namespace of the resource. Defaults to the namespace of the AgentRun.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
 }
 
+// TargetKind is the kind of resource a TargetRef references
+type TargetKind string
+
+const (
+	TargetKindPipelineRun TargetKind = "PipelineRun"
+	TargetKindTaskRun     TargetKind = "TaskRun"
+	TargetKindPod         TargetKind = "Pod"
+)
+
 // AgentRunStatus defines the observed state of AgentRun
 type AgentRunStatus struct {
 	// Conditions represent the latest available observations of the AgentRun's state
@@ -64,7 +194,7 @@ type AgentRunStatus struct {
 
 	// Phase represents the current phase of execution
 	// +optional
-	// +kubebuilder:validation:Enum=Pending;PreHooks;Planning;Acting;Reflecting;PostHooks;Succeeded;Failed
+	// +kubebuilder:validation:Enum=Pending;Queued;PreHooks;Planning;Acting;AwaitingApproval;Reflecting;PostHooks;Succeeded;Failed
 	Phase string `json:"phase,omitempty"`
 
 	// StartTime is when the AgentRun started executing
@@ -75,7 +205,7 @@ type AgentRunStatus struct {
 	// +optional
 	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
 
-	// Iterations is the number of plan-act-reflect iterations completed
+	// Iterations is the number of model turns the agent took
 	// +optional
 	Iterations int32 `json:"iterations,omitempty"`
 
@@ -83,6 +213,42 @@ type AgentRunStatus struct {
 	// +optional
 	// +listType=atomic
 	Results []AgentResult `json:"results,omitempty"`
+
+	// RetriesStatus records the outcome of each failed attempt that was retried
+	// +optional
+	// +listType=atomic
+	RetriesStatus []AgentRunAttemptStatus `json:"retriesStatus,omitempty"`
+
+	// Plan lists the mutating tool calls proposed by a plan-mode AgentRun,
+	// or the calls performed by an execute-mode AgentRun
+	// +optional
+	// +listType=atomic
+	Plan []ProposedAction `json:"plan,omitempty"`
+}
+
+// AgentRunAttemptStatus records the outcome of a single attempt of an AgentRun
+type AgentRunAttemptStatus struct {
+	// Attempt is the zero-based attempt number
+	Attempt int32 `json:"attempt"`
+
+	// PodName is the name of the agent pod used for this attempt
+	PodName string `json:"podName"`
+
+	// Reason is a machine-readable reason for the attempt's failure
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human-readable description of the attempt's failure
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// StartTime is when the attempt's pod started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the attempt finished
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
 }
 
 // AgentResult represents a result from the agent
@@ -106,6 +272,7 @@ type AgentRunList struct {
 // Phase constants
 const (
 	AgentRunPhasePending    = "Pending"
+	AgentRunPhaseQueued     = "Queued"
 	AgentRunPhasePreHooks   = "PreHooks"
 	AgentRunPhasePlanning   = "Planning"
 	AgentRunPhaseActing     = "Acting"
@@ -113,6 +280,62 @@ const (
 	AgentRunPhasePostHooks  = "PostHooks"
 	AgentRunPhaseSucceeded  = "Succeeded"
 	AgentRunPhaseFailed     = "Failed"
+
+	// AgentRunPhaseAwaitingApproval is set while a tool call waits for an AgentApproval decision
+	AgentRunPhaseAwaitingApproval = "AwaitingApproval"
+)
+
+// Condition types
+const (
+	// AgentRunConditionSucceeded reports whether the AgentRun finished successfully
+	AgentRunConditionSucceeded = "Succeeded"
+)
+
+// Condition reasons
+const (
+	AgentRunReasonRunning   = "Running"
+	AgentRunReasonSucceeded = "Succeeded"
+	AgentRunReasonFailed    = "Failed"
+	AgentRunReasonCancelled = "Cancelled"
+
+	// Reasons reported by the agent pod through its termination message
+	AgentRunReasonProviderError = "ProviderError"
+	AgentRunReasonTimeout       = "Timeout"
+	AgentRunReasonMaxIterations = "MaxIterations"
+	// AgentRunReasonBudgetExceeded is reported when a run uses more tokens or costs more than its budget
+	AgentRunReasonBudgetExceeded = "BudgetExceeded"
+
+	// AgentRunReasonRetrying is set while waiting to start the next attempt
+	AgentRunReasonRetrying = "Retrying"
+
+	// AgentRunReasonQueued is set while waiting for a concurrency slot
+	AgentRunReasonQueued = "Queued"
+
+	// AgentRunReasonWaitingForRun is set while waiting for the AgentRun referenced by
+	// PlanRef or ContinueFrom to finish
+	AgentRunReasonWaitingForRun = "WaitingForRun"
+
+	// AgentRunReasonAwaitingApproval is set while a tool call waits for an AgentApproval decision
+	AgentRunReasonAwaitingApproval = "AwaitingApproval"
+
+	// AgentRunReasonInvalidSpec is set when the spec of an AgentRun does not pass validation
+	AgentRunReasonInvalidSpec = "InvalidSpec"
+
+	// AgentRunReasonInvalidPlan is set when an execute-mode AgentRun references a plan that cannot be executed
+	AgentRunReasonInvalidPlan = "InvalidPlan"
+	// AgentRunReasonPlanTooLarge is reported by the agent when the plan does not fit in its termination message
+	AgentRunReasonPlanTooLarge = "PlanTooLarge"
+	// AgentRunReasonResultsTooLarge is reported by the agent when its results do not fit in its termination message
+	AgentRunReasonResultsTooLarge = "ResultsTooLarge"
+
+	// AgentRunReasonInvalidContinuation is set when the AgentRun referenced by ContinueFrom has no transcript to resume
+	AgentRunReasonInvalidContinuation = "InvalidContinuation"
+
+	// AgentRunReasonInvalidParams is set when the params of an AgentRun do not match the declarations of its AgentConfig
+	AgentRunReasonInvalidParams = "InvalidParams"
+
+	// AgentRunReasonDelegationNotAllowed is set when a child AgentRun exceeds the delegation limits of its parent's AgentConfig
+	AgentRunReasonDelegationNotAllowed = "DelegationNotAllowed"
 )
 
 // IsDone returns true if the AgentRun has completed (succeeded or failed)
@@ -124,3 +347,101 @@ func (ar *AgentRun) IsDone() bool {
 func (ar *AgentRun) HasStarted() bool {
 	return ar.Status.StartTime != nil
 }
+
+// Attempt returns the zero-based number of the current attempt
+func (ar *AgentRun) Attempt() int32 {
+	return int32(len(ar.Status.RetriesStatus))
+}
+
+// IsCancelled returns true if the AgentRun has been requested to be cancelled
+func (ar *AgentRun) IsCancelled() bool {
+	return ar.Spec.Status == AgentRunSpecStatusCancelled
+}
+
+// IsDryRun returns true if mutating tools should use server-side dry run.
+// The AgentRun's DryRun overrides the AgentConfig's when set.
+func (ar *AgentRun) IsDryRun(agentConfig *AgentConfig) bool {
+	if ar.Spec.DryRun != nil {
+		return *ar.Spec.DryRun
+	}
+	return agentConfig != nil && agentConfig.Spec.DryRun
+}
+
+// MarkRetrying records the failed attempt and moves the AgentRun back to Pending
+func (s *AgentRunStatus) MarkRetrying(attempt AgentRunAttemptStatus) {
+	s.RetriesStatus = append(s.RetriesStatus, attempt)
+	s.Phase = AgentRunPhasePending
+	meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+		Type:    AgentRunConditionSucceeded,
+		Status:  metav1.ConditionUnknown,
+		Reason:  AgentRunReasonRetrying,
+		Message: fmt.Sprintf("Attempt %d failed (%s), retrying", attempt.Attempt, attempt.Reason),
+	})
+}
+
+// MarkRunning moves the AgentRun to the Acting phase once its agent pod exists
+func (s *AgentRunStatus) MarkRunning(message string) {
+	s.Phase = AgentRunPhaseActing
+	meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+		Type:    AgentRunConditionSucceeded,
+		Status:  metav1.ConditionUnknown,
+		Reason:  AgentRunReasonRunning,
+		Message: message,
+	})
+}
+
+// MarkQueued moves the AgentRun to the Queued phase
+func (s *AgentRunStatus) MarkQueued(message string) {
+	s.Phase = AgentRunPhaseQueued
+	meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+		Type:    AgentRunConditionSucceeded,
+		Status:  metav1.ConditionUnknown,
+		Reason:  AgentRunReasonQueued,
+		Message: message,
+	})
+}
+
+// MarkWaitingForRun moves the AgentRun to the Queued phase while it waits for another
+// AgentRun to finish. Unlike MarkQueued, it does not take a place in the concurrency queue.
+func (s *AgentRunStatus) MarkWaitingForRun(message string) {
+	s.Phase = AgentRunPhaseQueued
+	meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+		Type:    AgentRunConditionSucceeded,
+		Status:  metav1.ConditionUnknown,
+		Reason:  AgentRunReasonWaitingForRun,
+		Message: message,
+	})
+}
+
+// MarkAwaitingApproval moves the AgentRun to the AwaitingApproval phase
+func (s *AgentRunStatus) MarkAwaitingApproval(message string) {
+	s.Phase = AgentRunPhaseAwaitingApproval
+	meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+		Type:    AgentRunConditionSucceeded,
+		Status:  metav1.ConditionUnknown,
+		Reason:  AgentRunReasonAwaitingApproval,
+		Message: message,
+	})
+}
+
+// MarkSucceeded moves the AgentRun to the Succeeded phase
+func (s *AgentRunStatus) MarkSucceeded(reason, message string) {
+	s.markDone(AgentRunPhaseSucceeded, metav1.ConditionTrue, reason, message)
+}
+
+// MarkFailed moves the AgentRun to the Failed phase
+func (s *AgentRunStatus) MarkFailed(reason, message string) {
+	s.markDone(AgentRunPhaseFailed, metav1.ConditionFalse, reason, message)
+}
+
+func (s *AgentRunStatus) markDone(phase string, status metav1.ConditionStatus, reason, message string) {
+	now := metav1.Now()
+	s.Phase = phase
+	s.CompletionTime = &now
+	meta.SetStatusCondition(&s.Conditions, metav1.Condition{
+		Type:    AgentRunConditionSucceeded,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
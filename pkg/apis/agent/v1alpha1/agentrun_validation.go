@@ -24,8 +24,54 @@ func (ars *AgentRunSpec) Validate(ctx context.Context) error {
 		return fmt.Errorf("configRef.name is required")
 	}
 
-	if ars.Goal == "" {
-		return fmt.Errorf("goal is required")
+	// Without a goal, the goal template of the AgentConfig is rendered from the params
+	if ars.Goal == "" && len(ars.Params) == 0 {
+		return fmt.Errorf("goal is required unless params are set")
+	}
+
+	if ars.Status != "" && ars.Status != AgentRunSpecStatusCancelled {
+		return fmt.Errorf("status must be either empty or '%s'", AgentRunSpecStatusCancelled)
+	}
+
+	if ars.Retries < 0 {
+		return fmt.Errorf("retries must not be negative")
+	}
+
+	if ars.TTLSecondsAfterFinished != nil && *ars.TTLSecondsAfterFinished < 0 {
+		return fmt.Errorf("ttlSecondsAfterFinished must not be negative")
+	}
+
+	switch ars.Mode {
+	case "", AgentRunModePlan:
+		if ars.PlanRef != nil {
+			return fmt.Errorf("planRef is only allowed in %s mode", AgentRunModeExecute)
+		}
+	case AgentRunModeExecute:
+		if ars.PlanRef == nil || ars.PlanRef.Name == "" {
+			return fmt.Errorf("planRef.name is required in %s mode", AgentRunModeExecute)
+		}
+	default:
+		return fmt.Errorf("mode must be empty, '%s' or '%s'", AgentRunModePlan, AgentRunModeExecute)
+	}
+
+	if ars.ContinueFrom != nil {
+		if ars.ContinueFrom.Name == "" {
+			return fmt.Errorf("continueFrom.name is required")
+		}
+		if ars.Mode == AgentRunModeExecute {
+			return fmt.Errorf("continueFrom is not allowed in %s mode", AgentRunModeExecute)
+		}
+	}
+
+	for i, target := range ars.Context.Targets {
+		switch target.Kind {
+		case TargetKindPipelineRun, TargetKindTaskRun, TargetKindPod:
+		default:
+			return fmt.Errorf("context.targets[%d].kind must be one of '%s', '%s' or '%s'", i, TargetKindPipelineRun, TargetKindTaskRun, TargetKindPod)
+		}
+		if target.Name == "" {
+			return fmt.Errorf("context.targets[%d].name is required", i)
+		}
 	}
 
 	return nil
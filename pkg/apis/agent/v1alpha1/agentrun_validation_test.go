@@ -43,6 +43,16 @@ func TestAgentRunSpec_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "params without goal",
+			spec: &AgentRunSpec{
+				ConfigRef: ConfigRef{
+					Name: "test-config",
+				},
+				Params: map[string]string{"pipeline": "build"},
+			},
+			wantErr: false,
+		},
 		{
 			name: "valid with context hints",
 			spec: &AgentRunSpec{
@@ -56,6 +66,157 @@ func TestAgentRunSpec_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid with context targets",
+			spec: &AgentRunSpec{
+				ConfigRef: ConfigRef{
+					Name: "test-config",
+				},
+				Goal: "Debug build failures",
+				Context: AgentContext{
+					Targets: []TargetRef{
+						{Kind: TargetKindPipelineRun, Name: "build-1"},
+						{Kind: TargetKindPod, Name: "build-1-compile-pod", Namespace: "ci"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid target kind",
+			spec: &AgentRunSpec{
+				ConfigRef: ConfigRef{
+					Name: "test-config",
+				},
+				Goal: "Debug build failures",
+				Context: AgentContext{
+					Targets: []TargetRef{{Kind: "Deployment", Name: "myapp"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "target without name",
+			spec: &AgentRunSpec{
+				ConfigRef: ConfigRef{
+					Name: "test-config",
+				},
+				Goal: "Debug build failures",
+				Context: AgentContext{
+					Targets: []TargetRef{{Kind: TargetKindTaskRun}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid cancelled status",
+			spec: &AgentRunSpec{
+				ConfigRef: ConfigRef{
+					Name: "test-config",
+				},
+				Goal:   "Debug deployment failures",
+				Status: AgentRunSpecStatusCancelled,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid status",
+			spec: &AgentRunSpec{
+				ConfigRef: ConfigRef{
+					Name: "test-config",
+				},
+				Goal:   "Debug deployment failures",
+				Status: "Paused",
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative retries",
+			spec: &AgentRunSpec{
+				ConfigRef: ConfigRef{
+					Name: "test-config",
+				},
+				Goal:    "Debug deployment failures",
+				Retries: -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid plan mode",
+			spec: &AgentRunSpec{
+				ConfigRef: ConfigRef{Name: "test-config"},
+				Goal:      "Roll out v2",
+				Mode:      AgentRunModePlan,
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid execute mode",
+			spec: &AgentRunSpec{
+				ConfigRef: ConfigRef{Name: "test-config"},
+				Goal:      "Roll out v2",
+				Mode:      AgentRunModeExecute,
+				PlanRef:   &PlanRef{Name: "rollout-plan"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "execute mode without planRef",
+			spec: &AgentRunSpec{
+				ConfigRef: ConfigRef{Name: "test-config"},
+				Goal:      "Roll out v2",
+				Mode:      AgentRunModeExecute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "planRef outside execute mode",
+			spec: &AgentRunSpec{
+				ConfigRef: ConfigRef{Name: "test-config"},
+				Goal:      "Roll out v2",
+				Mode:      AgentRunModePlan,
+				PlanRef:   &PlanRef{Name: "rollout-plan"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid mode",
+			spec: &AgentRunSpec{
+				ConfigRef: ConfigRef{Name: "test-config"},
+				Goal:      "Roll out v2",
+				Mode:      "yolo",
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid continuation",
+			spec: &AgentRunSpec{
+				ConfigRef:    ConfigRef{Name: "test-config"},
+				Goal:         "Now also rerun it with debug=true",
+				ContinueFrom: &ContinueFromRef{Name: "rollout"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "continueFrom without name",
+			spec: &AgentRunSpec{
+				ConfigRef:    ConfigRef{Name: "test-config"},
+				Goal:         "Now also rerun it with debug=true",
+				ContinueFrom: &ContinueFromRef{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "continueFrom in execute mode",
+			spec: &AgentRunSpec{
+				ConfigRef:    ConfigRef{Name: "test-config"},
+				Goal:         "Roll out v2",
+				Mode:         AgentRunModeExecute,
+				PlanRef:      &PlanRef{Name: "rollout-plan"},
+				ContinueFrom: &ContinueFromRef{Name: "rollout"},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,34 @@
+package v1alpha1
+
+import (
+	"context"
+)
+
+const (
+	DefaultSuccessfulRunsHistoryLimit = 3
+	DefaultFailedRunsHistoryLimit     = 1
+)
+
+// SetDefaults sets default values for AgentSchedule
+func (as *AgentSchedule) SetDefaults(ctx context.Context) {
+	as.Spec.SetDefaults(ctx)
+}
+
+// SetDefaults sets default values for AgentScheduleSpec
+func (ass *AgentScheduleSpec) SetDefaults(ctx context.Context) {
+	if ass.ConcurrencyPolicy == "" {
+		ass.ConcurrencyPolicy = ConcurrencyPolicyAllow
+	}
+
+	if ass.SuccessfulRunsHistoryLimit == nil {
+		limit := int32(DefaultSuccessfulRunsHistoryLimit)
+		ass.SuccessfulRunsHistoryLimit = &limit
+	}
+
+	if ass.FailedRunsHistoryLimit == nil {
+		limit := int32(DefaultFailedRunsHistoryLimit)
+		ass.FailedRunsHistoryLimit = &limit
+	}
+
+	ass.Template.Spec.SetDefaults(ctx)
+}
@@ -0,0 +1,127 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Namespaced
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+// +kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+// +kubebuilder:printcolumn:name="Last Schedule",type=date,JSONPath=`.status.lastScheduleTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// AgentSchedule creates AgentRuns on a cron schedule
+type AgentSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +optional
+	Spec AgentScheduleSpec `json:"spec,omitempty"`
+
+	// +optional
+	Status AgentScheduleStatus `json:"status,omitempty"`
+}
+
+// AgentScheduleSpec defines the desired state of AgentSchedule
+type AgentScheduleSpec struct {
+	// Schedule is a cron expression in the standard five-field format, e.g. "0 9 * * *"
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// TimeZone is the IANA time zone the schedule is evaluated in. Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// Template describes the AgentRun created at each scheduled time
+	Template AgentRunTemplateSpec `json:"template"`
+
+	// ConcurrencyPolicy specifies how to treat a scheduled time while a previous AgentRun is still active
+	// +optional
+	// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+	ConcurrencyPolicy ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+
+	// Suspend stops new AgentRuns from being created; active runs are not affected
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// SuccessfulRunsHistoryLimit is the number of succeeded AgentRuns to keep
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	SuccessfulRunsHistoryLimit *int32 `json:"successfulRunsHistoryLimit,omitempty"`
+
+	// FailedRunsHistoryLimit is the number of failed AgentRuns to keep
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	FailedRunsHistoryLimit *int32 `json:"failedRunsHistoryLimit,omitempty"`
+}
+
+// AgentRunTemplateSpec describes the AgentRun created from a template
+type AgentRunTemplateSpec struct {
+	// Labels are added to each created AgentRun
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are added to each created AgentRun
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Spec is the spec of each created AgentRun
+	Spec AgentRunSpec `json:"spec"`
+}
+
+// ConcurrencyPolicy describes how overlapping scheduled AgentRuns are handled
+type ConcurrencyPolicy string
+
+const (
+	// ConcurrencyPolicyAllow allows AgentRuns to run concurrently
+	ConcurrencyPolicyAllow ConcurrencyPolicy = "Allow"
+	// ConcurrencyPolicyForbid skips a scheduled time while a previous AgentRun is still active
+	ConcurrencyPolicyForbid ConcurrencyPolicy = "Forbid"
+	// ConcurrencyPolicyReplace cancels active AgentRuns and starts a new one
+	ConcurrencyPolicyReplace ConcurrencyPolicy = "Replace"
+)
+
+// AgentScheduleStatus defines the observed state of AgentSchedule
+type AgentScheduleStatus struct {
+	// Conditions represent the latest available observations of the AgentSchedule's state
+	// +optional
+	// +listType=atomic
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Active lists the names of AgentRuns created by this schedule that are still running
+	// +optional
+	// +listType=atomic
+	Active []string `json:"active,omitempty"`
+
+	// LastScheduleTime is the last time an AgentRun was scheduled
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// LastSuccessfulTime is the last time a scheduled AgentRun succeeded
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AgentScheduleList contains a list of AgentSchedule
+type AgentScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AgentSchedule `json:"items"`
+}
+
+// AgentScheduleLabelKey is set on AgentRuns created by an AgentSchedule
+const AgentScheduleLabelKey = "agent.tekton.dev/schedule"
+
+// CronSpec returns the schedule including its time zone in the form understood by the cron parser
+func (s *AgentScheduleSpec) CronSpec() string {
+	if s.TimeZone == "" {
+		return s.Schedule
+	}
+	return "CRON_TZ=" + s.TimeZone + " " + s.Schedule
+}
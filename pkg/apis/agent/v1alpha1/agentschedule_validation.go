@@ -0,0 +1,68 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Validate validates the AgentSchedule
+func (as *AgentSchedule) Validate(ctx context.Context) error {
+	if err := validateObjectMeta(as.ObjectMeta); err != nil {
+		return fmt.Errorf("metadata: %w", err)
+	}
+
+	if as.ObjectMeta.Namespace == "" {
+		return fmt.Errorf("namespace is required")
+	}
+
+	// Leave room for the scheduled-time suffix of created AgentRun names
+	if len(as.ObjectMeta.Name) > 52 {
+		return fmt.Errorf("metadata: name is too long (max 52 characters)")
+	}
+
+	return as.Spec.Validate(ctx)
+}
+
+// Validate validates the AgentScheduleSpec
+func (ass *AgentScheduleSpec) Validate(ctx context.Context) error {
+	if ass.Schedule == "" {
+		return fmt.Errorf("schedule is required")
+	}
+
+	if ass.TimeZone != "" {
+		if _, err := time.LoadLocation(ass.TimeZone); err != nil {
+			return fmt.Errorf("timeZone %q is invalid: %w", ass.TimeZone, err)
+		}
+	}
+
+	if _, err := cron.ParseStandard(ass.CronSpec()); err != nil {
+		return fmt.Errorf("schedule %q is invalid: %w", ass.Schedule, err)
+	}
+
+	switch ass.ConcurrencyPolicy {
+	case "", ConcurrencyPolicyAllow, ConcurrencyPolicyForbid, ConcurrencyPolicyReplace:
+	default:
+		return fmt.Errorf("concurrencyPolicy must be one of 'Allow', 'Forbid' or 'Replace'")
+	}
+
+	if ass.SuccessfulRunsHistoryLimit != nil && *ass.SuccessfulRunsHistoryLimit < 0 {
+		return fmt.Errorf("successfulRunsHistoryLimit must not be negative")
+	}
+
+	if ass.FailedRunsHistoryLimit != nil && *ass.FailedRunsHistoryLimit < 0 {
+		return fmt.Errorf("failedRunsHistoryLimit must not be negative")
+	}
+
+	if ass.Template.Spec.Status != "" {
+		return fmt.Errorf("template.spec.status must not be set")
+	}
+
+	if err := ass.Template.Spec.Validate(ctx); err != nil {
+		return fmt.Errorf("template.spec: %w", err)
+	}
+
+	return nil
+}
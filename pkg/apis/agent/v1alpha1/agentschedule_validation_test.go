@@ -0,0 +1,188 @@
+package v1alpha1
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func validAgentRunTemplate() AgentRunTemplateSpec {
+	return AgentRunTemplateSpec{
+		Spec: AgentRunSpec{
+			ConfigRef: ConfigRef{
+				Name: "test-config",
+			},
+			Goal: "Summarize failed PipelineRuns",
+		},
+	}
+}
+
+func TestAgentScheduleSpec_Validate(t *testing.T) {
+	negative := int32(-1)
+
+	tests := []struct {
+		name    string
+		spec    *AgentScheduleSpec
+		wantErr bool
+	}{
+		{
+			name: "valid spec",
+			spec: &AgentScheduleSpec{
+				Schedule: "0 9 * * 1-5",
+				Template: validAgentRunTemplate(),
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid with time zone",
+			spec: &AgentScheduleSpec{
+				Schedule: "@daily",
+				TimeZone: "Europe/Berlin",
+				Template: validAgentRunTemplate(),
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing schedule",
+			spec: &AgentScheduleSpec{
+				Template: validAgentRunTemplate(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid schedule",
+			spec: &AgentScheduleSpec{
+				Schedule: "every morning",
+				Template: validAgentRunTemplate(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid time zone",
+			spec: &AgentScheduleSpec{
+				Schedule: "0 9 * * *",
+				TimeZone: "Mars/Olympus",
+				Template: validAgentRunTemplate(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid concurrency policy",
+			spec: &AgentScheduleSpec{
+				Schedule:          "0 9 * * *",
+				ConcurrencyPolicy: "Queue",
+				Template:          validAgentRunTemplate(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative history limit",
+			spec: &AgentScheduleSpec{
+				Schedule:               "0 9 * * *",
+				FailedRunsHistoryLimit: &negative,
+				Template:               validAgentRunTemplate(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "template with cancelled status",
+			spec: &AgentScheduleSpec{
+				Schedule: "0 9 * * *",
+				Template: AgentRunTemplateSpec{
+					Spec: AgentRunSpec{
+						ConfigRef: ConfigRef{
+							Name: "test-config",
+						},
+						Goal:   "Summarize failed PipelineRuns",
+						Status: AgentRunSpecStatusCancelled,
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "template missing goal",
+			spec: &AgentScheduleSpec{
+				Schedule: "0 9 * * *",
+				Template: AgentRunTemplateSpec{
+					Spec: AgentRunSpec{
+						ConfigRef: ConfigRef{
+							Name: "test-config",
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.spec.Validate(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AgentScheduleSpec.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAgentSchedule_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule *AgentSchedule
+		wantErr  bool
+	}{
+		{
+			name: "valid schedule",
+			schedule: &AgentSchedule{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "nightly",
+					Namespace: "default",
+				},
+				Spec: AgentScheduleSpec{
+					Schedule: "0 9 * * *",
+					Template: validAgentRunTemplate(),
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing namespace",
+			schedule: &AgentSchedule{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "nightly",
+				},
+				Spec: AgentScheduleSpec{
+					Schedule: "0 9 * * *",
+					Template: validAgentRunTemplate(),
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "name too long",
+			schedule: &AgentSchedule{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      strings.Repeat("a", 53),
+					Namespace: "default",
+				},
+				Spec: AgentScheduleSpec{
+					Schedule: "0 9 * * *",
+					Template: validAgentRunTemplate(),
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schedule.Validate(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AgentSchedule.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
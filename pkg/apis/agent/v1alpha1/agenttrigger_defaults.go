@@ -0,0 +1,19 @@
+package v1alpha1
+
+import (
+	"context"
+)
+
+// SetDefaults sets default values for AgentTrigger
+func (at *AgentTrigger) SetDefaults(ctx context.Context) {
+	at.Spec.SetDefaults(ctx)
+}
+
+// SetDefaults sets default values for AgentTriggerSpec
+func (ats *AgentTriggerSpec) SetDefaults(ctx context.Context) {
+	if ats.Resource == "" {
+		ats.Resource = TriggerResourcePipelineRun
+	}
+
+	ats.Template.Spec.SetDefaults(ctx)
+}
@@ -0,0 +1,90 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Namespaced
+// +kubebuilder:printcolumn:name="Resource",type=string,JSONPath=`.spec.resource`
+// +kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=`.spec.suspend`
+// +kubebuilder:printcolumn:name="Last Failure",type=date,JSONPath=`.status.lastFailureTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// AgentTrigger creates AgentRuns when Tekton runs fail
+type AgentTrigger struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +optional
+	Spec AgentTriggerSpec `json:"spec,omitempty"`
+
+	// +optional
+	Status AgentTriggerStatus `json:"status,omitempty"`
+}
+
+// AgentTriggerSpec defines the desired state of AgentTrigger
+type AgentTriggerSpec struct {
+	// Resource is the kind of Tekton run to watch. Defaults to PipelineRun.
+	// +optional
+	// +kubebuilder:validation:Enum=PipelineRun;TaskRun
+	Resource TriggerResource `json:"resource,omitempty"`
+
+	// Selector selects the watched runs by label. An empty selector matches all runs in the namespace.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Template describes the AgentRun created for each failed run.
+	// The goal, hints and params may reference the failed run with $(failed.kind), $(failed.name),
+	// $(failed.namespace), $(failed.taskRun), $(failed.reason) and $(failed.message).
+	Template AgentRunTemplateSpec `json:"template"`
+
+	// Suspend stops new AgentRuns from being created; failures that happen while suspended are not triaged
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// TriggerResource is the kind of Tekton run an AgentTrigger watches
+type TriggerResource string
+
+const (
+	// TriggerResourcePipelineRun watches PipelineRuns
+	TriggerResourcePipelineRun TriggerResource = "PipelineRun"
+	// TriggerResourceTaskRun watches TaskRuns
+	TriggerResourceTaskRun TriggerResource = "TaskRun"
+)
+
+// AgentTriggerStatus defines the observed state of AgentTrigger
+type AgentTriggerStatus struct {
+	// Conditions represent the latest available observations of the AgentTrigger's state
+	// +optional
+	// +listType=atomic
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// LastFailureTime is the completion time of the most recent failed run an AgentRun was created for
+	// +optional
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+
+	// LastAgentRun is the name of the most recently created AgentRun
+	// +optional
+	LastAgentRun string `json:"lastAgentRun,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AgentTriggerList contains a list of AgentTrigger
+type AgentTriggerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AgentTrigger `json:"items"`
+}
+
+const (
+	// AgentTriggerLabelKey is set on AgentRuns created by an AgentTrigger
+	AgentTriggerLabelKey = "agent.tekton.dev/trigger"
+	// TriggeredByAnnotationKey records the failed run an AgentRun was created for, as <kind>/<name>
+	TriggeredByAnnotationKey = "agent.tekton.dev/triggered-by"
+)
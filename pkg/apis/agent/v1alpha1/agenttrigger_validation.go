@@ -0,0 +1,51 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Validate validates the AgentTrigger
+func (at *AgentTrigger) Validate(ctx context.Context) error {
+	if err := validateObjectMeta(at.ObjectMeta); err != nil {
+		return fmt.Errorf("metadata: %w", err)
+	}
+
+	if at.ObjectMeta.Namespace == "" {
+		return fmt.Errorf("namespace is required")
+	}
+
+	// Leave room for the hash suffix of created AgentRun names
+	if len(at.ObjectMeta.Name) > 52 {
+		return fmt.Errorf("metadata: name is too long (max 52 characters)")
+	}
+
+	return at.Spec.Validate(ctx)
+}
+
+// Validate validates the AgentTriggerSpec
+func (ats *AgentTriggerSpec) Validate(ctx context.Context) error {
+	switch ats.Resource {
+	case "", TriggerResourcePipelineRun, TriggerResourceTaskRun:
+	default:
+		return fmt.Errorf("resource must be one of 'PipelineRun' or 'TaskRun'")
+	}
+
+	if ats.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(ats.Selector); err != nil {
+			return fmt.Errorf("selector: %w", err)
+		}
+	}
+
+	if ats.Template.Spec.Status != "" {
+		return fmt.Errorf("template.spec.status must not be set")
+	}
+
+	if err := ats.Template.Spec.Validate(ctx); err != nil {
+		return fmt.Errorf("template.spec: %w", err)
+	}
+
+	return nil
+}
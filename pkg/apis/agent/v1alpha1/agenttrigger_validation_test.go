@@ -0,0 +1,134 @@
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAgentTriggerSpec_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    *AgentTriggerSpec
+		wantErr bool
+	}{
+		{
+			name: "valid spec",
+			spec: &AgentTriggerSpec{
+				Template: validAgentRunTemplate(),
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid TaskRun trigger with selector",
+			spec: &AgentTriggerSpec{
+				Resource: TriggerResourceTaskRun,
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "myapp"},
+				},
+				Template: validAgentRunTemplate(),
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid resource",
+			spec: &AgentTriggerSpec{
+				Resource: "CustomRun",
+				Template: validAgentRunTemplate(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid selector",
+			spec: &AgentTriggerSpec{
+				Selector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{{
+						Key:      "app",
+						Operator: "Matches",
+					}},
+				},
+				Template: validAgentRunTemplate(),
+			},
+			wantErr: true,
+		},
+		{
+			name: "template with cancelled status",
+			spec: &AgentTriggerSpec{
+				Template: AgentRunTemplateSpec{
+					Spec: AgentRunSpec{
+						ConfigRef: ConfigRef{
+							Name: "test-config",
+						},
+						Goal:   "Find the root cause of $(failed.name)",
+						Status: AgentRunSpecStatusCancelled,
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "template missing configRef",
+			spec: &AgentTriggerSpec{
+				Template: AgentRunTemplateSpec{
+					Spec: AgentRunSpec{
+						Goal: "Find the root cause of $(failed.name)",
+					},
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.spec.Validate(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AgentTriggerSpec.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAgentTrigger_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		trigger *AgentTrigger
+		wantErr bool
+	}{
+		{
+			name: "valid trigger",
+			trigger: &AgentTrigger{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "triage",
+					Namespace: "default",
+				},
+				Spec: AgentTriggerSpec{
+					Template: validAgentRunTemplate(),
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing namespace",
+			trigger: &AgentTrigger{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "triage",
+				},
+				Spec: AgentTriggerSpec{
+					Template: validAgentRunTemplate(),
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.trigger.Validate(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AgentTrigger.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package v1alpha1
+
+import (
+	"context"
+)
+
+// SetDefaults sets default values for AgentWorkflow
+func (aw *AgentWorkflow) SetDefaults(ctx context.Context) {
+	aw.Spec.SetDefaults(ctx)
+}
+
+// SetDefaults sets default values for AgentWorkflowSpec
+func (aws *AgentWorkflowSpec) SetDefaults(ctx context.Context) {
+	for i := range aws.Steps {
+		aws.Steps[i].Template.Spec.SetDefaults(ctx)
+	}
+}
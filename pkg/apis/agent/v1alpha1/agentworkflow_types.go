@@ -0,0 +1,131 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Namespaced
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Succeeded",type=string,JSONPath=`.status.conditions[?(@.type=="Succeeded")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// AgentWorkflow runs a graph of AgentRuns, passing the results of earlier steps
+// into the goals of the steps that run after them
+type AgentWorkflow struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +optional
+	Spec AgentWorkflowSpec `json:"spec,omitempty"`
+
+	// +optional
+	Status AgentWorkflowStatus `json:"status,omitempty"`
+}
+
+// AgentWorkflowSpec defines the desired state of AgentWorkflow
+type AgentWorkflowSpec struct {
+	// Steps are the AgentRuns of the workflow. A step starts once all steps in its runAfter have succeeded.
+	// +listType=map
+	// +listMapKey=name
+	// +kubebuilder:validation:MinItems=1
+	Steps []WorkflowStep `json:"steps"`
+}
+
+// WorkflowStep describes one AgentRun of an AgentWorkflow
+type WorkflowStep struct {
+	// Name identifies the step within the workflow
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// RunAfter lists the steps that must succeed before this step starts
+	// +optional
+	// +listType=set
+	RunAfter []string `json:"runAfter,omitempty"`
+
+	// Template describes the AgentRun of the step.
+	// The goal, hints and params may reference results of the steps it runs after,
+	// directly or indirectly, with $(steps.<step>.results.<result>).
+	Template AgentRunTemplateSpec `json:"template"`
+}
+
+// AgentWorkflowStatus defines the observed state of AgentWorkflow
+type AgentWorkflowStatus struct {
+	// Conditions represent the latest available observations of the AgentWorkflow's state
+	// +optional
+	// +listType=atomic
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Phase represents the current phase of the workflow
+	// +optional
+	// +kubebuilder:validation:Enum=Running;Succeeded;Failed
+	Phase string `json:"phase,omitempty"`
+
+	// StartTime is when the first step was created
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the workflow completed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Steps records the AgentRun and outcome of each started step. Finished steps
+	// keep their phase and results after their AgentRun is deleted.
+	// +optional
+	// +listType=atomic
+	Steps []WorkflowStepStatus `json:"steps,omitempty"`
+}
+
+// WorkflowStepStatus records the AgentRun of a started workflow step
+type WorkflowStepStatus struct {
+	// Name of the step
+	Name string `json:"name"`
+
+	// AgentRun is the name of the AgentRun created for the step
+	AgentRun string `json:"agentRun"`
+
+	// Phase is the phase of the step's AgentRun
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// Results are the results of the step's AgentRun
+	// +optional
+	// +listType=atomic
+	Results []AgentResult `json:"results,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AgentWorkflowList contains a list of AgentWorkflow
+type AgentWorkflowList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AgentWorkflow `json:"items"`
+}
+
+// Phase constants
+const (
+	AgentWorkflowPhaseRunning   = "Running"
+	AgentWorkflowPhaseSucceeded = "Succeeded"
+	AgentWorkflowPhaseFailed    = "Failed"
+)
+
+const (
+	// AgentWorkflowLabelKey is set on AgentRuns created by an AgentWorkflow
+	AgentWorkflowLabelKey = "agent.tekton.dev/workflow"
+	// AgentWorkflowStepLabelKey records the workflow step an AgentRun was created for
+	AgentWorkflowStepLabelKey = "agent.tekton.dev/workflow-step"
+)
+
+// IsDone returns true if the AgentWorkflow has completed (succeeded or failed)
+func (aw *AgentWorkflow) IsDone() bool {
+	return aw.Status.Phase == AgentWorkflowPhaseSucceeded || aw.Status.Phase == AgentWorkflowPhaseFailed
+}
+
+// StepRunName returns the name of the AgentRun created for a step
+func (aw *AgentWorkflow) StepRunName(step string) string {
+	return aw.Name + "-" + step
+}
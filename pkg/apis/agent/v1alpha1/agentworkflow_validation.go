@@ -0,0 +1,172 @@
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// stepResultRefPattern matches $(steps.<step>.results.<result>) references
+var stepResultRefPattern = regexp.MustCompile(`\$\(steps\.([^.()]+)\.results\.([^()]+)\)`)
+
+// StepResultRef is a $(steps.<step>.results.<result>) reference in a workflow step
+// +k8s:deepcopy-gen=false
+type StepResultRef struct {
+	// Expression is the reference as written, e.g. $(steps.investigate.results.response)
+	Expression string
+	Step       string
+	Result     string
+}
+
+// StepResultRefs returns the step result references in s
+func StepResultRefs(s string) []StepResultRef {
+	var refs []StepResultRef
+	for _, match := range stepResultRefPattern.FindAllStringSubmatch(s, -1) {
+		refs = append(refs, StepResultRef{Expression: match[0], Step: match[1], Result: match[2]})
+	}
+	return refs
+}
+
+// Validate validates the AgentWorkflow
+func (aw *AgentWorkflow) Validate(ctx context.Context) error {
+	if err := validateObjectMeta(aw.ObjectMeta); err != nil {
+		return fmt.Errorf("metadata: %w", err)
+	}
+
+	if aw.ObjectMeta.Namespace == "" {
+		return fmt.Errorf("namespace is required")
+	}
+
+	if err := aw.Spec.Validate(ctx); err != nil {
+		return err
+	}
+
+	// Step AgentRuns are named <workflow>-<step>
+	for i, step := range aw.Spec.Steps {
+		if name := aw.StepRunName(step.Name); len(name) > validation.DNS1123LabelMaxLength {
+			return fmt.Errorf("steps[%d]: AgentRun name %q is too long (max %d characters)", i, name, validation.DNS1123LabelMaxLength)
+		}
+	}
+
+	return nil
+}
+
+// Validate validates the AgentWorkflowSpec
+func (aws *AgentWorkflowSpec) Validate(ctx context.Context) error {
+	if len(aws.Steps) == 0 {
+		return fmt.Errorf("steps is required")
+	}
+
+	steps := make(map[string]*WorkflowStep, len(aws.Steps))
+	for i := range aws.Steps {
+		step := &aws.Steps[i]
+		if errs := validation.IsDNS1123Label(step.Name); len(errs) > 0 {
+			return fmt.Errorf("steps[%d].name: %s", i, strings.Join(errs, ", "))
+		}
+		if steps[step.Name] != nil {
+			return fmt.Errorf("steps[%d].name: duplicate step %q", i, step.Name)
+		}
+		steps[step.Name] = step
+	}
+
+	for i, step := range aws.Steps {
+		for _, dep := range step.RunAfter {
+			if dep == step.Name {
+				return fmt.Errorf("steps[%d].runAfter: step %q cannot run after itself", i, step.Name)
+			}
+			if steps[dep] == nil {
+				return fmt.Errorf("steps[%d].runAfter: unknown step %q", i, dep)
+			}
+		}
+
+		if step.Template.Spec.Status != "" {
+			return fmt.Errorf("steps[%d].template.spec.status must not be set", i)
+		}
+
+		if err := step.Template.Spec.Validate(ctx); err != nil {
+			return fmt.Errorf("steps[%d].template.spec: %w", i, err)
+		}
+	}
+
+	if cycle := findCycle(aws.Steps, steps); cycle != nil {
+		return fmt.Errorf("steps form a cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	for i, step := range aws.Steps {
+		ancestors := stepAncestors(steps, step.Name)
+		texts := append([]string{step.Template.Spec.Goal}, step.Template.Spec.Context.Hints...)
+		for _, value := range step.Template.Spec.Params {
+			texts = append(texts, value)
+		}
+		for _, text := range texts {
+			for _, ref := range StepResultRefs(text) {
+				if !ancestors[ref.Step] {
+					return fmt.Errorf("steps[%d]: %s must reference a step that %q runs after", i, ref.Expression, step.Name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// findCycle returns the steps of a runAfter cycle, or nil if the steps form a DAG
+func findCycle(order []WorkflowStep, steps map[string]*WorkflowStep) []string {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var path []string
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i, p := range path {
+				if p == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range steps[name].RunAfter {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, step := range order {
+		if cycle := visit(step.Name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// stepAncestors returns the steps that must succeed, directly or indirectly, before the named step starts
+func stepAncestors(steps map[string]*WorkflowStep, name string) map[string]bool {
+	ancestors := map[string]bool{}
+	pending := append([]string{}, steps[name].RunAfter...)
+	for len(pending) > 0 {
+		dep := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if ancestors[dep] {
+			continue
+		}
+		ancestors[dep] = true
+		pending = append(pending, steps[dep].RunAfter...)
+	}
+	return ancestors
+}
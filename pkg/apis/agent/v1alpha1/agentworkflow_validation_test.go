@@ -0,0 +1,204 @@
+package v1alpha1
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func workflowStep(name, goal string, runAfter ...string) WorkflowStep {
+	template := validAgentRunTemplate()
+	template.Spec.Goal = goal
+	return WorkflowStep{
+		Name:     name,
+		RunAfter: runAfter,
+		Template: template,
+	}
+}
+
+func TestAgentWorkflowSpec_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    *AgentWorkflowSpec
+		wantErr bool
+	}{
+		{
+			name: "valid spec",
+			spec: &AgentWorkflowSpec{
+				Steps: []WorkflowStep{
+					workflowStep("investigate", "Find why the build fails"),
+					workflowStep("fix", "Fix this: $(steps.investigate.results.response)", "investigate"),
+					workflowStep("validate", "Validate the fix for $(steps.investigate.results.response)", "fix"),
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "no steps",
+			spec:    &AgentWorkflowSpec{},
+			wantErr: true,
+		},
+		{
+			name: "invalid step name",
+			spec: &AgentWorkflowSpec{
+				Steps: []WorkflowStep{workflowStep("Investigate", "Find why the build fails")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate step",
+			spec: &AgentWorkflowSpec{
+				Steps: []WorkflowStep{
+					workflowStep("investigate", "Find why the build fails"),
+					workflowStep("investigate", "Find why the tests fail"),
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown runAfter",
+			spec: &AgentWorkflowSpec{
+				Steps: []WorkflowStep{workflowStep("fix", "Fix the build", "investigate")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "runs after itself",
+			spec: &AgentWorkflowSpec{
+				Steps: []WorkflowStep{workflowStep("fix", "Fix the build", "fix")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "cycle",
+			spec: &AgentWorkflowSpec{
+				Steps: []WorkflowStep{
+					workflowStep("investigate", "Find why the build fails", "validate"),
+					workflowStep("fix", "Fix the build", "investigate"),
+					workflowStep("validate", "Validate the fix", "fix"),
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "result of a step that does not run before",
+			spec: &AgentWorkflowSpec{
+				Steps: []WorkflowStep{
+					workflowStep("investigate", "Find why the build fails"),
+					workflowStep("fix", "Fix this: $(steps.investigate.results.response)"),
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "result reference in hints",
+			spec: &AgentWorkflowSpec{
+				Steps: []WorkflowStep{
+					workflowStep("investigate", "Find why the build fails"),
+					{
+						Name: "fix",
+						Template: AgentRunTemplateSpec{
+							Spec: AgentRunSpec{
+								ConfigRef: ConfigRef{Name: "test-config"},
+								Goal:      "Fix the build",
+								Context:   AgentContext{Hints: []string{"$(steps.validate.results.response)"}},
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "template with cancelled status",
+			spec: &AgentWorkflowSpec{
+				Steps: []WorkflowStep{{
+					Name: "investigate",
+					Template: AgentRunTemplateSpec{
+						Spec: AgentRunSpec{
+							ConfigRef: ConfigRef{Name: "test-config"},
+							Goal:      "Find why the build fails",
+							Status:    AgentRunSpecStatusCancelled,
+						},
+					},
+				}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.spec.Validate(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AgentWorkflowSpec.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAgentWorkflow_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		workflow *AgentWorkflow
+		wantErr  bool
+	}{
+		{
+			name: "valid workflow",
+			workflow: &AgentWorkflow{
+				ObjectMeta: metav1.ObjectMeta{Name: "fix-build", Namespace: "default"},
+				Spec: AgentWorkflowSpec{
+					Steps: []WorkflowStep{workflowStep("investigate", "Find why the build fails")},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing namespace",
+			workflow: &AgentWorkflow{
+				ObjectMeta: metav1.ObjectMeta{Name: "fix-build"},
+				Spec: AgentWorkflowSpec{
+					Steps: []WorkflowStep{workflowStep("investigate", "Find why the build fails")},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "step AgentRun name too long",
+			workflow: &AgentWorkflow{
+				ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("a", 52), Namespace: "default"},
+				Spec: AgentWorkflowSpec{
+					Steps: []WorkflowStep{workflowStep("investigate", "Find why the build fails")},
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.workflow.Validate(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AgentWorkflow.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStepResultRefs(t *testing.T) {
+	refs := StepResultRefs("Fix $(steps.investigate.results.response) then $(steps.plan.results.simulated-actions), not $(failed.name)")
+	want := []StepResultRef{
+		{Expression: "$(steps.investigate.results.response)", Step: "investigate", Result: "response"},
+		{Expression: "$(steps.plan.results.simulated-actions)", Step: "plan", Result: "simulated-actions"},
+	}
+	if len(refs) != len(want) {
+		t.Fatalf("StepResultRefs() = %+v, want %+v", refs, want)
+	}
+	for i := range want {
+		if refs[i] != want[i] {
+			t.Errorf("refs[%d] = %+v, want %+v", i, refs[i], want[i])
+		}
+	}
+}
@@ -29,10 +29,18 @@ var (
 // addKnownTypes adds the list of known types to Scheme
 func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
+		&AgentApproval{},
+		&AgentApprovalList{},
 		&AgentConfig{},
 		&AgentConfigList{},
 		&AgentRun{},
 		&AgentRunList{},
+		&AgentSchedule{},
+		&AgentScheduleList{},
+		&AgentTrigger{},
+		&AgentTriggerList{},
+		&AgentWorkflow{},
+		&AgentWorkflowList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
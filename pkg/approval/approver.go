@@ -0,0 +1,117 @@
+// Package approval asks humans to approve agent tool calls through AgentApproval objects
+package approval
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/waveywaves/agentrun-controller/pkg/agent"
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	"github.com/waveywaves/agentrun-controller/pkg/pod"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// defaultPollInterval is how often the AgentApproval is checked for a decision
+const defaultPollInterval = 5 * time.Second
+
+// maxNamePrefixLength leaves room for the hash suffix in AgentApproval names
+const maxNamePrefixLength = 253 - 9
+
+// Approver implements agent.Approver by creating an AgentApproval for the tool
+// call and waiting until its status records a decision
+type Approver struct {
+	AgentApprovals *client.AgentApprovals
+	Namespace      string
+	AgentRunName   string
+	AgentRunUID    types.UID
+	PollInterval   time.Duration
+}
+
+// RequestApproval creates an AgentApproval describing the tool call and blocks
+// until it is approved or rejected, or ctx is done
+func (a *Approver) RequestApproval(ctx context.Context, toolCall agent.ToolCall, reason string) (agent.ApprovalDecision, error) {
+	approval, err := a.buildAgentApproval(toolCall, reason)
+	if err != nil {
+		return agent.ApprovalDecision{}, err
+	}
+
+	// The approval may already exist if the same tool call was made before a restart
+	if _, err := a.AgentApprovals.Create(ctx, approval); err != nil && !errors.IsAlreadyExists(err) {
+		return agent.ApprovalDecision{}, fmt.Errorf("failed to create AgentApproval: %w", err)
+	}
+	log.Printf("Waiting for approval of tool %s (AgentApproval %s/%s)", toolCall.Name, approval.Namespace, approval.Name)
+
+	pollInterval := a.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		current, err := a.AgentApprovals.Get(ctx, approval.Namespace, approval.Name)
+		if err != nil {
+			return agent.ApprovalDecision{}, fmt.Errorf("failed to get AgentApproval: %w", err)
+		}
+		if current.IsDecided() {
+			log.Printf("AgentApproval %s/%s: %s", approval.Namespace, approval.Name, current.Status.Decision)
+			return agent.ApprovalDecision{
+				Approved: current.Status.Decision == v1alpha1.ApprovalApproved,
+				Message:  current.Status.Message,
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return agent.ApprovalDecision{}, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Approver) buildAgentApproval(toolCall agent.ToolCall, reason string) (*v1alpha1.AgentApproval, error) {
+	input, err := json.Marshal(toolCall.Input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tool input: %w", err)
+	}
+
+	return &v1alpha1.AgentApproval{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      Name(a.AgentRunName, a.AgentRunUID, toolCall.ID),
+			Namespace: a.Namespace,
+			Labels: map[string]string{
+				pod.AgentRunLabelKey: a.AgentRunName,
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+				Kind:       "AgentRun",
+				Name:       a.AgentRunName,
+				UID:        a.AgentRunUID,
+			}},
+		},
+		Spec: v1alpha1.AgentApprovalSpec{
+			AgentRun:   a.AgentRunName,
+			ToolCallID: toolCall.ID,
+			ToolName:   toolCall.Name,
+			Input:      string(input),
+			Reason:     reason,
+		},
+	}, nil
+}
+
+// Name returns the name of the AgentApproval for a tool call of an AgentRun
+func Name(agentRunName string, agentRunUID types.UID, toolCallID string) string {
+	sum := sha256.Sum256([]byte(string(agentRunUID) + "/" + toolCallID))
+	if len(agentRunName) > maxNamePrefixLength {
+		agentRunName = agentRunName[:maxNamePrefixLength]
+	}
+	return fmt.Sprintf("%s-%s", agentRunName, hex.EncodeToString(sum[:])[:8])
+}
@@ -0,0 +1,117 @@
+package approval
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/agentrun-controller/pkg/agent"
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newApprover() *Approver {
+	return &Approver{
+		AgentApprovals: &client.AgentApprovals{
+			Dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), client.ListKinds),
+		},
+		Namespace:    "default",
+		AgentRunName: "deploy",
+		AgentRunUID:  "uid-1",
+		PollInterval: 10 * time.Millisecond,
+	}
+}
+
+func TestRequestApproval(t *testing.T) {
+	tests := []struct {
+		name         string
+		decision     v1alpha1.ApprovalDecision
+		message      string
+		wantApproved bool
+	}{
+		{
+			name:         "approved",
+			decision:     v1alpha1.ApprovalApproved,
+			message:      "ship it",
+			wantApproved: true,
+		},
+		{
+			name:         "rejected",
+			decision:     v1alpha1.ApprovalRejected,
+			message:      "not during the freeze",
+			wantApproved: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			a := newApprover()
+			toolCall := agent.ToolCall{
+				ID:    "toolu_1",
+				Name:  "tekton_create_pipelinerun",
+				Input: map[string]interface{}{"namespace": "production"},
+			}
+
+			type result struct {
+				decision agent.ApprovalDecision
+				err      error
+			}
+			done := make(chan result, 1)
+			go func() {
+				decision, err := a.RequestApproval(ctx, toolCall, "Tool tekton_create_pipelinerun requires approval")
+				done <- result{decision, err}
+			}()
+
+			// Wait for the agent to record the pending tool call, then decide it
+			name := Name(a.AgentRunName, a.AgentRunUID, toolCall.ID)
+			var approval *v1alpha1.AgentApproval
+			for approval == nil {
+				select {
+				case <-ctx.Done():
+					t.Fatal("AgentApproval was not created")
+				case <-time.After(5 * time.Millisecond):
+				}
+				approval, _ = a.AgentApprovals.Get(ctx, "default", name)
+			}
+
+			if approval.Spec.ToolName != toolCall.Name {
+				t.Errorf("Spec.ToolName = %q, want %q", approval.Spec.ToolName, toolCall.Name)
+			}
+			if approval.Spec.Input != `{"namespace":"production"}` {
+				t.Errorf("Spec.Input = %q", approval.Spec.Input)
+			}
+			if approval.Spec.AgentRun != "deploy" || len(approval.OwnerReferences) != 1 {
+				t.Errorf("AgentApproval not linked to AgentRun: %+v", approval.ObjectMeta)
+			}
+
+			approval.Status.Decision = tt.decision
+			approval.Status.Message = tt.message
+			if _, err := a.AgentApprovals.UpdateStatus(ctx, approval); err != nil {
+				t.Fatalf("UpdateStatus() error = %v", err)
+			}
+
+			got := <-done
+			if got.err != nil {
+				t.Fatalf("RequestApproval() error = %v", got.err)
+			}
+			if got.decision.Approved != tt.wantApproved || got.decision.Message != tt.message {
+				t.Errorf("RequestApproval() = %+v, want approved=%v message=%q", got.decision, tt.wantApproved, tt.message)
+			}
+		})
+	}
+}
+
+func TestRequestApproval_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := newApprover().RequestApproval(ctx, agent.ToolCall{ID: "toolu_1", Name: "tekton_create_pipelinerun"}, "")
+	if err != context.DeadlineExceeded {
+		t.Errorf("RequestApproval() error = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+// AgentApprovals manages AgentApprovals through the dynamic client
+type AgentApprovals struct {
+	Dynamic dynamic.Interface
+}
+
+// Get returns the named AgentApproval
+func (c *AgentApprovals) Get(ctx context.Context, namespace, name string) (*v1alpha1.AgentApproval, error) {
+	unstr, err := c.Dynamic.Resource(AgentApprovalGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return toAgentApproval(unstr)
+}
+
+// List returns the AgentApprovals in namespace
+func (c *AgentApprovals) List(ctx context.Context, namespace string) ([]*v1alpha1.AgentApproval, error) {
+	list, err := c.Dynamic.Resource(AgentApprovalGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	approvals := make([]*v1alpha1.AgentApproval, 0, len(list.Items))
+	for i := range list.Items {
+		approval, err := toAgentApproval(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, approval)
+	}
+	return approvals, nil
+}
+
+// Create creates the AgentApproval
+func (c *AgentApprovals) Create(ctx context.Context, approval *v1alpha1.AgentApproval) (*v1alpha1.AgentApproval, error) {
+	unstr, err := fromAgentApproval(approval)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := c.Dynamic.Resource(AgentApprovalGVR).Namespace(approval.Namespace).Create(ctx, unstr, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return toAgentApproval(created)
+}
+
+// UpdateStatus updates the status subresource of the AgentApproval
+func (c *AgentApprovals) UpdateStatus(ctx context.Context, approval *v1alpha1.AgentApproval) (*v1alpha1.AgentApproval, error) {
+	unstr, err := fromAgentApproval(approval)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := c.Dynamic.Resource(AgentApprovalGVR).Namespace(approval.Namespace).UpdateStatus(ctx, unstr, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return toAgentApproval(updated)
+}
+
+func fromAgentApproval(approval *v1alpha1.AgentApproval) (*unstructured.Unstructured, error) {
+	approval = approval.DeepCopy()
+	approval.APIVersion = v1alpha1.SchemeGroupVersion.String()
+	approval.Kind = "AgentApproval"
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(approval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert AgentApproval: %w", err)
+	}
+	return &unstructured.Unstructured{Object: obj}, nil
+}
+
+func toAgentApproval(unstr *unstructured.Unstructured) (*v1alpha1.AgentApproval, error) {
+	var approval v1alpha1.AgentApproval
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstr.Object, &approval); err != nil {
+		return nil, fmt.Errorf("failed to convert AgentApproval %s/%s: %w", unstr.GetNamespace(), unstr.GetName(), err)
+	}
+	return &approval, nil
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// GVRs of the agent.tekton.dev resources
+var (
+	AgentRunGVR      = v1alpha1.SchemeGroupVersion.WithResource("agentruns")
+	AgentConfigGVR   = v1alpha1.SchemeGroupVersion.WithResource("agentconfigs")
+	AgentScheduleGVR = v1alpha1.SchemeGroupVersion.WithResource("agentschedules")
+	AgentTriggerGVR  = v1alpha1.SchemeGroupVersion.WithResource("agenttriggers")
+	AgentApprovalGVR = v1alpha1.SchemeGroupVersion.WithResource("agentapprovals")
+	AgentWorkflowGVR = v1alpha1.SchemeGroupVersion.WithResource("agentworkflows")
+)
+
+// AgentRuns manages AgentRuns through the dynamic client
+type AgentRuns struct {
+	Dynamic dynamic.Interface
+}
+
+// Get returns the named AgentRun
+func (c *AgentRuns) Get(ctx context.Context, namespace, name string) (*v1alpha1.AgentRun, error) {
+	unstr, err := c.Dynamic.Resource(AgentRunGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return toAgentRun(unstr)
+}
+
+// List returns the AgentRuns in namespace matching labelSelector
+func (c *AgentRuns) List(ctx context.Context, namespace, labelSelector string) ([]*v1alpha1.AgentRun, error) {
+	list, err := c.Dynamic.Resource(AgentRunGVR).Namespace(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labelSelector,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	agentRuns := make([]*v1alpha1.AgentRun, 0, len(list.Items))
+	for i := range list.Items {
+		ar, err := toAgentRun(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		agentRuns = append(agentRuns, ar)
+	}
+	return agentRuns, nil
+}
+
+// Create creates the AgentRun
+func (c *AgentRuns) Create(ctx context.Context, agentRun *v1alpha1.AgentRun) (*v1alpha1.AgentRun, error) {
+	agentRun = agentRun.DeepCopy()
+	agentRun.APIVersion = v1alpha1.SchemeGroupVersion.String()
+	agentRun.Kind = "AgentRun"
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(agentRun)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert AgentRun: %w", err)
+	}
+
+	created, err := c.Dynamic.Resource(AgentRunGVR).Namespace(agentRun.Namespace).Create(ctx, &unstructured.Unstructured{Object: obj}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return toAgentRun(created)
+}
+
+// Delete deletes the named AgentRun and, in the background, the resources it owns
+func (c *AgentRuns) Delete(ctx context.Context, namespace, name string) error {
+	propagation := metav1.DeletePropagationBackground
+	return c.Dynamic.Resource(AgentRunGVR).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+}
+
+// Cancel requests cancellation of the named AgentRun by setting spec.status
+func (c *AgentRuns) Cancel(ctx context.Context, namespace, name string) error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"status":%q}}`, v1alpha1.AgentRunSpecStatusCancelled))
+	_, err := c.Dynamic.Resource(AgentRunGVR).Namespace(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+func toAgentRun(unstr *unstructured.Unstructured) (*v1alpha1.AgentRun, error) {
+	var ar v1alpha1.AgentRun
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstr.Object, &ar); err != nil {
+		return nil, fmt.Errorf("failed to convert AgentRun %s/%s: %w", unstr.GetNamespace(), unstr.GetName(), err)
+	}
+	return &ar, nil
+}
+
+// ListKinds maps the agent.tekton.dev resources to their list kinds, for use with fake dynamic clients
+var ListKinds = map[schema.GroupVersionResource]string{
+	AgentRunGVR:      "AgentRunList",
+	AgentConfigGVR:   "AgentConfigList",
+	AgentScheduleGVR: "AgentScheduleList",
+	AgentTriggerGVR:  "AgentTriggerList",
+	AgentApprovalGVR: "AgentApprovalList",
+	AgentWorkflowGVR: "AgentWorkflowList",
+}
@@ -1,13 +1,38 @@
 package pod
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// Labels set on agent pods
+const (
+	AgentRunLabelKey    = "agent.tekton.dev/agentrun"
+	AgentConfigLabelKey = "agent.tekton.dev/config"
+	ComponentLabelKey   = "app.kubernetes.io/component"
+
+	// AgentRuntimeComponent is the component label value of agent pods
+	AgentRuntimeComponent = "agent-runtime"
+)
+
+// Labels set on AgentRuns delegated by another AgentRun
+const (
+	// ParentAgentRunLabelKey names the AgentRun that delegated to this one
+	ParentAgentRunLabelKey = "agent.tekton.dev/parent-agentrun"
+	// DelegationDepthLabelKey is how deeply the AgentRun is nested; children of a top-level AgentRun have depth 1
+	DelegationDepthLabelKey = "agent.tekton.dev/delegation-depth"
+	// ParentPodUIDLabelKey is the UID of the agent pod that created the AgentRun. The
+	// delegation admission policy requires it to be the pod of the requesting token,
+	// and the controller requires it to be a pod of the parent AgentRun.
+	ParentPodUIDLabelKey = "agent.tekton.dev/parent-pod-uid"
+)
+
 // Builder builds Pod specs for agent execution
 type Builder struct {
 	Image string
@@ -15,16 +40,30 @@ type Builder struct {
 
 // Build creates a Pod spec for an AgentRun
 func (b *Builder) Build(agentRun *v1alpha1.AgentRun, agentConfig *v1alpha1.AgentConfig) (*corev1.Pod, error) {
-	podName := fmt.Sprintf("%s-agent", agentRun.Name)
+	// The agent gets the goal with the params of the AgentRun substituted
+	goal, err := agentRun.ResolveGoal(agentConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve goal: %w", err)
+	}
+
+	// The plan of an execute-mode AgentRun is passed to the agent as JSON
+	plan := ""
+	if len(agentRun.Status.Plan) > 0 {
+		data, err := json.Marshal(agentRun.Status.Plan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal plan: %w", err)
+		}
+		plan = string(data)
+	}
 
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      podName,
+			Name:      PodName(agentRun),
 			Namespace: agentRun.Namespace,
 			Labels: map[string]string{
-				"agent.tekton.dev/agentrun": agentRun.Name,
-				"agent.tekton.dev/config":   agentConfig.Name,
-				"app.kubernetes.io/component": "agent-runtime",
+				AgentRunLabelKey:               agentRun.Name,
+				AgentConfigLabelKey:            agentConfig.Name,
+				ComponentLabelKey:              AgentRuntimeComponent,
 				"app.kubernetes.io/managed-by": "agentrun-controller",
 			},
 			OwnerReferences: []metav1.OwnerReference{
@@ -37,11 +76,13 @@ func (b *Builder) Build(agentRun *v1alpha1.AgentRun, agentConfig *v1alpha1.Agent
 			SecurityContext:    b.buildPodSecurityContext(),
 			Containers: []corev1.Container{
 				{
-					Name:            "agent",
-					Image:           b.Image,
-					ImagePullPolicy: corev1.PullIfNotPresent,
-					SecurityContext: b.buildContainerSecurityContext(),
-					VolumeMounts:    b.buildVolumeMounts(),
+					Name:                     "agent",
+					Image:                    b.Image,
+					ImagePullPolicy:          corev1.PullIfNotPresent,
+					SecurityContext:          b.buildContainerSecurityContext(),
+					VolumeMounts:             b.buildVolumeMounts(),
+					TerminationMessagePath:   TerminationMessagePath,
+					TerminationMessagePolicy: corev1.TerminationMessageReadFile,
 					Env: []corev1.EnvVar{
 						{
 							Name:  "AGENTRUN_NAME",
@@ -57,7 +98,7 @@ func (b *Builder) Build(agentRun *v1alpha1.AgentRun, agentConfig *v1alpha1.Agent
 						},
 						{
 							Name:  "AGENTRUN_GOAL",
-							Value: agentRun.Spec.Goal,
+							Value: goal,
 						},
 						{
 							Name:  "AGENTCONFIG_NAME",
@@ -67,6 +108,26 @@ func (b *Builder) Build(agentRun *v1alpha1.AgentRun, agentConfig *v1alpha1.Agent
 							Name:  "LLM_PROVIDER",
 							Value: agentConfig.Spec.Provider,
 						},
+						{
+							Name:  "AGENT_REQUIRE_APPROVAL",
+							Value: strings.Join(agentConfig.Spec.RequireApproval, ","),
+						},
+						{
+							Name:  "AGENT_DRY_RUN",
+							Value: strconv.FormatBool(agentRun.IsDryRun(agentConfig)),
+						},
+						{
+							Name:  "AGENTRUN_MODE",
+							Value: string(agentRun.Spec.Mode),
+						},
+						{
+							Name:  "AGENT_PLAN",
+							Value: plan,
+						},
+						{
+							Name:  "AGENT_TRANSCRIPT_CONFIGMAP",
+							Value: TranscriptName(agentRun.Name),
+						},
 					},
 				},
 			},
@@ -74,9 +135,154 @@ func (b *Builder) Build(agentRun *v1alpha1.AgentRun, agentConfig *v1alpha1.Agent
 		},
 	}
 
+	// The agent stops after the model turns allowed by the AgentConfig
+	if agentConfig.Spec.MaxIterations > 0 {
+		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
+			Name:  "AGENT_MAX_ITERATIONS",
+			Value: strconv.Itoa(int(agentConfig.Spec.MaxIterations)),
+		})
+	}
+
+	// Let the agent delegate sub-goals to child AgentRuns within the config's limits
+	if delegation := agentConfig.Spec.Delegation; delegation != nil {
+		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, delegationEnv(agentRun, delegation)...)
+	}
+
+	// Hints and targets reach the agent as JSON; targets without a namespace are in the AgentRun's
+	if agentContext := agentRun.Spec.Context; len(agentContext.Hints) > 0 || len(agentContext.Targets) > 0 {
+		agentContext = *agentContext.DeepCopy()
+		for i := range agentContext.Targets {
+			if agentContext.Targets[i].Namespace == "" {
+				agentContext.Targets[i].Namespace = agentRun.Namespace
+			}
+		}
+		data, err := json.Marshal(agentContext)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal context: %w", err)
+		}
+		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
+			Name:  "AGENTRUN_CONTEXT",
+			Value: string(data),
+		})
+	}
+
+	// The agent offers a submit_result tool for the results declared by the AgentConfig
+	if len(agentConfig.Spec.Results) > 0 {
+		data, err := json.Marshal(agentConfig.Spec.Results)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal results: %w", err)
+		}
+		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
+			Name:  "AGENT_RESULTS",
+			Value: string(data),
+		})
+	}
+
+	// The agent applies the tool limits of the AgentConfig to every call
+	if len(agentConfig.Spec.Tools) > 0 {
+		data, err := json.Marshal(agentConfig.Spec.Tools)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tools: %w", err)
+		}
+		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
+			Name:  "AGENT_TOOLS",
+			Value: string(data),
+		})
+	}
+
+	// The agent ends the run when it exceeds the budget of the AgentConfig
+	if agentConfig.Spec.Budget != nil {
+		data, err := json.Marshal(agentConfig.Spec.Budget)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal budget: %w", err)
+		}
+		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
+			Name:  "AGENT_BUDGET",
+			Value: string(data),
+		})
+	}
+
+	// The agent compacts long conversations as configured by the AgentConfig
+	if agentConfig.Spec.Compaction != nil {
+		data, err := json.Marshal(agentConfig.Spec.Compaction)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal compaction: %w", err)
+		}
+		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
+			Name:  "AGENT_COMPACTION",
+			Value: string(data),
+		})
+	}
+
+	// A continuation resumes the transcript of the previous AgentRun
+	if agentRun.Spec.ContinueFrom != nil {
+		addTranscriptVolume(pod, agentRun.Spec.ContinueFrom.Name)
+	}
+
 	return pod, nil
 }
 
+// delegationEnv passes the delegation limits of the AgentConfig to the agent, and the
+// UID of its pod to label the children with
+func delegationEnv(agentRun *v1alpha1.AgentRun, delegation *v1alpha1.DelegationSpec) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{
+			Name: "AGENT_POD_UID",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.uid"},
+			},
+		},
+		{
+			Name:  "AGENT_DELEGATE_CONFIGS",
+			Value: strings.Join(delegation.AllowedConfigs, ","),
+		},
+		{
+			Name:  "AGENT_DELEGATE_MAX_DEPTH",
+			Value: strconv.Itoa(int(delegation.GetMaxDepth())),
+		},
+		{
+			Name:  "AGENT_DELEGATE_MAX_CHILDREN",
+			Value: strconv.Itoa(int(delegation.GetMaxChildren())),
+		},
+		{
+			Name:  "AGENT_DELEGATION_DEPTH",
+			Value: strconv.Itoa(DelegationDepth(agentRun)),
+		},
+	}
+}
+
+// ParentAgentRunName returns the name of the AgentRun that delegated to this one, or
+// "" if it was not delegated. An AgentRun owned by another AgentRun counts as
+// delegated even without the parent label, so it cannot escape the delegation limits.
+func ParentAgentRunName(agentRun *v1alpha1.AgentRun) string {
+	if name := agentRun.Labels[ParentAgentRunLabelKey]; name != "" {
+		return name
+	}
+	for _, ref := range agentRun.OwnerReferences {
+		if ref.Kind == "AgentRun" {
+			return ref.Name
+		}
+	}
+	return ""
+}
+
+// DelegationDepth returns how deeply the AgentRun is nested in delegations; zero if it was not delegated
+func DelegationDepth(agentRun *v1alpha1.AgentRun) int {
+	depth, err := strconv.Atoi(agentRun.Labels[DelegationDepthLabelKey])
+	if err != nil || depth < 0 {
+		return 0
+	}
+	return depth
+}
+
+// PodName returns the name of the agent pod for the AgentRun's current attempt
+func PodName(agentRun *v1alpha1.AgentRun) string {
+	if attempt := agentRun.Attempt(); attempt > 0 {
+		return fmt.Sprintf("%s-agent-%d", agentRun.Name, attempt)
+	}
+	return fmt.Sprintf("%s-agent", agentRun.Name)
+}
+
 func (b *Builder) buildPodSecurityContext() *corev1.PodSecurityContext {
 	runAsNonRoot := true
 	runAsUser := int64(65532)
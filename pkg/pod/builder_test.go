@@ -2,6 +2,7 @@ package pod
 
 import (
 	"testing"
+	"time"
 
 	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
@@ -63,6 +64,393 @@ func TestBuild(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			name: "tools requiring approval",
+			agentRun: &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-run",
+					Namespace: "default",
+					UID:       "test-uid",
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Goal:      "Test goal",
+				},
+			},
+			agentConfig: &v1alpha1.AgentConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-config",
+				},
+				Spec: v1alpha1.AgentConfigSpec{
+					ConfigPVC:       "test-config-pvc",
+					RequireApproval: []string{"tekton_create_pipelinerun", "k8s_get_logs"},
+				},
+			},
+			image: "agentrun-runtime:latest",
+			checkPod: func(pod *corev1.Pod) error {
+				for _, env := range pod.Spec.Containers[0].Env {
+					if env.Name == "AGENT_REQUIRE_APPROVAL" {
+						if env.Value != "tekton_create_pipelinerun,k8s_get_logs" {
+							t.Errorf("AGENT_REQUIRE_APPROVAL = %q", env.Value)
+						}
+						return nil
+					}
+				}
+				t.Error("AGENT_REQUIRE_APPROVAL env var not set")
+				return nil
+			},
+		},
+		{
+			name: "agentrun dry run overrides config",
+			agentRun: &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-run",
+					Namespace: "default",
+					UID:       "test-uid",
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Goal:      "Test goal",
+					DryRun:    &[]bool{false}[0],
+				},
+			},
+			agentConfig: &v1alpha1.AgentConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-config",
+				},
+				Spec: v1alpha1.AgentConfigSpec{
+					ConfigPVC: "test-config-pvc",
+					DryRun:    true,
+				},
+			},
+			image: "agentrun-runtime:latest",
+			checkPod: func(pod *corev1.Pod) error {
+				for _, env := range pod.Spec.Containers[0].Env {
+					if env.Name == "AGENT_DRY_RUN" {
+						if env.Value != "false" {
+							t.Errorf("AGENT_DRY_RUN = %q, want false", env.Value)
+						}
+						return nil
+					}
+				}
+				t.Error("AGENT_DRY_RUN env var not set")
+				return nil
+			},
+		},
+		{
+			name: "delegation limits",
+			agentRun: &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-run",
+					Namespace: "default",
+					UID:       "test-uid",
+					Labels:    map[string]string{DelegationDepthLabelKey: "1"},
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Goal:      "Test goal",
+				},
+			},
+			agentConfig: &v1alpha1.AgentConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-config",
+				},
+				Spec: v1alpha1.AgentConfigSpec{
+					ConfigPVC:  "test-config-pvc",
+					Delegation: &v1alpha1.DelegationSpec{AllowedConfigs: []string{"investigator", "deployer"}, MaxDepth: 2},
+				},
+			},
+			image: "agentrun-runtime:latest",
+			checkPod: func(pod *corev1.Pod) error {
+				want := map[string]string{
+					"AGENT_DELEGATE_CONFIGS":      "investigator,deployer",
+					"AGENT_DELEGATE_MAX_DEPTH":    "2",
+					"AGENT_DELEGATE_MAX_CHILDREN": "5",
+					"AGENT_DELEGATION_DEPTH":      "1",
+				}
+				for _, env := range pod.Spec.Containers[0].Env {
+					if value, ok := want[env.Name]; ok {
+						if env.Value != value {
+							t.Errorf("%s = %q, want %q", env.Name, env.Value, value)
+						}
+						delete(want, env.Name)
+					}
+				}
+				for name := range want {
+					t.Errorf("%s env var not set", name)
+				}
+				for _, env := range pod.Spec.Containers[0].Env {
+					if env.Name == "AGENT_POD_UID" {
+						if env.ValueFrom == nil || env.ValueFrom.FieldRef == nil || env.ValueFrom.FieldRef.FieldPath != "metadata.uid" {
+							t.Errorf("AGENT_POD_UID = %+v, want the pod's UID", env)
+						}
+						return nil
+					}
+				}
+				t.Error("AGENT_POD_UID env var not set")
+				return nil
+			},
+		},
+		{
+			name: "goal rendered from params",
+			agentRun: &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-run",
+					Namespace: "default",
+					UID:       "test-uid",
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Params:    map[string]string{"pipeline": "build"},
+				},
+			},
+			agentConfig: &v1alpha1.AgentConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-config",
+				},
+				Spec: v1alpha1.AgentConfigSpec{
+					ConfigPVC:    "test-config-pvc",
+					Params:       []v1alpha1.ParamSpec{{Name: "pipeline"}},
+					GoalTemplate: "Run the $(params.pipeline) Pipeline",
+				},
+			},
+			image: "agentrun-runtime:latest",
+			checkPod: func(pod *corev1.Pod) error {
+				for _, env := range pod.Spec.Containers[0].Env {
+					if env.Name == "AGENTRUN_GOAL" {
+						if env.Value != "Run the build Pipeline" {
+							t.Errorf("AGENTRUN_GOAL = %q, want the rendered goal template", env.Value)
+						}
+						return nil
+					}
+				}
+				t.Error("AGENTRUN_GOAL env var not set")
+				return nil
+			},
+		},
+		{
+			name: "hints and targets",
+			agentRun: &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-run",
+					Namespace: "default",
+					UID:       "test-uid",
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Goal:      "Test goal",
+					Context: v1alpha1.AgentContext{
+						Hints: []string{"The build runs nightly"},
+						Targets: []v1alpha1.TargetRef{
+							{Kind: v1alpha1.TargetKindPipelineRun, Name: "build-1"},
+							{Kind: v1alpha1.TargetKindPod, Name: "build-1-pod", Namespace: "ci"},
+						},
+					},
+				},
+			},
+			agentConfig: &v1alpha1.AgentConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-config",
+				},
+				Spec: v1alpha1.AgentConfigSpec{
+					ConfigPVC: "test-config-pvc",
+				},
+			},
+			image: "agentrun-runtime:latest",
+			checkPod: func(pod *corev1.Pod) error {
+				for _, env := range pod.Spec.Containers[0].Env {
+					if env.Name == "AGENTRUN_CONTEXT" {
+						want := `{"hints":["The build runs nightly"],"targets":[{"kind":"PipelineRun","name":"build-1","namespace":"default"},{"kind":"Pod","name":"build-1-pod","namespace":"ci"}]}`
+						if env.Value != want {
+							t.Errorf("AGENTRUN_CONTEXT = %q, want %q", env.Value, want)
+						}
+						return nil
+					}
+				}
+				t.Error("AGENTRUN_CONTEXT env var not set")
+				return nil
+			},
+		},
+		{
+			name: "declared results",
+			agentRun: &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-run",
+					Namespace: "default",
+					UID:       "test-uid",
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Goal:      "Test goal",
+				},
+			},
+			agentConfig: &v1alpha1.AgentConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-config",
+				},
+				Spec: v1alpha1.AgentConfigSpec{
+					ConfigPVC: "test-config-pvc",
+					Results:   []v1alpha1.ResultSpec{{Name: "fixed", Type: v1alpha1.ParamTypeBoolean, Description: "Whether the build was fixed"}},
+				},
+			},
+			image: "agentrun-runtime:latest",
+			checkPod: func(pod *corev1.Pod) error {
+				for _, env := range pod.Spec.Containers[0].Env {
+					if env.Name == "AGENT_RESULTS" {
+						if want := `[{"name":"fixed","type":"boolean","description":"Whether the build was fixed"}]`; env.Value != want {
+							t.Errorf("AGENT_RESULTS = %q, want %q", env.Value, want)
+						}
+						return nil
+					}
+				}
+				t.Error("AGENT_RESULTS env var not set")
+				return nil
+			},
+		},
+		{
+			name: "tool limits",
+			agentRun: &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-run",
+					Namespace: "default",
+					UID:       "test-uid",
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Goal:      "Test goal",
+				},
+			},
+			agentConfig: &v1alpha1.AgentConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-config",
+				},
+				Spec: v1alpha1.AgentConfigSpec{
+					ConfigPVC: "test-config-pvc",
+					Tools:     []v1alpha1.ToolSpec{{Name: "k8s_get_logs", Timeout: &metav1.Duration{Duration: 30 * time.Second}, Retries: 2}},
+				},
+			},
+			image: "agentrun-runtime:latest",
+			checkPod: func(pod *corev1.Pod) error {
+				for _, env := range pod.Spec.Containers[0].Env {
+					if env.Name == "AGENT_TOOLS" {
+						if want := `[{"name":"k8s_get_logs","timeout":"30s","retries":2}]`; env.Value != want {
+							t.Errorf("AGENT_TOOLS = %q, want %q", env.Value, want)
+						}
+						return nil
+					}
+				}
+				t.Error("AGENT_TOOLS env var not set")
+				return nil
+			},
+		},
+		{
+			name: "budget",
+			agentRun: &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-run",
+					Namespace: "default",
+					UID:       "test-uid",
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Goal:      "Test goal",
+				},
+			},
+			agentConfig: &v1alpha1.AgentConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-config",
+				},
+				Spec: v1alpha1.AgentConfigSpec{
+					ConfigPVC: "test-config-pvc",
+					Budget:    &v1alpha1.BudgetSpec{MaxInputTokens: 100000, MaxCost: "0.50"},
+				},
+			},
+			image: "agentrun-runtime:latest",
+			checkPod: func(pod *corev1.Pod) error {
+				for _, env := range pod.Spec.Containers[0].Env {
+					if env.Name == "AGENT_BUDGET" {
+						if want := `{"maxInputTokens":100000,"maxCost":"0.50"}`; env.Value != want {
+							t.Errorf("AGENT_BUDGET = %q, want %q", env.Value, want)
+						}
+						return nil
+					}
+				}
+				t.Error("AGENT_BUDGET env var not set")
+				return nil
+			},
+		},
+		{
+			name: "compaction",
+			agentRun: &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-run",
+					Namespace: "default",
+					UID:       "test-uid",
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Goal:      "Test goal",
+				},
+			},
+			agentConfig: &v1alpha1.AgentConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-config",
+				},
+				Spec: v1alpha1.AgentConfigSpec{
+					ConfigPVC:  "test-config-pvc",
+					Compaction: &v1alpha1.CompactionSpec{MaxContextTokens: 100000, Summarize: true},
+				},
+			},
+			image: "agentrun-runtime:latest",
+			checkPod: func(pod *corev1.Pod) error {
+				for _, env := range pod.Spec.Containers[0].Env {
+					if env.Name == "AGENT_COMPACTION" {
+						if want := `{"maxContextTokens":100000,"summarize":true}`; env.Value != want {
+							t.Errorf("AGENT_COMPACTION = %q, want %q", env.Value, want)
+						}
+						return nil
+					}
+				}
+				t.Error("AGENT_COMPACTION env var not set")
+				return nil
+			},
+		},
+		{
+			name: "max iterations",
+			agentRun: &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-run",
+					Namespace: "default",
+					UID:       "test-uid",
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Goal:      "Test goal",
+				},
+			},
+			agentConfig: &v1alpha1.AgentConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-config",
+				},
+				Spec: v1alpha1.AgentConfigSpec{
+					ConfigPVC:     "test-config-pvc",
+					MaxIterations: 12,
+				},
+			},
+			image: "agentrun-runtime:latest",
+			checkPod: func(pod *corev1.Pod) error {
+				for _, env := range pod.Spec.Containers[0].Env {
+					if env.Name == "AGENT_MAX_ITERATIONS" {
+						if env.Value != "12" {
+							t.Errorf("AGENT_MAX_ITERATIONS = %q, want 12", env.Value)
+						}
+						return nil
+					}
+				}
+				t.Error("AGENT_MAX_ITERATIONS env var not set")
+				return nil
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -219,3 +607,66 @@ func TestBuildVolumes(t *testing.T) {
 		t.Errorf("Config PVC name = %v, want test-config-pvc", configVolume.PersistentVolumeClaim.ClaimName)
 	}
 }
+
+func TestPodName(t *testing.T) {
+	agentRun := &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-run",
+		},
+	}
+
+	if got := PodName(agentRun); got != "test-run-agent" {
+		t.Errorf("PodName() = %v, want test-run-agent", got)
+	}
+
+	agentRun.Status.RetriesStatus = []v1alpha1.AgentRunAttemptStatus{{Attempt: 0}, {Attempt: 1}}
+	if got := PodName(agentRun); got != "test-run-agent-2" {
+		t.Errorf("PodName() = %v, want test-run-agent-2", got)
+	}
+}
+
+func TestBuildContinuation(t *testing.T) {
+	agentRun := &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "follow-up",
+			Namespace: "default",
+			UID:       "test-uid",
+		},
+		Spec: v1alpha1.AgentRunSpec{
+			ConfigRef:    v1alpha1.ConfigRef{Name: "test-config"},
+			Goal:         "Now also rerun it with debug=true",
+			ContinueFrom: &v1alpha1.ContinueFromRef{Name: "rollout"},
+		},
+	}
+	agentConfig := &v1alpha1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-config"},
+		Spec:       v1alpha1.AgentConfigSpec{ConfigPVC: "test-config-pvc"},
+	}
+
+	builder := &Builder{Image: "agentrun-runtime:latest"}
+	pod, err := builder.Build(agentRun, agentConfig)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	var volume *corev1.Volume
+	for i := range pod.Spec.Volumes {
+		if pod.Spec.Volumes[i].Name == "transcript" {
+			volume = &pod.Spec.Volumes[i]
+		}
+	}
+	if volume == nil || volume.ConfigMap == nil || volume.ConfigMap.Name != "rollout-transcript" {
+		t.Fatalf("transcript volume = %+v, want ConfigMap rollout-transcript", volume)
+	}
+
+	env := map[string]string{}
+	for _, e := range pod.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	if got := env["AGENT_PREVIOUS_TRANSCRIPT"]; got != TranscriptMountPath+"/"+TranscriptKey {
+		t.Errorf("AGENT_PREVIOUS_TRANSCRIPT = %q", got)
+	}
+	if got := env["AGENT_TRANSCRIPT_CONFIGMAP"]; got != "follow-up-transcript" {
+		t.Errorf("AGENT_TRANSCRIPT_CONFIGMAP = %q, want follow-up-transcript", got)
+	}
+}
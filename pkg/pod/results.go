@@ -0,0 +1,60 @@
+package pod
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+)
+
+// TektonResultsDir is where Tekton collects the results of a step
+const TektonResultsDir = "/tekton/results"
+
+// maxTektonResultsLength keeps step results below the 4096 byte termination
+// message that Tekton shares between all steps of a TaskRun
+const maxTektonResultsLength = 3072
+
+// tektonResult is the entry Tekton records in the termination message for each result
+type tektonResult struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Type  int    `json:"type"`
+}
+
+// CheckTektonResults returns ErrResultsTooLarge if the results do not fit in
+// Tekton's result size limit
+func CheckTektonResults(results []v1alpha1.AgentResult) error {
+	_, err := fitTektonResults(results)
+	return err
+}
+
+// fitTektonResults returns results with the response shortened so that their
+// encoded size fits in maxTektonResultsLength
+func fitTektonResults(results []v1alpha1.AgentResult) ([]v1alpha1.AgentResult, error) {
+	return shrinkResults(results, maxTektonResultsLength, func(results []v1alpha1.AgentResult) int {
+		entries := make([]tektonResult, len(results))
+		for i, r := range results {
+			entries[i] = tektonResult{Key: r.Name, Value: r.Value, Type: 1}
+		}
+		data, _ := json.Marshal(entries)
+		return len(data)
+	})
+}
+
+// WriteTektonResults writes each result to a file named after it in dir.
+// The response is truncated to fit Tekton's result size limit.
+func WriteTektonResults(dir string, results []v1alpha1.AgentResult) error {
+	results, err := fitTektonResults(results)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		path := filepath.Join(dir, r.Name)
+		if err := os.WriteFile(path, []byte(r.Value), 0644); err != nil {
+			return fmt.Errorf("failed to write result %s: %w", r.Name, err)
+		}
+	}
+	return nil
+}
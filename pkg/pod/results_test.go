@@ -0,0 +1,95 @@
+package pod
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+)
+
+func TestWriteTektonResults(t *testing.T) {
+	dir := t.TempDir()
+
+	results := []v1alpha1.AgentResult{
+		{Name: "status", Value: "succeeded"},
+		{Name: "tokens-in", Value: "1200"},
+		{Name: "response", Value: strings.Repeat("a", maxTektonResultsLength)},
+	}
+	if err := WriteTektonResults(dir, results); err != nil {
+		t.Fatalf("WriteTektonResults() error = %v", err)
+	}
+
+	var entries []tektonResult
+	for _, r := range results {
+		data, err := os.ReadFile(filepath.Join(dir, r.Name))
+		if err != nil {
+			t.Fatalf("Failed to read result %s: %v", r.Name, err)
+		}
+		entries = append(entries, tektonResult{Key: r.Name, Value: string(data), Type: 1})
+	}
+
+	encoded, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatalf("Failed to marshal results: %v", err)
+	}
+	if len(encoded) > maxTektonResultsLength || len(encoded) < maxTektonResultsLength-1 {
+		t.Errorf("encoded result size = %d, want %d", len(encoded), maxTektonResultsLength)
+	}
+
+	status, _ := os.ReadFile(filepath.Join(dir, "status"))
+	if string(status) != "succeeded" {
+		t.Errorf("status = %q, want succeeded", status)
+	}
+}
+
+func TestWriteTektonResults_Escaped(t *testing.T) {
+	dir := t.TempDir()
+
+	results := []v1alpha1.AgentResult{
+		{Name: "status", Value: "succeeded"},
+		{Name: "response", Value: strings.Repeat("\"line\"\n", 1000)},
+	}
+	if err := WriteTektonResults(dir, results); err != nil {
+		t.Fatalf("WriteTektonResults() error = %v", err)
+	}
+
+	response, err := os.ReadFile(filepath.Join(dir, "response"))
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	encoded, err := json.Marshal([]tektonResult{
+		{Key: "status", Value: "succeeded", Type: 1},
+		{Key: "response", Value: string(response), Type: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal results: %v", err)
+	}
+	if len(encoded) > maxTektonResultsLength {
+		t.Errorf("encoded result size = %d, want at most %d", len(encoded), maxTektonResultsLength)
+	}
+	if len(response) == 0 || !strings.HasPrefix(results[1].Value, string(response)) {
+		t.Errorf("response = %q, want a non-empty prefix of the value", response)
+	}
+
+	// Declared results are not cut to fit
+	results = []v1alpha1.AgentResult{
+		{Name: "root-cause", Value: strings.Repeat("\n", maxTektonResultsLength)},
+		{Name: "response", Value: "done"},
+	}
+	if err := WriteTektonResults(t.TempDir(), results); !errors.Is(err, ErrResultsTooLarge) {
+		t.Errorf("WriteTektonResults() error = %v, want ErrResultsTooLarge", err)
+	}
+}
+
+func TestWriteTektonResults_MissingDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+
+	err := WriteTektonResults(dir, []v1alpha1.AgentResult{{Name: "status", Value: "failed"}})
+	if err == nil {
+		t.Error("WriteTektonResults() error = nil, want error for a missing directory")
+	}
+}
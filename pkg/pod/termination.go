@@ -0,0 +1,177 @@
+package pod
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TerminationMessagePath is where the agent container writes its termination message
+const TerminationMessagePath = "/dev/termination-log"
+
+// terminationMessageLimit is the kubelet's limit on the size of a termination
+// message. Longer messages are cut off and can no longer be parsed, so results
+// are shortened until the encoded message fits. maxTerminationMessageLength and
+// maxPlanLength leave room for the results.
+const (
+	terminationMessageLimit     = 4096
+	maxTerminationMessageLength = 1024
+	maxPlanLength               = 2048
+)
+
+// ErrPlanTooLarge is returned when a plan does not fit in the termination message.
+// Plans are never truncated since executing part of a plan would be unsafe.
+var ErrPlanTooLarge = errors.New("plan too large")
+
+// ErrResultsTooLarge is returned when the results do not fit in the termination
+// message or in Tekton's result size limit, even without the response. Only the response is ever shortened; other
+// results, such as declared integers, may no longer parse once cut.
+var ErrResultsTooLarge = errors.New("results too large")
+
+// responseResult is the free-text result that is shortened when the results do not fit
+const responseResult = "response"
+
+// TerminationMessage is written by the agent when it exits so the controller
+// can tell why an attempt ended
+type TerminationMessage struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+
+	// Iterations is the number of model turns the agent took
+	Iterations int `json:"iterations,omitempty"`
+
+	// Results are recorded in the AgentRun status when the agent succeeds
+	Results []v1alpha1.AgentResult `json:"results,omitempty"`
+
+	// Plan holds the actions proposed by a plan-mode agent
+	Plan []v1alpha1.ProposedAction `json:"plan,omitempty"`
+}
+
+// CheckPlan returns ErrPlanTooLarge if the plan does not fit in the termination message
+func CheckPlan(plan []v1alpha1.ProposedAction) error {
+	_, err := planLength(plan)
+	return err
+}
+
+func planLength(plan []v1alpha1.ProposedAction) (int, error) {
+	if len(plan) == 0 {
+		return 0, nil
+	}
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal plan: %w", err)
+	}
+	if len(data) > maxPlanLength {
+		return 0, fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrPlanTooLarge, len(data), maxPlanLength)
+	}
+	return len(data), nil
+}
+
+// CheckResults returns ErrResultsTooLarge if the results of a successful run and
+// its plan do not fit in the termination message
+func CheckResults(results []v1alpha1.AgentResult, plan []v1alpha1.ProposedAction) error {
+	_, err := fitResults(TerminationMessage{Reason: v1alpha1.AgentRunReasonSucceeded, Results: results, Plan: plan})
+	return err
+}
+
+// fitResults returns the results of msg with the response shortened so that the
+// encoded message fits in terminationMessageLimit
+func fitResults(msg TerminationMessage) ([]v1alpha1.AgentResult, error) {
+	return shrinkResults(msg.Results, terminationMessageLimit, func(results []v1alpha1.AgentResult) int {
+		msg.Results = results
+		data, _ := json.Marshal(msg)
+		return len(data)
+	})
+}
+
+// WriteTerminationMessage writes msg as JSON to path
+func WriteTerminationMessage(path string, msg TerminationMessage) error {
+	msg.Message = truncateUTF8(msg.Message, maxTerminationMessageLength)
+	if _, err := planLength(msg.Plan); err != nil {
+		return err
+	}
+	results, err := fitResults(msg)
+	if err != nil {
+		return err
+	}
+	msg.Results = results
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal termination message: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write termination message: %w", err)
+	}
+
+	return nil
+}
+
+// ReadTerminationMessage returns the termination message of the agent container, if any
+func ReadTerminationMessage(p *corev1.Pod) (*TerminationMessage, bool) {
+	for _, cs := range p.Status.ContainerStatuses {
+		if cs.Name != "agent" || cs.State.Terminated == nil || cs.State.Terminated.Message == "" {
+			continue
+		}
+
+		var msg TerminationMessage
+		if err := json.Unmarshal([]byte(cs.State.Terminated.Message), &msg); err != nil || msg.Reason == "" {
+			return nil, false
+		}
+		return &msg, true
+	}
+
+	return nil, false
+}
+
+// shrinkResults returns a copy of results with the response shortened until size
+// reports that they fit within limit. size measures the encoded results, so
+// escaped characters count at their encoded length.
+func shrinkResults(results []v1alpha1.AgentResult, limit int, size func([]v1alpha1.AgentResult) int) ([]v1alpha1.AgentResult, error) {
+	if results == nil || size(results) <= limit {
+		return results, nil
+	}
+
+	shrunk := slices.Clone(results)
+	for i := range shrunk {
+		if shrunk[i].Name != responseResult {
+			continue
+		}
+		// Find the longest prefix of the response that fits
+		value := shrunk[i].Value
+		lo, hi := 0, len(value)-1
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			shrunk[i].Value = truncateUTF8(value, mid)
+			if size(shrunk) <= limit {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		shrunk[i].Value = truncateUTF8(value, lo)
+	}
+
+	if n := size(shrunk); n > limit {
+		return nil, fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrResultsTooLarge, n, limit)
+	}
+	return shrunk, nil
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a rune
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
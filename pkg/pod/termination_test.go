@@ -0,0 +1,290 @@
+package pod
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestTerminationMessage_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "termination-log")
+
+	if err := WriteTerminationMessage(path, TerminationMessage{Reason: "ProviderError", Message: "overloaded"}); err != nil {
+		t.Fatalf("WriteTerminationMessage() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read termination log: %v", err)
+	}
+
+	p := &corev1.Pod{
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name: "agent",
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{Message: string(data)},
+					},
+				},
+			},
+		},
+	}
+
+	msg, ok := ReadTerminationMessage(p)
+	if !ok {
+		t.Fatal("ReadTerminationMessage() ok = false, want true")
+	}
+
+	if msg.Reason != "ProviderError" || msg.Message != "overloaded" {
+		t.Errorf("ReadTerminationMessage() = %+v, want ProviderError/overloaded", msg)
+	}
+}
+
+func TestReadTerminationMessage_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+	}{
+		{name: "empty", message: ""},
+		{name: "not json", message: "panic: something went wrong"},
+		{name: "missing reason", message: `{"message":"no reason"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &corev1.Pod{
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{
+						{
+							Name: "agent",
+							State: corev1.ContainerState{
+								Terminated: &corev1.ContainerStateTerminated{Message: tt.message},
+							},
+						},
+					},
+				},
+			}
+
+			if _, ok := ReadTerminationMessage(p); ok {
+				t.Error("ReadTerminationMessage() ok = true, want false")
+			}
+		})
+	}
+}
+
+func TestWriteTerminationMessage_Results(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "termination-log")
+
+	msg := TerminationMessage{
+		Reason: "Succeeded",
+		Results: []v1alpha1.AgentResult{
+			{Name: "iterations", Value: "3"},
+			{Name: "response", Value: strings.Repeat("a", terminationMessageLimit+100)},
+		},
+	}
+	if err := WriteTerminationMessage(path, msg); err != nil {
+		t.Fatalf("WriteTerminationMessage() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read termination log: %v", err)
+	}
+	if len(data) > 4096 {
+		t.Errorf("termination message is %d bytes, want at most 4096", len(data))
+	}
+
+	p := &corev1.Pod{
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name: "agent",
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{Message: string(data)},
+					},
+				},
+			},
+		},
+	}
+
+	got, ok := ReadTerminationMessage(p)
+	if !ok {
+		t.Fatal("ReadTerminationMessage() ok = false, want true")
+	}
+	if len(got.Results) != 2 {
+		t.Fatalf("Results = %+v, want 2 results", got.Results)
+	}
+	if got.Results[0].Value != "3" {
+		t.Errorf("iterations = %q, want 3", got.Results[0].Value)
+	}
+	if n := len(got.Results[1].Value); n == 0 || n >= terminationMessageLimit || len(data) < terminationMessageLimit-1 {
+		t.Errorf("response was cut to %d bytes in a %d byte message, want it to fill the message", n, len(data))
+	}
+
+	// The caller's results are not modified
+	if len(msg.Results[1].Value) != terminationMessageLimit+100 {
+		t.Error("WriteTerminationMessage() should not modify the caller's results")
+	}
+}
+
+func TestWriteTerminationMessage_EscapedResults(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "newlines", value: strings.Repeat("\n", 3000)},
+		{name: "quotes", value: strings.Repeat(`"`, 3000)},
+		{name: "control characters", value: strings.Repeat("\x01", 3000)},
+		{name: "html", value: strings.Repeat("<&>", 1000)},
+		{name: "multi-byte runes", value: strings.Repeat("é€😀", 500)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "termination-log")
+
+			msg := TerminationMessage{
+				Reason:  "Succeeded",
+				Message: strings.Repeat("\n", maxTerminationMessageLength),
+				Results: []v1alpha1.AgentResult{
+					{Name: "status", Value: "succeeded"},
+					{Name: "response", Value: tt.value},
+				},
+			}
+			if err := WriteTerminationMessage(path, msg); err != nil {
+				t.Fatalf("WriteTerminationMessage() error = %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read termination log: %v", err)
+			}
+			if len(data) > terminationMessageLimit {
+				t.Errorf("termination message is %d bytes, want at most %d", len(data), terminationMessageLimit)
+			}
+
+			var got TerminationMessage
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Failed to unmarshal termination message: %v", err)
+			}
+			if len(got.Results) != 2 || got.Results[0].Value != "succeeded" {
+				t.Fatalf("Results = %+v", got.Results)
+			}
+			response := got.Results[1].Value
+			if response == "" || !strings.HasPrefix(tt.value, response) || !utf8.ValidString(response) {
+				t.Errorf("response = %q, want a non-empty prefix of the value cut on a rune boundary", response)
+			}
+		})
+	}
+}
+
+func TestWriteTerminationMessage_DeclaredResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "termination-log")
+
+	// Only the response is shortened, wherever it is
+	msg := TerminationMessage{
+		Reason: "Succeeded",
+		Results: []v1alpha1.AgentResult{
+			{Name: "response", Value: strings.Repeat("a", terminationMessageLimit)},
+			{Name: "failed-tests", Value: "1234567890"},
+		},
+	}
+	if err := WriteTerminationMessage(path, msg); err != nil {
+		t.Fatalf("WriteTerminationMessage() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read termination log: %v", err)
+	}
+	var got TerminationMessage
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Failed to unmarshal termination message: %v", err)
+	}
+	if got.Results[1].Value != "1234567890" {
+		t.Errorf("failed-tests = %q, want it untouched", got.Results[1].Value)
+	}
+
+	// Declared results that do not fit without the response fail instead of being cut
+	results := []v1alpha1.AgentResult{
+		{Name: "root-cause", Value: strings.Repeat("a", terminationMessageLimit)},
+		{Name: "response", Value: "done"},
+	}
+	if err := CheckResults(results, nil); !errors.Is(err, ErrResultsTooLarge) {
+		t.Errorf("CheckResults() error = %v, want ErrResultsTooLarge", err)
+	}
+	err = WriteTerminationMessage(path, TerminationMessage{Reason: "Succeeded", Results: results})
+	if !errors.Is(err, ErrResultsTooLarge) {
+		t.Errorf("WriteTerminationMessage() error = %v, want ErrResultsTooLarge", err)
+	}
+}
+
+func TestWriteTerminationMessage_Plan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "termination-log")
+
+	plan := []v1alpha1.ProposedAction{
+		{ID: "toolu_1", Tool: "tekton_create_pipelinerun", Input: `{"name":"deploy-1","namespace":"prod"}`},
+	}
+	msg := TerminationMessage{
+		Reason: "Succeeded",
+		Results: []v1alpha1.AgentResult{
+			{Name: "response", Value: strings.Repeat("a", terminationMessageLimit)},
+		},
+		Plan: plan,
+	}
+	if err := WriteTerminationMessage(path, msg); err != nil {
+		t.Fatalf("WriteTerminationMessage() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read termination log: %v", err)
+	}
+	if len(data) > 4096 {
+		t.Errorf("termination message is %d bytes, want at most 4096", len(data))
+	}
+
+	p := &corev1.Pod{
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name: "agent",
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{Message: string(data)},
+					},
+				},
+			},
+		},
+	}
+
+	got, ok := ReadTerminationMessage(p)
+	if !ok {
+		t.Fatal("ReadTerminationMessage() ok = false, want true")
+	}
+	if len(got.Plan) != 1 || got.Plan[0] != plan[0] {
+		t.Errorf("Plan = %+v, want %+v", got.Plan, plan)
+	}
+}
+
+func TestWriteTerminationMessage_PlanTooLarge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "termination-log")
+
+	plan := []v1alpha1.ProposedAction{
+		{Tool: "tekton_create_pipelinerun", Input: strings.Repeat("a", maxPlanLength)},
+	}
+	if err := CheckPlan(plan); !errors.Is(err, ErrPlanTooLarge) {
+		t.Errorf("CheckPlan() error = %v, want ErrPlanTooLarge", err)
+	}
+
+	err := WriteTerminationMessage(path, TerminationMessage{Reason: "Succeeded", Plan: plan})
+	if !errors.Is(err, ErrPlanTooLarge) {
+		t.Errorf("WriteTerminationMessage() error = %v, want ErrPlanTooLarge", err)
+	}
+}
@@ -0,0 +1,79 @@
+package pod
+
+import (
+	"fmt"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// TranscriptKey is the ConfigMap key holding an agent's messages as JSON
+	TranscriptKey = "transcript.json"
+
+	// CheckpointKey is the ConfigMap key holding the checkpoint of a running agent as
+	// JSON. A restarted agent pod resumes from it; it is removed when the run finishes,
+	// but kept when the agent is stopped by a signal so that the next pod resumes.
+	CheckpointKey = "checkpoint.json"
+
+	// TranscriptMountPath is where the transcript of the AgentRun being continued is mounted
+	TranscriptMountPath = "/workspace/transcript"
+
+	// TranscriptComponent is the component label value of transcript ConfigMaps
+	TranscriptComponent = "agent-transcript"
+
+	// MaxTranscriptLength and MaxCheckpointLength share the 1MiB ConfigMap limit, since
+	// a retry checkpoints next to the transcript left by the attempt before it
+	MaxTranscriptLength = 450 * 1024
+	MaxCheckpointLength = 450 * 1024
+)
+
+// TranscriptName returns the name of the ConfigMap holding the transcript of an AgentRun
+func TranscriptName(agentRunName string) string {
+	return fmt.Sprintf("%s-transcript", agentRunName)
+}
+
+// BuildTranscript returns the empty transcript ConfigMap of an AgentRun. The agent
+// writes its messages to it when it exits so a later AgentRun can continue from them.
+func BuildTranscript(agentRun *v1alpha1.AgentRun) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      TranscriptName(agentRun.Name),
+			Namespace: agentRun.Namespace,
+			Labels: map[string]string{
+				AgentRunLabelKey:               agentRun.Name,
+				ComponentLabelKey:              TranscriptComponent,
+				"app.kubernetes.io/managed-by": "agentrun-controller",
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(agentRun, v1alpha1.SchemeGroupVersion.WithKind("AgentRun")),
+			},
+		},
+	}
+}
+
+// addTranscriptVolume mounts the transcript of the AgentRun being continued
+func addTranscriptVolume(pod *corev1.Pod, agentRunName string) {
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: "transcript",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: TranscriptName(agentRunName),
+				},
+			},
+		},
+	})
+
+	container := &pod.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "transcript",
+		MountPath: TranscriptMountPath,
+		ReadOnly:  true,
+	})
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name:  "AGENT_PREVIOUS_TRANSCRIPT",
+		Value: TranscriptMountPath + "/" + TranscriptKey,
+	})
+}
@@ -17,6 +17,13 @@ const (
 	anthropicAPIVersion = "2023-06-01"
 )
 
+// Prices are the list prices of Claude models. An AgentConfig budget can override them.
+var Prices = map[string]agent.ModelPrice{
+	"claude-3-5-sonnet-20241022": {InputPerMillion: 3, OutputPerMillion: 15},
+	"claude-3-5-haiku-20241022":  {InputPerMillion: 0.8, OutputPerMillion: 4},
+	"claude-3-opus-20240229":     {InputPerMillion: 15, OutputPerMillion: 75},
+}
+
 // Client implements the agent.Provider interface for Claude
 type Client struct {
 	APIKey      string
@@ -0,0 +1,54 @@
+package agentapproval
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Reconciler reconciles AgentApproval objects
+type Reconciler struct {
+	AgentRuns *client.AgentRuns
+
+	// Now returns the current time; defaults to time.Now
+	Now func() time.Time
+}
+
+// Reconcile marks new AgentApprovals as Pending, records when a decision was made,
+// and rejects approvals whose AgentRun finished before anyone decided
+func (r *Reconciler) Reconcile(ctx context.Context, approval *v1alpha1.AgentApproval) error {
+	if approval.IsDecided() {
+		if approval.Status.DecisionTime == nil {
+			now := metav1.NewTime(r.now())
+			approval.Status.DecisionTime = &now
+		}
+		return nil
+	}
+
+	agentRun, err := r.AgentRuns.Get(ctx, approval.Namespace, approval.Spec.AgentRun)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get AgentRun: %w", err)
+	}
+	if err == nil && agentRun.IsDone() {
+		now := metav1.NewTime(r.now())
+		approval.Status.Decision = v1alpha1.ApprovalRejected
+		approval.Status.Message = fmt.Sprintf("AgentRun %s finished before a decision was made", agentRun.Name)
+		approval.Status.DecisionTime = &now
+		return nil
+	}
+
+	approval.Status.Decision = v1alpha1.ApprovalPending
+	return nil
+}
+
+func (r *Reconciler) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
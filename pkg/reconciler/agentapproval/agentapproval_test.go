@@ -0,0 +1,128 @@
+package agentapproval
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newApproval(decision v1alpha1.ApprovalDecision) *v1alpha1.AgentApproval {
+	return &v1alpha1.AgentApproval{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "deploy-1a2b3c4d",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.AgentApprovalSpec{
+			AgentRun: "deploy",
+			ToolName: "tekton_create_pipelinerun",
+		},
+		Status: v1alpha1.AgentApprovalStatus{
+			Decision: decision,
+		},
+	}
+}
+
+func newAgentRun(phase string) *v1alpha1.AgentRun {
+	return &v1alpha1.AgentRun{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       "AgentRun",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "deploy",
+			Namespace: "default",
+		},
+		Status: v1alpha1.AgentRunStatus{
+			Phase: phase,
+		},
+	}
+}
+
+func newReconciler(t *testing.T, now time.Time, agentRuns ...*v1alpha1.AgentRun) *Reconciler {
+	t.Helper()
+	// The fake dynamic client only round-trips unstructured objects when the
+	// scheme does not know the typed kinds
+	objs := make([]runtime.Object, 0, len(agentRuns))
+	for _, ar := range agentRuns {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(ar)
+		if err != nil {
+			t.Fatalf("Failed to convert AgentRun: %v", err)
+		}
+		objs = append(objs, &unstructured.Unstructured{Object: obj})
+	}
+	return &Reconciler{
+		AgentRuns: &client.AgentRuns{
+			Dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), client.ListKinds, objs...),
+		},
+		Now: func() time.Time { return now },
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		approval         *v1alpha1.AgentApproval
+		agentRun         *v1alpha1.AgentRun
+		wantDecision     v1alpha1.ApprovalDecision
+		wantDecisionTime bool
+	}{
+		{
+			name:         "new approval is pending",
+			approval:     newApproval(""),
+			agentRun:     newAgentRun(v1alpha1.AgentRunPhaseAwaitingApproval),
+			wantDecision: v1alpha1.ApprovalPending,
+		},
+		{
+			name:             "decision time is recorded",
+			approval:         newApproval(v1alpha1.ApprovalApproved),
+			agentRun:         newAgentRun(v1alpha1.AgentRunPhaseAwaitingApproval),
+			wantDecision:     v1alpha1.ApprovalApproved,
+			wantDecisionTime: true,
+		},
+		{
+			name:             "finished run rejects pending approval",
+			approval:         newApproval(v1alpha1.ApprovalPending),
+			agentRun:         newAgentRun(v1alpha1.AgentRunPhaseFailed),
+			wantDecision:     v1alpha1.ApprovalRejected,
+			wantDecisionTime: true,
+		},
+		{
+			name:         "missing run leaves approval pending",
+			approval:     newApproval(v1alpha1.ApprovalPending),
+			wantDecision: v1alpha1.ApprovalPending,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r *Reconciler
+			if tt.agentRun != nil {
+				r = newReconciler(t, now, tt.agentRun)
+			} else {
+				r = newReconciler(t, now)
+			}
+
+			if err := r.Reconcile(context.Background(), tt.approval); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if tt.approval.Status.Decision != tt.wantDecision {
+				t.Errorf("Decision = %q, want %q", tt.approval.Status.Decision, tt.wantDecision)
+			}
+			if got := tt.approval.Status.DecisionTime != nil; got != tt.wantDecisionTime {
+				t.Errorf("DecisionTime set = %v, want %v", got, tt.wantDecisionTime)
+			}
+			if tt.wantDecisionTime && !tt.approval.Status.DecisionTime.Time.Equal(now) {
+				t.Errorf("DecisionTime = %v, want %v", tt.approval.Status.DecisionTime, now)
+			}
+		})
+	}
+}
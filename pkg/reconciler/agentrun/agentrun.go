@@ -3,21 +3,57 @@ package agentrun
 import (
 	"context"
 	"fmt"
+	"slices"
+	"time"
 
+	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
 	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
 	"github.com/waveywaves/agentrun-controller/pkg/pod"
 	"github.com/waveywaves/agentrun-controller/pkg/security"
+	"github.com/waveywaves/agentrun-controller/pkg/tools/tekton"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	// retryBaseBackoff is the delay before the first retry; it doubles for each further attempt
+	retryBaseBackoff = 10 * time.Second
+	// retryMaxBackoff caps the delay between attempts
+	retryMaxBackoff = 5 * time.Minute
+)
+
+// retryableReasons are the failure reasons for which a new attempt is started
+var retryableReasons = map[string]bool{
+	v1alpha1.AgentRunReasonProviderError: true,
+	v1alpha1.AgentRunReasonTimeout:       true,
+}
+
+// podEvictedReason is the status reason of a pod evicted by the kubelet
+const podEvictedReason = "Evicted"
+
+// agentPodGracePeriodSeconds gives the agent time to flush a partial result on cancellation
+const agentPodGracePeriodSeconds = int64(30)
+
 // Reconciler reconciles AgentRun objects
 type Reconciler struct {
 	KubeClient   kubernetes.Interface
+	TektonClient tektonclient.Interface
 	Image        string
 	AgentConfigs map[string]*v1alpha1.AgentConfig
+
+	// AgentRuns is a snapshot of all AgentRuns, used to admit queued runs in creation order
+	AgentRuns []*v1alpha1.AgentRun
+
+	// AgentApprovals is a snapshot of all AgentApprovals, used to report runs awaiting approval
+	AgentApprovals []*v1alpha1.AgentApproval
+
+	// MaxConcurrentRunsPerNamespace limits active AgentRuns in namespaces without the
+	// MaxConcurrentRunsAnnotationKey annotation (0 means unlimited)
+	MaxConcurrentRunsPerNamespace int32
 }
 
 // Reconcile handles the reconciliation of an AgentRun
@@ -27,23 +63,28 @@ func (r *Reconciler) Reconcile(ctx context.Context, agentRun *v1alpha1.AgentRun)
 		return nil
 	}
 
+	// Handle cancellation before anything else
+	if agentRun.IsCancelled() {
+		return r.handleCancelled(ctx, agentRun)
+	}
+
+	// Without a webhook an invalid spec is only caught here, e.g. an execute-mode run without a plan
+	if err := agentRun.Spec.Validate(ctx); err != nil {
+		agentRun.Status.MarkFailed(v1alpha1.AgentRunReasonInvalidSpec, err.Error())
+		return nil
+	}
+
 	// Get AgentConfig
 	agentConfig, err := r.getAgentConfig(agentRun)
 	if err != nil {
 		return fmt.Errorf("failed to get AgentConfig: %w", err)
 	}
 
-	// Initialize start time if not set
-	if !agentRun.HasStarted() {
-		now := metav1.Now()
-		agentRun.Status.StartTime = &now
-	}
-
 	// Handle based on current phase
 	switch agentRun.Status.Phase {
-	case v1alpha1.AgentRunPhasePending:
+	case v1alpha1.AgentRunPhasePending, v1alpha1.AgentRunPhaseQueued:
 		return r.handlePending(ctx, agentRun, agentConfig)
-	case v1alpha1.AgentRunPhaseActing:
+	case v1alpha1.AgentRunPhaseActing, v1alpha1.AgentRunPhaseAwaitingApproval:
 		return r.handleActing(ctx, agentRun)
 	default:
 		// Unknown phase, set to Pending
@@ -53,29 +94,92 @@ func (r *Reconciler) Reconcile(ctx context.Context, agentRun *v1alpha1.AgentRun)
 }
 
 func (r *Reconciler) handlePending(ctx context.Context, agentRun *v1alpha1.AgentRun, agentConfig *v1alpha1.AgentConfig) error {
+	// Wait out the backoff before starting a retry attempt
+	if time.Now().Before(nextAttemptTime(agentRun)) {
+		return nil
+	}
+
+	// Execute-mode runs perform the actions of a reviewed plan
+	if agentRun.Spec.Mode == v1alpha1.AgentRunModeExecute && len(agentRun.Status.Plan) == 0 {
+		if done := r.resolvePlan(agentRun); done {
+			return nil
+		}
+	}
+
+	// Child AgentRuns must stay within the delegation limits of their parent before they first start
+	if !agentRun.HasStarted() {
+		message, err := r.checkDelegation(ctx, agentRun)
+		if err != nil {
+			return fmt.Errorf("failed to check delegation: %w", err)
+		}
+		if message != "" {
+			agentRun.Status.MarkFailed(v1alpha1.AgentRunReasonDelegationNotAllowed, message)
+			return nil
+		}
+	}
+
+	// Params must match the declarations of the AgentConfig before the goal can be rendered
+	if _, err := agentRun.ResolveGoal(agentConfig); err != nil {
+		agentRun.Status.MarkFailed(v1alpha1.AgentRunReasonInvalidParams, err.Error())
+		return nil
+	}
+
+	// Continuations resume the transcript of a finished AgentRun
+	if agentRun.Spec.ContinueFrom != nil {
+		done, err := r.resolveContinuation(ctx, agentRun)
+		if err != nil {
+			return fmt.Errorf("failed to resolve continuation: %w", err)
+		}
+		if done {
+			return nil
+		}
+	}
+
+	// Hold the run in the queue until a concurrency slot is free
+	admitted, message, err := r.admit(ctx, agentRun, agentConfig)
+	if err != nil {
+		return fmt.Errorf("failed to check concurrency limits: %w", err)
+	}
+	if !admitted {
+		agentRun.Status.MarkQueued(message)
+		return nil
+	}
+
+	// Initialize start time if not set
+	if !agentRun.HasStarted() {
+		now := metav1.Now()
+		agentRun.Status.StartTime = &now
+	}
+
 	// Create RBAC for agent pod
 	if err := r.createRBAC(ctx, agentRun, agentConfig); err != nil {
 		return fmt.Errorf("failed to create RBAC: %w", err)
 	}
 
+	// Create the ConfigMap the agent saves its transcript to
+	if err := r.createTranscript(ctx, agentRun); err != nil {
+		return fmt.Errorf("failed to create transcript: %w", err)
+	}
+
 	// Create agent pod
 	if err := r.createAgentPod(ctx, agentRun, agentConfig); err != nil {
 		return fmt.Errorf("failed to create agent pod: %w", err)
 	}
 
 	// Update phase to Acting
-	agentRun.Status.Phase = v1alpha1.AgentRunPhaseActing
+	agentRun.Status.MarkRunning(fmt.Sprintf("Agent pod %s created", pod.PodName(agentRun)))
 
 	return nil
 }
 
 func (r *Reconciler) handleActing(ctx context.Context, agentRun *v1alpha1.AgentRun) error {
-	// Get agent pod
-	podName := fmt.Sprintf("%s-agent", agentRun.Name)
+	// Get agent pod for the current attempt
+	podName := pod.PodName(agentRun)
 	agentPod, err := r.KubeClient.CoreV1().Pods(agentRun.Namespace).Get(ctx, podName, metav1.GetOptions{})
 	if err != nil {
 		if errors.IsNotFound(err) {
-			// Pod doesn't exist, go back to Pending
+			// Pod doesn't exist, go back to Pending. The new pod resumes from the
+			// agent's last checkpoint.
 			agentRun.Status.Phase = v1alpha1.AgentRunPhasePending
 			return nil
 		}
@@ -85,28 +189,292 @@ func (r *Reconciler) handleActing(ctx context.Context, agentRun *v1alpha1.AgentR
 	// Check pod status
 	switch agentPod.Status.Phase {
 	case corev1.PodSucceeded:
-		// Agent completed successfully
-		agentRun.Status.Phase = v1alpha1.AgentRunPhaseSucceeded
-		now := metav1.Now()
-		agentRun.Status.CompletionTime = &now
+		// Agent completed successfully, record the results it reported
+		if tm, ok := pod.ReadTerminationMessage(agentPod); ok {
+			agentRun.Status.Iterations = int32(tm.Iterations)
+			agentRun.Status.Results = tm.Results
+			if agentRun.Spec.Mode == v1alpha1.AgentRunModePlan {
+				agentRun.Status.Plan = tm.Plan
+			}
+		}
+		agentRun.Status.MarkSucceeded(v1alpha1.AgentRunReasonSucceeded, "Agent pod completed successfully")
 		return nil
 
 	case corev1.PodFailed:
-		// Agent failed
-		agentRun.Status.Phase = v1alpha1.AgentRunPhaseFailed
-		now := metav1.Now()
-		agentRun.Status.CompletionTime = &now
+		// An evicted pod did not fail the run; it is replaced by one that resumes
+		// from the agent's last checkpoint
+		if agentPod.Status.Reason == podEvictedReason {
+			err := r.KubeClient.CoreV1().Pods(agentRun.Namespace).Delete(ctx, podName, metav1.DeleteOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete evicted agent pod: %w", err)
+			}
+			agentRun.Status.Phase = v1alpha1.AgentRunPhasePending
+			return nil
+		}
+
+		// Agent failed, use the reason it reported if any
+		reason, message := v1alpha1.AgentRunReasonFailed, "Agent pod failed"
+		if tm, ok := pod.ReadTerminationMessage(agentPod); ok {
+			reason, message = tm.Reason, tm.Message
+			agentRun.Status.Iterations = int32(tm.Iterations)
+		}
+
+		if retryableReasons[reason] && agentRun.Attempt() < agentRun.Spec.Retries {
+			now := metav1.Now()
+			agentRun.Status.MarkRetrying(v1alpha1.AgentRunAttemptStatus{
+				Attempt:        agentRun.Attempt(),
+				PodName:        podName,
+				Reason:         reason,
+				Message:        message,
+				StartTime:      agentPod.Status.StartTime,
+				CompletionTime: &now,
+			})
+			return nil
+		}
+
+		agentRun.Status.MarkFailed(reason, message)
 		return nil
 
 	default:
-		// Still running, nothing to do
+		// Still running; report whether the agent is waiting for a human decision
+		if approval := r.pendingApproval(agentRun); approval != nil {
+			agentRun.Status.MarkAwaitingApproval(fmt.Sprintf("Tool %s is waiting for approval (AgentApproval %s)", approval.Spec.ToolName, approval.Name))
+		} else if agentRun.Status.Phase == v1alpha1.AgentRunPhaseAwaitingApproval {
+			agentRun.Status.MarkRunning(fmt.Sprintf("Agent pod %s running", podName))
+		}
 		return nil
 	}
 }
 
+// resolvePlan copies the plan referenced by an execute-mode AgentRun into its status.
+// It returns true if the AgentRun cannot start yet, or is finished because the plan
+// cannot or need not be executed.
+func (r *Reconciler) resolvePlan(agentRun *v1alpha1.AgentRun) bool {
+	var planRun *v1alpha1.AgentRun
+	for _, ar := range r.AgentRuns {
+		if ar.Namespace == agentRun.Namespace && ar.Name == agentRun.Spec.PlanRef.Name {
+			planRun = ar
+			break
+		}
+	}
+
+	switch {
+	case planRun == nil:
+		agentRun.Status.MarkFailed(v1alpha1.AgentRunReasonInvalidPlan, fmt.Sprintf("Plan AgentRun %s not found", agentRun.Spec.PlanRef.Name))
+		return true
+	case planRun.Spec.Mode != v1alpha1.AgentRunModePlan:
+		agentRun.Status.MarkFailed(v1alpha1.AgentRunReasonInvalidPlan, fmt.Sprintf("AgentRun %s is not a plan-mode AgentRun", planRun.Name))
+		return true
+	case !planRun.IsDone():
+		agentRun.Status.MarkWaitingForRun(fmt.Sprintf("Waiting for plan AgentRun %s to finish", planRun.Name))
+		return true
+	case planRun.Status.Phase != v1alpha1.AgentRunPhaseSucceeded:
+		agentRun.Status.MarkFailed(v1alpha1.AgentRunReasonInvalidPlan, fmt.Sprintf("Plan AgentRun %s did not succeed", planRun.Name))
+		return true
+	case len(planRun.Status.Plan) == 0:
+		agentRun.Status.MarkSucceeded(v1alpha1.AgentRunReasonSucceeded, fmt.Sprintf("Plan AgentRun %s proposed no actions", planRun.Name))
+		return true
+	}
+
+	agentRun.Status.Plan = append([]v1alpha1.ProposedAction(nil), planRun.Status.Plan...)
+	return false
+}
+
+// resolveContinuation checks that the AgentRun referenced by ContinueFrom has a transcript to resume.
+// It returns true if the AgentRun cannot start yet, or has failed because there is nothing to continue.
+func (r *Reconciler) resolveContinuation(ctx context.Context, agentRun *v1alpha1.AgentRun) (bool, error) {
+	name := agentRun.Spec.ContinueFrom.Name
+	var previous *v1alpha1.AgentRun
+	for _, ar := range r.AgentRuns {
+		if ar.Namespace == agentRun.Namespace && ar.Name == name {
+			previous = ar
+			break
+		}
+	}
+
+	switch {
+	case previous == nil:
+		agentRun.Status.MarkFailed(v1alpha1.AgentRunReasonInvalidContinuation, fmt.Sprintf("AgentRun %s not found", name))
+		return true, nil
+	case previous.UID == agentRun.UID:
+		agentRun.Status.MarkFailed(v1alpha1.AgentRunReasonInvalidContinuation, "An AgentRun cannot continue from itself")
+		return true, nil
+	case !previous.IsDone():
+		agentRun.Status.MarkWaitingForRun(fmt.Sprintf("Waiting for AgentRun %s to finish", name))
+		return true, nil
+	}
+
+	transcript, err := r.KubeClient.CoreV1().ConfigMaps(agentRun.Namespace).Get(ctx, pod.TranscriptName(name), metav1.GetOptions{})
+	if errors.IsNotFound(err) || (err == nil && transcript.Data[pod.TranscriptKey] == "") {
+		agentRun.Status.MarkFailed(v1alpha1.AgentRunReasonInvalidContinuation, fmt.Sprintf("AgentRun %s has no transcript to continue", name))
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get transcript of AgentRun %s: %w", name, err)
+	}
+	return false, nil
+}
+
+// checkDelegation returns why a child AgentRun may not run, or "" if it may. Children
+// are AgentRuns labelled with and owned by their parent, and created by one of its
+// agent pods; other AgentRuns are not checked.
+func (r *Reconciler) checkDelegation(ctx context.Context, agentRun *v1alpha1.AgentRun) (string, error) {
+	parentName := pod.ParentAgentRunName(agentRun)
+	if parentName == "" {
+		return "", nil
+	}
+
+	var parent *v1alpha1.AgentRun
+	for _, ar := range r.AgentRuns {
+		if ar.Namespace == agentRun.Namespace && ar.Name == parentName && isOwnedBy(agentRun, ar) {
+			parent = ar
+			break
+		}
+	}
+	if parent == nil {
+		return fmt.Sprintf("Parent AgentRun %s not found", parentName), nil
+	}
+	if agentRun.Labels[pod.ParentAgentRunLabelKey] != parent.Name {
+		return fmt.Sprintf("AgentRun owned by AgentRun %s must be labelled %s=%s", parent.Name, pod.ParentAgentRunLabelKey, parent.Name), nil
+	}
+
+	parentConfig := r.AgentConfigs[parent.Spec.ConfigRef.Name]
+	if parentConfig == nil || parentConfig.Spec.Delegation == nil {
+		return fmt.Sprintf("AgentConfig %s of parent AgentRun %s does not allow delegation", parent.Spec.ConfigRef.Name, parent.Name), nil
+	}
+	delegation := parentConfig.Spec.Delegation
+
+	// Agents of other AgentRuns share the ServiceAccount, so the child must come from a pod of the parent
+	createdByParent, err := r.isParentPod(ctx, parent, agentRun.Labels[pod.ParentPodUIDLabelKey])
+	if err != nil {
+		return "", err
+	}
+	if !createdByParent {
+		return fmt.Sprintf("AgentRun must be created by an agent pod of AgentRun %s, named by its %s label", parent.Name, pod.ParentPodUIDLabelKey), nil
+	}
+
+	if !slices.Contains(delegation.AllowedConfigs, agentRun.Spec.ConfigRef.Name) {
+		return fmt.Sprintf("AgentConfig %s is not allowed for AgentRuns delegated by %s", agentRun.Spec.ConfigRef.Name, parent.Name), nil
+	}
+
+	depth := pod.DelegationDepth(parent) + 1
+	if pod.DelegationDepth(agentRun) != depth {
+		return fmt.Sprintf("Delegation depth label must be %d", depth), nil
+	}
+	if depth > int(delegation.GetMaxDepth()) {
+		return fmt.Sprintf("Delegation depth %d exceeds the limit of %d", depth, delegation.GetMaxDepth()), nil
+	}
+
+	// Only the parent's first MaxChildren children, in creation order, may run
+	earlier := 0
+	for _, ar := range r.AgentRuns {
+		if ar.Namespace != agentRun.Namespace || ar.UID == agentRun.UID || !isOwnedBy(ar, parent) {
+			continue
+		}
+		if pod.ParentAgentRunName(ar) == parent.Name && createdBefore(ar, agentRun) {
+			earlier++
+		}
+	}
+	if earlier >= int(delegation.GetMaxChildren()) {
+		return fmt.Sprintf("AgentRun %s may delegate to at most %d child AgentRuns", parent.Name, delegation.GetMaxChildren()), nil
+	}
+
+	return "", nil
+}
+
+// isParentPod returns true if uid is the UID of an agent pod of the parent AgentRun
+func (r *Reconciler) isParentPod(ctx context.Context, parent *v1alpha1.AgentRun, uid string) (bool, error) {
+	if uid == "" {
+		return false, nil
+	}
+	pods, err := r.KubeClient.CoreV1().Pods(parent.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", pod.AgentRunLabelKey, parent.Name),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list agent pods of AgentRun %s: %w", parent.Name, err)
+	}
+	for i := range pods.Items {
+		if string(pods.Items[i].UID) == uid && isOwnedBy(&pods.Items[i], parent) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// pendingApproval returns the AgentApproval the AgentRun is waiting on, if any
+func (r *Reconciler) pendingApproval(agentRun *v1alpha1.AgentRun) *v1alpha1.AgentApproval {
+	for _, approval := range r.AgentApprovals {
+		if approval.IsPendingFor(agentRun) {
+			return approval
+		}
+	}
+	return nil
+}
+
+func (r *Reconciler) handleCancelled(ctx context.Context, agentRun *v1alpha1.AgentRun) error {
+	// Delete the agent pod; the kubelet sends SIGTERM so the agent can flush a partial result
+	podName := pod.PodName(agentRun)
+	gracePeriod := agentPodGracePeriodSeconds
+	err := r.KubeClient.CoreV1().Pods(agentRun.Namespace).Delete(ctx, podName, metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete agent pod: %w", err)
+	}
+
+	// Optionally cancel PipelineRuns the agent created
+	if agentRun.Spec.CancelPipelineRuns {
+		if err := r.cancelPipelineRuns(ctx, agentRun); err != nil {
+			return fmt.Errorf("failed to cancel PipelineRuns: %w", err)
+		}
+	}
+
+	agentRun.Status.MarkFailed(v1alpha1.AgentRunReasonCancelled, "AgentRun was cancelled")
+	return nil
+}
+
+func (r *Reconciler) cancelPipelineRuns(ctx context.Context, agentRun *v1alpha1.AgentRun) error {
+	if r.TektonClient == nil {
+		return fmt.Errorf("tekton client is not configured")
+	}
+
+	prs, err := r.TektonClient.TektonV1().PipelineRuns(agentRun.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", tekton.AgentRunLabelKey, agentRun.Name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list PipelineRuns: %w", err)
+	}
+
+	patch := []byte(fmt.Sprintf(`{"spec":{"status":%q}}`, tektonv1.PipelineRunSpecStatusCancelled))
+	for _, pr := range prs.Items {
+		// Only touch PipelineRuns owned by this AgentRun that are still running
+		if !isOwnedBy(&pr, agentRun) {
+			continue
+		}
+		if pr.IsDone() || pr.IsCancelled() {
+			continue
+		}
+
+		_, err := r.TektonClient.TektonV1().PipelineRuns(pr.Namespace).Patch(ctx, pr.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to cancel PipelineRun %s: %w", pr.Name, err)
+		}
+	}
+
+	return nil
+}
+
 func (r *Reconciler) createRBAC(ctx context.Context, agentRun *v1alpha1.AgentRun, agentConfig *v1alpha1.AgentConfig) error {
-	// Generate Role
+	// Generate Role; the agent may also need to request approval of tool calls, save its
+	// transcript and delegate to child AgentRuns
 	role := security.GenerateRole(agentRun)
+	role.Rules = append(role.Rules,
+		security.GenerateApprovalRule(),
+		security.GenerateTranscriptRule(pod.TranscriptName(agentRun.Name)),
+	)
+	if agentConfig.Spec.Delegation != nil {
+		role.Rules = append(role.Rules, security.GenerateDelegationRule(), security.GenerateDelegatorRule())
+	}
 
 	// Create Role
 	_, err := r.KubeClient.RbacV1().Roles(agentRun.Namespace).Create(ctx, role, metav1.CreateOptions{})
@@ -126,6 +494,14 @@ func (r *Reconciler) createRBAC(ctx context.Context, agentRun *v1alpha1.AgentRun
 	return nil
 }
 
+func (r *Reconciler) createTranscript(ctx context.Context, agentRun *v1alpha1.AgentRun) error {
+	_, err := r.KubeClient.CoreV1().ConfigMaps(agentRun.Namespace).Create(ctx, pod.BuildTranscript(agentRun), metav1.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create transcript ConfigMap: %w", err)
+	}
+	return nil
+}
+
 func (r *Reconciler) createAgentPod(ctx context.Context, agentRun *v1alpha1.AgentRun, agentConfig *v1alpha1.AgentConfig) error {
 	// Build pod spec
 	builder := &pod.Builder{
@@ -155,3 +531,35 @@ func (r *Reconciler) getAgentConfig(agentRun *v1alpha1.AgentRun) (*v1alpha1.Agen
 	}
 	return config, nil
 }
+
+// nextAttemptTime returns the earliest time the next attempt may start
+func nextAttemptTime(agentRun *v1alpha1.AgentRun) time.Time {
+	retries := agentRun.Status.RetriesStatus
+	if len(retries) == 0 || retries[len(retries)-1].CompletionTime == nil {
+		return time.Time{}
+	}
+	last := retries[len(retries)-1].CompletionTime.Time
+	return last.Add(retryBackoff(len(retries)))
+}
+
+// retryBackoff returns the exponential backoff before the given retry (1-based)
+func retryBackoff(retry int) time.Duration {
+	backoff := retryBaseBackoff
+	for i := 1; i < retry && backoff < retryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > retryMaxBackoff {
+		backoff = retryMaxBackoff
+	}
+	return backoff
+}
+
+// isOwnedBy returns true if obj has an owner reference pointing at the AgentRun
+func isOwnedBy(obj metav1.Object, agentRun *v1alpha1.AgentRun) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == agentRun.UID {
+			return true
+		}
+	}
+	return false
+}
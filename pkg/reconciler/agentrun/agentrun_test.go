@@ -2,11 +2,21 @@ package agentrun
 
 import (
 	"context"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
 	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/pod"
+	"github.com/waveywaves/agentrun-controller/pkg/tools/tekton"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
@@ -48,6 +58,64 @@ func TestReconcile_NewAgentRun(t *testing.T) {
 			wantPhase:    v1alpha1.AgentRunPhaseActing,
 			wantPodCount: 1,
 		},
+		{
+			name: "params render the goal template",
+			agentRun: &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-run",
+					Namespace: "default",
+					UID:       "test-uid",
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Params:    map[string]string{"pipeline": "build"},
+				},
+				Status: v1alpha1.AgentRunStatus{
+					Phase: v1alpha1.AgentRunPhasePending,
+				},
+			},
+			agentConfig: &v1alpha1.AgentConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-config",
+				},
+				Spec: v1alpha1.AgentConfigSpec{
+					ConfigPVC:    "test-config-pvc",
+					Params:       []v1alpha1.ParamSpec{{Name: "pipeline", Type: v1alpha1.ParamTypeString}},
+					GoalTemplate: "Run the $(params.pipeline) Pipeline",
+				},
+			},
+			wantPhase:    v1alpha1.AgentRunPhaseActing,
+			wantPodCount: 1,
+		},
+		{
+			name: "invalid params fail the run",
+			agentRun: &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-run",
+					Namespace: "default",
+					UID:       "test-uid",
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Params:    map[string]string{"replicas": "two"},
+				},
+				Status: v1alpha1.AgentRunStatus{
+					Phase: v1alpha1.AgentRunPhasePending,
+				},
+			},
+			agentConfig: &v1alpha1.AgentConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-config",
+				},
+				Spec: v1alpha1.AgentConfigSpec{
+					ConfigPVC:    "test-config-pvc",
+					Params:       []v1alpha1.ParamSpec{{Name: "replicas", Type: v1alpha1.ParamTypeInteger}},
+					GoalTemplate: "Scale to $(params.replicas) replicas",
+				},
+			},
+			wantPhase:    v1alpha1.AgentRunPhaseFailed,
+			wantPodCount: 0,
+		},
 	}
 
 	for _, tt := range tests {
@@ -62,7 +130,7 @@ func TestReconcile_NewAgentRun(t *testing.T) {
 			}
 
 			// Store the agentConfig in a map (simulating a cache)
-			r.agentConfigs = map[string]*v1alpha1.AgentConfig{
+			r.AgentConfigs = map[string]*v1alpha1.AgentConfig{
 				tt.agentConfig.Name: tt.agentConfig,
 			}
 
@@ -113,7 +181,7 @@ func TestReconcile_AlreadyDone(t *testing.T) {
 	r := &Reconciler{
 		KubeClient: kubeClient,
 		Image:      "agentrun-runtime:test",
-		agentConfigs: map[string]*v1alpha1.AgentConfig{
+		AgentConfigs: map[string]*v1alpha1.AgentConfig{
 			"test-config": {
 				ObjectMeta: metav1.ObjectMeta{
 					Name: "test-config",
@@ -185,7 +253,7 @@ func TestReconcile_UpdateStatusFromPod(t *testing.T) {
 	r := &Reconciler{
 		KubeClient: kubeClient,
 		Image:      "agentrun-runtime:test",
-		agentConfigs: map[string]*v1alpha1.AgentConfig{
+		AgentConfigs: map[string]*v1alpha1.AgentConfig{
 			"test-config": {
 				ObjectMeta: metav1.ObjectMeta{
 					Name: "test-config",
@@ -216,3 +284,1066 @@ func TestReconcile_UpdateStatusFromPod(t *testing.T) {
 		t.Error("CompletionTime should be set")
 	}
 }
+
+func TestReconcile_Results(t *testing.T) {
+	agentRun := &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-run",
+			Namespace: "default",
+			UID:       "test-uid",
+		},
+		Spec: v1alpha1.AgentRunSpec{
+			ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+			Goal:      "Test goal",
+		},
+		Status: v1alpha1.AgentRunStatus{
+			Phase: v1alpha1.AgentRunPhaseActing,
+		},
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-run-agent",
+			Namespace: "default",
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodSucceeded,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name: "agent",
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{
+							Message: `{"reason":"Succeeded","iterations":2,"results":[{"name":"iterations","value":"2"},{"name":"response","value":"Created PipelineRun myapp-build-v1"}]}`,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	r := &Reconciler{
+		KubeClient: fake.NewSimpleClientset(pod),
+		Image:      "agentrun-runtime:test",
+		AgentConfigs: map[string]*v1alpha1.AgentConfig{
+			"test-config": {
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-config",
+				},
+				Spec: v1alpha1.AgentConfigSpec{
+					ServiceAccount: "default",
+					ConfigPVC:      "test-config-pvc",
+					Provider:       "claude",
+				},
+			},
+		},
+	}
+
+	if err := r.Reconcile(context.Background(), agentRun); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if agentRun.Status.Phase != v1alpha1.AgentRunPhaseSucceeded {
+		t.Errorf("Phase = %v, want Succeeded", agentRun.Status.Phase)
+	}
+	if agentRun.Status.Iterations != 2 {
+		t.Errorf("Iterations = %d, want 2", agentRun.Status.Iterations)
+	}
+
+	want := []v1alpha1.AgentResult{
+		{Name: "iterations", Value: "2"},
+		{Name: "response", Value: "Created PipelineRun myapp-build-v1"},
+	}
+	if !reflect.DeepEqual(agentRun.Status.Results, want) {
+		t.Errorf("Results = %+v, want %+v", agentRun.Status.Results, want)
+	}
+}
+
+func TestReconcile_Cancelled(t *testing.T) {
+	agentRun := &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-run",
+			Namespace: "default",
+			UID:       "test-uid",
+		},
+		Spec: v1alpha1.AgentRunSpec{
+			ConfigRef:          v1alpha1.ConfigRef{Name: "test-config"},
+			Goal:               "Test goal",
+			Status:             v1alpha1.AgentRunSpecStatusCancelled,
+			CancelPipelineRuns: true,
+		},
+		Status: v1alpha1.AgentRunStatus{
+			Phase: v1alpha1.AgentRunPhaseActing,
+		},
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-run-agent",
+			Namespace: "default",
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+
+	ownedPR := &tektonv1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "owned-run",
+			Namespace: "default",
+			Labels:    map[string]string{tekton.AgentRunLabelKey: "test-run"},
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "agent.tekton.dev/v1alpha1", Kind: "AgentRun", Name: "test-run", UID: "test-uid"},
+			},
+		},
+	}
+
+	// Same label but owned by a previous AgentRun with the same name
+	staleOwnedPR := &tektonv1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "stale-run",
+			Namespace: "default",
+			Labels:    map[string]string{tekton.AgentRunLabelKey: "test-run"},
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "agent.tekton.dev/v1alpha1", Kind: "AgentRun", Name: "test-run", UID: "old-uid"},
+			},
+		},
+	}
+
+	kubeClient := fake.NewSimpleClientset(pod)
+	tektonClient := tektonfake.NewSimpleClientset(ownedPR, staleOwnedPR)
+
+	r := &Reconciler{
+		KubeClient:   kubeClient,
+		TektonClient: tektonClient,
+		Image:        "agentrun-runtime:test",
+	}
+
+	ctx := context.Background()
+	if err := r.Reconcile(ctx, agentRun); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if agentRun.Status.Phase != v1alpha1.AgentRunPhaseFailed {
+		t.Errorf("Phase = %v, want Failed", agentRun.Status.Phase)
+	}
+
+	if agentRun.Status.CompletionTime == nil {
+		t.Error("CompletionTime should be set")
+	}
+
+	cond := meta.FindStatusCondition(agentRun.Status.Conditions, v1alpha1.AgentRunConditionSucceeded)
+	if cond == nil || cond.Reason != v1alpha1.AgentRunReasonCancelled {
+		t.Errorf("Succeeded condition = %+v, want reason %s", cond, v1alpha1.AgentRunReasonCancelled)
+	}
+
+	if _, err := kubeClient.CoreV1().Pods("default").Get(ctx, "test-run-agent", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("agent pod should be deleted, got err = %v", err)
+	}
+
+	pr, err := tektonClient.TektonV1().PipelineRuns("default").Get(ctx, "owned-run", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get PipelineRun: %v", err)
+	}
+	if pr.Spec.Status != tektonv1.PipelineRunSpecStatusCancelled {
+		t.Errorf("owned PipelineRun spec.status = %q, want %q", pr.Spec.Status, tektonv1.PipelineRunSpecStatusCancelled)
+	}
+
+	pr, err = tektonClient.TektonV1().PipelineRuns("default").Get(ctx, "stale-run", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get PipelineRun: %v", err)
+	}
+	if pr.Spec.Status != "" {
+		t.Errorf("PipelineRun not owned by this AgentRun should not be cancelled, got spec.status = %q", pr.Spec.Status)
+	}
+}
+
+func TestReconcile_Retries(t *testing.T) {
+	agentConfig := &v1alpha1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-config",
+		},
+		Spec: v1alpha1.AgentConfigSpec{
+			ServiceAccount: "default",
+			ConfigPVC:      "test-config-pvc",
+			Provider:       "claude",
+		},
+	}
+
+	failedPod := func(name, message string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: "agent",
+						State: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Message: message},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		retries     int32
+		pod         *corev1.Pod
+		wantPhase   string
+		wantReason  string
+		wantRetries int
+	}{
+		{
+			name:        "provider error is retried",
+			retries:     2,
+			pod:         failedPod("test-run-agent", `{"reason":"ProviderError","message":"overloaded"}`),
+			wantPhase:   v1alpha1.AgentRunPhasePending,
+			wantReason:  v1alpha1.AgentRunReasonRetrying,
+			wantRetries: 1,
+		},
+		{
+			name:        "timeout is retried",
+			retries:     1,
+			pod:         failedPod("test-run-agent", `{"reason":"Timeout"}`),
+			wantPhase:   v1alpha1.AgentRunPhasePending,
+			wantReason:  v1alpha1.AgentRunReasonRetrying,
+			wantRetries: 1,
+		},
+		{
+			name:        "max iterations is not retried",
+			retries:     2,
+			pod:         failedPod("test-run-agent", `{"reason":"MaxIterations"}`),
+			wantPhase:   v1alpha1.AgentRunPhaseFailed,
+			wantReason:  v1alpha1.AgentRunReasonMaxIterations,
+			wantRetries: 0,
+		},
+		{
+			name:        "no retries configured",
+			retries:     0,
+			pod:         failedPod("test-run-agent", `{"reason":"ProviderError"}`),
+			wantPhase:   v1alpha1.AgentRunPhaseFailed,
+			wantReason:  v1alpha1.AgentRunReasonProviderError,
+			wantRetries: 0,
+		},
+		{
+			name:        "missing termination message",
+			retries:     2,
+			pod:         failedPod("test-run-agent", ""),
+			wantPhase:   v1alpha1.AgentRunPhaseFailed,
+			wantReason:  v1alpha1.AgentRunReasonFailed,
+			wantRetries: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agentRun := &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-run",
+					Namespace: "default",
+					UID:       "test-uid",
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Goal:      "Test goal",
+					Retries:   tt.retries,
+				},
+				Status: v1alpha1.AgentRunStatus{
+					Phase: v1alpha1.AgentRunPhaseActing,
+				},
+			}
+
+			r := &Reconciler{
+				KubeClient:   fake.NewSimpleClientset(tt.pod),
+				Image:        "agentrun-runtime:test",
+				AgentConfigs: map[string]*v1alpha1.AgentConfig{"test-config": agentConfig},
+			}
+
+			if err := r.Reconcile(context.Background(), agentRun); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			if agentRun.Status.Phase != tt.wantPhase {
+				t.Errorf("Phase = %v, want %v", agentRun.Status.Phase, tt.wantPhase)
+			}
+
+			cond := meta.FindStatusCondition(agentRun.Status.Conditions, v1alpha1.AgentRunConditionSucceeded)
+			if cond == nil || cond.Reason != tt.wantReason {
+				t.Errorf("Succeeded condition = %+v, want reason %s", cond, tt.wantReason)
+			}
+
+			if len(agentRun.Status.RetriesStatus) != tt.wantRetries {
+				t.Errorf("RetriesStatus length = %d, want %d", len(agentRun.Status.RetriesStatus), tt.wantRetries)
+			}
+		})
+	}
+}
+
+func TestReconcile_EvictedPod(t *testing.T) {
+	agentRun := &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-run",
+			Namespace: "default",
+			UID:       "test-uid",
+		},
+		Spec: v1alpha1.AgentRunSpec{
+			ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+			Goal:      "Test goal",
+		},
+		Status: v1alpha1.AgentRunStatus{
+			Phase: v1alpha1.AgentRunPhaseActing,
+		},
+	}
+	evictedPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-run-agent",
+			Namespace: "default",
+		},
+		Status: corev1.PodStatus{
+			Phase:  corev1.PodFailed,
+			Reason: "Evicted",
+		},
+	}
+
+	kubeClient := fake.NewSimpleClientset(evictedPod)
+	r := &Reconciler{
+		KubeClient: kubeClient,
+		Image:      "agentrun-runtime:test",
+		AgentConfigs: map[string]*v1alpha1.AgentConfig{
+			"test-config": {
+				ObjectMeta: metav1.ObjectMeta{Name: "test-config"},
+				Spec: v1alpha1.AgentConfigSpec{
+					ServiceAccount: "default",
+					ConfigPVC:      "test-config-pvc",
+					Provider:       "claude",
+				},
+			},
+		},
+	}
+
+	ctx := context.Background()
+	if err := r.Reconcile(ctx, agentRun); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	// The evicted pod is replaced rather than failing or retrying the run
+	if agentRun.Status.Phase != v1alpha1.AgentRunPhasePending || len(agentRun.Status.RetriesStatus) != 0 {
+		t.Errorf("Phase = %v with %d retries, want Pending without a retry", agentRun.Status.Phase, len(agentRun.Status.RetriesStatus))
+	}
+	if _, err := kubeClient.CoreV1().Pods("default").Get(ctx, "test-run-agent", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("evicted pod should be deleted, got err = %v", err)
+	}
+
+	if err := r.Reconcile(ctx, agentRun); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	newPod, err := kubeClient.CoreV1().Pods("default").Get(ctx, "test-run-agent", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("agent pod should be created again: %v", err)
+	}
+	if newPod.Status.Reason == "Evicted" || agentRun.Status.Phase != v1alpha1.AgentRunPhaseActing {
+		t.Errorf("Phase = %v, want Acting with a new pod", agentRun.Status.Phase)
+	}
+}
+
+func TestReconcile_RetryBackoff(t *testing.T) {
+	agentRun := &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-run",
+			Namespace: "default",
+			UID:       "test-uid",
+		},
+		Spec: v1alpha1.AgentRunSpec{
+			ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+			Goal:      "Test goal",
+			Retries:   3,
+		},
+		Status: v1alpha1.AgentRunStatus{
+			Phase: v1alpha1.AgentRunPhasePending,
+			RetriesStatus: []v1alpha1.AgentRunAttemptStatus{
+				{
+					Attempt:        0,
+					PodName:        "test-run-agent",
+					Reason:         v1alpha1.AgentRunReasonProviderError,
+					CompletionTime: &metav1.Time{Time: time.Now()},
+				},
+			},
+		},
+	}
+
+	kubeClient := fake.NewSimpleClientset()
+	r := &Reconciler{
+		KubeClient: kubeClient,
+		Image:      "agentrun-runtime:test",
+		AgentConfigs: map[string]*v1alpha1.AgentConfig{
+			"test-config": {
+				ObjectMeta: metav1.ObjectMeta{Name: "test-config"},
+				Spec: v1alpha1.AgentConfigSpec{
+					ServiceAccount: "default",
+					ConfigPVC:      "test-config-pvc",
+				},
+			},
+		},
+	}
+
+	ctx := context.Background()
+
+	// Within the backoff window no pod is created
+	if err := r.Reconcile(ctx, agentRun); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	pods, _ := kubeClient.CoreV1().Pods("default").List(ctx, metav1.ListOptions{})
+	if len(pods.Items) != 0 {
+		t.Fatalf("Pod count = %d, want 0 during backoff", len(pods.Items))
+	}
+
+	// Once the backoff has elapsed the next attempt's pod is created
+	agentRun.Status.RetriesStatus[0].CompletionTime = &metav1.Time{Time: time.Now().Add(-retryBackoff(1))}
+	if err := r.Reconcile(ctx, agentRun); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if _, err := kubeClient.CoreV1().Pods("default").Get(ctx, "test-run-agent-1", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected attempt pod test-run-agent-1: %v", err)
+	}
+	if agentRun.Status.Phase != v1alpha1.AgentRunPhaseActing {
+		t.Errorf("Phase = %v, want Acting", agentRun.Status.Phase)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{retry: 1, want: 10 * time.Second},
+		{retry: 2, want: 20 * time.Second},
+		{retry: 3, want: 40 * time.Second},
+		{retry: 10, want: retryMaxBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := retryBackoff(tt.retry); got != tt.want {
+			t.Errorf("retryBackoff(%d) = %v, want %v", tt.retry, got, tt.want)
+		}
+	}
+}
+
+func TestReconcile_AwaitingApproval(t *testing.T) {
+	agentRun := &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-run",
+			Namespace: "default",
+			UID:       "test-uid",
+		},
+		Spec: v1alpha1.AgentRunSpec{
+			ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+			Goal:      "Deploy to production",
+		},
+		Status: v1alpha1.AgentRunStatus{
+			Phase: v1alpha1.AgentRunPhaseActing,
+		},
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-run-agent",
+			Namespace: "default",
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+
+	approval := &v1alpha1.AgentApproval{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "test-run-1a2b3c4d",
+			Namespace:       "default",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "AgentRun", Name: "test-run", UID: "test-uid"}},
+		},
+		Spec: v1alpha1.AgentApprovalSpec{
+			AgentRun: "test-run",
+			ToolName: "tekton_create_pipelinerun",
+		},
+		Status: v1alpha1.AgentApprovalStatus{
+			Decision: v1alpha1.ApprovalPending,
+		},
+	}
+
+	r := &Reconciler{
+		KubeClient: fake.NewSimpleClientset(pod),
+		AgentConfigs: map[string]*v1alpha1.AgentConfig{
+			"test-config": {
+				ObjectMeta: metav1.ObjectMeta{Name: "test-config"},
+				Spec:       v1alpha1.AgentConfigSpec{ConfigPVC: "test-config-pvc"},
+			},
+		},
+		AgentApprovals: []*v1alpha1.AgentApproval{approval},
+	}
+
+	ctx := context.Background()
+	if err := r.Reconcile(ctx, agentRun); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if agentRun.Status.Phase != v1alpha1.AgentRunPhaseAwaitingApproval {
+		t.Fatalf("Phase = %v, want AwaitingApproval", agentRun.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(agentRun.Status.Conditions, v1alpha1.AgentRunConditionSucceeded)
+	if cond == nil || cond.Reason != v1alpha1.AgentRunReasonAwaitingApproval {
+		t.Errorf("Succeeded condition = %+v, want reason AwaitingApproval", cond)
+	}
+
+	// Once the tool call is decided the run goes back to Acting
+	approval.Status.Decision = v1alpha1.ApprovalApproved
+	if err := r.Reconcile(ctx, agentRun); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if agentRun.Status.Phase != v1alpha1.AgentRunPhaseActing {
+		t.Errorf("Phase = %v, want Acting", agentRun.Status.Phase)
+	}
+}
+
+func TestReconcile_PlanResults(t *testing.T) {
+	agentRun := &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-run",
+			Namespace: "default",
+			UID:       "test-uid",
+		},
+		Spec: v1alpha1.AgentRunSpec{
+			ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+			Goal:      "Roll out v2",
+			Mode:      v1alpha1.AgentRunModePlan,
+		},
+		Status: v1alpha1.AgentRunStatus{
+			Phase: v1alpha1.AgentRunPhaseActing,
+		},
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-run-agent",
+			Namespace: "default",
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodSucceeded,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name: "agent",
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{
+							Message: `{"reason":"Succeeded","plan":[{"id":"toolu_1","tool":"tekton_create_pipelinerun","input":"{\"name\":\"deploy-v2\"}"}]}`,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	r := &Reconciler{
+		KubeClient: fake.NewSimpleClientset(pod),
+		AgentConfigs: map[string]*v1alpha1.AgentConfig{
+			"test-config": {
+				ObjectMeta: metav1.ObjectMeta{Name: "test-config"},
+				Spec:       v1alpha1.AgentConfigSpec{ConfigPVC: "test-config-pvc"},
+			},
+		},
+	}
+
+	if err := r.Reconcile(context.Background(), agentRun); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	want := []v1alpha1.ProposedAction{
+		{ID: "toolu_1", Tool: "tekton_create_pipelinerun", Input: `{"name":"deploy-v2"}`},
+	}
+	if !reflect.DeepEqual(agentRun.Status.Plan, want) {
+		t.Errorf("Plan = %+v, want %+v", agentRun.Status.Plan, want)
+	}
+}
+
+func TestReconcile_ExecutePlan(t *testing.T) {
+	plan := []v1alpha1.ProposedAction{
+		{ID: "toolu_1", Tool: "tekton_create_pipelinerun", Input: `{"name":"deploy-v2"}`},
+	}
+	planRun := func(mode v1alpha1.AgentRunMode, phase string, plan []v1alpha1.ProposedAction) *v1alpha1.AgentRun {
+		return &v1alpha1.AgentRun{
+			ObjectMeta: metav1.ObjectMeta{Name: "rollout-plan", Namespace: "default"},
+			Spec:       v1alpha1.AgentRunSpec{Mode: mode},
+			Status:     v1alpha1.AgentRunStatus{Phase: phase, Plan: plan},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		planRun    *v1alpha1.AgentRun
+		wantPhase  string
+		wantReason string
+		wantPod    bool
+	}{
+		{
+			name:      "succeeded plan is executed",
+			planRun:   planRun(v1alpha1.AgentRunModePlan, v1alpha1.AgentRunPhaseSucceeded, plan),
+			wantPhase: v1alpha1.AgentRunPhaseActing,
+			wantPod:   true,
+		},
+		{
+			name:       "missing plan",
+			wantPhase:  v1alpha1.AgentRunPhaseFailed,
+			wantReason: v1alpha1.AgentRunReasonInvalidPlan,
+		},
+		{
+			name:       "not a plan-mode run",
+			planRun:    planRun("", v1alpha1.AgentRunPhaseSucceeded, nil),
+			wantPhase:  v1alpha1.AgentRunPhaseFailed,
+			wantReason: v1alpha1.AgentRunReasonInvalidPlan,
+		},
+		{
+			name:       "plan still running",
+			planRun:    planRun(v1alpha1.AgentRunModePlan, v1alpha1.AgentRunPhaseActing, nil),
+			wantPhase:  v1alpha1.AgentRunPhaseQueued,
+			wantReason: v1alpha1.AgentRunReasonWaitingForRun,
+		},
+		{
+			name:       "failed plan",
+			planRun:    planRun(v1alpha1.AgentRunModePlan, v1alpha1.AgentRunPhaseFailed, nil),
+			wantPhase:  v1alpha1.AgentRunPhaseFailed,
+			wantReason: v1alpha1.AgentRunReasonInvalidPlan,
+		},
+		{
+			name:       "empty plan",
+			planRun:    planRun(v1alpha1.AgentRunModePlan, v1alpha1.AgentRunPhaseSucceeded, nil),
+			wantPhase:  v1alpha1.AgentRunPhaseSucceeded,
+			wantReason: v1alpha1.AgentRunReasonSucceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agentRun := &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "rollout",
+					Namespace: "default",
+					UID:       "test-uid",
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Goal:      "Roll out v2",
+					Mode:      v1alpha1.AgentRunModeExecute,
+					PlanRef:   &v1alpha1.PlanRef{Name: "rollout-plan"},
+				},
+				Status: v1alpha1.AgentRunStatus{
+					Phase: v1alpha1.AgentRunPhasePending,
+				},
+			}
+
+			kubeClient := fake.NewSimpleClientset()
+			r := &Reconciler{
+				KubeClient: kubeClient,
+				AgentConfigs: map[string]*v1alpha1.AgentConfig{
+					"test-config": {
+						ObjectMeta: metav1.ObjectMeta{Name: "test-config"},
+						Spec:       v1alpha1.AgentConfigSpec{ConfigPVC: "test-config-pvc"},
+					},
+				},
+				AgentRuns: []*v1alpha1.AgentRun{agentRun},
+			}
+			if tt.planRun != nil {
+				r.AgentRuns = append(r.AgentRuns, tt.planRun)
+			}
+
+			ctx := context.Background()
+			if err := r.Reconcile(ctx, agentRun); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			if agentRun.Status.Phase != tt.wantPhase {
+				t.Errorf("Phase = %v, want %v", agentRun.Status.Phase, tt.wantPhase)
+			}
+			if tt.wantReason != "" {
+				cond := meta.FindStatusCondition(agentRun.Status.Conditions, v1alpha1.AgentRunConditionSucceeded)
+				if cond == nil || cond.Reason != tt.wantReason {
+					t.Errorf("Succeeded condition = %+v, want reason %v", cond, tt.wantReason)
+				}
+			}
+
+			agentPod, err := kubeClient.CoreV1().Pods("default").Get(ctx, "rollout-agent", metav1.GetOptions{})
+			if (err == nil) != tt.wantPod {
+				t.Fatalf("agent pod created = %v, want %v", err == nil, tt.wantPod)
+			}
+			if !tt.wantPod {
+				return
+			}
+			if !reflect.DeepEqual(agentRun.Status.Plan, plan) {
+				t.Errorf("Plan = %+v, want %+v", agentRun.Status.Plan, plan)
+			}
+			for _, env := range agentPod.Spec.Containers[0].Env {
+				if env.Name == "AGENT_PLAN" && env.Value != `[{"id":"toolu_1","tool":"tekton_create_pipelinerun","input":"{\"name\":\"deploy-v2\"}"}]` {
+					t.Errorf("AGENT_PLAN = %s", env.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcile_InvalidSpec(t *testing.T) {
+	// An execute-mode run without a planRef must fail instead of panicking
+	agentRun := &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "rollout",
+			Namespace: "default",
+			UID:       "test-uid",
+		},
+		Spec: v1alpha1.AgentRunSpec{
+			ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+			Goal:      "Roll out v2",
+			Mode:      v1alpha1.AgentRunModeExecute,
+		},
+		Status: v1alpha1.AgentRunStatus{
+			Phase: v1alpha1.AgentRunPhasePending,
+		},
+	}
+
+	kubeClient := fake.NewSimpleClientset()
+	r := &Reconciler{
+		KubeClient: kubeClient,
+		AgentConfigs: map[string]*v1alpha1.AgentConfig{
+			"test-config": {
+				ObjectMeta: metav1.ObjectMeta{Name: "test-config"},
+				Spec:       v1alpha1.AgentConfigSpec{ConfigPVC: "test-config-pvc"},
+			},
+		},
+		AgentRuns: []*v1alpha1.AgentRun{agentRun},
+	}
+
+	ctx := context.Background()
+	if err := r.Reconcile(ctx, agentRun); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if agentRun.Status.Phase != v1alpha1.AgentRunPhaseFailed {
+		t.Errorf("Phase = %v, want %v", agentRun.Status.Phase, v1alpha1.AgentRunPhaseFailed)
+	}
+	cond := meta.FindStatusCondition(agentRun.Status.Conditions, v1alpha1.AgentRunConditionSucceeded)
+	if cond == nil || cond.Reason != v1alpha1.AgentRunReasonInvalidSpec || !strings.Contains(cond.Message, "planRef.name is required") {
+		t.Errorf("Succeeded condition = %+v, want reason %v", cond, v1alpha1.AgentRunReasonInvalidSpec)
+	}
+	if _, err := kubeClient.CoreV1().Pods("default").Get(ctx, "rollout-agent", metav1.GetOptions{}); err == nil {
+		t.Error("agent pod created for an invalid AgentRun")
+	}
+}
+
+func TestReconcile_ContinueFrom(t *testing.T) {
+	previousRun := func(phase string) *v1alpha1.AgentRun {
+		return &v1alpha1.AgentRun{
+			ObjectMeta: metav1.ObjectMeta{Name: "rollout", Namespace: "default", UID: "previous-uid"},
+			Status:     v1alpha1.AgentRunStatus{Phase: phase},
+		}
+	}
+	transcript := func(data string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "rollout-transcript", Namespace: "default"},
+			Data:       map[string]string{pod.TranscriptKey: data},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		previousRun *v1alpha1.AgentRun
+		transcript  *corev1.ConfigMap
+		wantPhase   string
+		wantReason  string
+		wantPod     bool
+	}{
+		{
+			name:        "finished run is continued",
+			previousRun: previousRun(v1alpha1.AgentRunPhaseSucceeded),
+			transcript:  transcript(`[{"role":"user","content":"Goal: roll out"}]`),
+			wantPhase:   v1alpha1.AgentRunPhaseActing,
+			wantPod:     true,
+		},
+		{
+			name:       "missing run",
+			wantPhase:  v1alpha1.AgentRunPhaseFailed,
+			wantReason: v1alpha1.AgentRunReasonInvalidContinuation,
+		},
+		{
+			name:        "run still running",
+			previousRun: previousRun(v1alpha1.AgentRunPhaseActing),
+			wantPhase:   v1alpha1.AgentRunPhaseQueued,
+			wantReason:  v1alpha1.AgentRunReasonWaitingForRun,
+		},
+		{
+			name:        "missing transcript",
+			previousRun: previousRun(v1alpha1.AgentRunPhaseFailed),
+			wantPhase:   v1alpha1.AgentRunPhaseFailed,
+			wantReason:  v1alpha1.AgentRunReasonInvalidContinuation,
+		},
+		{
+			name:        "empty transcript",
+			previousRun: previousRun(v1alpha1.AgentRunPhaseFailed),
+			transcript:  transcript(""),
+			wantPhase:   v1alpha1.AgentRunPhaseFailed,
+			wantReason:  v1alpha1.AgentRunReasonInvalidContinuation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agentRun := &v1alpha1.AgentRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "rollout-debug",
+					Namespace: "default",
+					UID:       "test-uid",
+				},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef:    v1alpha1.ConfigRef{Name: "test-config"},
+					Goal:         "Now also rerun it with debug=true",
+					ContinueFrom: &v1alpha1.ContinueFromRef{Name: "rollout"},
+				},
+				Status: v1alpha1.AgentRunStatus{
+					Phase: v1alpha1.AgentRunPhasePending,
+				},
+			}
+
+			kubeClient := fake.NewSimpleClientset()
+			if tt.transcript != nil {
+				kubeClient = fake.NewSimpleClientset(tt.transcript)
+			}
+			r := &Reconciler{
+				KubeClient: kubeClient,
+				AgentConfigs: map[string]*v1alpha1.AgentConfig{
+					"test-config": {
+						ObjectMeta: metav1.ObjectMeta{Name: "test-config"},
+						Spec:       v1alpha1.AgentConfigSpec{ConfigPVC: "test-config-pvc"},
+					},
+				},
+				AgentRuns: []*v1alpha1.AgentRun{agentRun},
+			}
+			if tt.previousRun != nil {
+				r.AgentRuns = append(r.AgentRuns, tt.previousRun)
+			}
+
+			ctx := context.Background()
+			if err := r.Reconcile(ctx, agentRun); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			if agentRun.Status.Phase != tt.wantPhase {
+				t.Errorf("Phase = %v, want %v", agentRun.Status.Phase, tt.wantPhase)
+			}
+			if tt.wantReason != "" {
+				cond := meta.FindStatusCondition(agentRun.Status.Conditions, v1alpha1.AgentRunConditionSucceeded)
+				if cond == nil || cond.Reason != tt.wantReason {
+					t.Errorf("Succeeded condition = %+v, want reason %v", cond, tt.wantReason)
+				}
+			}
+
+			_, err := kubeClient.CoreV1().Pods("default").Get(ctx, "rollout-debug-agent", metav1.GetOptions{})
+			if (err == nil) != tt.wantPod {
+				t.Fatalf("agent pod created = %v, want %v", err == nil, tt.wantPod)
+			}
+			if !tt.wantPod {
+				return
+			}
+
+			// The continuation saves its own transcript so it can be continued in turn
+			own, err := kubeClient.CoreV1().ConfigMaps("default").Get(ctx, "rollout-debug-transcript", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("transcript ConfigMap not created: %v", err)
+			}
+			if len(own.OwnerReferences) == 0 || own.OwnerReferences[0].UID != agentRun.UID {
+				t.Errorf("transcript ConfigMap owner = %+v, want the AgentRun", own.OwnerReferences)
+			}
+		})
+	}
+}
+
+func TestReconcile_Delegation(t *testing.T) {
+	parent := func(depth string) *v1alpha1.AgentRun {
+		ar := &v1alpha1.AgentRun{
+			ObjectMeta: metav1.ObjectMeta{Name: "coordinator", Namespace: "default", UID: "parent-uid"},
+			Spec:       v1alpha1.AgentRunSpec{ConfigRef: v1alpha1.ConfigRef{Name: "coordinator-config"}},
+			Status:     v1alpha1.AgentRunStatus{Phase: v1alpha1.AgentRunPhaseActing},
+		}
+		if depth != "" {
+			ar.Labels = map[string]string{pod.DelegationDepthLabelKey: depth}
+		}
+		return ar
+	}
+	child := func(name, config, depth string) *v1alpha1.AgentRun {
+		return &v1alpha1.AgentRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				UID:       types.UID(name + "-uid"),
+				Labels: map[string]string{
+					pod.ParentAgentRunLabelKey:  "coordinator",
+					pod.DelegationDepthLabelKey: depth,
+					pod.ParentPodUIDLabelKey:    "parent-pod-uid",
+				},
+				OwnerReferences: []metav1.OwnerReference{{Kind: "AgentRun", Name: "coordinator", UID: "parent-uid"}},
+			},
+			Spec: v1alpha1.AgentRunSpec{
+				ConfigRef: v1alpha1.ConfigRef{Name: config},
+				Goal:      "Investigate namespace team-a",
+			},
+			Status: v1alpha1.AgentRunStatus{Phase: v1alpha1.AgentRunPhasePending},
+		}
+	}
+	unlabelled := func(ar *v1alpha1.AgentRun) *v1alpha1.AgentRun {
+		ar.Labels = nil
+		return ar
+	}
+	createdBy := func(ar *v1alpha1.AgentRun, podUID string) *v1alpha1.AgentRun {
+		ar.Labels[pod.ParentPodUIDLabelKey] = podUID
+		return ar
+	}
+	// The agent pods of the parent and of another AgentRun of the same config
+	parentPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "coordinator-agent",
+			Namespace:       "default",
+			UID:             "parent-pod-uid",
+			Labels:          map[string]string{pod.AgentRunLabelKey: "coordinator"},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "AgentRun", Name: "coordinator", UID: "parent-uid"}},
+		},
+	}
+	otherPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "other-coordinator-agent",
+			Namespace:       "default",
+			UID:             "other-pod-uid",
+			Labels:          map[string]string{pod.AgentRunLabelKey: "other-coordinator"},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "AgentRun", Name: "other-coordinator", UID: "other-uid"}},
+		},
+	}
+	delegation := &v1alpha1.DelegationSpec{AllowedConfigs: []string{"investigator"}, MaxDepth: 1, MaxChildren: 1}
+
+	tests := []struct {
+		name       string
+		agentRun   *v1alpha1.AgentRun
+		parent     *v1alpha1.AgentRun
+		siblings   []*v1alpha1.AgentRun
+		delegation *v1alpha1.DelegationSpec
+		wantPhase  string
+	}{
+		{
+			name:       "allowed child",
+			agentRun:   child("child-a", "investigator", "1"),
+			parent:     parent(""),
+			delegation: delegation,
+			wantPhase:  v1alpha1.AgentRunPhaseActing,
+		},
+		{
+			name:       "missing parent",
+			agentRun:   child("child-a", "investigator", "1"),
+			delegation: delegation,
+			wantPhase:  v1alpha1.AgentRunPhaseFailed,
+		},
+		{
+			name:      "parent config does not allow delegation",
+			agentRun:  child("child-a", "investigator", "1"),
+			parent:    parent(""),
+			wantPhase: v1alpha1.AgentRunPhaseFailed,
+		},
+		{
+			name:       "config not allowed",
+			agentRun:   child("child-a", "coordinator-config", "1"),
+			parent:     parent(""),
+			delegation: delegation,
+			wantPhase:  v1alpha1.AgentRunPhaseFailed,
+		},
+		{
+			name:       "depth exceeded",
+			agentRun:   child("child-a", "investigator", "2"),
+			parent:     parent("1"),
+			delegation: delegation,
+			wantPhase:  v1alpha1.AgentRunPhaseFailed,
+		},
+		{
+			name:       "wrong depth label",
+			agentRun:   child("child-a", "investigator", "0"),
+			parent:     parent(""),
+			delegation: delegation,
+			wantPhase:  v1alpha1.AgentRunPhaseFailed,
+		},
+		{
+			name:       "too many children",
+			agentRun:   child("child-b", "investigator", "1"),
+			parent:     parent(""),
+			siblings:   []*v1alpha1.AgentRun{child("child-a", "investigator", "1")},
+			delegation: delegation,
+			wantPhase:  v1alpha1.AgentRunPhaseFailed,
+		},
+		{
+			name:       "created by another AgentRun's pod",
+			agentRun:   createdBy(child("child-a", "investigator", "1"), "other-pod-uid"),
+			parent:     parent(""),
+			delegation: delegation,
+			wantPhase:  v1alpha1.AgentRunPhaseFailed,
+		},
+		{
+			name:       "without the pod of its creator",
+			agentRun:   createdBy(child("child-a", "investigator", "1"), ""),
+			parent:     parent(""),
+			delegation: delegation,
+			wantPhase:  v1alpha1.AgentRunPhaseFailed,
+		},
+		{
+			name:       "unlabelled child of the parent",
+			agentRun:   unlabelled(child("child-a", "coordinator-config", "")),
+			parent:     parent(""),
+			delegation: delegation,
+			wantPhase:  v1alpha1.AgentRunPhaseFailed,
+		},
+		{
+			name:       "unlabelled children count towards the limit",
+			agentRun:   child("child-b", "investigator", "1"),
+			parent:     parent(""),
+			siblings:   []*v1alpha1.AgentRun{unlabelled(child("child-a", "investigator", ""))},
+			delegation: delegation,
+			wantPhase:  v1alpha1.AgentRunPhaseFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeClient := fake.NewSimpleClientset(parentPod, otherPod)
+			r := &Reconciler{
+				KubeClient: kubeClient,
+				AgentConfigs: map[string]*v1alpha1.AgentConfig{
+					"investigator": {
+						ObjectMeta: metav1.ObjectMeta{Name: "investigator"},
+						Spec:       v1alpha1.AgentConfigSpec{ConfigPVC: "test-config-pvc"},
+					},
+					"coordinator-config": {
+						ObjectMeta: metav1.ObjectMeta{Name: "coordinator-config"},
+						Spec:       v1alpha1.AgentConfigSpec{ConfigPVC: "test-config-pvc", Delegation: tt.delegation},
+					},
+				},
+				AgentRuns: append([]*v1alpha1.AgentRun{tt.agentRun}, tt.siblings...),
+			}
+			if tt.parent != nil {
+				r.AgentRuns = append(r.AgentRuns, tt.parent)
+			}
+
+			if err := r.Reconcile(context.Background(), tt.agentRun); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			if tt.agentRun.Status.Phase != tt.wantPhase {
+				t.Errorf("Phase = %v, want %v", tt.agentRun.Status.Phase, tt.wantPhase)
+			}
+			if tt.wantPhase == v1alpha1.AgentRunPhaseFailed {
+				cond := meta.FindStatusCondition(tt.agentRun.Status.Conditions, v1alpha1.AgentRunConditionSucceeded)
+				if cond == nil || cond.Reason != v1alpha1.AgentRunReasonDelegationNotAllowed {
+					t.Errorf("Succeeded condition = %+v, want reason %v", cond, v1alpha1.AgentRunReasonDelegationNotAllowed)
+				}
+			}
+		})
+	}
+}
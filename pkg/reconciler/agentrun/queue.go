@@ -0,0 +1,158 @@
+package agentrun
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/pod"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MaxConcurrentRunsAnnotationKey is the Namespace annotation limiting how many AgentRuns
+// may run at once in the namespace. It overrides Reconciler.MaxConcurrentRunsPerNamespace.
+const MaxConcurrentRunsAnnotationKey = "agent.tekton.dev/max-concurrent-runs"
+
+// admit decides whether a pending AgentRun may start its agent pod now. Runs are
+// admitted in creation order while the number of active agent pods is below the
+// AgentConfig and namespace limits. When the run has to wait, a message
+// describing the exhausted limit is returned.
+func (r *Reconciler) admit(ctx context.Context, agentRun *v1alpha1.AgentRun, agentConfig *v1alpha1.AgentConfig) (bool, string, error) {
+	configLimit := int(agentConfig.Spec.MaxConcurrentRuns)
+	namespaceLimit, err := r.namespaceLimit(ctx, agentRun.Namespace)
+	if err != nil {
+		return false, "", err
+	}
+	if configLimit == 0 && namespaceLimit == 0 {
+		return true, "", nil
+	}
+
+	// Count active agent pods
+	pods, err := r.KubeClient.CoreV1().Pods(agentRun.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", pod.ComponentLabelKey, pod.AgentRuntimeComponent),
+	})
+	if err != nil {
+		return false, "", fmt.Errorf("failed to list agent pods: %w", err)
+	}
+
+	running := map[string]bool{}
+	configsActive := map[string]int{}
+	namespaceActive := 0
+	for _, p := range pods.Items {
+		if p.DeletionTimestamp != nil || p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		runName := p.Labels[pod.AgentRunLabelKey]
+		if runName == agentRun.Name {
+			// This run already holds a slot
+			return true, "", nil
+		}
+		running[runName] = true
+		namespaceActive++
+		configsActive[p.Labels[pod.AgentConfigLabelKey]]++
+	}
+	configActive := configsActive[agentConfig.Name]
+
+	// Waiting runs created earlier are admitted first
+	var ahead []*v1alpha1.AgentRun
+	for _, other := range r.AgentRuns {
+		if other.Namespace != agentRun.Namespace || other.UID == agentRun.UID || running[other.Name] {
+			continue
+		}
+		if isWaiting(other) && createdBefore(other, agentRun) {
+			ahead = append(ahead, other)
+		}
+	}
+	sort.Slice(ahead, func(i, j int) bool { return createdBefore(ahead[i], ahead[j]) })
+
+	// Runs ahead only take a namespace slot if their own AgentConfig has room for them
+	namespaceAhead, configAhead := 0, 0
+	configsAhead := map[string]int{}
+	for _, other := range ahead {
+		name := other.Spec.ConfigRef.Name
+		if name == agentConfig.Name {
+			configAhead++
+		}
+		limit := r.configLimit(agentConfig, name)
+		if limit > 0 && configsActive[name]+configsAhead[name] >= limit {
+			continue
+		}
+		configsAhead[name]++
+		namespaceAhead++
+	}
+
+	if namespaceLimit > 0 && namespaceActive+namespaceAhead >= namespaceLimit {
+		return false, fmt.Sprintf("Waiting for a free slot: %d of %d runs active in namespace %s, %d queued ahead",
+			namespaceActive, namespaceLimit, agentRun.Namespace, namespaceAhead), nil
+	}
+
+	if configLimit > 0 && configActive+configAhead >= configLimit {
+		return false, fmt.Sprintf("Waiting for a free slot: %d of %d runs active for AgentConfig %s, %d queued ahead",
+			configActive, configLimit, agentConfig.Name, configAhead), nil
+	}
+
+	return true, "", nil
+}
+
+// configLimit returns the concurrency limit of the named AgentConfig, or 0 if it is
+// unknown or unlimited
+func (r *Reconciler) configLimit(agentConfig *v1alpha1.AgentConfig, name string) int {
+	if name == agentConfig.Name {
+		return int(agentConfig.Spec.MaxConcurrentRuns)
+	}
+	if config, ok := r.AgentConfigs[name]; ok {
+		return int(config.Spec.MaxConcurrentRuns)
+	}
+	return 0
+}
+
+// namespaceLimit returns the concurrency limit of the namespace: its annotation if set
+// to a valid number, otherwise MaxConcurrentRunsPerNamespace
+func (r *Reconciler) namespaceLimit(ctx context.Context, namespace string) (int, error) {
+	ns, err := r.KubeClient.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return int(r.MaxConcurrentRunsPerNamespace), nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get namespace: %w", err)
+	}
+
+	if value, ok := ns.Annotations[MaxConcurrentRunsAnnotationKey]; ok {
+		if limit, err := strconv.Atoi(value); err == nil && limit >= 0 {
+			return limit, nil
+		}
+	}
+	return int(r.MaxConcurrentRunsPerNamespace), nil
+}
+
+// isWaiting returns true if the AgentRun is waiting for a concurrency slot. Runs
+// waiting for another AgentRun to finish or for their retry backoff to elapse do
+// not hold a place in the queue.
+func isWaiting(agentRun *v1alpha1.AgentRun) bool {
+	if agentRun.IsDone() || agentRun.IsCancelled() || time.Now().Before(nextAttemptTime(agentRun)) {
+		return false
+	}
+	switch agentRun.Status.Phase {
+	case "", v1alpha1.AgentRunPhasePending:
+		return true
+	case v1alpha1.AgentRunPhaseQueued:
+		cond := meta.FindStatusCondition(agentRun.Status.Conditions, v1alpha1.AgentRunConditionSucceeded)
+		return cond == nil || cond.Reason == v1alpha1.AgentRunReasonQueued
+	default:
+		return false
+	}
+}
+
+// createdBefore orders AgentRuns by creation time, breaking ties by name
+func createdBefore(a, b *v1alpha1.AgentRun) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
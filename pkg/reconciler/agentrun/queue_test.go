@@ -0,0 +1,304 @@
+package agentrun
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/pod"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func queuedAgentRun(name, config string, created time.Time) *v1alpha1.AgentRun {
+	return &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			UID:               types.UID(name + "-uid"),
+			CreationTimestamp: metav1.Time{Time: created},
+		},
+		Spec: v1alpha1.AgentRunSpec{
+			ConfigRef: v1alpha1.ConfigRef{Name: config},
+			Goal:      "Test goal",
+		},
+		Status: v1alpha1.AgentRunStatus{
+			Phase: v1alpha1.AgentRunPhasePending,
+		},
+	}
+}
+
+func activeAgentPod(runName, config string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      runName + "-agent",
+			Namespace: "default",
+			Labels: map[string]string{
+				pod.AgentRunLabelKey:    runName,
+				pod.AgentConfigLabelKey: config,
+				pod.ComponentLabelKey:   pod.AgentRuntimeComponent,
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	first := queuedAgentRun("first", "test-config", base)
+	second := queuedAgentRun("second", "test-config", base.Add(time.Minute))
+	other := queuedAgentRun("other", "other-config", base.Add(-time.Minute))
+	otherNext := queuedAgentRun("other-next", "other-config", base.Add(-time.Second))
+
+	tests := []struct {
+		name           string
+		agentRun       *v1alpha1.AgentRun
+		configLimit    int32
+		namespaceLimit int32
+		// otherConfigLimit is the concurrency limit of other-config
+		otherConfigLimit int32
+		// annotation is the concurrency limit annotation of the namespace, if set
+		annotation   string
+		pods         []*corev1.Pod
+		runs         []*v1alpha1.AgentRun
+		wantAdmitted bool
+	}{
+		{
+			name:         "no limits",
+			agentRun:     second,
+			pods:         []*corev1.Pod{activeAgentPod("a", "test-config")},
+			runs:         []*v1alpha1.AgentRun{first, second},
+			wantAdmitted: true,
+		},
+		{
+			name:         "config limit reached",
+			agentRun:     first,
+			configLimit:  1,
+			pods:         []*corev1.Pod{activeAgentPod("a", "test-config")},
+			runs:         []*v1alpha1.AgentRun{first},
+			wantAdmitted: false,
+		},
+		{
+			name:         "pods of other configs do not count against config limit",
+			agentRun:     first,
+			configLimit:  1,
+			pods:         []*corev1.Pod{activeAgentPod("a", "other-config")},
+			runs:         []*v1alpha1.AgentRun{first},
+			wantAdmitted: true,
+		},
+		{
+			name:         "older waiting run goes first",
+			agentRun:     second,
+			configLimit:  1,
+			runs:         []*v1alpha1.AgentRun{first, second},
+			wantAdmitted: false,
+		},
+		{
+			name:         "oldest waiting run is admitted",
+			agentRun:     first,
+			configLimit:  1,
+			runs:         []*v1alpha1.AgentRun{first, second},
+			wantAdmitted: true,
+		},
+		{
+			name:         "older run of another config does not block config slot",
+			agentRun:     first,
+			configLimit:  1,
+			runs:         []*v1alpha1.AgentRun{other, first},
+			wantAdmitted: true,
+		},
+		{
+			name:           "older run of another config blocks namespace slot",
+			agentRun:       first,
+			namespaceLimit: 1,
+			runs:           []*v1alpha1.AgentRun{other, first},
+			wantAdmitted:   false,
+		},
+		{
+			name:           "namespace limit reached",
+			agentRun:       first,
+			namespaceLimit: 2,
+			pods:           []*corev1.Pod{activeAgentPod("a", "x"), activeAgentPod("b", "y")},
+			runs:           []*v1alpha1.AgentRun{first},
+			wantAdmitted:   false,
+		},
+		{
+			name:         "namespace annotation limits the namespace",
+			agentRun:     first,
+			annotation:   "1",
+			pods:         []*corev1.Pod{activeAgentPod("a", "x")},
+			runs:         []*v1alpha1.AgentRun{first},
+			wantAdmitted: false,
+		},
+		{
+			name:           "namespace annotation overrides the default limit",
+			agentRun:       first,
+			namespaceLimit: 1,
+			annotation:     "3",
+			pods:           []*corev1.Pod{activeAgentPod("a", "x")},
+			runs:           []*v1alpha1.AgentRun{first},
+			wantAdmitted:   true,
+		},
+		{
+			name:           "invalid namespace annotation falls back to the default limit",
+			agentRun:       first,
+			namespaceLimit: 1,
+			annotation:     "many",
+			pods:           []*corev1.Pod{activeAgentPod("a", "x")},
+			runs:           []*v1alpha1.AgentRun{first},
+			wantAdmitted:   false,
+		},
+		{
+			name:           "run waiting for another AgentRun is not queued ahead",
+			agentRun:       first,
+			namespaceLimit: 1,
+			runs:           []*v1alpha1.AgentRun{waitingForRun(other), first},
+			wantAdmitted:   true,
+		},
+		{
+			name:             "older runs blocked by their own config limit do not take namespace slots",
+			agentRun:         first,
+			namespaceLimit:   2,
+			otherConfigLimit: 1,
+			pods:             []*corev1.Pod{activeAgentPod("a", "other-config")},
+			runs:             []*v1alpha1.AgentRun{other, otherNext, first},
+			wantAdmitted:     true,
+		},
+		{
+			name:             "older run of a config with a free slot takes a namespace slot",
+			agentRun:         first,
+			namespaceLimit:   1,
+			otherConfigLimit: 1,
+			runs:             []*v1alpha1.AgentRun{other, otherNext, first},
+			wantAdmitted:     false,
+		},
+		{
+			name:           "run in retry backoff is not queued ahead",
+			agentRun:       first,
+			namespaceLimit: 1,
+			runs:           []*v1alpha1.AgentRun{inBackoff(other), first},
+			wantAdmitted:   true,
+		},
+		{
+			name:         "run that already has a pod keeps its slot",
+			agentRun:     second,
+			configLimit:  1,
+			pods:         []*corev1.Pod{activeAgentPod("second", "test-config")},
+			runs:         []*v1alpha1.AgentRun{first, second},
+			wantAdmitted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+			if tt.annotation != "" {
+				ns.Annotations = map[string]string{MaxConcurrentRunsAnnotationKey: tt.annotation}
+			}
+			kubeClient := fake.NewSimpleClientset(ns)
+			for _, p := range tt.pods {
+				if _, err := kubeClient.CoreV1().Pods(p.Namespace).Create(context.Background(), p, metav1.CreateOptions{}); err != nil {
+					t.Fatalf("Failed to create pod: %v", err)
+				}
+			}
+
+			r := &Reconciler{
+				KubeClient: kubeClient,
+				AgentConfigs: map[string]*v1alpha1.AgentConfig{
+					"other-config": {
+						ObjectMeta: metav1.ObjectMeta{Name: "other-config"},
+						Spec:       v1alpha1.AgentConfigSpec{MaxConcurrentRuns: tt.otherConfigLimit},
+					},
+				},
+				AgentRuns:                     tt.runs,
+				MaxConcurrentRunsPerNamespace: tt.namespaceLimit,
+			}
+
+			agentConfig := &v1alpha1.AgentConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: tt.agentRun.Spec.ConfigRef.Name},
+				Spec: v1alpha1.AgentConfigSpec{
+					MaxConcurrentRuns: tt.configLimit,
+				},
+			}
+
+			admitted, message, err := r.admit(context.Background(), tt.agentRun, agentConfig)
+			if err != nil {
+				t.Fatalf("admit() error = %v", err)
+			}
+			if admitted != tt.wantAdmitted {
+				t.Errorf("admit() = %v (%s), want %v", admitted, message, tt.wantAdmitted)
+			}
+		})
+	}
+}
+
+// inBackoff returns a copy of the AgentRun waiting out the backoff before its retry
+func inBackoff(agentRun *v1alpha1.AgentRun) *v1alpha1.AgentRun {
+	retrying := agentRun.DeepCopy()
+	retrying.Status.RetriesStatus = []v1alpha1.AgentRunAttemptStatus{{
+		Attempt:        0,
+		PodName:        agentRun.Name + "-agent",
+		CompletionTime: &metav1.Time{Time: time.Now()},
+	}}
+	return retrying
+}
+
+// waitingForRun returns a copy of the AgentRun waiting for another AgentRun to finish
+func waitingForRun(agentRun *v1alpha1.AgentRun) *v1alpha1.AgentRun {
+	waiting := agentRun.DeepCopy()
+	waiting.Status.MarkWaitingForRun("Waiting for plan AgentRun plan to finish")
+	return waiting
+}
+
+func TestReconcile_Queued(t *testing.T) {
+	agentRun := queuedAgentRun("test-run", "test-config", time.Now())
+
+	kubeClient := fake.NewSimpleClientset(activeAgentPod("busy", "test-config"))
+	r := &Reconciler{
+		KubeClient: kubeClient,
+		Image:      "agentrun-runtime:test",
+		AgentConfigs: map[string]*v1alpha1.AgentConfig{
+			"test-config": {
+				ObjectMeta: metav1.ObjectMeta{Name: "test-config"},
+				Spec: v1alpha1.AgentConfigSpec{
+					ServiceAccount:    "default",
+					ConfigPVC:         "test-config-pvc",
+					MaxConcurrentRuns: 1,
+				},
+			},
+		},
+		AgentRuns: []*v1alpha1.AgentRun{agentRun},
+	}
+
+	ctx := context.Background()
+	if err := r.Reconcile(ctx, agentRun); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if agentRun.Status.Phase != v1alpha1.AgentRunPhaseQueued {
+		t.Errorf("Phase = %v, want Queued", agentRun.Status.Phase)
+	}
+	if agentRun.HasStarted() {
+		t.Error("StartTime should not be set while queued")
+	}
+
+	// Free the slot and the run is admitted
+	if err := kubeClient.CoreV1().Pods("default").Delete(ctx, "busy-agent", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("Failed to delete pod: %v", err)
+	}
+	if err := r.Reconcile(ctx, agentRun); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if agentRun.Status.Phase != v1alpha1.AgentRunPhaseActing {
+		t.Errorf("Phase = %v, want Acting", agentRun.Status.Phase)
+	}
+	if !agentRun.HasStarted() {
+		t.Error("StartTime should be set once admitted")
+	}
+}
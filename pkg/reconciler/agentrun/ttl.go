@@ -0,0 +1,40 @@
+package agentrun
+
+import (
+	"time"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+)
+
+// TTLSecondsAfterFinished returns the effective TTL of an AgentRun. The AgentRun's
+// own setting takes precedence over the AgentConfig default. agentConfig may be nil.
+func TTLSecondsAfterFinished(agentRun *v1alpha1.AgentRun, agentConfig *v1alpha1.AgentConfig) *int32 {
+	if agentRun.Spec.TTLSecondsAfterFinished != nil {
+		return agentRun.Spec.TTLSecondsAfterFinished
+	}
+	if agentConfig != nil {
+		return agentConfig.Spec.TTLSecondsAfterFinished
+	}
+	return nil
+}
+
+// ExpiresAt returns the time at which a finished AgentRun should be deleted.
+// It returns false if the AgentRun has not finished or has no TTL.
+func ExpiresAt(agentRun *v1alpha1.AgentRun, agentConfig *v1alpha1.AgentConfig) (time.Time, bool) {
+	if !agentRun.IsDone() || agentRun.Status.CompletionTime == nil {
+		return time.Time{}, false
+	}
+
+	ttl := TTLSecondsAfterFinished(agentRun, agentConfig)
+	if ttl == nil {
+		return time.Time{}, false
+	}
+
+	return agentRun.Status.CompletionTime.Add(time.Duration(*ttl) * time.Second), true
+}
+
+// IsExpired returns true if a finished AgentRun has outlived its TTL
+func IsExpired(agentRun *v1alpha1.AgentRun, agentConfig *v1alpha1.AgentConfig, now time.Time) bool {
+	expiresAt, ok := ExpiresAt(agentRun, agentConfig)
+	return ok && !now.Before(expiresAt)
+}
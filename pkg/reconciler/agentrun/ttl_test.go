@@ -0,0 +1,112 @@
+package agentrun
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func TestIsExpired(t *testing.T) {
+	now := time.Now()
+	finishedAt := &metav1.Time{Time: now.Add(-10 * time.Minute)}
+
+	tests := []struct {
+		name        string
+		phase       string
+		completion  *metav1.Time
+		runTTL      *int32
+		configTTL   *int32
+		nilConfig   bool
+		wantExpired bool
+	}{
+		{
+			name:        "no ttl keeps run forever",
+			phase:       v1alpha1.AgentRunPhaseSucceeded,
+			completion:  finishedAt,
+			wantExpired: false,
+		},
+		{
+			name:        "run ttl elapsed",
+			phase:       v1alpha1.AgentRunPhaseSucceeded,
+			completion:  finishedAt,
+			runTTL:      int32Ptr(60),
+			wantExpired: true,
+		},
+		{
+			name:        "run ttl not yet elapsed",
+			phase:       v1alpha1.AgentRunPhaseFailed,
+			completion:  finishedAt,
+			runTTL:      int32Ptr(3600),
+			wantExpired: false,
+		},
+		{
+			name:        "config default applies",
+			phase:       v1alpha1.AgentRunPhaseSucceeded,
+			completion:  finishedAt,
+			configTTL:   int32Ptr(60),
+			wantExpired: true,
+		},
+		{
+			name:        "run ttl overrides config default",
+			phase:       v1alpha1.AgentRunPhaseSucceeded,
+			completion:  finishedAt,
+			runTTL:      int32Ptr(3600),
+			configTTL:   int32Ptr(60),
+			wantExpired: false,
+		},
+		{
+			name:        "zero ttl deletes immediately",
+			phase:       v1alpha1.AgentRunPhaseSucceeded,
+			completion:  &metav1.Time{Time: now},
+			runTTL:      int32Ptr(0),
+			wantExpired: true,
+		},
+		{
+			name:        "running run is never expired",
+			phase:       v1alpha1.AgentRunPhaseActing,
+			runTTL:      int32Ptr(0),
+			wantExpired: false,
+		},
+		{
+			name:        "missing config uses run ttl",
+			phase:       v1alpha1.AgentRunPhaseSucceeded,
+			completion:  finishedAt,
+			runTTL:      int32Ptr(60),
+			nilConfig:   true,
+			wantExpired: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agentRun := &v1alpha1.AgentRun{
+				Spec: v1alpha1.AgentRunSpec{
+					TTLSecondsAfterFinished: tt.runTTL,
+				},
+				Status: v1alpha1.AgentRunStatus{
+					Phase:          tt.phase,
+					CompletionTime: tt.completion,
+				},
+			}
+
+			var agentConfig *v1alpha1.AgentConfig
+			if !tt.nilConfig {
+				agentConfig = &v1alpha1.AgentConfig{
+					Spec: v1alpha1.AgentConfigSpec{
+						TTLSecondsAfterFinished: tt.configTTL,
+					},
+				}
+			}
+
+			if got := IsExpired(agentRun, agentConfig, now); got != tt.wantExpired {
+				t.Errorf("IsExpired() = %v, want %v", got, tt.wantExpired)
+			}
+		})
+	}
+}
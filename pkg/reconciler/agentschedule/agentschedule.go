@@ -0,0 +1,245 @@
+package agentschedule
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ScheduledAtAnnotationKey records the scheduled time an AgentRun was created for
+const ScheduledAtAnnotationKey = "agent.tekton.dev/scheduled-at"
+
+// maxMissedSchedules caps the walk over missed schedule times, as CronJob does. A
+// schedule that missed more jumps to the most recent time.
+const maxMissedSchedules = 100
+
+// Condition types and reasons
+const (
+	AgentScheduleConditionReady = "Ready"
+
+	AgentScheduleReasonScheduled       = "Scheduled"
+	AgentScheduleReasonSuspended       = "Suspended"
+	AgentScheduleReasonInvalidSchedule = "InvalidSchedule"
+	AgentScheduleReasonSkipped         = "Skipped"
+)
+
+// Reconciler reconciles AgentSchedule objects
+type Reconciler struct {
+	AgentRuns *client.AgentRuns
+
+	// Now returns the current time; defaults to time.Now
+	Now func() time.Time
+}
+
+// Reconcile creates AgentRuns for due schedule times and prunes finished runs
+func (r *Reconciler) Reconcile(ctx context.Context, schedule *v1alpha1.AgentSchedule) error {
+	schedule.SetDefaults(ctx)
+	now := r.now()
+
+	// Collect the AgentRuns created by this schedule
+	runs, err := r.AgentRuns.List(ctx, schedule.Namespace, fmt.Sprintf("%s=%s", v1alpha1.AgentScheduleLabelKey, schedule.Name))
+	if err != nil {
+		return fmt.Errorf("failed to list AgentRuns: %w", err)
+	}
+
+	var active, succeeded, failed []*v1alpha1.AgentRun
+	for _, run := range runs {
+		if !metav1.IsControlledBy(run, schedule) {
+			continue
+		}
+		switch run.Status.Phase {
+		case v1alpha1.AgentRunPhaseSucceeded:
+			succeeded = append(succeeded, run)
+			if run.Status.CompletionTime != nil && (schedule.Status.LastSuccessfulTime == nil || schedule.Status.LastSuccessfulTime.Before(run.Status.CompletionTime)) {
+				schedule.Status.LastSuccessfulTime = run.Status.CompletionTime.DeepCopy()
+			}
+		case v1alpha1.AgentRunPhaseFailed:
+			failed = append(failed, run)
+		default:
+			active = append(active, run)
+		}
+	}
+
+	schedule.Status.Active = nil
+	for _, run := range active {
+		schedule.Status.Active = append(schedule.Status.Active, run.Name)
+	}
+
+	// Prune finished runs beyond the history limits
+	if err := r.pruneHistory(ctx, succeeded, *schedule.Spec.SuccessfulRunsHistoryLimit); err != nil {
+		return err
+	}
+	if err := r.pruneHistory(ctx, failed, *schedule.Spec.FailedRunsHistoryLimit); err != nil {
+		return err
+	}
+
+	if schedule.Spec.Suspend {
+		setReady(schedule, metav1.ConditionFalse, AgentScheduleReasonSuspended, "Schedule is suspended")
+		return nil
+	}
+
+	sched, err := cron.ParseStandard(schedule.Spec.CronSpec())
+	if err != nil {
+		setReady(schedule, metav1.ConditionFalse, AgentScheduleReasonInvalidSchedule, err.Error())
+		return nil
+	}
+
+	scheduledTime, tooMany := mostRecentScheduleTime(sched, lastScheduleTime(schedule), now)
+	if scheduledTime.IsZero() {
+		setReady(schedule, metav1.ConditionTrue, AgentScheduleReasonScheduled,
+			fmt.Sprintf("Next run at %s", sched.Next(now).UTC().Format(time.RFC3339)))
+		return nil
+	}
+
+	switch schedule.Spec.ConcurrencyPolicy {
+	case v1alpha1.ConcurrencyPolicyForbid:
+		if len(active) > 0 {
+			schedule.Status.LastScheduleTime = &metav1.Time{Time: scheduledTime}
+			setReady(schedule, metav1.ConditionTrue, AgentScheduleReasonSkipped,
+				missedNote(tooMany)+fmt.Sprintf("Skipped run at %s: %d AgentRun(s) still active", scheduledTime.UTC().Format(time.RFC3339), len(active)))
+			return nil
+		}
+	case v1alpha1.ConcurrencyPolicyReplace:
+		for _, run := range active {
+			if run.IsCancelled() {
+				continue
+			}
+			if err := r.AgentRuns.Cancel(ctx, run.Namespace, run.Name); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to cancel AgentRun %s: %w", run.Name, err)
+			}
+		}
+	}
+
+	agentRun := buildAgentRun(schedule, scheduledTime)
+	if _, err := r.AgentRuns.Create(ctx, agentRun); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create AgentRun: %w", err)
+	}
+
+	schedule.Status.LastScheduleTime = &metav1.Time{Time: scheduledTime}
+	schedule.Status.Active = append(schedule.Status.Active, agentRun.Name)
+	setReady(schedule, metav1.ConditionTrue, AgentScheduleReasonScheduled,
+		missedNote(tooMany)+fmt.Sprintf("Created AgentRun %s; next run at %s", agentRun.Name, sched.Next(now).UTC().Format(time.RFC3339)))
+	return nil
+}
+
+// missedNote tells that the schedule missed more times than were walked
+func missedNote(tooMany bool) string {
+	if !tooMany {
+		return ""
+	}
+	return fmt.Sprintf("Missed more than %d schedule times, skipped to the most recent one. ", maxMissedSchedules)
+}
+
+// pruneHistory deletes the oldest finished runs so that at most limit remain
+func (r *Reconciler) pruneHistory(ctx context.Context, runs []*v1alpha1.AgentRun, limit int32) error {
+	if len(runs) <= int(limit) {
+		return nil
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].CreationTimestamp.Before(&runs[j].CreationTimestamp)
+	})
+
+	for _, run := range runs[:len(runs)-int(limit)] {
+		if err := r.AgentRuns.Delete(ctx, run.Namespace, run.Name); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete AgentRun %s: %w", run.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *Reconciler) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// buildAgentRun stamps out an AgentRun from the schedule's template. The name is
+// derived from the scheduled time so that repeated reconciles are idempotent.
+func buildAgentRun(schedule *v1alpha1.AgentSchedule, scheduledTime time.Time) *v1alpha1.AgentRun {
+	labels := map[string]string{}
+	for k, v := range schedule.Spec.Template.Labels {
+		labels[k] = v
+	}
+	labels[v1alpha1.AgentScheduleLabelKey] = schedule.Name
+
+	annotations := map[string]string{}
+	for k, v := range schedule.Spec.Template.Annotations {
+		annotations[k] = v
+	}
+	annotations[ScheduledAtAnnotationKey] = scheduledTime.UTC().Format(time.RFC3339)
+
+	return &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-%d", schedule.Name, scheduledTime.Unix()/60),
+			Namespace:   schedule.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(schedule, v1alpha1.SchemeGroupVersion.WithKind("AgentSchedule")),
+			},
+		},
+		Spec: *schedule.Spec.Template.Spec.DeepCopy(),
+	}
+}
+
+// lastScheduleTime returns the time from which missed schedules are searched
+func lastScheduleTime(schedule *v1alpha1.AgentSchedule) time.Time {
+	if schedule.Status.LastScheduleTime != nil {
+		return schedule.Status.LastScheduleTime.Time
+	}
+	return schedule.CreationTimestamp.Time
+}
+
+// mostRecentScheduleTime returns the latest schedule time in (earliest, now], or
+// the zero time if none is due. Only the most recent missed time is run. After
+// maxMissedSchedules times it stops walking and searches back from now instead,
+// returning true.
+func mostRecentScheduleTime(sched cron.Schedule, earliest, now time.Time) (time.Time, bool) {
+	var mostRecent time.Time
+	missed := 0
+	for t := sched.Next(earliest); !t.IsZero() && !t.After(now); t = sched.Next(t) {
+		mostRecent = t
+		if missed++; missed > maxMissedSchedules {
+			return latestScheduleTime(sched, mostRecent, now), true
+		}
+	}
+	return mostRecent, false
+}
+
+// latestScheduleTime returns the latest schedule time in [after, now], where after is
+// a schedule time. It walks from ever earlier points before now, doubling the
+// distance, so only the times close to the most recent one are visited.
+func latestScheduleTime(sched cron.Schedule, after, now time.Time) time.Time {
+	for step := time.Minute; ; step *= 2 {
+		from := now.Add(-step)
+		if !from.After(after) {
+			from = after
+		}
+		latest := after
+		for t := sched.Next(from); !t.IsZero() && !t.After(now); t = sched.Next(t) {
+			latest = t
+		}
+		if latest.After(after) || from.Equal(after) {
+			return latest
+		}
+	}
+}
+
+func setReady(schedule *v1alpha1.AgentSchedule, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&schedule.Status.Conditions, metav1.Condition{
+		Type:    AgentScheduleConditionReady,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
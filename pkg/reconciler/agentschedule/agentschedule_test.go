@@ -0,0 +1,333 @@
+package agentschedule
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newSchedule(policy v1alpha1.ConcurrencyPolicy, created time.Time) *v1alpha1.AgentSchedule {
+	return &v1alpha1.AgentSchedule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "nightly",
+			Namespace:         "default",
+			UID:               "schedule-uid",
+			CreationTimestamp: metav1.Time{Time: created},
+		},
+		Spec: v1alpha1.AgentScheduleSpec{
+			Schedule:          "0 9 * * *",
+			ConcurrencyPolicy: policy,
+			Template: v1alpha1.AgentRunTemplateSpec{
+				Labels: map[string]string{"team": "ci"},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Goal:      "Summarize failed PipelineRuns",
+					Context:   v1alpha1.AgentContext{Hints: []string{"Look at the last 24h"}},
+				},
+			},
+		},
+	}
+}
+
+func scheduledRun(schedule *v1alpha1.AgentSchedule, name, phase string, created time.Time) *v1alpha1.AgentRun {
+	return &v1alpha1.AgentRun{
+		TypeMeta: metav1.TypeMeta{APIVersion: "agent.tekton.dev/v1alpha1", Kind: "AgentRun"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			CreationTimestamp: metav1.Time{Time: created},
+			Labels:            map[string]string{v1alpha1.AgentScheduleLabelKey: schedule.Name},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(schedule, v1alpha1.SchemeGroupVersion.WithKind("AgentSchedule")),
+			},
+		},
+		Spec: schedule.Spec.Template.Spec,
+		Status: v1alpha1.AgentRunStatus{
+			Phase: phase,
+		},
+	}
+}
+
+func newReconciler(t *testing.T, now time.Time, agentRuns ...*v1alpha1.AgentRun) *Reconciler {
+	t.Helper()
+	// The fake dynamic client only round-trips unstructured objects when the
+	// scheme does not know the typed kinds
+	objs := make([]runtime.Object, 0, len(agentRuns))
+	for _, ar := range agentRuns {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(ar)
+		if err != nil {
+			t.Fatalf("Failed to convert AgentRun: %v", err)
+		}
+		objs = append(objs, &unstructured.Unstructured{Object: obj})
+	}
+	return &Reconciler{
+		AgentRuns: &client.AgentRuns{
+			Dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), client.ListKinds, objs...),
+		},
+		Now: func() time.Time { return now },
+	}
+}
+
+func TestReconcile_CreatesAgentRunWhenDue(t *testing.T) {
+	created := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 1, 1, 9, 0, 30, 0, time.UTC)
+	schedule := newSchedule(v1alpha1.ConcurrencyPolicyAllow, created)
+
+	r := newReconciler(t, now)
+	ctx := context.Background()
+
+	if err := r.Reconcile(ctx, schedule); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	runs, err := r.AgentRuns.List(ctx, "default", "")
+	if err != nil {
+		t.Fatalf("Failed to list AgentRuns: %v", err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("AgentRun count = %d, want 1", len(runs))
+	}
+
+	run := runs[0]
+	if run.Spec.Goal != "Summarize failed PipelineRuns" || run.Spec.ConfigRef.Name != "test-config" {
+		t.Errorf("AgentRun spec = %+v, want template spec", run.Spec)
+	}
+	if run.Labels["team"] != "ci" || run.Labels[v1alpha1.AgentScheduleLabelKey] != "nightly" {
+		t.Errorf("AgentRun labels = %v", run.Labels)
+	}
+	if !metav1.IsControlledBy(run, schedule) {
+		t.Error("AgentRun should be controlled by the AgentSchedule")
+	}
+
+	wantScheduled := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	if schedule.Status.LastScheduleTime == nil || !schedule.Status.LastScheduleTime.Time.Equal(wantScheduled) {
+		t.Errorf("LastScheduleTime = %v, want %v", schedule.Status.LastScheduleTime, wantScheduled)
+	}
+
+	// A second reconcile within the same minute is a no-op
+	if err := r.Reconcile(ctx, schedule); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	runs, _ = r.AgentRuns.List(ctx, "default", "")
+	if len(runs) != 1 {
+		t.Errorf("AgentRun count = %d after second reconcile, want 1", len(runs))
+	}
+}
+
+func TestReconcile_NotDue(t *testing.T) {
+	created := time.Date(2026, 1, 1, 9, 30, 0, 0, time.UTC)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	schedule := newSchedule(v1alpha1.ConcurrencyPolicyAllow, created)
+
+	r := newReconciler(t, now)
+	ctx := context.Background()
+
+	if err := r.Reconcile(ctx, schedule); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	runs, _ := r.AgentRuns.List(ctx, "default", "")
+	if len(runs) != 0 {
+		t.Errorf("AgentRun count = %d, want 0", len(runs))
+	}
+}
+
+func TestReconcile_Suspended(t *testing.T) {
+	created := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 1, 1, 9, 0, 30, 0, time.UTC)
+	schedule := newSchedule(v1alpha1.ConcurrencyPolicyAllow, created)
+	schedule.Spec.Suspend = true
+
+	r := newReconciler(t, now)
+	ctx := context.Background()
+
+	if err := r.Reconcile(ctx, schedule); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	runs, _ := r.AgentRuns.List(ctx, "default", "")
+	if len(runs) != 0 {
+		t.Errorf("AgentRun count = %d, want 0", len(runs))
+	}
+
+	cond := meta.FindStatusCondition(schedule.Status.Conditions, AgentScheduleConditionReady)
+	if cond == nil || cond.Reason != AgentScheduleReasonSuspended {
+		t.Errorf("Ready condition = %+v, want reason %s", cond, AgentScheduleReasonSuspended)
+	}
+}
+
+func TestReconcile_TooManyMissed(t *testing.T) {
+	created := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 1, 1, 9, 0, 30, 0, time.UTC)
+	schedule := newSchedule(v1alpha1.ConcurrencyPolicyAllow, created)
+	schedule.Spec.Schedule = "* * * * *"
+
+	r := newReconciler(t, now)
+	if err := r.Reconcile(context.Background(), schedule); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	wantScheduled := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	if schedule.Status.LastScheduleTime == nil || !schedule.Status.LastScheduleTime.Time.Equal(wantScheduled) {
+		t.Errorf("LastScheduleTime = %v, want %v", schedule.Status.LastScheduleTime, wantScheduled)
+	}
+	cond := meta.FindStatusCondition(schedule.Status.Conditions, AgentScheduleConditionReady)
+	if cond == nil || !strings.HasPrefix(cond.Message, "Missed more than 100 schedule times") {
+		t.Errorf("Ready condition = %+v, want the missed times noted", cond)
+	}
+}
+
+func TestMostRecentScheduleTime(t *testing.T) {
+	now := time.Date(2026, 1, 4, 12, 0, 0, 0, time.UTC) // a Sunday
+
+	tests := []struct {
+		name        string
+		schedule    string
+		earliest    time.Time
+		want        time.Time
+		wantTooMany bool
+	}{
+		{
+			name:     "few missed",
+			schedule: "0 * * * *",
+			earliest: now.Add(-5 * time.Hour),
+			want:     time.Date(2026, 1, 4, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "every minute for a year",
+			schedule:    "* * * * *",
+			earliest:    now.AddDate(-1, 0, 0),
+			want:        now,
+			wantTooMany: true,
+		},
+		{
+			name:        "weekdays only",
+			schedule:    "30 9 * * 1-5",
+			earliest:    now.AddDate(-1, 0, 0),
+			want:        time.Date(2026, 1, 2, 9, 30, 0, 0, time.UTC),
+			wantTooMany: true,
+		},
+		{
+			name:     "none due",
+			schedule: "0 9 * * *",
+			earliest: time.Date(2026, 1, 4, 10, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched, err := cron.ParseStandard(tt.schedule)
+			if err != nil {
+				t.Fatalf("ParseStandard() error = %v", err)
+			}
+			got, tooMany := mostRecentScheduleTime(sched, tt.earliest, now)
+			if !got.Equal(tt.want) || tooMany != tt.wantTooMany {
+				t.Errorf("mostRecentScheduleTime() = %v, %v, want %v, %v", got, tooMany, tt.want, tt.wantTooMany)
+			}
+		})
+	}
+}
+
+func TestReconcile_ConcurrencyPolicy(t *testing.T) {
+	created := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 1, 2, 9, 0, 30, 0, time.UTC)
+	lastSchedule := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		policy        v1alpha1.ConcurrencyPolicy
+		wantRuns      int
+		wantCancelled bool
+	}{
+		{name: "allow starts a concurrent run", policy: v1alpha1.ConcurrencyPolicyAllow, wantRuns: 2},
+		{name: "forbid skips while active", policy: v1alpha1.ConcurrencyPolicyForbid, wantRuns: 1},
+		{name: "replace cancels the active run", policy: v1alpha1.ConcurrencyPolicyReplace, wantRuns: 2, wantCancelled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := newSchedule(tt.policy, created)
+			schedule.Status.LastScheduleTime = &metav1.Time{Time: lastSchedule}
+			previous := scheduledRun(schedule, "nightly-previous", v1alpha1.AgentRunPhaseActing, lastSchedule)
+
+			r := newReconciler(t, now, previous)
+			ctx := context.Background()
+
+			if err := r.Reconcile(ctx, schedule); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			runs, _ := r.AgentRuns.List(ctx, "default", "")
+			if len(runs) != tt.wantRuns {
+				t.Errorf("AgentRun count = %d, want %d", len(runs), tt.wantRuns)
+			}
+
+			got, err := r.AgentRuns.Get(ctx, "default", "nightly-previous")
+			if err != nil {
+				t.Fatalf("Failed to get previous AgentRun: %v", err)
+			}
+			if got.IsCancelled() != tt.wantCancelled {
+				t.Errorf("previous AgentRun cancelled = %v, want %v", got.IsCancelled(), tt.wantCancelled)
+			}
+
+			if !schedule.Status.LastScheduleTime.Time.Equal(time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)) {
+				t.Errorf("LastScheduleTime = %v, want the 2026-01-02 run", schedule.Status.LastScheduleTime)
+			}
+		})
+	}
+}
+
+func TestReconcile_HistoryLimits(t *testing.T) {
+	created := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	schedule := newSchedule(v1alpha1.ConcurrencyPolicyAllow, created)
+	schedule.Status.LastScheduleTime = &metav1.Time{Time: time.Date(2026, 1, 10, 9, 0, 0, 0, time.UTC)}
+	one := int32(1)
+	schedule.Spec.SuccessfulRunsHistoryLimit = &one
+	schedule.Spec.FailedRunsHistoryLimit = &one
+
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 9, 0, 0, 0, time.UTC) }
+	r := newReconciler(t, now,
+		scheduledRun(schedule, "succeeded-old", v1alpha1.AgentRunPhaseSucceeded, day(2)),
+		scheduledRun(schedule, "succeeded-new", v1alpha1.AgentRunPhaseSucceeded, day(3)),
+		scheduledRun(schedule, "failed-old", v1alpha1.AgentRunPhaseFailed, day(4)),
+		scheduledRun(schedule, "failed-new", v1alpha1.AgentRunPhaseFailed, day(5)),
+		scheduledRun(schedule, "active", v1alpha1.AgentRunPhaseActing, day(6)),
+	)
+	ctx := context.Background()
+
+	if err := r.Reconcile(ctx, schedule); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	runs, _ := r.AgentRuns.List(ctx, "default", "")
+	remaining := map[string]bool{}
+	for _, run := range runs {
+		remaining[run.Name] = true
+	}
+
+	for _, name := range []string{"succeeded-new", "failed-new", "active"} {
+		if !remaining[name] {
+			t.Errorf("AgentRun %s should be kept", name)
+		}
+	}
+	for _, name := range []string{"succeeded-old", "failed-old"} {
+		if remaining[name] {
+			t.Errorf("AgentRun %s should be pruned", name)
+		}
+	}
+
+	if len(schedule.Status.Active) != 1 || schedule.Status.Active[0] != "active" {
+		t.Errorf("Active = %v, want [active]", schedule.Status.Active)
+	}
+}
@@ -0,0 +1,218 @@
+package agenttrigger
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types and reasons
+const (
+	AgentTriggerConditionReady = "Ready"
+
+	AgentTriggerReasonWatching        = "Watching"
+	AgentTriggerReasonTriggered       = "Triggered"
+	AgentTriggerReasonSuspended       = "Suspended"
+	AgentTriggerReasonInvalidSelector = "InvalidSelector"
+)
+
+// settleDuration delays triage of fresh failures so that runs completing within the
+// same second are picked up in the same pass before LastFailureTime moves past them
+const settleDuration = 5 * time.Second
+
+// Reconciler reconciles AgentTrigger objects
+type Reconciler struct {
+	AgentRuns    *client.AgentRuns
+	TektonClient tektonclient.Interface
+
+	// Now returns the current time; defaults to time.Now
+	Now func() time.Time
+}
+
+// Reconcile creates AgentRuns for runs that failed since the last reconcile
+func (r *Reconciler) Reconcile(ctx context.Context, trigger *v1alpha1.AgentTrigger) error {
+	trigger.SetDefaults(ctx)
+	now := r.now()
+
+	if trigger.Spec.Suspend {
+		// Skip failures that happen while suspended
+		trigger.Status.LastFailureTime = &metav1.Time{Time: now.Add(-settleDuration)}
+		setReady(trigger, metav1.ConditionFalse, AgentTriggerReasonSuspended, "Trigger is suspended")
+		return nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(trigger.Spec.Selector)
+	if err != nil {
+		setReady(trigger, metav1.ConditionFalse, AgentTriggerReasonInvalidSelector, err.Error())
+		return nil
+	}
+
+	failures, err := r.listFailures(ctx, trigger.Spec.Resource, trigger.Namespace, selector)
+	if err != nil {
+		return err
+	}
+
+	// AgentRuns created by this trigger
+	agentRuns, err := r.AgentRuns.List(ctx, trigger.Namespace, fmt.Sprintf("%s=%s", v1alpha1.AgentTriggerLabelKey, trigger.Name))
+	if err != nil {
+		return fmt.Errorf("failed to list AgentRuns: %w", err)
+	}
+	ownRuns := map[string]bool{}
+	for _, ar := range agentRuns {
+		ownRuns[ar.Name] = true
+	}
+
+	// Only failures in (since, now-settleDuration] are new
+	since := trigger.CreationTimestamp.Time
+	if trigger.Status.LastFailureTime != nil && trigger.Status.LastFailureTime.After(since) {
+		since = trigger.Status.LastFailureTime.Time
+	}
+	until := now.Add(-settleDuration)
+
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].CompletionTime.Before(&failures[j].CompletionTime)
+	})
+
+	for _, f := range failures {
+		if !f.CompletionTime.After(since) || f.CompletionTime.After(until) {
+			continue
+		}
+		// Don't triage failures of runs started by this trigger's own AgentRuns
+		if isCreatedByAgentRun(f, ownRuns) {
+			continue
+		}
+		if err := r.addFailingTaskRun(ctx, &f); err != nil {
+			return err
+		}
+
+		agentRun := buildAgentRun(trigger, f)
+		if _, err := r.AgentRuns.Create(ctx, agentRun); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create AgentRun for %s %s: %w", f.Kind, f.Name, err)
+		}
+
+		trigger.Status.LastFailureTime = f.CompletionTime.DeepCopy()
+		trigger.Status.LastAgentRun = agentRun.Name
+		setReady(trigger, metav1.ConditionTrue, AgentTriggerReasonTriggered,
+			fmt.Sprintf("Created AgentRun %s for failed %s %s", agentRun.Name, f.Kind, f.Name))
+	}
+
+	if cond := meta.FindStatusCondition(trigger.Status.Conditions, AgentTriggerConditionReady); cond == nil || cond.Status != metav1.ConditionTrue {
+		setReady(trigger, metav1.ConditionTrue, AgentTriggerReasonWatching,
+			fmt.Sprintf("Watching %ss matching %q", trigger.Spec.Resource, selector.String()))
+	}
+	return nil
+}
+
+func (r *Reconciler) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// buildAgentRun stamps out an AgentRun for the failure from the trigger's template.
+// The name is derived from the failed run's UID so that repeated reconciles are idempotent.
+func buildAgentRun(trigger *v1alpha1.AgentTrigger, f failure) *v1alpha1.AgentRun {
+	labels := map[string]string{}
+	for k, v := range trigger.Spec.Template.Labels {
+		labels[k] = v
+	}
+	labels[v1alpha1.AgentTriggerLabelKey] = trigger.Name
+
+	annotations := map[string]string{}
+	for k, v := range trigger.Spec.Template.Annotations {
+		annotations[k] = v
+	}
+	annotations[v1alpha1.TriggeredByAnnotationKey] = fmt.Sprintf("%s/%s", f.Kind, f.Name)
+
+	spec := trigger.Spec.Template.Spec.DeepCopy()
+	replacer := failureReplacer(f)
+	spec.Goal = replacer.Replace(spec.Goal)
+	for i, hint := range spec.Context.Hints {
+		spec.Context.Hints[i] = replacer.Replace(hint)
+	}
+	for name, value := range spec.Params {
+		spec.Params[name] = replacer.Replace(value)
+	}
+	spec.Context.Hints = append(spec.Context.Hints, failureHints(f)...)
+	spec.Context.Targets = append(spec.Context.Targets, failureTargets(f)...)
+
+	sum := sha256.Sum256([]byte(f.UID))
+
+	return &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-%s", trigger.Name, hex.EncodeToString(sum[:])[:8]),
+			Namespace:   trigger.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(trigger, v1alpha1.SchemeGroupVersion.WithKind("AgentTrigger")),
+			},
+		},
+		Spec: *spec,
+	}
+}
+
+// failureReplacer substitutes the $(failed.*) variables of the template
+func failureReplacer(f failure) *strings.Replacer {
+	return strings.NewReplacer(
+		"$(failed.kind)", string(f.Kind),
+		"$(failed.name)", f.Name,
+		"$(failed.namespace)", f.Namespace,
+		"$(failed.taskRun)", f.TaskRun,
+		"$(failed.reason)", f.Reason,
+		"$(failed.message)", f.Message,
+	)
+}
+
+// failureHints describes the failure to the agent independently of the template
+func failureHints(f failure) []string {
+	hints := []string{
+		fmt.Sprintf("Failed %s: %s in namespace %s (reason: %s)", f.Kind, f.Name, f.Namespace, f.Reason),
+	}
+	if f.TaskRun != "" && f.Kind != v1alpha1.TriggerResourceTaskRun {
+		hints = append(hints, fmt.Sprintf("Failing TaskRun: %s", f.TaskRun))
+	}
+	if f.PodName != "" {
+		hints = append(hints, fmt.Sprintf("Logs of the failing TaskRun are in pod %s", f.PodName))
+	}
+	if f.Message != "" {
+		hints = append(hints, fmt.Sprintf("Failure message: %s", f.Message))
+	}
+	return hints
+}
+
+// failureTargets references the failed run, its failing TaskRun and pod so the
+// agent starts with their state
+func failureTargets(f failure) []v1alpha1.TargetRef {
+	targets := []v1alpha1.TargetRef{
+		{Kind: v1alpha1.TargetKind(f.Kind), Name: f.Name, Namespace: f.Namespace},
+	}
+	if f.TaskRun != "" && f.Kind != v1alpha1.TriggerResourceTaskRun {
+		targets = append(targets, v1alpha1.TargetRef{Kind: v1alpha1.TargetKindTaskRun, Name: f.TaskRun, Namespace: f.Namespace})
+	}
+	if f.PodName != "" {
+		targets = append(targets, v1alpha1.TargetRef{Kind: v1alpha1.TargetKindPod, Name: f.PodName, Namespace: f.Namespace})
+	}
+	return targets
+}
+
+func setReady(trigger *v1alpha1.AgentTrigger, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&trigger.Status.Conditions, metav1.Condition{
+		Type:    AgentTriggerConditionReady,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
@@ -0,0 +1,330 @@
+package agenttrigger
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	"github.com/waveywaves/agentrun-controller/pkg/tools/tekton"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+var (
+	created = time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	now     = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func newTrigger(resource v1alpha1.TriggerResource) *v1alpha1.AgentTrigger {
+	return &v1alpha1.AgentTrigger{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "triage",
+			Namespace:         "default",
+			UID:               "trigger-uid",
+			CreationTimestamp: metav1.Time{Time: created},
+		},
+		Spec: v1alpha1.AgentTriggerSpec{
+			Resource: resource,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "myapp"}},
+			Template: v1alpha1.AgentRunTemplateSpec{
+				Labels: map[string]string{"team": "ci"},
+				Spec: v1alpha1.AgentRunSpec{
+					ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+					Goal:      "Find the root cause of $(failed.kind) $(failed.namespace)/$(failed.name)",
+					Context:   v1alpha1.AgentContext{Hints: []string{"Start with $(failed.taskRun)"}},
+					Params:    map[string]string{"pipelineRun": "$(failed.name)"},
+				},
+			},
+		},
+	}
+}
+
+func succeededCondition(status corev1.ConditionStatus, reason, message string, at time.Time) duckv1.Status {
+	return duckv1.Status{
+		Conditions: duckv1.Conditions{{
+			Type:               apis.ConditionSucceeded,
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			LastTransitionTime: apis.VolatileTime{Inner: metav1.Time{Time: at}},
+		}},
+	}
+}
+
+func pipelineRun(name string, status corev1.ConditionStatus, reason string, completed time.Time, children ...string) *tektonv1.PipelineRun {
+	pr := &tektonv1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			UID:       types.UID(name + "-uid"),
+			Labels:    map[string]string{"app": "myapp"},
+		},
+	}
+	pr.Status.Status = succeededCondition(status, reason, "Tasks Completed: 2 (Failed: 1)", completed)
+	pr.Status.CompletionTime = &metav1.Time{Time: completed}
+	for _, child := range children {
+		pr.Status.ChildReferences = append(pr.Status.ChildReferences, tektonv1.ChildStatusReference{
+			TypeMeta: runtime.TypeMeta{Kind: "TaskRun"},
+			Name:     child,
+		})
+	}
+	return pr
+}
+
+func taskRun(name string, status corev1.ConditionStatus, reason string, completed time.Time) *tektonv1.TaskRun {
+	tr := &tektonv1.TaskRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			UID:       types.UID(name + "-uid"),
+			Labels:    map[string]string{"app": "myapp"},
+		},
+	}
+	tr.Status.Status = succeededCondition(status, reason, `"step-compile" exited with code 2`, completed)
+	tr.Status.CompletionTime = &metav1.Time{Time: completed}
+	tr.Status.PodName = name + "-pod"
+	return tr
+}
+
+func newReconciler(t *testing.T, tektonObjs []runtime.Object, agentRuns ...*v1alpha1.AgentRun) *Reconciler {
+	t.Helper()
+	objs := make([]runtime.Object, 0, len(agentRuns))
+	for _, ar := range agentRuns {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(ar)
+		if err != nil {
+			t.Fatalf("Failed to convert AgentRun: %v", err)
+		}
+		objs = append(objs, &unstructured.Unstructured{Object: obj})
+	}
+	return &Reconciler{
+		AgentRuns: &client.AgentRuns{
+			Dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), client.ListKinds, objs...),
+		},
+		TektonClient: tektonfake.NewSimpleClientset(tektonObjs...),
+		Now:          func() time.Time { return now },
+	}
+}
+
+func listAgentRuns(t *testing.T, r *Reconciler) []*v1alpha1.AgentRun {
+	t.Helper()
+	runs, err := r.AgentRuns.List(context.Background(), "default", "")
+	if err != nil {
+		t.Fatalf("Failed to list AgentRuns: %v", err)
+	}
+	return runs
+}
+
+func TestReconcile_PipelineRunFailure(t *testing.T) {
+	failedAt := now.Add(-time.Minute)
+	trigger := newTrigger(v1alpha1.TriggerResourcePipelineRun)
+
+	r := newReconciler(t, []runtime.Object{
+		pipelineRun("build-1", corev1.ConditionFalse, "Failed", failedAt, "build-1-fetch", "build-1-compile"),
+		taskRun("build-1-fetch", corev1.ConditionTrue, "Succeeded", failedAt),
+		taskRun("build-1-compile", corev1.ConditionFalse, "Failed", failedAt),
+		pipelineRun("build-2", corev1.ConditionTrue, "Succeeded", failedAt),
+		pipelineRun("build-3", corev1.ConditionFalse, tektonv1.PipelineRunReasonCancelled.String(), failedAt),
+		pipelineRun("build-old", corev1.ConditionFalse, "Failed", created.Add(-time.Hour)),
+	})
+
+	if err := r.Reconcile(context.Background(), trigger); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	runs := listAgentRuns(t, r)
+	if len(runs) != 1 {
+		t.Fatalf("AgentRun count = %d, want 1", len(runs))
+	}
+
+	run := runs[0]
+	if want := "Find the root cause of PipelineRun default/build-1"; run.Spec.Goal != want {
+		t.Errorf("Goal = %q, want %q", run.Spec.Goal, want)
+	}
+	if run.Spec.Context.Hints[0] != "Start with build-1-compile" {
+		t.Errorf("Hints[0] = %q, want the substituted template hint", run.Spec.Context.Hints[0])
+	}
+
+	if run.Spec.Params["pipelineRun"] != "build-1" {
+		t.Errorf("Params = %v, want the substituted template param", run.Spec.Params)
+	}
+
+	hints := strings.Join(run.Spec.Context.Hints, "\n")
+	for _, want := range []string{"Failing TaskRun: build-1-compile", "build-1-compile-pod", `"step-compile" exited with code 2`} {
+		if !strings.Contains(hints, want) {
+			t.Errorf("Hints should contain %q, got:\n%s", want, hints)
+		}
+	}
+
+	wantTargets := []v1alpha1.TargetRef{
+		{Kind: v1alpha1.TargetKindPipelineRun, Name: "build-1", Namespace: "default"},
+		{Kind: v1alpha1.TargetKindTaskRun, Name: "build-1-compile", Namespace: "default"},
+		{Kind: v1alpha1.TargetKindPod, Name: "build-1-compile-pod", Namespace: "default"},
+	}
+	if !reflect.DeepEqual(run.Spec.Context.Targets, wantTargets) {
+		t.Errorf("Targets = %+v, want %+v", run.Spec.Context.Targets, wantTargets)
+	}
+
+	if run.Labels["team"] != "ci" || run.Labels[v1alpha1.AgentTriggerLabelKey] != "triage" {
+		t.Errorf("AgentRun labels = %v", run.Labels)
+	}
+	if run.Annotations[v1alpha1.TriggeredByAnnotationKey] != "PipelineRun/build-1" {
+		t.Errorf("AgentRun annotations = %v", run.Annotations)
+	}
+	if !metav1.IsControlledBy(run, trigger) {
+		t.Error("AgentRun should be controlled by the AgentTrigger")
+	}
+
+	if trigger.Status.LastFailureTime == nil || !trigger.Status.LastFailureTime.Time.Equal(failedAt) {
+		t.Errorf("LastFailureTime = %v, want %v", trigger.Status.LastFailureTime, failedAt)
+	}
+	cond := meta.FindStatusCondition(trigger.Status.Conditions, AgentTriggerConditionReady)
+	if cond == nil || cond.Reason != AgentTriggerReasonTriggered {
+		t.Errorf("Ready condition = %+v, want reason %s", cond, AgentTriggerReasonTriggered)
+	}
+
+	// A second reconcile does not triage the same failure again
+	if err := r.Reconcile(context.Background(), trigger); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if runs := listAgentRuns(t, r); len(runs) != 1 {
+		t.Errorf("AgentRun count = %d after second reconcile, want 1", len(runs))
+	}
+}
+
+func TestReconcile_TaskRunFailure(t *testing.T) {
+	trigger := newTrigger(v1alpha1.TriggerResourceTaskRun)
+
+	r := newReconciler(t, []runtime.Object{
+		taskRun("unit-tests", corev1.ConditionFalse, "Failed", now.Add(-time.Minute)),
+		taskRun("lint", corev1.ConditionFalse, tektonv1.TaskRunReasonCancelled.String(), now.Add(-time.Minute)),
+	})
+
+	if err := r.Reconcile(context.Background(), trigger); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	runs := listAgentRuns(t, r)
+	if len(runs) != 1 {
+		t.Fatalf("AgentRun count = %d, want 1", len(runs))
+	}
+	if want := "Find the root cause of TaskRun default/unit-tests"; runs[0].Spec.Goal != want {
+		t.Errorf("Goal = %q, want %q", runs[0].Spec.Goal, want)
+	}
+}
+
+func TestReconcile_SettleDuration(t *testing.T) {
+	trigger := newTrigger(v1alpha1.TriggerResourcePipelineRun)
+
+	r := newReconciler(t, []runtime.Object{
+		pipelineRun("build-1", corev1.ConditionFalse, "Failed", now.Add(-time.Second)),
+	})
+
+	if err := r.Reconcile(context.Background(), trigger); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if runs := listAgentRuns(t, r); len(runs) != 0 {
+		t.Fatalf("AgentRun count = %d, want 0 before the failure settles", len(runs))
+	}
+
+	r.Now = func() time.Time { return now.Add(settleDuration) }
+	if err := r.Reconcile(context.Background(), trigger); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if runs := listAgentRuns(t, r); len(runs) != 1 {
+		t.Errorf("AgentRun count = %d, want 1 after the failure settles", len(runs))
+	}
+}
+
+func TestReconcile_GetsTaskRunsOnlyForNewFailures(t *testing.T) {
+	trigger := newTrigger(v1alpha1.TriggerResourcePipelineRun)
+	trigger.Status.LastFailureTime = &metav1.Time{Time: now.Add(-time.Hour)}
+
+	r := newReconciler(t, []runtime.Object{
+		pipelineRun("build-old", corev1.ConditionFalse, "Failed", now.Add(-2*time.Hour), "build-old-compile"),
+		taskRun("build-old-compile", corev1.ConditionFalse, "Failed", now.Add(-2*time.Hour)),
+		pipelineRun("build-new", corev1.ConditionFalse, "Failed", now.Add(-time.Minute), "build-new-compile"),
+		taskRun("build-new-compile", corev1.ConditionFalse, "Failed", now.Add(-time.Minute)),
+	})
+
+	if err := r.Reconcile(context.Background(), trigger); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	var gets []string
+	for _, action := range r.TektonClient.(*tektonfake.Clientset).Actions() {
+		if get, ok := action.(k8stesting.GetAction); ok && action.GetResource().Resource == "taskruns" {
+			gets = append(gets, get.GetName())
+		}
+	}
+	if !reflect.DeepEqual(gets, []string{"build-new-compile"}) {
+		t.Errorf("TaskRuns fetched = %v, want only the child of the new failure", gets)
+	}
+}
+
+func TestReconcile_IgnoresOwnAgentRuns(t *testing.T) {
+	trigger := newTrigger(v1alpha1.TriggerResourcePipelineRun)
+
+	ownRun := &v1alpha1.AgentRun{
+		TypeMeta: metav1.TypeMeta{APIVersion: "agent.tekton.dev/v1alpha1", Kind: "AgentRun"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "triage-abc",
+			Namespace: "default",
+			Labels:    map[string]string{v1alpha1.AgentTriggerLabelKey: "triage"},
+		},
+	}
+	agentCreated := pipelineRun("rerun-1", corev1.ConditionFalse, "Failed", now.Add(-time.Minute))
+	agentCreated.Labels[tekton.AgentRunLabelKey] = ownRun.Name
+
+	r := newReconciler(t, []runtime.Object{agentCreated}, ownRun)
+
+	if err := r.Reconcile(context.Background(), trigger); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if runs := listAgentRuns(t, r); len(runs) != 1 {
+		t.Errorf("AgentRun count = %d, want only the existing AgentRun", len(runs))
+	}
+}
+
+func TestReconcile_Suspended(t *testing.T) {
+	trigger := newTrigger(v1alpha1.TriggerResourcePipelineRun)
+	trigger.Spec.Suspend = true
+
+	r := newReconciler(t, []runtime.Object{
+		pipelineRun("build-1", corev1.ConditionFalse, "Failed", now.Add(-time.Minute)),
+	})
+
+	if err := r.Reconcile(context.Background(), trigger); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if runs := listAgentRuns(t, r); len(runs) != 0 {
+		t.Errorf("AgentRun count = %d, want 0", len(runs))
+	}
+
+	cond := meta.FindStatusCondition(trigger.Status.Conditions, AgentTriggerConditionReady)
+	if cond == nil || cond.Reason != AgentTriggerReasonSuspended {
+		t.Errorf("Ready condition = %+v, want reason %s", cond, AgentTriggerReasonSuspended)
+	}
+
+	// Failures that happened while suspended are not triaged after resuming
+	trigger.Spec.Suspend = false
+	if err := r.Reconcile(context.Background(), trigger); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if runs := listAgentRuns(t, r); len(runs) != 0 {
+		t.Errorf("AgentRun count = %d after resuming, want 0", len(runs))
+	}
+}
@@ -0,0 +1,168 @@
+package agenttrigger
+
+import (
+	"context"
+	"fmt"
+
+	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/tools/tekton"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+// failure describes a failed PipelineRun or TaskRun
+type failure struct {
+	Kind           v1alpha1.TriggerResource
+	Name           string
+	Namespace      string
+	UID            types.UID
+	CompletionTime metav1.Time
+	Labels         map[string]string
+
+	// TaskRun is the failing TaskRun; for TaskRun triggers it is the failed run itself
+	TaskRun string
+	// PodName is the pod of the failing TaskRun, for fetching its logs
+	PodName string
+
+	// childTaskRuns are the child TaskRuns of a failed PipelineRun, searched for the
+	// failing one by addFailingTaskRun
+	childTaskRuns []string
+
+	Reason  string
+	Message string
+}
+
+// listFailures returns the failed runs in namespace matching selector
+func (r *Reconciler) listFailures(ctx context.Context, resource v1alpha1.TriggerResource, namespace string, selector labels.Selector) ([]failure, error) {
+	if resource == v1alpha1.TriggerResourceTaskRun {
+		return r.listFailedTaskRuns(ctx, namespace, selector)
+	}
+	return r.listFailedPipelineRuns(ctx, namespace, selector)
+}
+
+func (r *Reconciler) listFailedPipelineRuns(ctx context.Context, namespace string, selector labels.Selector) ([]failure, error) {
+	prs, err := r.TektonClient.TektonV1().PipelineRuns(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PipelineRuns: %w", err)
+	}
+
+	var failures []failure
+	for i := range prs.Items {
+		pr := &prs.Items[i]
+		cond := failedCondition(pr.Status.Status)
+		if cond == nil || cond.Reason == tektonv1.PipelineRunReasonCancelled.String() {
+			continue
+		}
+
+		f := failure{
+			Kind:           v1alpha1.TriggerResourcePipelineRun,
+			Name:           pr.Name,
+			Namespace:      pr.Namespace,
+			UID:            pr.UID,
+			CompletionTime: completionTime(pr.Status.CompletionTime, cond),
+			Labels:         pr.Labels,
+			Reason:         cond.Reason,
+			Message:        cond.Message,
+		}
+		for _, child := range pr.Status.ChildReferences {
+			if child.Kind == "TaskRun" {
+				f.childTaskRuns = append(f.childTaskRuns, child.Name)
+			}
+		}
+
+		failures = append(failures, f)
+	}
+	return failures, nil
+}
+
+func (r *Reconciler) listFailedTaskRuns(ctx context.Context, namespace string, selector labels.Selector) ([]failure, error) {
+	trs, err := r.TektonClient.TektonV1().TaskRuns(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list TaskRuns: %w", err)
+	}
+
+	var failures []failure
+	for i := range trs.Items {
+		tr := &trs.Items[i]
+		cond := failedCondition(tr.Status.Status)
+		if cond == nil || cond.Reason == tektonv1.TaskRunReasonCancelled.String() {
+			continue
+		}
+
+		failures = append(failures, failure{
+			Kind:           v1alpha1.TriggerResourceTaskRun,
+			Name:           tr.Name,
+			Namespace:      tr.Namespace,
+			UID:            tr.UID,
+			CompletionTime: completionTime(tr.Status.CompletionTime, cond),
+			Labels:         tr.Labels,
+			TaskRun:        tr.Name,
+			PodName:        tr.Status.PodName,
+			Reason:         cond.Reason,
+			Message:        cond.Message,
+		})
+	}
+	return failures, nil
+}
+
+// addFailingTaskRun records the first failed child TaskRun of a failed PipelineRun in f.
+// It gets the child TaskRuns, so it is only called for failures that are triaged.
+func (r *Reconciler) addFailingTaskRun(ctx context.Context, f *failure) error {
+	for _, name := range f.childTaskRuns {
+		tr, err := r.TektonClient.TektonV1().TaskRuns(f.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get TaskRun %s: %w", name, err)
+		}
+
+		trCond := failedCondition(tr.Status.Status)
+		if trCond == nil {
+			continue
+		}
+		f.TaskRun = tr.Name
+		f.PodName = tr.Status.PodName
+		// The TaskRun's message usually names the failing step
+		if trCond.Message != "" {
+			f.Message = trCond.Message
+		}
+		return nil
+	}
+	return nil
+}
+
+// isCreatedByAgentRun reports whether the failed run was created by one of the named
+// AgentRuns. TaskRuns inherit the label from their PipelineRun.
+func isCreatedByAgentRun(f failure, agentRuns map[string]bool) bool {
+	name, ok := f.Labels[tekton.AgentRunLabelKey]
+	return ok && agentRuns[name]
+}
+
+// failedCondition returns the Succeeded condition if it is False
+func failedCondition(status duckv1.Status) *apis.Condition {
+	for i := range status.Conditions {
+		cond := &status.Conditions[i]
+		if cond.Type == "Succeeded" && cond.Status == corev1.ConditionFalse {
+			return cond
+		}
+	}
+	return nil
+}
+
+func completionTime(completion *metav1.Time, cond *apis.Condition) metav1.Time {
+	if completion != nil {
+		return *completion
+	}
+	return metav1.Time{Time: cond.LastTransitionTime.Inner.Time}
+}
@@ -0,0 +1,262 @@
+package agentworkflow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types and reasons
+const (
+	AgentWorkflowConditionSucceeded = "Succeeded"
+
+	AgentWorkflowReasonRunning         = "Running"
+	AgentWorkflowReasonSucceeded       = "Succeeded"
+	AgentWorkflowReasonStepFailed      = "StepFailed"
+	AgentWorkflowReasonInvalidWorkflow = "InvalidWorkflow"
+	AgentWorkflowReasonMissingResult   = "MissingResult"
+)
+
+// Reconciler reconciles AgentWorkflow objects
+type Reconciler struct {
+	AgentRuns *client.AgentRuns
+}
+
+// Reconcile creates the AgentRuns of steps whose dependencies have succeeded and
+// records the progress of the workflow
+func (r *Reconciler) Reconcile(ctx context.Context, workflow *v1alpha1.AgentWorkflow) error {
+	workflow.SetDefaults(ctx)
+	if workflow.IsDone() {
+		return nil
+	}
+
+	// Without a webhook an invalid graph is only caught here; a cycle would never finish
+	if err := workflow.Validate(ctx); err != nil {
+		markDone(workflow, v1alpha1.AgentWorkflowPhaseFailed, metav1.ConditionFalse, AgentWorkflowReasonInvalidWorkflow, err.Error())
+		return nil
+	}
+
+	runs, err := r.AgentRuns.List(ctx, workflow.Namespace, fmt.Sprintf("%s=%s", v1alpha1.AgentWorkflowLabelKey, workflow.Name))
+	if err != nil {
+		return fmt.Errorf("failed to list AgentRuns: %w", err)
+	}
+	steps := stepStatuses(workflow, runs)
+
+	if workflow.Status.StartTime == nil {
+		now := metav1.Now()
+		workflow.Status.StartTime = &now
+	}
+	workflow.Status.Phase = v1alpha1.AgentWorkflowPhaseRunning
+
+	// Start the steps that are ready, unless a step has failed
+	if len(failedSteps(workflow, steps)) == 0 {
+		for i := range workflow.Spec.Steps {
+			step := &workflow.Spec.Steps[i]
+			if steps[step.Name] != nil || !dependenciesSucceeded(step, steps) {
+				continue
+			}
+
+			agentRun, err := buildAgentRun(workflow, step, steps)
+			if err != nil {
+				updateSteps(workflow, steps)
+				markDone(workflow, v1alpha1.AgentWorkflowPhaseFailed, metav1.ConditionFalse, AgentWorkflowReasonMissingResult, err.Error())
+				return nil
+			}
+			if _, err := r.AgentRuns.Create(ctx, agentRun); err != nil && !errors.IsAlreadyExists(err) {
+				return fmt.Errorf("failed to create AgentRun for step %s: %w", step.Name, err)
+			}
+			steps[step.Name] = &v1alpha1.WorkflowStepStatus{
+				Name:     step.Name,
+				AgentRun: agentRun.Name,
+				Phase:    v1alpha1.AgentRunPhasePending,
+			}
+		}
+	}
+
+	updateSteps(workflow, steps)
+
+	failed := failedSteps(workflow, steps)
+	active, succeeded := 0, 0
+	for _, status := range steps {
+		switch {
+		case status.Phase == v1alpha1.AgentRunPhaseSucceeded:
+			succeeded++
+		case !stepDone(status):
+			active++
+		}
+	}
+
+	switch {
+	case len(failed) > 0 && active == 0:
+		markDone(workflow, v1alpha1.AgentWorkflowPhaseFailed, metav1.ConditionFalse, AgentWorkflowReasonStepFailed,
+			fmt.Sprintf("Steps failed: %s", strings.Join(failed, ", ")))
+	case len(failed) > 0:
+		setSucceeded(workflow, metav1.ConditionUnknown, AgentWorkflowReasonRunning,
+			fmt.Sprintf("Steps failed: %s; waiting for %d running steps to finish", strings.Join(failed, ", "), active))
+	case succeeded == len(workflow.Spec.Steps):
+		markDone(workflow, v1alpha1.AgentWorkflowPhaseSucceeded, metav1.ConditionTrue, AgentWorkflowReasonSucceeded,
+			fmt.Sprintf("All %d steps succeeded", succeeded))
+	default:
+		setSucceeded(workflow, metav1.ConditionUnknown, AgentWorkflowReasonRunning,
+			fmt.Sprintf("%d of %d steps succeeded", succeeded, len(workflow.Spec.Steps)))
+	}
+	return nil
+}
+
+// stepStatuses returns the status of each started step by name. The live AgentRuns of
+// the workflow take precedence; a finished step keeps its recorded status after its
+// AgentRun is deleted, so it is not started again and its results stay available.
+func stepStatuses(workflow *v1alpha1.AgentWorkflow, runs []*v1alpha1.AgentRun) map[string]*v1alpha1.WorkflowStepStatus {
+	steps := map[string]*v1alpha1.WorkflowStepStatus{}
+	for i := range workflow.Status.Steps {
+		if status := &workflow.Status.Steps[i]; stepDone(status) {
+			steps[status.Name] = status.DeepCopy()
+		}
+	}
+	for _, run := range runs {
+		if !metav1.IsControlledBy(run, workflow) {
+			continue
+		}
+		phase := run.Status.Phase
+		if phase == "" {
+			phase = v1alpha1.AgentRunPhasePending
+		}
+		name := run.Labels[v1alpha1.AgentWorkflowStepLabelKey]
+		steps[name] = &v1alpha1.WorkflowStepStatus{
+			Name:     name,
+			AgentRun: run.Name,
+			Phase:    phase,
+			Results:  run.Status.Results,
+		}
+	}
+	return steps
+}
+
+func stepDone(status *v1alpha1.WorkflowStepStatus) bool {
+	return status.Phase == v1alpha1.AgentRunPhaseSucceeded || status.Phase == v1alpha1.AgentRunPhaseFailed
+}
+
+// buildAgentRun stamps out the AgentRun of a step, substituting the results of earlier steps
+func buildAgentRun(workflow *v1alpha1.AgentWorkflow, step *v1alpha1.WorkflowStep, steps map[string]*v1alpha1.WorkflowStepStatus) (*v1alpha1.AgentRun, error) {
+	labels := map[string]string{}
+	for k, v := range step.Template.Labels {
+		labels[k] = v
+	}
+	labels[v1alpha1.AgentWorkflowLabelKey] = workflow.Name
+	labels[v1alpha1.AgentWorkflowStepLabelKey] = step.Name
+
+	annotations := map[string]string{}
+	for k, v := range step.Template.Annotations {
+		annotations[k] = v
+	}
+
+	spec := step.Template.Spec.DeepCopy()
+	var err error
+	if spec.Goal, err = substituteResults(spec.Goal, steps); err != nil {
+		return nil, fmt.Errorf("step %s: %w", step.Name, err)
+	}
+	for i, hint := range spec.Context.Hints {
+		if spec.Context.Hints[i], err = substituteResults(hint, steps); err != nil {
+			return nil, fmt.Errorf("step %s: %w", step.Name, err)
+		}
+	}
+	for name, value := range spec.Params {
+		if spec.Params[name], err = substituteResults(value, steps); err != nil {
+			return nil, fmt.Errorf("step %s: %w", step.Name, err)
+		}
+	}
+
+	return &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        workflow.StepRunName(step.Name),
+			Namespace:   workflow.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(workflow, v1alpha1.SchemeGroupVersion.WithKind("AgentWorkflow")),
+			},
+		},
+		Spec: *spec,
+	}, nil
+}
+
+// substituteResults replaces the $(steps.<step>.results.<result>) references in s.
+// Values are substituted in a single pass, so references inside results are left alone.
+func substituteResults(s string, steps map[string]*v1alpha1.WorkflowStepStatus) (string, error) {
+	var oldnew []string
+	for _, ref := range v1alpha1.StepResultRefs(s) {
+		value, ok := stepResult(steps[ref.Step], ref.Result)
+		if !ok {
+			return "", fmt.Errorf("%s: step %s has no result %q", ref.Expression, ref.Step, ref.Result)
+		}
+		oldnew = append(oldnew, ref.Expression, value)
+	}
+	if len(oldnew) == 0 {
+		return s, nil
+	}
+	return strings.NewReplacer(oldnew...).Replace(s), nil
+}
+
+func stepResult(status *v1alpha1.WorkflowStepStatus, name string) (string, bool) {
+	if status == nil {
+		return "", false
+	}
+	for _, result := range status.Results {
+		if result.Name == name {
+			return result.Value, true
+		}
+	}
+	return "", false
+}
+
+func dependenciesSucceeded(step *v1alpha1.WorkflowStep, steps map[string]*v1alpha1.WorkflowStepStatus) bool {
+	for _, dep := range step.RunAfter {
+		if status := steps[dep]; status == nil || status.Phase != v1alpha1.AgentRunPhaseSucceeded {
+			return false
+		}
+	}
+	return true
+}
+
+// failedSteps returns the names of the failed steps in spec order
+func failedSteps(workflow *v1alpha1.AgentWorkflow, steps map[string]*v1alpha1.WorkflowStepStatus) []string {
+	var failed []string
+	for _, step := range workflow.Spec.Steps {
+		if status := steps[step.Name]; status != nil && status.Phase == v1alpha1.AgentRunPhaseFailed {
+			failed = append(failed, step.Name)
+		}
+	}
+	return failed
+}
+
+// updateSteps records the status of each started step in spec order
+func updateSteps(workflow *v1alpha1.AgentWorkflow, steps map[string]*v1alpha1.WorkflowStepStatus) {
+	workflow.Status.Steps = nil
+	for _, step := range workflow.Spec.Steps {
+		if status := steps[step.Name]; status != nil {
+			workflow.Status.Steps = append(workflow.Status.Steps, *status)
+		}
+	}
+}
+
+func markDone(workflow *v1alpha1.AgentWorkflow, phase string, status metav1.ConditionStatus, reason, message string) {
+	now := metav1.Now()
+	workflow.Status.Phase = phase
+	workflow.Status.CompletionTime = &now
+	setSucceeded(workflow, status, reason, message)
+}
+
+func setSucceeded(workflow *v1alpha1.AgentWorkflow, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&workflow.Status.Conditions, metav1.Condition{
+		Type:    AgentWorkflowConditionSucceeded,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
@@ -0,0 +1,274 @@
+package agentworkflow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func step(name, goal string, runAfter ...string) v1alpha1.WorkflowStep {
+	return v1alpha1.WorkflowStep{
+		Name:     name,
+		RunAfter: runAfter,
+		Template: v1alpha1.AgentRunTemplateSpec{
+			Labels: map[string]string{"team": "ci"},
+			Spec: v1alpha1.AgentRunSpec{
+				ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+				Goal:      goal,
+			},
+		},
+	}
+}
+
+func newWorkflow(steps ...v1alpha1.WorkflowStep) *v1alpha1.AgentWorkflow {
+	return &v1alpha1.AgentWorkflow{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "fix-build",
+			Namespace: "default",
+			UID:       "workflow-uid",
+		},
+		Spec: v1alpha1.AgentWorkflowSpec{Steps: steps},
+	}
+}
+
+func newReconciler() *Reconciler {
+	return &Reconciler{
+		AgentRuns: &client.AgentRuns{
+			Dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), client.ListKinds),
+		},
+	}
+}
+
+func reconcile(t *testing.T, r *Reconciler, workflow *v1alpha1.AgentWorkflow) {
+	t.Helper()
+	if err := r.Reconcile(context.Background(), workflow); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+}
+
+func agentRunNames(t *testing.T, r *Reconciler) map[string]*v1alpha1.AgentRun {
+	t.Helper()
+	runs, err := r.AgentRuns.List(context.Background(), "default", "")
+	if err != nil {
+		t.Fatalf("Failed to list AgentRuns: %v", err)
+	}
+	byName := map[string]*v1alpha1.AgentRun{}
+	for _, run := range runs {
+		byName[run.Name] = run
+	}
+	return byName
+}
+
+// finish sets the phase and results of an AgentRun created by the workflow
+func finish(t *testing.T, r *Reconciler, name, phase string, results ...v1alpha1.AgentResult) {
+	t.Helper()
+	ctx := context.Background()
+	resource := r.AgentRuns.Dynamic.Resource(client.AgentRunGVR).Namespace("default")
+
+	unstr, err := resource.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get AgentRun %s: %v", name, err)
+	}
+	status, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&v1alpha1.AgentRunStatus{
+		Phase:   phase,
+		Results: results,
+	})
+	if err != nil {
+		t.Fatalf("Failed to convert status: %v", err)
+	}
+	unstr.Object["status"] = status
+	if _, err := resource.UpdateStatus(ctx, unstr, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+}
+
+func condition(workflow *v1alpha1.AgentWorkflow) *metav1.Condition {
+	return meta.FindStatusCondition(workflow.Status.Conditions, AgentWorkflowConditionSucceeded)
+}
+
+func TestReconcile_Succeeds(t *testing.T) {
+	workflow := newWorkflow(
+		step("investigate", "Find why the build fails"),
+		step("fix", "Fix this: $(steps.investigate.results.response)", "investigate"),
+		step("docs", "Document the failure: $(steps.investigate.results.response)", "investigate"),
+		step("validate", "Validate the fix: $(steps.fix.results.response)", "fix", "docs"),
+	)
+	workflow.Spec.Steps[1].Template.Spec.Context.Hints = []string{"Root cause: $(steps.investigate.results.response)"}
+	r := newReconciler()
+
+	// Only the step without dependencies starts
+	reconcile(t, r, workflow)
+	runs := agentRunNames(t, r)
+	if len(runs) != 1 || runs["fix-build-investigate"] == nil {
+		t.Fatalf("AgentRuns = %v, want only fix-build-investigate", runs)
+	}
+	run := runs["fix-build-investigate"]
+	if !metav1.IsControlledBy(run, workflow) {
+		t.Error("AgentRun should be controlled by the AgentWorkflow")
+	}
+	if run.Labels["team"] != "ci" || run.Labels[v1alpha1.AgentWorkflowLabelKey] != "fix-build" || run.Labels[v1alpha1.AgentWorkflowStepLabelKey] != "investigate" {
+		t.Errorf("AgentRun labels = %v", run.Labels)
+	}
+	if workflow.Status.Phase != v1alpha1.AgentWorkflowPhaseRunning || workflow.Status.StartTime == nil {
+		t.Errorf("Phase = %q, StartTime = %v, want Running with a start time", workflow.Status.Phase, workflow.Status.StartTime)
+	}
+	if len(workflow.Status.Steps) != 1 || workflow.Status.Steps[0].Phase != v1alpha1.AgentRunPhasePending {
+		t.Errorf("Status.Steps = %+v", workflow.Status.Steps)
+	}
+
+	// Both dependents start once investigate succeeds, with its response substituted
+	finish(t, r, "fix-build-investigate", v1alpha1.AgentRunPhaseSucceeded,
+		v1alpha1.AgentResult{Name: "response", Value: "the cache volume is full $(steps.fix.results.response)"})
+	reconcile(t, r, workflow)
+	runs = agentRunNames(t, r)
+	if len(runs) != 3 {
+		t.Fatalf("AgentRun count = %d, want 3", len(runs))
+	}
+	fix := runs["fix-build-fix"]
+	if want := "Fix this: the cache volume is full $(steps.fix.results.response)"; fix.Spec.Goal != want {
+		t.Errorf("Goal = %q, want %q", fix.Spec.Goal, want)
+	}
+	if want := "Root cause: the cache volume is full $(steps.fix.results.response)"; fix.Spec.Context.Hints[0] != want {
+		t.Errorf("Hints[0] = %q, want %q", fix.Spec.Context.Hints[0], want)
+	}
+
+	// validate waits for both of its dependencies
+	finish(t, r, "fix-build-fix", v1alpha1.AgentRunPhaseSucceeded, v1alpha1.AgentResult{Name: "response", Value: "pruned the cache"})
+	reconcile(t, r, workflow)
+	if runs := agentRunNames(t, r); runs["fix-build-validate"] != nil {
+		t.Fatal("validate should wait for docs")
+	}
+
+	finish(t, r, "fix-build-docs", v1alpha1.AgentRunPhaseSucceeded, v1alpha1.AgentResult{Name: "response", Value: "done"})
+	reconcile(t, r, workflow)
+	validate := agentRunNames(t, r)["fix-build-validate"]
+	if validate == nil || validate.Spec.Goal != "Validate the fix: pruned the cache" {
+		t.Fatalf("validate AgentRun = %+v", validate)
+	}
+
+	finish(t, r, "fix-build-validate", v1alpha1.AgentRunPhaseSucceeded)
+	reconcile(t, r, workflow)
+	if workflow.Status.Phase != v1alpha1.AgentWorkflowPhaseSucceeded || workflow.Status.CompletionTime == nil {
+		t.Errorf("Phase = %q, want %q", workflow.Status.Phase, v1alpha1.AgentWorkflowPhaseSucceeded)
+	}
+	if cond := condition(workflow); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Errorf("Succeeded condition = %+v, want True", cond)
+	}
+	if len(workflow.Status.Steps) != 4 {
+		t.Errorf("Status.Steps = %+v, want 4 steps", workflow.Status.Steps)
+	}
+}
+
+func TestReconcile_StepFailed(t *testing.T) {
+	workflow := newWorkflow(
+		step("investigate", "Find why the build fails"),
+		step("lint", "Find lint errors"),
+		step("fix", "Fix this: $(steps.investigate.results.response)", "investigate"),
+	)
+	r := newReconciler()
+
+	reconcile(t, r, workflow)
+	finish(t, r, "fix-build-investigate", v1alpha1.AgentRunPhaseFailed)
+
+	// The workflow waits for the running step and starts nothing new
+	reconcile(t, r, workflow)
+	if runs := agentRunNames(t, r); len(runs) != 2 {
+		t.Fatalf("AgentRun count = %d, want 2", len(runs))
+	}
+	if workflow.IsDone() {
+		t.Fatal("workflow should wait for lint to finish")
+	}
+
+	finish(t, r, "fix-build-lint", v1alpha1.AgentRunPhaseSucceeded)
+	reconcile(t, r, workflow)
+	if workflow.Status.Phase != v1alpha1.AgentWorkflowPhaseFailed {
+		t.Errorf("Phase = %q, want %q", workflow.Status.Phase, v1alpha1.AgentWorkflowPhaseFailed)
+	}
+	if cond := condition(workflow); cond == nil || cond.Reason != AgentWorkflowReasonStepFailed {
+		t.Errorf("Succeeded condition = %+v, want reason %s", cond, AgentWorkflowReasonStepFailed)
+	}
+}
+
+func TestReconcile_StepRunDeletedAfterSuccess(t *testing.T) {
+	workflow := newWorkflow(
+		step("investigate", "Find why the build fails"),
+		step("fix", "Fix the build", "investigate"),
+		step("validate", "Validate the fix for: $(steps.investigate.results.response)", "fix"),
+	)
+	r := newReconciler()
+
+	reconcile(t, r, workflow)
+	finish(t, r, "fix-build-investigate", v1alpha1.AgentRunPhaseSucceeded, v1alpha1.AgentResult{Name: "response", Value: "the cache volume is full"})
+	reconcile(t, r, workflow)
+
+	// The TTL collector deletes the finished step while the workflow is still running
+	if err := r.AgentRuns.Dynamic.Resource(client.AgentRunGVR).Namespace("default").Delete(context.Background(), "fix-build-investigate", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	reconcile(t, r, workflow)
+	if runs := agentRunNames(t, r); runs["fix-build-investigate"] != nil {
+		t.Fatal("succeeded step should not be started again")
+	}
+
+	// Its results are still substituted into later steps
+	finish(t, r, "fix-build-fix", v1alpha1.AgentRunPhaseSucceeded)
+	reconcile(t, r, workflow)
+	validate := agentRunNames(t, r)["fix-build-validate"]
+	if validate == nil || validate.Spec.Goal != "Validate the fix for: the cache volume is full" {
+		t.Fatalf("validate AgentRun = %+v", validate)
+	}
+
+	finish(t, r, "fix-build-validate", v1alpha1.AgentRunPhaseSucceeded)
+	reconcile(t, r, workflow)
+	if workflow.Status.Phase != v1alpha1.AgentWorkflowPhaseSucceeded {
+		t.Errorf("Phase = %q, want %q", workflow.Status.Phase, v1alpha1.AgentWorkflowPhaseSucceeded)
+	}
+	if len(workflow.Status.Steps) != 3 || workflow.Status.Steps[0].Phase != v1alpha1.AgentRunPhaseSucceeded {
+		t.Errorf("Status.Steps = %+v", workflow.Status.Steps)
+	}
+}
+
+func TestReconcile_MissingResult(t *testing.T) {
+	workflow := newWorkflow(
+		step("investigate", "Find why the build fails"),
+		step("fix", "Fix this: $(steps.investigate.results.root-cause)", "investigate"),
+	)
+	r := newReconciler()
+
+	reconcile(t, r, workflow)
+	finish(t, r, "fix-build-investigate", v1alpha1.AgentRunPhaseSucceeded, v1alpha1.AgentResult{Name: "response", Value: "done"})
+	reconcile(t, r, workflow)
+
+	if workflow.Status.Phase != v1alpha1.AgentWorkflowPhaseFailed {
+		t.Errorf("Phase = %q, want %q", workflow.Status.Phase, v1alpha1.AgentWorkflowPhaseFailed)
+	}
+	if cond := condition(workflow); cond == nil || cond.Reason != AgentWorkflowReasonMissingResult {
+		t.Errorf("Succeeded condition = %+v, want reason %s", cond, AgentWorkflowReasonMissingResult)
+	}
+	if runs := agentRunNames(t, r); runs["fix-build-fix"] != nil {
+		t.Error("fix should not be created without the result")
+	}
+}
+
+func TestReconcile_InvalidWorkflow(t *testing.T) {
+	workflow := newWorkflow(
+		step("investigate", "Find why the build fails", "fix"),
+		step("fix", "Fix the build", "investigate"),
+	)
+	r := newReconciler()
+
+	reconcile(t, r, workflow)
+
+	if cond := condition(workflow); cond == nil || cond.Reason != AgentWorkflowReasonInvalidWorkflow {
+		t.Errorf("Succeeded condition = %+v, want reason %s", cond, AgentWorkflowReasonInvalidWorkflow)
+	}
+	if runs := agentRunNames(t, r); len(runs) != 0 {
+		t.Errorf("AgentRun count = %d, want 0", len(runs))
+	}
+}
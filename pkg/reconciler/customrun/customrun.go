@@ -0,0 +1,242 @@
+package customrun
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	tektonv1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Params of a CustomRun that map onto the AgentRun spec. Every param can also be
+// referenced from the goal and hints as $(params.<name>).
+const (
+	GoalParam  = "goal"
+	HintsParam = "hints"
+)
+
+// CustomRunLabelKey is set on AgentRuns created for a CustomRun
+const CustomRunLabelKey = "tekton.dev/customRun"
+
+// CustomRun condition reasons besides the ones defined by Tekton
+const (
+	ReasonInvalidSpec     = "InvalidAgentRunSpec"
+	ReasonAgentRunExists  = "AgentRunAlreadyExists"
+	ReasonAgentRunRunning = "Running"
+)
+
+// Reconciler runs AgentRuns for CustomRuns that reference kind AgentRun
+type Reconciler struct {
+	AgentRuns *client.AgentRuns
+
+	// Now returns the current time; defaults to time.Now
+	Now func() time.Time
+}
+
+// IsAgentRunCustomRun reports whether the CustomRun references an AgentRun
+func IsAgentRunCustomRun(cr *tektonv1beta1.CustomRun) bool {
+	var apiVersion, kind string
+	switch {
+	case cr.Spec.CustomRef != nil:
+		apiVersion, kind = cr.Spec.CustomRef.APIVersion, string(cr.Spec.CustomRef.Kind)
+	case cr.Spec.CustomSpec != nil:
+		apiVersion, kind = cr.Spec.CustomSpec.APIVersion, cr.Spec.CustomSpec.Kind
+	}
+	return apiVersion == v1alpha1.SchemeGroupVersion.String() && kind == "AgentRun"
+}
+
+// Reconcile creates the AgentRun for the CustomRun and mirrors its status
+func (r *Reconciler) Reconcile(ctx context.Context, cr *tektonv1beta1.CustomRun) error {
+	if !IsAgentRunCustomRun(cr) || cr.IsDone() {
+		return nil
+	}
+
+	if !cr.HasStarted() {
+		cr.Status.StartTime = &metav1.Time{Time: r.now()}
+		cr.Status.InitializeConditions()
+	}
+
+	agentRun, err := r.AgentRuns.Get(ctx, cr.Namespace, cr.Name)
+	if errors.IsNotFound(err) {
+		return r.createAgentRun(ctx, cr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get AgentRun: %w", err)
+	}
+
+	if !metav1.IsControlledBy(agentRun, cr) {
+		cr.Status.MarkCustomRunFailed(ReasonAgentRunExists, "AgentRun %s already exists and is not owned by this CustomRun", agentRun.Name)
+		return nil
+	}
+
+	if cr.IsCancelled() {
+		if err := r.cancel(ctx, agentRun); err != nil {
+			return err
+		}
+		message := string(cr.Spec.StatusMessage)
+		if message == "" {
+			message = "CustomRun was cancelled"
+		}
+		cr.Status.MarkCustomRunFailed(tektonv1beta1.CustomRunReasonCancelled.String(), "%s", message)
+		return nil
+	}
+
+	if r.hasTimedOut(cr) {
+		if err := r.cancel(ctx, agentRun); err != nil {
+			return err
+		}
+		cr.Status.MarkCustomRunFailed(tektonv1beta1.CustomRunReasonTimedOut.String(), "CustomRun timed out after %s", cr.GetTimeout())
+		return nil
+	}
+
+	switch agentRun.Status.Phase {
+	case v1alpha1.AgentRunPhaseSucceeded:
+		cr.Status.Results = nil
+		for _, result := range agentRun.Status.Results {
+			cr.Status.Results = append(cr.Status.Results, tektonv1beta1.CustomRunResult{
+				Name:  result.Name,
+				Value: result.Value,
+			})
+		}
+		cr.Status.MarkCustomRunSucceeded(tektonv1beta1.CustomRunReasonSuccessful.String(), "AgentRun %s succeeded", agentRun.Name)
+
+	case v1alpha1.AgentRunPhaseFailed:
+		reason, message := tektonv1beta1.CustomRunReasonFailed.String(), fmt.Sprintf("AgentRun %s failed", agentRun.Name)
+		if cond := meta.FindStatusCondition(agentRun.Status.Conditions, v1alpha1.AgentRunConditionSucceeded); cond != nil {
+			reason, message = cond.Reason, cond.Message
+		}
+		cr.Status.MarkCustomRunFailed(reason, "%s", message)
+
+	default:
+		cr.Status.MarkCustomRunRunning(ReasonAgentRunRunning, "AgentRun %s is %s", agentRun.Name, agentRun.Status.Phase)
+	}
+
+	return nil
+}
+
+func (r *Reconciler) createAgentRun(ctx context.Context, cr *tektonv1beta1.CustomRun) error {
+	if cr.IsCancelled() {
+		cr.Status.MarkCustomRunFailed(tektonv1beta1.CustomRunReasonCancelled.String(), "CustomRun was cancelled before the AgentRun was created")
+		return nil
+	}
+
+	agentRun, err := buildAgentRun(ctx, cr)
+	if err != nil {
+		cr.Status.MarkCustomRunFailed(ReasonInvalidSpec, "%s", err.Error())
+		return nil
+	}
+
+	if _, err := r.AgentRuns.Create(ctx, agentRun); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create AgentRun: %w", err)
+	}
+
+	cr.Status.MarkCustomRunRunning(ReasonAgentRunRunning, "Created AgentRun %s", agentRun.Name)
+	return nil
+}
+
+func (r *Reconciler) cancel(ctx context.Context, agentRun *v1alpha1.AgentRun) error {
+	if agentRun.IsDone() || agentRun.IsCancelled() {
+		return nil
+	}
+	if err := r.AgentRuns.Cancel(ctx, agentRun.Namespace, agentRun.Name); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to cancel AgentRun %s: %w", agentRun.Name, err)
+	}
+	return nil
+}
+
+// hasTimedOut mirrors CustomRun.HasTimedOut using the reconciler's clock
+func (r *Reconciler) hasTimedOut(cr *tektonv1beta1.CustomRun) bool {
+	if cr.Status.StartTime == nil || cr.Status.StartTime.IsZero() {
+		return false
+	}
+	timeout := cr.GetTimeout()
+	return timeout > 0 && r.now().Sub(cr.Status.StartTime.Time) > timeout
+}
+
+func (r *Reconciler) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// buildAgentRun builds the AgentRun for the CustomRun. The spec comes from the embedded
+// customSpec, or from the AgentConfig named by customRef; params set the goal and hints.
+func buildAgentRun(ctx context.Context, cr *tektonv1beta1.CustomRun) (*v1alpha1.AgentRun, error) {
+	var spec v1alpha1.AgentRunSpec
+	if cr.Spec.CustomSpec != nil && len(cr.Spec.CustomSpec.Spec.Raw) > 0 {
+		if err := json.Unmarshal(cr.Spec.CustomSpec.Spec.Raw, &spec); err != nil {
+			return nil, fmt.Errorf("failed to parse customSpec: %w", err)
+		}
+	}
+	if cr.Spec.CustomRef != nil && cr.Spec.CustomRef.Name != "" {
+		spec.ConfigRef.Name = cr.Spec.CustomRef.Name
+	}
+
+	if p := cr.Spec.GetParam(GoalParam); p != nil {
+		spec.Goal = p.Value.StringVal
+	}
+	if p := cr.Spec.GetParam(HintsParam); p != nil {
+		if p.Value.Type == tektonv1beta1.ParamTypeArray {
+			spec.Context.Hints = append(spec.Context.Hints, p.Value.ArrayVal...)
+		} else if p.Value.StringVal != "" {
+			spec.Context.Hints = append(spec.Context.Hints, p.Value.StringVal)
+		}
+	}
+
+	replacer := paramReplacer(cr.Spec.Params)
+	spec.Goal = replacer.Replace(spec.Goal)
+	for i, hint := range spec.Context.Hints {
+		spec.Context.Hints[i] = replacer.Replace(hint)
+	}
+
+	if cr.Spec.Retries > 0 {
+		spec.Retries = int32(cr.Spec.Retries)
+	}
+
+	// Cancellation is driven by the CustomRun
+	spec.Status = ""
+
+	spec.SetDefaults(ctx)
+	if err := spec.Validate(ctx); err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{}
+	for k, v := range cr.Labels {
+		labels[k] = v
+	}
+	labels[CustomRunLabelKey] = cr.Name
+
+	return &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cr.Name,
+			Namespace: cr.Namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(cr, tektonv1beta1.SchemeGroupVersion.WithKind("CustomRun")),
+			},
+		},
+		Spec: spec,
+	}, nil
+}
+
+// paramReplacer substitutes $(params.<name>) references with string param values
+func paramReplacer(params tektonv1beta1.Params) *strings.Replacer {
+	var oldnew []string
+	for _, p := range params {
+		value := p.Value.StringVal
+		if p.Value.Type == tektonv1beta1.ParamTypeArray {
+			value = strings.Join(p.Value.ArrayVal, ", ")
+		}
+		oldnew = append(oldnew, fmt.Sprintf("$(params.%s)", p.Name), value)
+	}
+	return strings.NewReplacer(oldnew...)
+}
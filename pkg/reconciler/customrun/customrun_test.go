@@ -0,0 +1,325 @@
+package customrun
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	tektonv1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"knative.dev/pkg/apis"
+)
+
+var now = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newCustomRun() *tektonv1beta1.CustomRun {
+	return &tektonv1beta1.CustomRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "release-verify",
+			Namespace: "default",
+			UID:       "customrun-uid",
+			Labels:    map[string]string{"tekton.dev/pipelineRun": "release"},
+		},
+		Spec: tektonv1beta1.CustomRunSpec{
+			CustomRef: &tektonv1beta1.TaskRef{
+				APIVersion: "agent.tekton.dev/v1alpha1",
+				Kind:       "AgentRun",
+				Name:       "test-config",
+			},
+			Params: tektonv1beta1.Params{
+				{Name: "goal", Value: *tektonv1beta1.NewStructuredValues("Verify the $(params.version) release")},
+				{Name: "hints", Value: *tektonv1beta1.NewStructuredValues("Check the changelog", "Check the image tags")},
+				{Name: "version", Value: *tektonv1beta1.NewStructuredValues("v1.2.3")},
+			},
+		},
+	}
+}
+
+// ownedAgentRun returns the AgentRun the reconciler would have created for cr
+func ownedAgentRun(cr *tektonv1beta1.CustomRun, phase string) *v1alpha1.AgentRun {
+	return &v1alpha1.AgentRun{
+		TypeMeta: metav1.TypeMeta{APIVersion: "agent.tekton.dev/v1alpha1", Kind: "AgentRun"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cr.Name,
+			Namespace: cr.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(cr, tektonv1beta1.SchemeGroupVersion.WithKind("CustomRun")),
+			},
+		},
+		Spec: v1alpha1.AgentRunSpec{
+			ConfigRef: v1alpha1.ConfigRef{Name: "test-config"},
+			Goal:      "Verify the v1.2.3 release",
+		},
+		Status: v1alpha1.AgentRunStatus{
+			Phase: phase,
+		},
+	}
+}
+
+func newReconciler(t *testing.T, agentRuns ...*v1alpha1.AgentRun) *Reconciler {
+	t.Helper()
+	objs := make([]runtime.Object, 0, len(agentRuns))
+	for _, ar := range agentRuns {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(ar)
+		if err != nil {
+			t.Fatalf("Failed to convert AgentRun: %v", err)
+		}
+		objs = append(objs, &unstructured.Unstructured{Object: obj})
+	}
+	return &Reconciler{
+		AgentRuns: &client.AgentRuns{
+			Dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), client.ListKinds, objs...),
+		},
+		Now: func() time.Time { return now },
+	}
+}
+
+func succeeded(cr *tektonv1beta1.CustomRun) *apis.Condition {
+	return cr.Status.GetCondition(apis.ConditionSucceeded)
+}
+
+func TestReconcile_CreatesAgentRun(t *testing.T) {
+	cr := newCustomRun()
+	cr.Spec.Retries = 2
+	r := newReconciler(t)
+	ctx := context.Background()
+
+	if err := r.Reconcile(ctx, cr); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	agentRun, err := r.AgentRuns.Get(ctx, "default", "release-verify")
+	if err != nil {
+		t.Fatalf("AgentRun should be created: %v", err)
+	}
+
+	if agentRun.Spec.ConfigRef.Name != "test-config" {
+		t.Errorf("ConfigRef = %q, want test-config", agentRun.Spec.ConfigRef.Name)
+	}
+	if agentRun.Spec.Goal != "Verify the v1.2.3 release" {
+		t.Errorf("Goal = %q, want params substituted", agentRun.Spec.Goal)
+	}
+	if want := []string{"Check the changelog", "Check the image tags"}; !reflect.DeepEqual(agentRun.Spec.Context.Hints, want) {
+		t.Errorf("Hints = %v, want %v", agentRun.Spec.Context.Hints, want)
+	}
+	if agentRun.Spec.Retries != 2 {
+		t.Errorf("Retries = %d, want 2", agentRun.Spec.Retries)
+	}
+	if agentRun.Labels[CustomRunLabelKey] != "release-verify" || agentRun.Labels["tekton.dev/pipelineRun"] != "release" {
+		t.Errorf("Labels = %v", agentRun.Labels)
+	}
+	if !metav1.IsControlledBy(agentRun, cr) {
+		t.Error("AgentRun should be controlled by the CustomRun")
+	}
+
+	if cr.Status.StartTime == nil || !cr.Status.StartTime.Time.Equal(now) {
+		t.Errorf("StartTime = %v, want %v", cr.Status.StartTime, now)
+	}
+	if cond := succeeded(cr); cond == nil || cond.Status != corev1.ConditionUnknown || cond.Reason != ReasonAgentRunRunning {
+		t.Errorf("Succeeded condition = %+v, want Unknown/%s", cond, ReasonAgentRunRunning)
+	}
+}
+
+func TestReconcile_CustomSpec(t *testing.T) {
+	cr := newCustomRun()
+	cr.Spec.CustomRef = nil
+	cr.Spec.CustomSpec = &tektonv1beta1.EmbeddedCustomRunSpec{
+		TypeMeta: runtime.TypeMeta{APIVersion: "agent.tekton.dev/v1alpha1", Kind: "AgentRun"},
+		Spec: runtime.RawExtension{
+			Raw: []byte(`{"configRef":{"name":"embedded-config"},"goal":"overridden","context":{"hints":["From the spec"]}}`),
+		},
+	}
+	r := newReconciler(t)
+	ctx := context.Background()
+
+	if err := r.Reconcile(ctx, cr); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	agentRun, err := r.AgentRuns.Get(ctx, "default", "release-verify")
+	if err != nil {
+		t.Fatalf("AgentRun should be created: %v", err)
+	}
+	if agentRun.Spec.ConfigRef.Name != "embedded-config" {
+		t.Errorf("ConfigRef = %q, want embedded-config", agentRun.Spec.ConfigRef.Name)
+	}
+	if agentRun.Spec.Goal != "Verify the v1.2.3 release" {
+		t.Errorf("Goal = %q, want the goal param", agentRun.Spec.Goal)
+	}
+	if want := []string{"From the spec", "Check the changelog", "Check the image tags"}; !reflect.DeepEqual(agentRun.Spec.Context.Hints, want) {
+		t.Errorf("Hints = %v, want %v", agentRun.Spec.Context.Hints, want)
+	}
+}
+
+func TestReconcile_InvalidSpec(t *testing.T) {
+	cr := newCustomRun()
+	cr.Spec.Params = nil
+	r := newReconciler(t)
+
+	if err := r.Reconcile(context.Background(), cr); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if cond := succeeded(cr); cond == nil || cond.Status != corev1.ConditionFalse || cond.Reason != ReasonInvalidSpec {
+		t.Errorf("Succeeded condition = %+v, want False/%s", cond, ReasonInvalidSpec)
+	}
+}
+
+func TestReconcile_AgentRunStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		agentRun    func(*v1alpha1.AgentRun)
+		wantStatus  corev1.ConditionStatus
+		wantReason  string
+		wantResults []tektonv1beta1.CustomRunResult
+	}{
+		{
+			name:       "running",
+			agentRun:   func(ar *v1alpha1.AgentRun) { ar.Status.Phase = v1alpha1.AgentRunPhaseActing },
+			wantStatus: corev1.ConditionUnknown,
+			wantReason: ReasonAgentRunRunning,
+		},
+		{
+			name: "succeeded with results",
+			agentRun: func(ar *v1alpha1.AgentRun) {
+				ar.Status.MarkSucceeded(v1alpha1.AgentRunReasonSucceeded, "done")
+				ar.Status.Results = []v1alpha1.AgentResult{{Name: "response", Value: "Release looks good"}}
+			},
+			wantStatus:  corev1.ConditionTrue,
+			wantReason:  tektonv1beta1.CustomRunReasonSuccessful.String(),
+			wantResults: []tektonv1beta1.CustomRunResult{{Name: "response", Value: "Release looks good"}},
+		},
+		{
+			name: "failed",
+			agentRun: func(ar *v1alpha1.AgentRun) {
+				ar.Status.MarkFailed(v1alpha1.AgentRunReasonMaxIterations, "Goal not achieved within 10 iterations")
+			},
+			wantStatus: corev1.ConditionFalse,
+			wantReason: v1alpha1.AgentRunReasonMaxIterations,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := newCustomRun()
+			cr.Status.StartTime = &metav1.Time{Time: now.Add(-time.Minute)}
+			cr.Status.InitializeConditions()
+
+			agentRun := ownedAgentRun(cr, "")
+			tt.agentRun(agentRun)
+			r := newReconciler(t, agentRun)
+
+			if err := r.Reconcile(context.Background(), cr); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			cond := succeeded(cr)
+			if cond == nil || cond.Status != tt.wantStatus || cond.Reason != tt.wantReason {
+				t.Errorf("Succeeded condition = %+v, want %s/%s", cond, tt.wantStatus, tt.wantReason)
+			}
+			if !reflect.DeepEqual(cr.Status.Results, tt.wantResults) {
+				t.Errorf("Results = %+v, want %+v", cr.Status.Results, tt.wantResults)
+			}
+		})
+	}
+}
+
+func TestReconcile_CancelAndTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		customRun  func(*tektonv1beta1.CustomRun)
+		wantReason string
+	}{
+		{
+			name: "cancelled",
+			customRun: func(cr *tektonv1beta1.CustomRun) {
+				cr.Spec.Status = tektonv1beta1.CustomRunSpecStatusCancelled
+				cr.Spec.StatusMessage = tektonv1beta1.CustomRunCancelledByPipelineMsg
+			},
+			wantReason: tektonv1beta1.CustomRunReasonCancelled.String(),
+		},
+		{
+			name: "timed out",
+			customRun: func(cr *tektonv1beta1.CustomRun) {
+				cr.Spec.Timeout = &metav1.Duration{Duration: 30 * time.Second}
+			},
+			wantReason: tektonv1beta1.CustomRunReasonTimedOut.String(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := newCustomRun()
+			cr.Status.StartTime = &metav1.Time{Time: now.Add(-time.Minute)}
+			cr.Status.InitializeConditions()
+			tt.customRun(cr)
+
+			r := newReconciler(t, ownedAgentRun(cr, v1alpha1.AgentRunPhaseActing))
+			ctx := context.Background()
+
+			if err := r.Reconcile(ctx, cr); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			cond := succeeded(cr)
+			if cond == nil || cond.Status != corev1.ConditionFalse || cond.Reason != tt.wantReason {
+				t.Errorf("Succeeded condition = %+v, want False/%s", cond, tt.wantReason)
+			}
+
+			agentRun, err := r.AgentRuns.Get(ctx, "default", "release-verify")
+			if err != nil {
+				t.Fatalf("Failed to get AgentRun: %v", err)
+			}
+			if !agentRun.IsCancelled() {
+				t.Error("AgentRun should be cancelled")
+			}
+		})
+	}
+}
+
+func TestReconcile_NotOwned(t *testing.T) {
+	cr := newCustomRun()
+	cr.Status.StartTime = &metav1.Time{Time: now}
+	cr.Status.InitializeConditions()
+
+	other := ownedAgentRun(cr, v1alpha1.AgentRunPhaseActing)
+	other.OwnerReferences = nil
+	r := newReconciler(t, other)
+
+	if err := r.Reconcile(context.Background(), cr); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if cond := succeeded(cr); cond == nil || cond.Reason != ReasonAgentRunExists {
+		t.Errorf("Succeeded condition = %+v, want reason %s", cond, ReasonAgentRunExists)
+	}
+}
+
+func TestIsAgentRunCustomRun(t *testing.T) {
+	other := newCustomRun()
+	other.Spec.CustomRef.APIVersion = "example.dev/v1"
+	other.Spec.CustomRef.Kind = "Wait"
+
+	if !IsAgentRunCustomRun(newCustomRun()) {
+		t.Error("IsAgentRunCustomRun() = false for an AgentRun ref")
+	}
+	if IsAgentRunCustomRun(other) {
+		t.Error("IsAgentRunCustomRun() = true for another custom task")
+	}
+
+	// Other custom tasks are left alone
+	r := newReconciler(t)
+	if err := r.Reconcile(context.Background(), other); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if other.HasStarted() {
+		t.Error("Reconcile() should not touch CustomRuns of other custom tasks")
+	}
+}
@@ -50,6 +50,51 @@ func GenerateRole(agentRun *v1alpha1.AgentRun) *rbacv1.Role {
 	return role
 }
 
+// GenerateApprovalRule lets the agent request approval of tool calls by creating
+// AgentApprovals. Decisions live in the status subresource, which the agent cannot write.
+func GenerateApprovalRule() rbacv1.PolicyRule {
+	return rbacv1.PolicyRule{
+		APIGroups: []string{v1alpha1.SchemeGroupVersion.Group},
+		Resources: []string{"agentapprovals"},
+		Verbs:     []string{"get", "create"},
+	}
+}
+
+// GenerateDelegationRule lets the agent create child AgentRuns and wait for their results.
+// The controller checks each child against the delegation limits of the parent's AgentConfig.
+func GenerateDelegationRule() rbacv1.PolicyRule {
+	return rbacv1.PolicyRule{
+		APIGroups: []string{v1alpha1.SchemeGroupVersion.Group},
+		Resources: []string{"agentruns"},
+		Verbs:     []string{"get", "create"},
+	}
+}
+
+// DelegatorResource is the subresource of AgentRuns that marks the ServiceAccounts of
+// delegating agents. Nothing serves it; the delegation admission policy checks it to
+// require the AgentRuns those agents create to be labelled with and owned by their parent.
+const DelegatorResource = "agentruns/delegate"
+
+// GenerateDelegatorRule marks the agent as a delegating agent for the delegation admission policy
+func GenerateDelegatorRule() rbacv1.PolicyRule {
+	return rbacv1.PolicyRule{
+		APIGroups: []string{v1alpha1.SchemeGroupVersion.Group},
+		Resources: []string{DelegatorResource},
+		Verbs:     []string{"create"},
+	}
+}
+
+// GenerateTranscriptRule lets the agent save its transcript to the named ConfigMap,
+// which the controller creates, without access to any other ConfigMap
+func GenerateTranscriptRule(configMapName string) rbacv1.PolicyRule {
+	return rbacv1.PolicyRule{
+		APIGroups:     []string{""},
+		Resources:     []string{"configmaps"},
+		ResourceNames: []string{configMapName},
+		Verbs:         []string{"get", "update"},
+	}
+}
+
 // GenerateRoleBinding creates a RoleBinding linking the Role to the ServiceAccount
 func GenerateRoleBinding(agentRun *v1alpha1.AgentRun, agentConfig *v1alpha1.AgentConfig, roleName string) *rbacv1.RoleBinding {
 	roleBindingName := GenerateRoleBindingName(agentRun)
@@ -173,3 +173,68 @@ func TestGenerateRoleName(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateApprovalRule(t *testing.T) {
+	rule := GenerateApprovalRule()
+
+	if len(rule.Resources) != 1 || rule.Resources[0] != "agentapprovals" {
+		t.Errorf("Resources = %v, want [agentapprovals]", rule.Resources)
+	}
+
+	// The agent must never be able to record its own decision
+	for _, verb := range rule.Verbs {
+		if verb != "get" && verb != "create" {
+			t.Errorf("unexpected verb %q", verb)
+		}
+	}
+	for _, resource := range rule.Resources {
+		if resource == "agentapprovals/status" {
+			t.Error("agent must not have access to agentapprovals/status")
+		}
+	}
+}
+
+func TestGenerateTranscriptRule(t *testing.T) {
+	rule := GenerateTranscriptRule("test-run-transcript")
+
+	if len(rule.Resources) != 1 || rule.Resources[0] != "configmaps" {
+		t.Errorf("Resources = %v, want [configmaps]", rule.Resources)
+	}
+
+	// The agent may only touch its own transcript
+	if len(rule.ResourceNames) != 1 || rule.ResourceNames[0] != "test-run-transcript" {
+		t.Errorf("ResourceNames = %v, want [test-run-transcript]", rule.ResourceNames)
+	}
+	for _, verb := range rule.Verbs {
+		if verb != "get" && verb != "update" {
+			t.Errorf("unexpected verb %q", verb)
+		}
+	}
+}
+
+func TestGenerateDelegationRule(t *testing.T) {
+	rule := GenerateDelegationRule()
+
+	if len(rule.Resources) != 1 || rule.Resources[0] != "agentruns" {
+		t.Errorf("Resources = %v, want [agentruns]", rule.Resources)
+	}
+
+	// Children are created and watched, never modified or deleted
+	for _, verb := range rule.Verbs {
+		if verb != "get" && verb != "create" {
+			t.Errorf("unexpected verb %q", verb)
+		}
+	}
+}
+
+func TestGenerateDelegatorRule(t *testing.T) {
+	rule := GenerateDelegatorRule()
+
+	// The marker grants nothing on AgentRuns themselves
+	if len(rule.Resources) != 1 || rule.Resources[0] != DelegatorResource {
+		t.Errorf("Resources = %v, want [%s]", rule.Resources, DelegatorResource)
+	}
+	if len(rule.Verbs) != 1 || rule.Verbs[0] != "create" {
+		t.Errorf("Verbs = %v, want [create]", rule.Verbs)
+	}
+}
@@ -0,0 +1,265 @@
+// Package targets describes the resources an AgentRun is about, so the agent
+// starts with their state instead of having to look them up first
+package targets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"github.com/waveywaves/agentrun-controller/pkg/agent"
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+// maxDescriptionLength keeps a single target from crowding out the rest of the first message
+const maxDescriptionLength = 4096
+
+// targetResources are the resource types of the target kinds
+var targetResources = map[v1alpha1.TargetKind]string{
+	v1alpha1.TargetKindPipelineRun: "pipelineruns",
+	v1alpha1.TargetKindTaskRun:     "taskruns",
+	v1alpha1.TargetKindPod:         "pods",
+}
+
+// Fetcher fetches the targets of an AgentRun
+type Fetcher struct {
+	KubeClient   kubernetes.Interface
+	TektonClient tektonclient.Interface
+
+	// Policy must allow reading each target as a k8s_get_resources call would
+	Policy agent.Policy
+}
+
+// Context renders the hints and targets of an AgentRun as the context of the
+// agent's first message
+func (f *Fetcher) Context(ctx context.Context, agentContext v1alpha1.AgentContext) string {
+	var sections []string
+	if len(agentContext.Hints) > 0 {
+		lines := []string{"Hints:"}
+		for _, hint := range agentContext.Hints {
+			lines = append(lines, "- "+hint)
+		}
+		sections = append(sections, strings.Join(lines, "\n"))
+	}
+	for _, ref := range agentContext.Targets {
+		sections = append(sections, f.Describe(ctx, ref))
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+// Describe returns a description of the target. A target that cannot be fetched
+// is described by the error, since the agent may still get on without it.
+func (f *Fetcher) Describe(ctx context.Context, ref v1alpha1.TargetRef) string {
+	header := fmt.Sprintf("Target %s %s/%s:", ref.Kind, ref.Namespace, ref.Name)
+
+	// Targets are fetched with the agent's ServiceAccount, so they are held to the same policy as its tool calls
+	if err := f.allow(ctx, ref); err != nil {
+		return fmt.Sprintf("%s could not be fetched: %v", header, err)
+	}
+
+	var info interface{}
+	var err error
+	switch ref.Kind {
+	case v1alpha1.TargetKindPipelineRun:
+		info, err = f.pipelineRun(ctx, ref)
+	case v1alpha1.TargetKindTaskRun:
+		info, err = f.taskRun(ctx, ref)
+	case v1alpha1.TargetKindPod:
+		info, err = f.pod(ctx, ref)
+	default:
+		err = fmt.Errorf("unsupported kind %q", ref.Kind)
+	}
+	if err != nil {
+		return fmt.Sprintf("%s could not be fetched: %v", header, err)
+	}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%s could not be described: %v", header, err)
+	}
+	description := string(data)
+	if len(description) > maxDescriptionLength {
+		description = description[:maxDescriptionLength] + "\n[truncated]"
+	}
+	return header + "\n" + description
+}
+
+// allow checks the target against the policy as the equivalent k8s_get_resources call
+func (f *Fetcher) allow(ctx context.Context, ref v1alpha1.TargetRef) error {
+	resourceType, ok := targetResources[ref.Kind]
+	if !ok {
+		return fmt.Errorf("unsupported kind %q", ref.Kind)
+	}
+	if f.Policy == nil {
+		return fmt.Errorf("policy denied: no policy")
+	}
+	return f.Policy.Allow(ctx, agent.ToolCall{
+		Name: "k8s_get_resources",
+		Input: map[string]interface{}{
+			"namespace":    ref.Namespace,
+			"resourceType": resourceType,
+			"name":         ref.Name,
+		},
+	})
+}
+
+type conditionInfo struct {
+	Succeeded string `json:"succeeded"`
+	Reason    string `json:"reason,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+type pipelineRunInfo struct {
+	Pipeline       string          `json:"pipeline,omitempty"`
+	Params         tektonv1.Params `json:"params,omitempty"`
+	Status         conditionInfo   `json:"status"`
+	StartTime      string          `json:"startTime,omitempty"`
+	CompletionTime string          `json:"completionTime,omitempty"`
+	TaskRuns       []childInfo     `json:"taskRuns,omitempty"`
+}
+
+type childInfo struct {
+	Name             string `json:"name"`
+	PipelineTaskName string `json:"pipelineTask"`
+}
+
+type taskRunInfo struct {
+	Task           string          `json:"task,omitempty"`
+	Params         tektonv1.Params `json:"params,omitempty"`
+	Status         conditionInfo   `json:"status"`
+	Pod            string          `json:"pod,omitempty"`
+	Steps          []stepInfo      `json:"steps,omitempty"`
+	StartTime      string          `json:"startTime,omitempty"`
+	CompletionTime string          `json:"completionTime,omitempty"`
+}
+
+type stepInfo struct {
+	Name     string `json:"name"`
+	ExitCode *int32 `json:"exitCode,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type podInfo struct {
+	Phase      string          `json:"phase"`
+	Reason     string          `json:"reason,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Node       string          `json:"node,omitempty"`
+	Containers []containerInfo `json:"containers,omitempty"`
+}
+
+type containerInfo struct {
+	Name     string `json:"name"`
+	Ready    bool   `json:"ready"`
+	Restarts int32  `json:"restarts"`
+	State    string `json:"state"`
+}
+
+func (f *Fetcher) pipelineRun(ctx context.Context, ref v1alpha1.TargetRef) (*pipelineRunInfo, error) {
+	pr, err := f.TektonClient.TektonV1().PipelineRuns(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	info := &pipelineRunInfo{
+		Params:         pr.Spec.Params,
+		Status:         succeededCondition(pr.Status.Status),
+		StartTime:      formatTime(pr.Status.StartTime),
+		CompletionTime: formatTime(pr.Status.CompletionTime),
+	}
+	if pr.Spec.PipelineRef != nil {
+		info.Pipeline = pr.Spec.PipelineRef.Name
+	}
+	for _, child := range pr.Status.ChildReferences {
+		if child.Kind == "TaskRun" {
+			info.TaskRuns = append(info.TaskRuns, childInfo{Name: child.Name, PipelineTaskName: child.PipelineTaskName})
+		}
+	}
+	return info, nil
+}
+
+func (f *Fetcher) taskRun(ctx context.Context, ref v1alpha1.TargetRef) (*taskRunInfo, error) {
+	tr, err := f.TektonClient.TektonV1().TaskRuns(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	info := &taskRunInfo{
+		Params:         tr.Spec.Params,
+		Status:         succeededCondition(tr.Status.Status),
+		Pod:            tr.Status.PodName,
+		StartTime:      formatTime(tr.Status.StartTime),
+		CompletionTime: formatTime(tr.Status.CompletionTime),
+	}
+	if tr.Spec.TaskRef != nil {
+		info.Task = tr.Spec.TaskRef.Name
+	}
+	for _, step := range tr.Status.Steps {
+		s := stepInfo{Name: step.Name}
+		if t := step.Terminated; t != nil {
+			exitCode := t.ExitCode
+			s.ExitCode = &exitCode
+			s.Reason = t.Reason
+		}
+		info.Steps = append(info.Steps, s)
+	}
+	return info, nil
+}
+
+func (f *Fetcher) pod(ctx context.Context, ref v1alpha1.TargetRef) (*podInfo, error) {
+	pod, err := f.KubeClient.CoreV1().Pods(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	info := &podInfo{
+		Phase:   string(pod.Status.Phase),
+		Reason:  pod.Status.Reason,
+		Message: pod.Status.Message,
+		Node:    pod.Spec.NodeName,
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		info.Containers = append(info.Containers, containerInfo{
+			Name:     cs.Name,
+			Ready:    cs.Ready,
+			Restarts: cs.RestartCount,
+			State:    containerState(cs.State),
+		})
+	}
+	return info, nil
+}
+
+func succeededCondition(status duckv1.Status) conditionInfo {
+	for _, cond := range status.Conditions {
+		if cond.Type == "Succeeded" {
+			return conditionInfo{Succeeded: string(cond.Status), Reason: cond.Reason, Message: cond.Message}
+		}
+	}
+	return conditionInfo{Succeeded: string(corev1.ConditionUnknown)}
+}
+
+func containerState(state corev1.ContainerState) string {
+	switch {
+	case state.Waiting != nil:
+		return fmt.Sprintf("waiting (%s)", state.Waiting.Reason)
+	case state.Terminated != nil:
+		return fmt.Sprintf("terminated with exit code %d (%s)", state.Terminated.ExitCode, state.Terminated.Reason)
+	case state.Running != nil:
+		return "running"
+	default:
+		return "unknown"
+	}
+}
+
+func formatTime(t *metav1.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
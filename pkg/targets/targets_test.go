@@ -0,0 +1,167 @@
+package targets
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"github.com/waveywaves/agentrun-controller/pkg/agent"
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+// namespacePolicy allows k8s_get_resources calls in a single namespace
+type namespacePolicy struct {
+	namespace string
+	calls     []agent.ToolCall
+}
+
+func (p *namespacePolicy) Allow(ctx context.Context, toolCall agent.ToolCall) error {
+	p.calls = append(p.calls, toolCall)
+	if toolCall.Name == "k8s_get_resources" && toolCall.Input["namespace"] == p.namespace {
+		return nil
+	}
+	return errors.New("policy denied: allow rule returned false")
+}
+
+func newFetcher() *Fetcher {
+	pr := &tektonv1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "build-1", Namespace: "ci"},
+		Spec: tektonv1.PipelineRunSpec{
+			PipelineRef: &tektonv1.PipelineRef{Name: "build"},
+			Params:      tektonv1.Params{{Name: "image", Value: *tektonv1.NewStructuredValues("myapp:v1")}},
+		},
+		Status: tektonv1.PipelineRunStatus{
+			Status: duckv1.Status{Conditions: duckv1.Conditions{{
+				Type:    apis.ConditionSucceeded,
+				Status:  corev1.ConditionFalse,
+				Reason:  "Failed",
+				Message: "Tasks Completed: 1 (Failed: 1)",
+			}}},
+			PipelineRunStatusFields: tektonv1.PipelineRunStatusFields{
+				ChildReferences: []tektonv1.ChildStatusReference{{
+					TypeMeta:         runtime.TypeMeta{APIVersion: "tekton.dev/v1", Kind: "TaskRun"},
+					Name:             "build-1-compile",
+					PipelineTaskName: "compile",
+				}},
+			},
+		},
+	}
+	tr := &tektonv1.TaskRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "build-1-compile", Namespace: "ci"},
+		Spec:       tektonv1.TaskRunSpec{TaskRef: &tektonv1.TaskRef{Name: "compile"}},
+		Status: tektonv1.TaskRunStatus{
+			TaskRunStatusFields: tektonv1.TaskRunStatusFields{
+				PodName: "build-1-compile-pod",
+				Steps: []tektonv1.StepState{{
+					Name:           "go-build",
+					ContainerState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 2, Reason: "Error"}},
+				}},
+			},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "build-1-compile-pod", Namespace: "ci"},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodFailed,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "step-go-build",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 2, Reason: "Error"}},
+			}},
+		},
+	}
+
+	return &Fetcher{
+		KubeClient:   fake.NewSimpleClientset(pod),
+		TektonClient: tektonfake.NewSimpleClientset(pr, tr),
+		Policy:       &namespacePolicy{namespace: "ci"},
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		name string
+		ref  v1alpha1.TargetRef
+		want []string
+	}{
+		{
+			name: "pipelinerun",
+			ref:  v1alpha1.TargetRef{Kind: v1alpha1.TargetKindPipelineRun, Name: "build-1", Namespace: "ci"},
+			want: []string{"Target PipelineRun ci/build-1:", `"pipeline": "build"`, `"succeeded": "False"`, "Tasks Completed: 1 (Failed: 1)", `"name": "build-1-compile"`, "myapp:v1"},
+		},
+		{
+			name: "taskrun",
+			ref:  v1alpha1.TargetRef{Kind: v1alpha1.TargetKindTaskRun, Name: "build-1-compile", Namespace: "ci"},
+			want: []string{"Target TaskRun ci/build-1-compile:", `"task": "compile"`, `"pod": "build-1-compile-pod"`, `"exitCode": 2`},
+		},
+		{
+			name: "pod",
+			ref:  v1alpha1.TargetRef{Kind: v1alpha1.TargetKindPod, Name: "build-1-compile-pod", Namespace: "ci"},
+			want: []string{"Target Pod ci/build-1-compile-pod:", `"phase": "Failed"`, "terminated with exit code 2 (Error)"},
+		},
+		{
+			name: "missing target",
+			ref:  v1alpha1.TargetRef{Kind: v1alpha1.TargetKindPod, Name: "gone", Namespace: "ci"},
+			want: []string{"Target Pod ci/gone: could not be fetched", "not found"},
+		},
+		{
+			name: "namespace denied by policy",
+			ref:  v1alpha1.TargetRef{Kind: v1alpha1.TargetKindPod, Name: "etcd-0", Namespace: "kube-system"},
+			want: []string{"Target Pod kube-system/etcd-0: could not be fetched: policy denied"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newFetcher().Describe(context.Background(), tt.ref)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("Describe() = %s\nwant it to contain %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDescribe_Policy(t *testing.T) {
+	fetcher := newFetcher()
+	policy := fetcher.Policy.(*namespacePolicy)
+
+	fetcher.Describe(context.Background(), v1alpha1.TargetRef{Kind: v1alpha1.TargetKindTaskRun, Name: "build-1-compile", Namespace: "ci"})
+	if len(policy.calls) != 1 {
+		t.Fatalf("policy checked %d calls, want 1", len(policy.calls))
+	}
+	call := policy.calls[0]
+	if call.Name != "k8s_get_resources" || call.Input["namespace"] != "ci" || call.Input["resourceType"] != "taskruns" || call.Input["name"] != "build-1-compile" {
+		t.Errorf("policy call = %+v, want a get of the TaskRun", call)
+	}
+
+	// Without a policy no target is fetched
+	fetcher.Policy = nil
+	got := fetcher.Describe(context.Background(), v1alpha1.TargetRef{Kind: v1alpha1.TargetKindPod, Name: "build-1-compile-pod", Namespace: "ci"})
+	if !strings.Contains(got, "could not be fetched: policy denied") {
+		t.Errorf("Describe() without a policy = %s", got)
+	}
+}
+
+func TestContext(t *testing.T) {
+	got := newFetcher().Context(context.Background(), v1alpha1.AgentContext{
+		Hints:   []string{"The build runs nightly", "Ignore flaky tests"},
+		Targets: []v1alpha1.TargetRef{{Kind: v1alpha1.TargetKindPipelineRun, Name: "build-1", Namespace: "ci"}},
+	})
+
+	if !strings.HasPrefix(got, "Hints:\n- The build runs nightly\n- Ignore flaky tests\n\nTarget PipelineRun ci/build-1:\n") {
+		t.Errorf("Context() = %s", got)
+	}
+	if got := newFetcher().Context(context.Background(), v1alpha1.AgentContext{}); got != "" {
+		t.Errorf("Context() of an empty context = %q, want empty", got)
+	}
+}
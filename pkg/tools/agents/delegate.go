@@ -0,0 +1,252 @@
+// Package agents provides tools that let an agent work with other AgentRuns
+package agents
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	"github.com/waveywaves/agentrun-controller/pkg/pod"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// defaultPollInterval is how often a child AgentRun is checked for completion
+const defaultPollInterval = 5 * time.Second
+
+// maxNamePrefixLength leaves room for the hash suffix in child AgentRun names
+const maxNamePrefixLength = 63 - 9
+
+// Delegate implements the agent_delegate tool. It creates a child AgentRun owned
+// by the running AgentRun for each goal, waits for them to finish and returns their
+// final responses. Since the tool is mutating, the agent runs one delegation at a
+// time; a delegation of several goals is how it fans out.
+type Delegate struct {
+	AgentRuns    *client.AgentRuns
+	Namespace    string
+	AgentRunName string
+	AgentRunUID  types.UID
+	// PodUID is the UID of the agent's pod, which binds the children to this agent
+	PodUID types.UID
+
+	// AllowedConfigs are the AgentConfigs child AgentRuns may use; the first is the default
+	AllowedConfigs []string
+	// Depth is the delegation depth of the running AgentRun
+	Depth int
+	// MaxDepth limits the delegation depth of child AgentRuns
+	MaxDepth int
+	// MaxChildren limits the number of child AgentRuns this agent creates
+	MaxChildren int
+
+	// DryRun is passed on to child AgentRuns so they change nothing either
+	DryRun bool
+
+	PollInterval time.Duration
+
+	mu       sync.Mutex
+	children int
+}
+
+// Name returns the tool name
+func (d *Delegate) Name() string {
+	return "agent_delegate"
+}
+
+// Mutating returns true since the tool creates AgentRuns that may act on the cluster
+func (d *Delegate) Mutating() bool {
+	return true
+}
+
+// Execute runs the tool
+func (d *Delegate) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
+	goals, err := delegatedGoals(input)
+	if err != nil {
+		return "", err
+	}
+
+	config, _ := input["config"].(string)
+	if config == "" && len(d.AllowedConfigs) > 0 {
+		config = d.AllowedConfigs[0]
+	}
+	if !slices.Contains(d.AllowedConfigs, config) {
+		return "", fmt.Errorf("AgentConfig %q is not allowed for delegation (allowed: %v)", config, d.AllowedConfigs)
+	}
+
+	if d.Depth+1 > d.MaxDepth {
+		return "", fmt.Errorf("delegation depth limit of %d reached", d.MaxDepth)
+	}
+
+	children := make([]*v1alpha1.AgentRun, 0, len(goals))
+	for _, goal := range goals {
+		children = append(children, d.buildChild(config, goal))
+	}
+	if err := d.create(ctx, children); err != nil {
+		return "", err
+	}
+
+	if len(children) == 1 {
+		log.Printf("Delegated to AgentRun %s/%s, waiting for it to finish", children[0].Namespace, children[0].Name)
+		done, err := d.wait(ctx, children[0].Name)
+		if err != nil {
+			return "", err
+		}
+		return childResult(done)
+	}
+
+	// The children run concurrently, so waiting for them in turn takes as long as the slowest
+	log.Printf("Delegated to %d AgentRuns, waiting for them to finish", len(children))
+	outputs := make([]string, 0, len(children))
+	for _, child := range children {
+		done, err := d.wait(ctx, child.Name)
+		if err != nil {
+			return "", err
+		}
+		output, err := childResult(done)
+		if err != nil {
+			output = err.Error()
+		}
+		outputs = append(outputs, output)
+	}
+	return strings.Join(outputs, "\n\n"), nil
+}
+
+// delegatedGoals returns the goals of the input, given either as goal or as goals
+func delegatedGoals(input map[string]interface{}) ([]string, error) {
+	if goal, ok := input["goal"].(string); ok && goal != "" {
+		return []string{goal}, nil
+	}
+
+	list, _ := input["goals"].([]interface{})
+	if len(list) == 0 {
+		return nil, fmt.Errorf("goal is required, or goals to delegate several at once")
+	}
+	goals := make([]string, 0, len(list))
+	for _, g := range list {
+		goal, ok := g.(string)
+		if !ok || goal == "" {
+			return nil, fmt.Errorf("goals must be non-empty strings")
+		}
+		goals = append(goals, goal)
+	}
+	return goals, nil
+}
+
+// create creates the child AgentRuns unless an identical delegation already created
+// them, e.g. before the agent was restarted. No child is created if they would not
+// all fit within the limit.
+func (d *Delegate) create(ctx context.Context, children []*v1alpha1.AgentRun) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.children+len(children) > d.MaxChildren {
+		return fmt.Errorf("limit of %d child AgentRuns reached: %d created, %d more requested", d.MaxChildren, d.children, len(children))
+	}
+
+	for _, child := range children {
+		_, err := d.AgentRuns.Create(ctx, child)
+		if errors.IsAlreadyExists(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create child AgentRun: %w", err)
+		}
+		d.children++
+	}
+	return nil
+}
+
+// wait polls the child AgentRun until it is done or ctx is done
+func (d *Delegate) wait(ctx context.Context, name string) (*v1alpha1.AgentRun, error) {
+	pollInterval := d.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		child, err := d.AgentRuns.Get(ctx, d.Namespace, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get child AgentRun: %w", err)
+		}
+		if child.IsDone() {
+			return child, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Delegate) buildChild(config, goal string) *v1alpha1.AgentRun {
+	child := &v1alpha1.AgentRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ChildName(d.AgentRunName, d.AgentRunUID, config, goal),
+			Namespace: d.Namespace,
+			Labels: map[string]string{
+				pod.ParentAgentRunLabelKey:  d.AgentRunName,
+				pod.DelegationDepthLabelKey: strconv.Itoa(d.Depth + 1),
+				pod.ParentPodUIDLabelKey:    string(d.PodUID),
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+				Kind:       "AgentRun",
+				Name:       d.AgentRunName,
+				UID:        d.AgentRunUID,
+			}},
+		},
+		Spec: v1alpha1.AgentRunSpec{
+			ConfigRef: v1alpha1.ConfigRef{Name: config},
+			Goal:      goal,
+		},
+	}
+	if d.DryRun {
+		dryRun := true
+		child.Spec.DryRun = &dryRun
+	}
+	return child
+}
+
+// childResult returns the final response of a succeeded child AgentRun, or an error
+// describing why it did not succeed
+func childResult(child *v1alpha1.AgentRun) (string, error) {
+	if child.Status.Phase != v1alpha1.AgentRunPhaseSucceeded {
+		reason, message := child.Status.Phase, ""
+		if cond := meta.FindStatusCondition(child.Status.Conditions, v1alpha1.AgentRunConditionSucceeded); cond != nil {
+			reason, message = cond.Reason, cond.Message
+		}
+		return "", fmt.Errorf("child AgentRun %s did not succeed (%s): %s", child.Name, reason, message)
+	}
+
+	response := ""
+	for _, result := range child.Status.Results {
+		if result.Name == "response" {
+			response = result.Value
+		}
+	}
+	return fmt.Sprintf("Child AgentRun %s succeeded. Its final response:\n%s", child.Name, response), nil
+}
+
+// ChildName returns the name of the child AgentRun delegated a goal. The same
+// delegation from the same AgentRun always gets the same name.
+func ChildName(agentRunName string, agentRunUID types.UID, config, goal string) string {
+	sum := sha256.Sum256([]byte(string(agentRunUID) + "/" + config + "/" + goal))
+	if len(agentRunName) > maxNamePrefixLength {
+		agentRunName = agentRunName[:maxNamePrefixLength]
+	}
+	return fmt.Sprintf("%s-%s", agentRunName, hex.EncodeToString(sum[:])[:8])
+}
@@ -0,0 +1,248 @@
+package agents
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waveywaves/agentrun-controller/pkg/apis/agent/v1alpha1"
+	"github.com/waveywaves/agentrun-controller/pkg/client"
+	"github.com/waveywaves/agentrun-controller/pkg/pod"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newDelegate() *Delegate {
+	return &Delegate{
+		AgentRuns: &client.AgentRuns{
+			Dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), client.ListKinds),
+		},
+		Namespace:      "default",
+		AgentRunName:   "coordinator",
+		AgentRunUID:    "uid-1",
+		PodUID:         "pod-uid-1",
+		AllowedConfigs: []string{"investigator", "deployer"},
+		MaxDepth:       1,
+		MaxChildren:    2,
+		PollInterval:   10 * time.Millisecond,
+	}
+}
+
+// finish records the outcome of a child AgentRun as the controller would
+func finish(t *testing.T, ctx context.Context, d *Delegate, name string, status v1alpha1.AgentRunStatus) {
+	t.Helper()
+	resource := d.AgentRuns.Dynamic.Resource(client.AgentRunGVR).Namespace(d.Namespace)
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.Fatal("child AgentRun was not created")
+		case <-time.After(5 * time.Millisecond):
+		}
+
+		unstr, err := resource.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			continue
+		}
+		statusObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+		if err != nil {
+			t.Fatalf("failed to convert status: %v", err)
+		}
+		unstr.Object["status"] = statusObj
+		if _, err := resource.UpdateStatus(ctx, unstr, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("UpdateStatus() error = %v", err)
+		}
+		return
+	}
+}
+
+func TestDelegate_Execute(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     v1alpha1.AgentRunStatus
+		wantOutput string
+		wantErr    string
+	}{
+		{
+			name: "child succeeds",
+			status: func() v1alpha1.AgentRunStatus {
+				s := v1alpha1.AgentRunStatus{Results: []v1alpha1.AgentResult{{Name: "response", Value: "3 pods are crash looping"}}}
+				s.MarkSucceeded(v1alpha1.AgentRunReasonSucceeded, "done")
+				return s
+			}(),
+			wantOutput: "3 pods are crash looping",
+		},
+		{
+			name: "child fails",
+			status: func() v1alpha1.AgentRunStatus {
+				s := v1alpha1.AgentRunStatus{}
+				s.MarkFailed(v1alpha1.AgentRunReasonMaxIterations, "Goal not achieved within 3 iterations")
+				return s
+			}(),
+			wantErr: "MaxIterations",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			d := newDelegate()
+			input := map[string]interface{}{"goal": "Investigate namespace team-a", "config": "investigator"}
+
+			type result struct {
+				output string
+				err    error
+			}
+			done := make(chan result, 1)
+			go func() {
+				output, err := d.Execute(ctx, input)
+				done <- result{output, err}
+			}()
+
+			name := ChildName("coordinator", "uid-1", "investigator", "Investigate namespace team-a")
+			finish(t, ctx, d, name, tt.status)
+			got := <-done
+
+			if tt.wantErr != "" {
+				if got.err == nil || !strings.Contains(got.err.Error(), tt.wantErr) {
+					t.Errorf("Execute() error = %v, want %q", got.err, tt.wantErr)
+				}
+			} else if got.err != nil || !strings.Contains(got.output, tt.wantOutput) {
+				t.Errorf("Execute() = %q, %v, want output containing %q", got.output, got.err, tt.wantOutput)
+			}
+
+			child, err := d.AgentRuns.Get(ctx, "default", name)
+			if err != nil {
+				t.Fatalf("failed to get child AgentRun: %v", err)
+			}
+			if child.Labels[pod.ParentAgentRunLabelKey] != "coordinator" || child.Labels[pod.DelegationDepthLabelKey] != "1" || child.Labels[pod.ParentPodUIDLabelKey] != "pod-uid-1" {
+				t.Errorf("child labels = %v", child.Labels)
+			}
+			if len(child.OwnerReferences) != 1 || child.OwnerReferences[0].UID != "uid-1" {
+				t.Errorf("child owner references = %+v", child.OwnerReferences)
+			}
+			if child.Spec.ConfigRef.Name != "investigator" {
+				t.Errorf("child config = %q, want investigator", child.Spec.ConfigRef.Name)
+			}
+		})
+	}
+}
+
+func TestDelegate_Limits(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(*Delegate)
+		input   map[string]interface{}
+		wantErr string
+	}{
+		{
+			name:    "missing goal",
+			input:   map[string]interface{}{},
+			wantErr: "goal is required",
+		},
+		{
+			name:    "config not allowed",
+			input:   map[string]interface{}{"goal": "Investigate", "config": "admin"},
+			wantErr: "not allowed",
+		},
+		{
+			name:    "depth limit",
+			setup:   func(d *Delegate) { d.Depth = 1 },
+			input:   map[string]interface{}{"goal": "Investigate"},
+			wantErr: "depth limit",
+		},
+		{
+			name:    "children limit",
+			setup:   func(d *Delegate) { d.children = 2 },
+			input:   map[string]interface{}{"goal": "Investigate"},
+			wantErr: "limit of 2 child AgentRuns",
+		},
+		{
+			name:    "more goals than the children limit",
+			input:   map[string]interface{}{"goals": []interface{}{"Investigate team-a", "Investigate team-b", "Investigate team-c"}},
+			wantErr: "limit of 2 child AgentRuns",
+		},
+		{
+			name:    "empty goal in goals",
+			input:   map[string]interface{}{"goals": []interface{}{"Investigate team-a", ""}},
+			wantErr: "non-empty strings",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDelegate()
+			if tt.setup != nil {
+				tt.setup(d)
+			}
+
+			_, err := d.Execute(context.Background(), tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Execute() error = %v, want %q", err, tt.wantErr)
+			}
+
+			children, _ := d.AgentRuns.List(context.Background(), "default", "")
+			if len(children) != 0 {
+				t.Errorf("created %d child AgentRuns, want none", len(children))
+			}
+		})
+	}
+}
+
+func TestDelegate_Goals(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	d := newDelegate()
+	input := map[string]interface{}{"goals": []interface{}{"Investigate team-a", "Investigate team-b"}}
+
+	type result struct {
+		output string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := d.Execute(ctx, input)
+		done <- result{output, err}
+	}()
+
+	// Both children exist before either finishes
+	succeeded := v1alpha1.AgentRunStatus{Results: []v1alpha1.AgentResult{{Name: "response", Value: "team-a is healthy"}}}
+	succeeded.MarkSucceeded(v1alpha1.AgentRunReasonSucceeded, "done")
+	failed := v1alpha1.AgentRunStatus{}
+	failed.MarkFailed(v1alpha1.AgentRunReasonTimeout, "Agent timed out")
+	finish(t, ctx, d, ChildName("coordinator", "uid-1", "investigator", "Investigate team-b"), failed)
+	finish(t, ctx, d, ChildName("coordinator", "uid-1", "investigator", "Investigate team-a"), succeeded)
+	got := <-done
+
+	if got.err != nil {
+		t.Fatalf("Execute() error = %v", got.err)
+	}
+	if !strings.Contains(got.output, "team-a is healthy") || !strings.Contains(got.output, "did not succeed (Timeout)") {
+		t.Errorf("Execute() = %q, want the outcome of both children", got.output)
+	}
+	if d.children != 2 {
+		t.Errorf("children = %d, want 2", d.children)
+	}
+}
+
+func TestDelegate_DryRun(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	d := newDelegate()
+	d.DryRun = true
+	d.Execute(ctx, map[string]interface{}{"goal": "Roll out v2", "config": "deployer"})
+
+	child, err := d.AgentRuns.Get(context.Background(), "default", ChildName("coordinator", "uid-1", "deployer", "Roll out v2"))
+	if err != nil {
+		t.Fatalf("failed to get child AgentRun: %v", err)
+	}
+	if child.Spec.DryRun == nil || !*child.Spec.DryRun {
+		t.Errorf("child DryRun = %v, want true", child.Spec.DryRun)
+	}
+}
@@ -19,6 +19,11 @@ func (g *GetLogs) Name() string {
 	return "k8s_get_logs"
 }
 
+// Parallel returns true since the tool only reads, so its calls can run concurrently
+func (g *GetLogs) Parallel() bool {
+	return true
+}
+
 // Execute runs the tool
 func (g *GetLogs) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
 	// Parse input
@@ -19,6 +19,11 @@ func (g *GetResources) Name() string {
 	return "k8s_get_resources"
 }
 
+// Parallel returns true since the tool only reads, so its calls can run concurrently
+func (g *GetResources) Parallel() bool {
+	return true
+}
+
 // Execute runs the tool
 func (g *GetResources) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
 	// Parse input
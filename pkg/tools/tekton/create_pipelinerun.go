@@ -2,22 +2,43 @@ package tekton
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 
 	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
 	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"github.com/waveywaves/agentrun-controller/pkg/agent"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	// AgentRunLabelKey is the label set on PipelineRuns created on behalf of an AgentRun
+	AgentRunLabelKey = "agent.tekton.dev/agentrun"
+
+	// AgentRunUIDLabelKey holds the UID of the AgentRun a PipelineRun was created for
+	AgentRunUIDLabelKey = "agent.tekton.dev/agentrun-uid"
+
+	// ToolCallIDLabelKey holds the ID of the tool call that created a PipelineRun
+	ToolCallIDLabelKey = "agent.tekton.dev/tool-call-id"
+)
+
 // CreatePipelineRun implements the tekton_create_pipelinerun tool
 type CreatePipelineRun struct {
 	KubeClient   kubernetes.Interface
 	TektonClient tektonclient.Interface
 	AgentRunName string
 	AgentRunUID  types.UID
+
+	// DryRun creates PipelineRuns with server-side dry run and returns the would-be object
+	DryRun bool
 }
 
 // Name returns the tool name
@@ -25,6 +46,11 @@ func (c *CreatePipelineRun) Name() string {
 	return "tekton_create_pipelinerun"
 }
 
+// Mutating returns true since the tool creates PipelineRuns
+func (c *CreatePipelineRun) Mutating() bool {
+	return true
+}
+
 // Execute runs the tool
 func (c *CreatePipelineRun) Execute(ctx context.Context, input map[string]interface{}) (string, error) {
 	// Parse input
@@ -56,8 +82,15 @@ func (c *CreatePipelineRun) Execute(ctx context.Context, input map[string]interf
 		},
 	}
 
-	// Add owner reference if AgentRun info is provided
+	// Add owner reference and labels if AgentRun info is provided
 	if c.AgentRunName != "" && c.AgentRunUID != "" {
+		pr.Labels = map[string]string{
+			AgentRunLabelKey:    c.AgentRunName,
+			AgentRunUIDLabelKey: string(c.AgentRunUID),
+		}
+		if id := agent.ToolCallID(ctx); id != "" {
+			pr.Labels[ToolCallIDLabelKey] = labelValue(id)
+		}
 		pr.OwnerReferences = []metav1.OwnerReference{
 			{
 				APIVersion: "agent.tekton.dev/v1alpha1",
@@ -139,11 +172,101 @@ func (c *CreatePipelineRun) Execute(ctx context.Context, input map[string]interf
 		}
 	}
 
+	// An earlier attempt of the call may have created the PipelineRun under another name
+	existing, err := c.findCreated(ctx, pr)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		return c.adopted(existing, pr), nil
+	}
+
 	// Create PipelineRun
-	created, err := c.TektonClient.TektonV1().PipelineRuns(namespace).Create(ctx, pr, metav1.CreateOptions{})
+	opts := metav1.CreateOptions{}
+	if c.DryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	created, err := c.TektonClient.TektonV1().PipelineRuns(namespace).Create(ctx, pr, opts)
+	if errors.IsAlreadyExists(err) {
+		return c.adopt(ctx, pr)
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to create PipelineRun: %w", err)
 	}
 
+	if c.DryRun {
+		return dryRunOutput(created)
+	}
+
 	return fmt.Sprintf("PipelineRun %s/%s created successfully", created.Namespace, created.Name), nil
 }
+
+// adopt returns the existing PipelineRun with the name of pr if this AgentRun created
+// it, e.g. in an attempt of the call that timed out or before the agent restarted.
+// A PipelineRun created by anyone else is not taken over.
+func (c *CreatePipelineRun) adopt(ctx context.Context, pr *tektonv1.PipelineRun) (string, error) {
+	existing, err := c.TektonClient.TektonV1().PipelineRuns(pr.Namespace).Get(ctx, pr.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get existing PipelineRun: %w", err)
+	}
+	if c.AgentRunUID == "" || existing.Labels[AgentRunUIDLabelKey] != string(c.AgentRunUID) {
+		return "", fmt.Errorf("failed to create PipelineRun: PipelineRun %s/%s already exists and was not created by this AgentRun", pr.Namespace, pr.Name)
+	}
+	return c.adopted(existing, pr), nil
+}
+
+// findCreated returns the PipelineRun this AgentRun created in the tool call of pr,
+// whatever its name, or nil if there is none
+func (c *CreatePipelineRun) findCreated(ctx context.Context, pr *tektonv1.PipelineRun) (*tektonv1.PipelineRun, error) {
+	id := pr.Labels[ToolCallIDLabelKey]
+	if c.AgentRunUID == "" || id == "" {
+		return nil, nil
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{
+		AgentRunUIDLabelKey: string(c.AgentRunUID),
+		ToolCallIDLabelKey:  id,
+	})
+	list, err := c.TektonClient.TektonV1().PipelineRuns(pr.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PipelineRuns created by this tool call: %w", err)
+	}
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+	return &list.Items[0], nil
+}
+
+// adopted describes an existing PipelineRun created by this AgentRun as the result
+// of the call that would have created pr
+func (c *CreatePipelineRun) adopted(existing, pr *tektonv1.PipelineRun) string {
+	if c.DryRun {
+		return fmt.Sprintf("DRY RUN: PipelineRun %s/%s already exists: it was created by this AgentRun and would not have been created again", existing.Namespace, existing.Name)
+	}
+	if id := existing.Labels[ToolCallIDLabelKey]; id != "" && id != pr.Labels[ToolCallIDLabelKey] {
+		return fmt.Sprintf("PipelineRun %s/%s already exists: it was created by this AgentRun in tool call %s and was not created again", existing.Namespace, existing.Name, id)
+	}
+	return fmt.Sprintf("PipelineRun %s/%s created successfully", existing.Namespace, existing.Name)
+}
+
+// labelValue returns id if it is a valid label value, otherwise a hash of it
+func labelValue(id string) string {
+	if len(validation.IsValidLabelValue(id)) == 0 {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])[:32]
+}
+
+// dryRunOutput describes the PipelineRun the API server would have created
+func dryRunOutput(pr *tektonv1.PipelineRun) (string, error) {
+	pr = pr.DeepCopy()
+	pr.ManagedFields = nil
+
+	data, err := json.MarshalIndent(pr, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal PipelineRun: %w", err)
+	}
+
+	return fmt.Sprintf("DRY RUN: PipelineRun %s/%s was validated by the API server but not created. It would have been:\n%s", pr.Namespace, pr.Name, data), nil
+}
@@ -5,8 +5,11 @@ import (
 	"strings"
 	"testing"
 
+	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"github.com/waveywaves/agentrun-controller/pkg/agent"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
 )
 
@@ -190,4 +193,174 @@ func TestCreatePipelineRun_OwnerReference(t *testing.T) {
 	if len(pr.OwnerReferences) == 0 {
 		t.Error("PipelineRun should have owner reference")
 	}
+
+	if got := pr.Labels[AgentRunLabelKey]; got != "test-agentrun" {
+		t.Errorf("PipelineRun label %s = %q, want test-agentrun", AgentRunLabelKey, got)
+	}
+}
+
+func TestCreatePipelineRun_DryRun(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	tektonClient := tektonfake.NewSimpleClientset()
+
+	tool := &CreatePipelineRun{
+		KubeClient:   kubeClient,
+		TektonClient: tektonClient,
+		DryRun:       true,
+	}
+
+	input := map[string]interface{}{
+		"namespace":    "default",
+		"name":         "test-run",
+		"pipelineName": "test-pipeline",
+	}
+
+	result, err := tool.Execute(context.Background(), input)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if !strings.HasPrefix(result, "DRY RUN:") {
+		t.Errorf("Execute() result should be marked as a dry run, got %q", result)
+	}
+	if !strings.Contains(result, `"name": "test-pipeline"`) {
+		t.Errorf("Execute() result should include the would-be PipelineRun, got %q", result)
+	}
+
+	var created bool
+	for _, action := range tektonClient.Actions() {
+		create, ok := action.(k8stesting.CreateActionImpl)
+		if !ok {
+			continue
+		}
+		created = true
+		if got := create.CreateOptions.DryRun; len(got) != 1 || got[0] != metav1.DryRunAll {
+			t.Errorf("Create DryRun = %v, want [%s]", got, metav1.DryRunAll)
+		}
+	}
+	if !created {
+		t.Error("Execute() did not call Create")
+	}
+}
+
+func TestCreatePipelineRun_Idempotent(t *testing.T) {
+	input := map[string]interface{}{
+		"namespace":    "default",
+		"name":         "test-run",
+		"pipelineName": "test-pipeline",
+	}
+
+	tests := []struct {
+		name         string
+		existingName string
+		existing     map[string]string
+		toolCallID   string
+		dryRun       bool
+		want         string
+		wantErr      string
+	}{
+		{
+			name:       "created by an earlier attempt of the call",
+			existing:   map[string]string{AgentRunUIDLabelKey: "test-uid", ToolCallIDLabelKey: "toolu_01"},
+			toolCallID: "toolu_01",
+			want:       "PipelineRun default/test-run created successfully",
+		},
+		{
+			name:         "created under another name by an earlier attempt of the call",
+			existingName: "test-run-x7k2p",
+			existing:     map[string]string{AgentRunUIDLabelKey: "test-uid", ToolCallIDLabelKey: "toolu_01"},
+			toolCallID:   "toolu_01",
+			want:         "PipelineRun default/test-run-x7k2p created successfully",
+		},
+		{
+			name:       "dry run of a call that already created its PipelineRun",
+			existing:   map[string]string{AgentRunUIDLabelKey: "test-uid", ToolCallIDLabelKey: "toolu_01"},
+			toolCallID: "toolu_01",
+			dryRun:     true,
+			want:       "DRY RUN: PipelineRun default/test-run already exists: it was created by this AgentRun and would not have been created again",
+		},
+		{
+			name:       "created by another call of the run",
+			existing:   map[string]string{AgentRunUIDLabelKey: "test-uid", ToolCallIDLabelKey: "toolu_01"},
+			toolCallID: "toolu_02",
+			want:       "PipelineRun default/test-run already exists: it was created by this AgentRun in tool call toolu_01 and was not created again",
+		},
+		{
+			name:       "created by someone else",
+			existing:   map[string]string{AgentRunUIDLabelKey: "other-uid"},
+			toolCallID: "toolu_01",
+			wantErr:    "already exists and was not created by this AgentRun",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := tt.existingName
+			if name == "" {
+				name = "test-run"
+			}
+			existing := &tektonv1.PipelineRun{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: tt.existing},
+			}
+			tektonClient := tektonfake.NewSimpleClientset(existing)
+			tool := &CreatePipelineRun{
+				KubeClient:   fake.NewSimpleClientset(),
+				TektonClient: tektonClient,
+				AgentRunName: "test-agentrun",
+				AgentRunUID:  "test-uid",
+				DryRun:       tt.dryRun,
+			}
+
+			ctx := agent.WithToolCallID(context.Background(), tt.toolCallID)
+			got, err := tool.Execute(ctx, input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Execute() = %q, %v, want %q", got, err, tt.want)
+			}
+
+			// No second PipelineRun is created
+			list, err := tektonClient.TektonV1().PipelineRuns("default").List(ctx, metav1.ListOptions{})
+			if err != nil || len(list.Items) != 1 {
+				t.Errorf("PipelineRuns = %d, %v, want only the existing one", len(list.Items), err)
+			}
+		})
+	}
+}
+
+func TestCreatePipelineRun_ToolCallLabel(t *testing.T) {
+	tektonClient := tektonfake.NewSimpleClientset()
+	tool := &CreatePipelineRun{
+		KubeClient:   fake.NewSimpleClientset(),
+		TektonClient: tektonClient,
+		AgentRunName: "test-agentrun",
+		AgentRunUID:  "test-uid",
+	}
+
+	ctx := agent.WithToolCallID(context.Background(), "toolu_01ABC")
+	input := map[string]interface{}{
+		"namespace":    "default",
+		"name":         "test-run",
+		"pipelineName": "test-pipeline",
+	}
+	if _, err := tool.Execute(ctx, input); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	pr, err := tektonClient.TektonV1().PipelineRuns("default").Get(ctx, "test-run", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get created PipelineRun: %v", err)
+	}
+	if pr.Labels[AgentRunUIDLabelKey] != "test-uid" || pr.Labels[ToolCallIDLabelKey] != "toolu_01ABC" {
+		t.Errorf("PipelineRun labels = %v, want the AgentRun UID and tool call ID", pr.Labels)
+	}
+
+	// IDs that are not valid label values are hashed
+	if got := labelValue(strings.Repeat("x", 70)); len(got) != 32 {
+		t.Errorf("labelValue() = %q, want a 32 character hash", got)
+	}
 }